@@ -48,6 +48,9 @@ import (
 func (p *PriFiLibClientInstance) Received_ALL_ALL_SHUTDOWN(msg net.ALL_ALL_SHUTDOWN) error {
 	log.Lvl2("Client " + strconv.Itoa(p.clientState.ID) + " : Received a SHUTDOWN message. ")
 
+	if p.clientState.DCNet != nil {
+		p.clientState.DCNet.StopPadPrecomputation()
+	}
 	p.stateMachine.ChangeState("SHUTDOWN")
 
 	return nil
@@ -63,11 +66,23 @@ func (p *PriFiLibClientInstance) Received_ALL_ALL_PARAMETERS(msg net.ALL_ALL_PAR
 	nTrustees := msg.IntValueOrElse("NTrustees", p.clientState.nTrustees)
 	nClients := msg.IntValueOrElse("NClients", p.clientState.nClients)
 	payloadSize := msg.IntValueOrElse("PayloadSize", p.clientState.PayloadSize)
+	windowSize := msg.IntValueOrElse("WindowSize", 1)
 	useUDP := msg.BoolValueOrElse("UseUDP", p.clientState.UseUDP)
 	dcNetType := msg.StringValueOrElse("DCNetType", "not initialized")
 	disruptionProtection := msg.BoolValueOrElse("DisruptionProtectionEnabled", false)
 	equivProtection := msg.BoolValueOrElse("EquivocationProtectionEnabled", false)
 	ForceDisruptionSinceRound3 := msg.BoolValueOrElse("ForceDisruptionSinceRound3", false)
+	dcNetParallelism := msg.IntValueOrElse("DCNetParallelism", 0)
+	dcNetPRG := msg.StringValueOrElse("DCNetPRG", dcnet.PRG_XOF)
+	dcNetPrecomputedRounds := msg.IntValueOrElse("DCNetPrecomputedRounds", 0)
+	sessionNonce := msg.BytesValueOrElse("SessionNonce", nil)
+	dcNetEpochLength := msg.IntValueOrElse("DCNetEpochLength", 0)
+	cryptoSuite := msg.StringValueOrElse("CryptoSuite", p.clientState.CryptoSuite.String())
+	slotSchedulerName := msg.StringValueOrElse("SlotScheduler", scheduler.SLOT_SCHEDULER_BITMASK)
+	signReservations := msg.BoolValueOrElse("SignedReservations", false)
+	coverReservationPolicy := msg.StringValueOrElse("CoverReservationPolicy", scheduler.COVER_POLICY_TAIL)
+	coverReservationProbability := msg.IntValueOrElse("CoverReservationProbability", 0)
+	coverReservationTail := msg.IntValueOrElse("CoverReservationTail", int(scheduler.COVER_DEFAULT_TAIL/time.Millisecond))
 	//sanity checks
 	if clientID < -1 {
 		return errors.New("ClientID cannot be negative")
@@ -82,9 +97,34 @@ func (p *PriFiLibClientInstance) Received_ALL_ALL_PARAMETERS(msg net.ALL_ALL_PAR
 		return errors.New("PayloadSize cannot be 0")
 	}
 
+	suite, err := config.FindCryptoSuite(cryptoSuite)
+	if err != nil {
+		return err
+	}
+	prg, err := dcnet.NewPRG(dcNetPRG, suite)
+	if err != nil {
+		return err
+	}
+	slotScheduler, err := scheduler.NewSlotScheduler(slotSchedulerName)
+	if err != nil {
+		return err
+	}
+	coverPolicy, err := scheduler.NewCoverPolicy(coverReservationPolicy, coverReservationProbability, time.Duration(coverReservationTail)*time.Millisecond)
+	if err != nil {
+		return err
+	}
+	var signedReservations *scheduler.SignedReservations
+	if signReservations {
+		signedReservations, err = scheduler.NewSignedReservations(suite, slotScheduler, nClients)
+		if err != nil {
+			return err
+		}
+	}
+
 	switch dcNetType {
-	case "Verifiable":
-		panic("verifiable not supported yet")
+	case "Simple", "Verifiable":
+	default:
+		return errors.New("unknown DCNetType " + dcNetType)
 	}
 
 	//set the received parameters
@@ -94,14 +134,33 @@ func (p *PriFiLibClientInstance) Received_ALL_ALL_PARAMETERS(msg net.ALL_ALL_PAR
 	p.clientState.nClients = nClients
 	p.clientState.nTrustees = nTrustees
 	p.clientState.PayloadSize = payloadSize
+	p.clientState.WindowSize = windowSize
 	p.clientState.UseUDP = useUDP
 	p.clientState.TrusteePublicKey = make([]kyber.Point, nTrustees)
-	p.clientState.sharedSecrets = make([]kyber.Point, nTrustees)
 	p.clientState.RoundNo = int32(0)
+	p.clientState.committedEpoch = -1
 	p.clientState.BufferedRoundData = make(map[int32]net.REL_CLI_DOWNSTREAM_DATA)
-	p.clientState.MessageHistory = config.CryptoSuite.XOF([]byte("init")) //any non-nil, non-empty, constant array
+	p.clientState.MessageHistory = suite.XOF([]byte("init")) //any non-nil, non-empty, constant array
 	p.clientState.DisruptionProtectionEnabled = disruptionProtection
 	p.clientState.EquivocationProtectionEnabled = equivProtection
+	p.clientState.DCNetType = dcNetType
+	p.clientState.DCNetParallelism = dcNetParallelism
+	p.clientState.DCNetPRG = prg
+	p.clientState.DCNetPrecomputedRounds = dcNetPrecomputedRounds
+	p.clientState.SessionNonce = sessionNonce
+	p.clientState.DCNetEpochLength = dcNetEpochLength
+	if suite.String() != p.clientState.CryptoSuite.String() {
+		// our key is sent to the relay after the parameters, it must be in the suite of the session
+		p.clientState.PublicKey, p.clientState.privateKey = crypto.NewKeyPair(suite)
+	}
+	p.clientState.CryptoSuite = suite
+	p.clientState.slotScheduler = slotScheduler.NewClient()
+	p.clientState.coverPolicy = coverPolicy
+	p.clientState.reshuffle = nil
+	p.clientState.signedReservations = signedReservations
+	p.clientState.pseudonymBase = nil
+	p.clientState.myReservations = make(map[int32][]byte)
+	p.clientState.reservationBlame = nil
 	p.clientState.ForceDisruptionSinceRound3 = ForceDisruptionSinceRound3
 	p.clientState.MyLastRound = -10
 	p.clientState.DisruptionWrongBitPosition = -1
@@ -147,9 +206,7 @@ func (p *PriFiLibClientInstance) Received_ALL_ALL_PARAMETERS(msg net.ALL_ALL_PAR
 	log.Lvl2("Client " + strconv.Itoa(p.clientState.ID) + " has been initialized by message. ")
 
 	// continue with handling the public keys
-	p.Received_REL_CLI_TELL_TRUSTEES_PK(msg.TrusteesPks)
-
-	return nil
+	return p.Received_REL_CLI_TELL_TRUSTEES_PK(msg.TrusteesPks, msg.TrusteesSessionPks, msg.TrusteesSessionPkSigs)
 }
 
 /*
@@ -204,6 +261,9 @@ When this function ends, it calls SendUpstreamData() which continues the communi
 func (p *PriFiLibClientInstance) ProcessDownStreamData(msg net.REL_CLI_DOWNSTREAM_DATA) error {
 	timing.StartMeasure("round-processing")
 
+	//our slot might have been reshuffled, starting from this round
+	p.switchSlotIfDue(msg.RoundID)
+
 	/*
 	 * HANDLE THE DOWNSTREAM DATA
 	 */
@@ -231,6 +291,9 @@ func (p *PriFiLibClientInstance) ProcessDownStreamData(msg net.REL_CLI_DOWNSTREA
 		}
 	}
 
+	//the length of our upstream cell in this round, as announced by the relay
+	p.clientState.DCNet.SetRoundPayloadSize(msg.RoundID, msg.UpstreamPayloadSize)
+
 	//test if we have latency test to send
 	now := time.Now()
 	if p.clientState.LatencyTest.DoLatencyTests && p.clientState.ID == 0 && now.After(p.clientState.LatencyTest.NextLatencyTest) {
@@ -259,19 +322,26 @@ func (p *PriFiLibClientInstance) ProcessDownStreamData(msg net.REL_CLI_DOWNSTREA
 		log.Lvl3("Client", p.clientState.ID, "Relay wants to open/closed schedule slots ")
 
 		//do the schedule
-		bmc := new(scheduler.BitMaskSlotScheduler_Client)
-		bmc.Client_ReceivedScheduleRequest(p.clientState.nClients)
+		//the rounds already opened by the relay keep the previous schedule
+		p.clientState.slotScheduler.Client_ReceivedScheduleRequest(p.clientState.nClients, p.clientState.RoundNo+int32(p.clientState.WindowSize))
 
 		//check if we want to transmit
 		if p.WantsToTransmit() {
-			bmc.Client_ReserveRound(p.clientState.MySlot)
-			log.Lvl3("Client ", p.clientState.ID, "Gonna reserve slot", p.clientState.MySlot, "(we are in round", msg.RoundID, ")")
+			//one cell for the data we hold, and one per message still queued
+			nCells := 1 + len(p.clientState.DataForDCNet)
+			payloadSize := p.upstreamPayloadSizeRequest()
+			p.clientState.slotScheduler.Client_ReserveRound(p.clientState.MySlot, nCells, payloadSize)
+			log.Lvl3("Client ", p.clientState.ID, "Gonna reserve slot", p.clientState.MySlot, "for", nCells, "cells of", payloadSize, "bytes (we are in round", msg.RoundID, ")")
+		}
+		contribution := p.clientState.slotScheduler.Client_GetOpenScheduleContribution()
+		if p.clientState.signedReservations != nil {
+			contribution = p.signReservation(contribution)
 		}
-		contribution := bmc.Client_GetOpenScheduleContribution()
 
 		//produce the next upstream cell
 
-		upstreamCell, _ := p.clientState.DCNet.EncodeForRound(p.clientState.RoundNo, false, contribution)
+		p.commitToEpochSeeds()
+		upstreamCell, _ := p.clientState.DCNet.EncodeForSlot(p.clientState.RoundNo, -1, contribution)
 
 		//send the data to the relay
 		toSend := &net.CLI_REL_OPENCLOSED_DATA{
@@ -282,7 +352,7 @@ func (p *PriFiLibClientInstance) ProcessDownStreamData(msg net.REL_CLI_DOWNSTREA
 
 	} else {
 		//send upstream data for next round
-		p.SendUpstreamData(msg.OwnershipID)
+		p.SendUpstreamData(msg.OwnershipID, msg.SubCellOwners)
 	}
 
 	//clean old buffered messages
@@ -296,6 +366,9 @@ func (p *PriFiLibClientInstance) ProcessDownStreamData(msg net.REL_CLI_DOWNSTREA
 	p.clientState.RoundNo++
 
 	p.clientState.timeStatistics["round-processing"].AddTime(timeMs)
+	if p.clientState.DCNetPrecomputedRounds > 0 && p.clientState.RoundNo%1000 == 0 {
+		log.Lvl2("Client", p.clientState.ID, ":", p.clientState.DCNet.PadPrecomputationStats())
+	}
 	//p.clientState.timeStatistics["round-processing"].ReportWithInfo("round-processing")
 
 	//now we will be expecting next message. Except if we already received and buffered it !
@@ -324,21 +397,11 @@ func (p *PriFiLibClientInstance) WantsToTransmit() bool {
 		return true
 	}
 
-	// if we have already ready-to-send data
-	if p.clientState.NextDataForDCNet != nil {
+	// if we have already ready-to-send data, or a jammer of our reservation to blame
+	if p.clientState.NextDataForDCNet != nil || p.clientState.reservationBlame != nil {
 		return true
 	}
 
-	// if we transmitted in the last second, keep reserving (but don't do this with pcaps)
-	if true || !p.clientState.pcapReplay.Enabled {
-		now := time.Now()
-		//if we transmitted in the last second, keep reserving slots
-		if now.Before(p.clientState.LastWantToSend.Add(1 * time.Second)) {
-			log.Lvl3("WantToSend < 5 sec,  true")
-			return true
-		}
-	}
-
 	// otherwise, poll the channel
 	select {
 	case myData := <-p.clientState.DataForDCNet:
@@ -348,28 +411,163 @@ func (p *PriFiLibClientInstance) WantsToTransmit() bool {
 		return true
 
 	default:
-		log.Lvl3("WantToSend           false")
-		return false
 	}
+
+	// with nothing to send, the cover policy might reserve a cell anyway (e.g., if we transmitted in the last second),
+	// so that the schedule does not show when we are active
+	if p.clientState.coverPolicy.WantsCover(time.Now(), p.clientState.LastWantToSend) {
+		log.Lvl3("WantToSend has no data, cover reservation, true")
+		return true
+	}
+	log.Lvl3("WantToSend           false")
+	return false
+}
+
+// upstreamPayloadSizeRequest returns the length of the cells we ask for in the schedule, 0 for the session's
+// PayloadSize. Interactive traffic (a message, latency tests) asks for cells just large enough, bulk transfers (queued
+// messages, pcaps) for full cells; the relay rounds it up to its minimal cell length
+func (p *PriFiLibClientInstance) upstreamPayloadSizeRequest() int {
+	if len(p.clientState.DataForDCNet) > 0 || p.clientState.pcapReplay.Enabled {
+		return 0
+	}
+	payloadSize := 1
+	if p.clientState.NextDataForDCNet != nil {
+		payloadSize = len(*p.clientState.NextDataForDCNet)
+	}
+	payloadSize += scheduler.CELL_HEADER_SIZE
+	if p.clientState.reservationBlame != nil && scheduler.ReservationBlameSize(p.clientState.CryptoSuite) > payloadSize {
+		payloadSize = scheduler.ReservationBlameSize(p.clientState.CryptoSuite)
+	}
+	if p.clientState.DisruptionProtectionEnabled {
+		payloadSize++
+	}
+	if p.clientState.EquivocationProtectionEnabled {
+		payloadSize += 16
+	}
+	if payloadSize >= p.clientState.PayloadSize {
+		return 0
+	}
+	return payloadSize
+}
+
+// nextUpstreamContent returns the cell (or sub-cell) we send in a cell we own, of at most actualPayloadSize bytes: our
+// data behind the header which flags it, or a cover cell if we have nothing to send
+func (p *PriFiLibClientInstance) nextUpstreamContent(actualPayloadSize int) []byte {
+	data := p.nextUpstreamData(actualPayloadSize - scheduler.CELL_HEADER_SIZE)
+	if len(data) == 0 {
+		return scheduler.NewCoverCell(actualPayloadSize)
+	}
+	return scheduler.NewDataCell(data)
+}
+
+// nextUpstreamData returns the data we send in a cell we own, of at most actualPayloadSize bytes, nil if none
+func (p *PriFiLibClientInstance) nextUpstreamData(actualPayloadSize int) []byte {
+
+	var upstreamCellContent []byte
+
+	//this data has already been polled out of the DataForDCNet chan, so send it first
+	//this is non-nil when OpenClosedSlot is true, and that it had to poll data out
+	//data which does not fit in this round waits for a larger cell
+	if p.clientState.NextDataForDCNet != nil {
+		if len(*p.clientState.NextDataForDCNet) <= actualPayloadSize {
+			upstreamCellContent = *p.clientState.NextDataForDCNet
+			p.clientState.NextDataForDCNet = nil
+		}
+	} else {
+
+		//if there are some pcap packets to replay
+		if p.clientState.pcapReplay.Enabled && p.clientState.pcapReplay.currentPacket < len(p.clientState.pcapReplay.Packets) {
+
+			if p.clientState.pcapReplay.currentPacket >= len(p.clientState.pcapReplay.Packets)-2 {
+				log.Error("Important: Client", p.clientState.ID, " sent all packets!")
+				p.clientState.pcapReplay.Enabled = false
+			} else {
+				//if it is time to send some packet
+				relativeNow := uint64(MsTimeStampNow()) - p.clientState.pcapReplay.time0
+
+				payload := make([]byte, 0)
+				payloadRealLength := 0 // payload actually only contains the headers
+				currentPacket := p.clientState.pcapReplay.Packets[p.clientState.pcapReplay.currentPacket]
+
+				//all packets >= currentPacket AND <= relativeNow should be sent
+				basePacketID := p.clientState.pcapReplay.currentPacket
+				lastPacketID := p.clientState.pcapReplay.currentPacket
+				for p.clientState.pcapReplay.currentPacket < len(p.clientState.pcapReplay.Packets)-1 &&
+					currentPacket.MsSinceBeginningOfCapture <= relativeNow &&
+					payloadRealLength+currentPacket.RealLength <= actualPayloadSize {
+
+					//log.Lvl1("Sending PCAP", p.clientState.pcapReplay.currentPacket, "because now is", relativeNow, "and it should be sent at", currentPacket.MsSinceBeginningOfCapture)
+
+					// add this packet
+					payload = append(payload, currentPacket.Header...)
+					payloadRealLength += currentPacket.RealLength
+					p.clientState.pcapReplay.currentPacket++
+					currentPacket = p.clientState.pcapReplay.Packets[p.clientState.pcapReplay.currentPacket]
+					lastPacketID = p.clientState.pcapReplay.currentPacket
+
+				}
+				totalPackets := len(p.clientState.pcapReplay.Packets)
+				log.Lvl2("Client", p.clientState.ID, "Adding pcap packets", basePacketID, "-", lastPacketID, "/", totalPackets)
+
+				upstreamCellContent = payload
+			}
+		} else {
+
+			select {
+
+			//either select data from the data we have to send, if any
+			case myData := <-p.clientState.DataForDCNet:
+				if len(myData) <= actualPayloadSize {
+					upstreamCellContent = myData
+				} else {
+					p.clientState.NextDataForDCNet = &myData
+				}
+
+			//or, if we have nothing to send, and we are doing Latency tests, embed a pre-crafted message that we will recognize later on
+			//otherwise, we send a cover cell, which the relay drops
+			default:
+				if len(p.clientState.LatencyTest.LatencyTestsToSend) > 0 {
+
+					logFn := func(timeDiff int64) {
+						p.clientState.timeStatistics["latency-msg-stayed-in-buffer"].AddTime(timeDiff)
+						p.clientState.timeStatistics["latency-msg-stayed-in-buffer"].ReportWithInfo("latency-msg-stayed-in-buffer")
+					}
+
+					bytes, outMsgs := prifilog.LatencyMessagesToBytes(p.clientState.LatencyTest.LatencyTestsToSend,
+						p.clientState.ID, p.clientState.RoundNo, actualPayloadSize, logFn)
+
+					p.clientState.LatencyTest.LatencyTestsToSend = outMsgs
+					upstreamCellContent = bytes
+				}
+			}
+		}
+
+		//content := make([]byte, len(upstreamCellContent))
+		//copy(content[:], upstreamCellContent[:])
+		//p.clientState.DataHistory[p.clientState.RoundNo] = content
+	}
+	return upstreamCellContent
 }
 
 /*
 SendUpstreamData determines if it's our round, embeds data (maybe latency-test message) in the payload if we can,
 creates the DC-net cipher and sends it to the relay.
+If the round is split in sub-cells, subCellOwners holds the owner of each sub-cell (and ownerSlotID is -1); we embed
+data in each sub-cell we own.
 */
-func (p *PriFiLibClientInstance) SendUpstreamData(ownerSlotID int) error {
+func (p *PriFiLibClientInstance) SendUpstreamData(ownerSlotID int, subCellOwners []int) error {
 
 	var upstreamCellContent []byte
 
 	//if we can send data
 	slotOwner := false
-	if ownerSlotID == p.clientState.MySlot {
+	if p.clientState.slotScheduler.Client_IsSlotOwner(p.clientState.RoundNo, ownerSlotID, p.clientState.MySlot) {
 		slotOwner = true
 		p.clientState.MyLastRound = p.clientState.RoundNo
 	}
 
-	//how much data we can send
-	actualPayloadSize := p.clientState.PayloadSize
+	//how much data we can send, the relay might announce shorter cells than PayloadSize
+	actualPayloadSize := p.clientState.DCNet.RoundPayloadSize(p.clientState.RoundNo)
 	if p.clientState.DisruptionProtectionEnabled {
 		// Making room for the b_echo_last flag
 		actualPayloadSize--
@@ -384,82 +582,33 @@ func (p *PriFiLibClientInstance) SendUpstreamData(ownerSlotID int) error {
 		}
 	}
 
-	if slotOwner {
+	//the blame of a jammer of our reservation takes our cell
+	reservationBlame := false
+	if slotOwner && p.clientState.reservationBlame != nil {
+		upstreamCellContent = p.nextReservationBlame(actualPayloadSize)
+		reservationBlame = upstreamCellContent != nil
+	}
+	if slotOwner && !reservationBlame {
+		upstreamCellContent = p.nextUpstreamContent(actualPayloadSize)
+	}
 
-		//this data has already been polled out of the DataForDCNet chan, so send it first
-		//this is non-nil when OpenClosedSlot is true, and that it had to poll data out
-		if p.clientState.NextDataForDCNet != nil {
-			upstreamCellContent = *p.clientState.NextDataForDCNet
+	//with sub-cells, the sub-cells have fixed offsets in the cell
+	if len(subCellOwners) > 1 {
+		subCellSize := actualPayloadSize / len(subCellOwners)
+		//every round we own is split, data which does not fit in a sub-cell would wait forever
+		if next := p.clientState.NextDataForDCNet; next != nil && len(*next) > subCellSize-scheduler.CELL_HEADER_SIZE {
+			log.Error("Client", p.clientState.ID, "drops", len(*next), "bytes of data, the sub-cells only fit", subCellSize-scheduler.CELL_HEADER_SIZE)
 			p.clientState.NextDataForDCNet = nil
-		} else {
-
-			//if there are some pcap packets to replay
-			if p.clientState.pcapReplay.Enabled && p.clientState.pcapReplay.currentPacket < len(p.clientState.pcapReplay.Packets) {
-
-				if p.clientState.pcapReplay.currentPacket >= len(p.clientState.pcapReplay.Packets)-2 {
-					log.Error("Important: Client", p.clientState.ID, " sent all packets!")
-					p.clientState.pcapReplay.Enabled = false
-				} else {
-					//if it is time to send some packet
-					relativeNow := uint64(MsTimeStampNow()) - p.clientState.pcapReplay.time0
-
-					payload := make([]byte, 0)
-					payloadRealLength := 0 // payload actually only contains the headers
-					currentPacket := p.clientState.pcapReplay.Packets[p.clientState.pcapReplay.currentPacket]
-
-					//all packets >= currentPacket AND <= relativeNow should be sent
-					basePacketID := p.clientState.pcapReplay.currentPacket
-					lastPacketID := p.clientState.pcapReplay.currentPacket
-					for p.clientState.pcapReplay.currentPacket < len(p.clientState.pcapReplay.Packets)-1 &&
-						currentPacket.MsSinceBeginningOfCapture <= relativeNow &&
-						payloadRealLength+currentPacket.RealLength <= actualPayloadSize {
-
-						//log.Lvl1("Sending PCAP", p.clientState.pcapReplay.currentPacket, "because now is", relativeNow, "and it should be sent at", currentPacket.MsSinceBeginningOfCapture)
-
-						// add this packet
-						payload = append(payload, currentPacket.Header...)
-						payloadRealLength += currentPacket.RealLength
-						p.clientState.pcapReplay.currentPacket++
-						currentPacket = p.clientState.pcapReplay.Packets[p.clientState.pcapReplay.currentPacket]
-						lastPacketID = p.clientState.pcapReplay.currentPacket
-
-					}
-					totalPackets := len(p.clientState.pcapReplay.Packets)
-					log.Lvl2("Client", p.clientState.ID, "Adding pcap packets", basePacketID, "-", lastPacketID, "/", totalPackets)
-
-					upstreamCellContent = payload
-				}
-			} else {
-
-				select {
-
-				//either select data from the data we have to send, if any
-				case myData := <-p.clientState.DataForDCNet:
-					upstreamCellContent = myData
-
-				//or, if we have nothing to send, and we are doing Latency tests, embed a pre-crafted message that we will recognize later on
-				default:
-					upstreamCellContent = make([]byte, actualPayloadSize)
-
-					if len(p.clientState.LatencyTest.LatencyTestsToSend) > 0 {
-
-						logFn := func(timeDiff int64) {
-							p.clientState.timeStatistics["latency-msg-stayed-in-buffer"].AddTime(timeDiff)
-							p.clientState.timeStatistics["latency-msg-stayed-in-buffer"].ReportWithInfo("latency-msg-stayed-in-buffer")
-						}
-
-						bytes, outMsgs := prifilog.LatencyMessagesToBytes(p.clientState.LatencyTest.LatencyTestsToSend,
-							p.clientState.ID, p.clientState.RoundNo, actualPayloadSize, logFn)
-
-						p.clientState.LatencyTest.LatencyTestsToSend = outMsgs
-						upstreamCellContent = bytes
-					}
-				}
+		}
+		for i, owner := range subCellOwners {
+			if !p.clientState.slotScheduler.Client_IsSlotOwner(p.clientState.RoundNo, owner, p.clientState.MySlot) {
+				continue
 			}
-
-			//content := make([]byte, len(upstreamCellContent))
-			//copy(content[:], upstreamCellContent[:])
-			//p.clientState.DataHistory[p.clientState.RoundNo] = content
+			p.clientState.MyLastRound = p.clientState.RoundNo
+			if upstreamCellContent == nil {
+				upstreamCellContent = make([]byte, actualPayloadSize)
+			}
+			copy(upstreamCellContent[i*subCellSize:(i+1)*subCellSize], p.nextUpstreamContent(subCellSize))
 		}
 	}
 
@@ -469,7 +618,7 @@ func (p *PriFiLibClientInstance) SendUpstreamData(ownerSlotID int) error {
 			blameRoundID := p.clientState.RoundNo - int32(p.clientState.nClients)*2
 
 			pred := proof.Rep("X", "x", "B")
-			suite := config.CryptoSuite
+			suite := p.clientState.CryptoSuite
 			B := suite.Point().Base()
 			sval := map[string]kyber.Scalar{"x": p.clientState.ephemeralPrivateKey}
 			pval := map[string]kyber.Point{"B": B, "X": p.clientState.EphemeralPublicKey}
@@ -504,7 +653,9 @@ func (p *PriFiLibClientInstance) SendUpstreamData(ownerSlotID int) error {
 				hash = sha256.Sum256(payload_to_hash)
 			} else {
 				// TODO: CHECK IT FITS
-				upstreamCellContent[3] = byte(p.clientState.ID)
+				if !reservationBlame {
+					upstreamCellContent[3] = byte(p.clientState.ID)
+				}
 				// Saving data for possible disruption
 				p.clientState.LastMessage = upstreamCellContent
 				// Creating hash
@@ -525,7 +676,13 @@ func (p *PriFiLibClientInstance) SendUpstreamData(ownerSlotID int) error {
 	}
 	payload := append(slice_b_echo_last, upstreamCellContent...)
 
-	upstreamCell, plainPayload := p.clientState.DCNet.EncodeForRound(p.clientState.RoundNo, slotOwner, payload)
+	p.commitToEpochSeeds()
+	var upstreamCell, plainPayload []byte
+	if p.clientState.DCNet.IsVerifiable() {
+		upstreamCell, plainPayload = p.clientState.DCNet.VerifiableEncodeForRound(p.clientState.RoundNo, ownerSlotID, payload)
+	} else {
+		upstreamCell, plainPayload = p.clientState.DCNet.EncodeForSlot(p.clientState.RoundNo, ownerSlotID, payload)
+	}
 
 	if p.clientState.EquivocationProtectionEnabled && p.clientState.DisruptionProtectionEnabled && slotOwner && p.clientState.B_echo_last != 1 {
 		// Saving data for possible disruption
@@ -573,9 +730,10 @@ Received_REL_CLI_TELL_TRUSTEES_PK handles REL_CLI_TELL_TRUSTEES_PK messages. The
 The relay sends us a pack of public key which correspond to the set of pre-agreed trustees.
 Of course, there should be check on those public keys (each client need to trust one), but for now we assume those public keys belong indeed to the trustees,
 and that clients have agreed on the set of trustees.
-Once we receive this message, we need to reply with our Public Key (Used to derive DC-net secrets), and our Ephemeral Public Key (used for the Shuffle protocol)
+The trustees' session keys come with them, signed by their public keys; the DC-net secrets are derived from the session keys.
+Once we receive this message, we need to reply with our Public Key, our Session Public Key (Used to derive DC-net secrets), and our Ephemeral Public Key (used for the Shuffle protocol)
 */
-func (p *PriFiLibClientInstance) Received_REL_CLI_TELL_TRUSTEES_PK(trusteesPks []kyber.Point) error {
+func (p *PriFiLibClientInstance) Received_REL_CLI_TELL_TRUSTEES_PK(trusteesPks, trusteesSessionPks []kyber.Point, trusteesSessionPkSigs []net.ByteArray) error {
 
 	//sanity check
 	if len(trusteesPks) < 1 {
@@ -583,26 +741,67 @@ func (p *PriFiLibClientInstance) Received_REL_CLI_TELL_TRUSTEES_PK(trusteesPks [
 		log.Error(e)
 		return errors.New(e)
 	}
+	if len(trusteesSessionPks) != len(trusteesPks) || len(trusteesSessionPkSigs) != len(trusteesPks) {
+		e := "Client " + strconv.Itoa(p.clientState.ID) + " : expected one signed session key per trustee"
+		log.Error(e)
+		return errors.New(e)
+	}
+
+	//the relay cannot substitute the session keys of the trustees, they are signed by their long-term keys
+	for i := 0; i < len(trusteesPks); i++ {
+		err := crypto.VerifySessionKey(p.clientState.CryptoSuite, trusteesPks[i], crypto.SessionKeyTrustee, i, p.clientState.SessionNonce,
+			trusteesSessionPks[i], trusteesSessionPkSigs[i].Bytes)
+		if err != nil {
+			e := "Client " + strconv.Itoa(p.clientState.ID) + " : invalid session key of trustee " + strconv.Itoa(i) + ", " + err.Error()
+			log.Error(e)
+			return errors.New(e)
+		}
+	}
+
+	//our session key is only used to derive the secrets of this session, and signed by our long-term key
+	sessionPk, sessionPriv, sessionPkSig, err := crypto.NewSessionKeyPair(p.clientState.CryptoSuite, p.clientState.privateKey,
+		crypto.SessionKeyClient, p.clientState.ID, p.clientState.SessionNonce)
+	if err != nil {
+		e := "Client " + strconv.Itoa(p.clientState.ID) + " : could not create our session key, " + err.Error()
+		log.Error(e)
+		return errors.New(e)
+	}
 
 	p.clientState.TrusteePublicKey = make([]kyber.Point, p.clientState.nTrustees)
-	p.clientState.sharedSecrets = make([]kyber.Point, p.clientState.nTrustees)
+	sharedSecrets := make([]kyber.Point, p.clientState.nTrustees)
 
 	for i := 0; i < len(trusteesPks); i++ {
 		p.clientState.TrusteePublicKey[i] = trusteesPks[i]
-		p.clientState.sharedSecrets[i] = config.CryptoSuite.Point().Mul(p.clientState.privateKey, trusteesPks[i])
+		sharedSecrets[i] = p.clientState.CryptoSuite.Point().Mul(sessionPriv, trusteesSessionPks[i])
 	}
 
+	if p.clientState.DCNet != nil {
+		p.clientState.DCNet.StopPadPrecomputation()
+	}
 	p.clientState.DCNet = dcnet.NewDCNetEntity(p.clientState.ID,
-		dcnet.DCNET_CLIENT, p.clientState.PayloadSize, p.clientState.EquivocationProtectionEnabled, p.clientState.sharedSecrets)
+		dcnet.DCNET_CLIENT, p.clientState.PayloadSize, p.clientState.EquivocationProtectionEnabled, sharedSecrets, p.clientState.CryptoSuite)
+	p.clientState.DCNet.SetParallelism(p.clientState.DCNetParallelism)
+	p.clientState.DCNet.SetPRG(p.clientState.DCNetPRG)
+	p.clientState.DCNet.SetSessionContext(dcnet.SessionContext{Nonce: p.clientState.SessionNonce, EpochLength: int32(p.clientState.DCNetEpochLength)})
+
+	//the chain keys of the first epoch are derived, the shared secrets would give back every pad of the session
+	p.clientState.DCNet.EraseSharedKeys()
+	for _, secret := range sharedSecrets {
+		secret.Null()
+	}
+	//and so would our session key
+	sessionPriv.Zero()
 
 	//then, generate our ephemeral keys (used for shuffling)
-	p.clientState.EphemeralPublicKey, p.clientState.ephemeralPrivateKey = crypto.NewKeyPair()
+	p.clientState.EphemeralPublicKey, p.clientState.ephemeralPrivateKey = crypto.NewKeyPair(p.clientState.CryptoSuite)
 
 	//send the keys to the relay
 	toSend := &net.CLI_REL_TELL_PK_AND_EPH_PK{
-		ClientID: p.clientState.ID,
-		Pk:       p.clientState.PublicKey,
-		EphPk:    p.clientState.EphemeralPublicKey,
+		ClientID:     p.clientState.ID,
+		Pk:           p.clientState.PublicKey,
+		EphPk:        p.clientState.EphemeralPublicKey,
+		SessionPk:    sessionPk,
+		SessionPkSig: sessionPkSig,
 	}
 	p.messageSender.SendToRelayWithLog(toSend, "")
 
@@ -625,6 +824,7 @@ As the client should send the first data, we do so; to keep this function simple
 func (p *PriFiLibClientInstance) Received_REL_CLI_TELL_EPH_PKS_AND_TRUSTEES_SIG(msg net.REL_CLI_TELL_EPH_PKS_AND_TRUSTEES_SIG) error {
 	//verify the signature
 	neff := new(scheduler.NeffShuffle)
+	neff.Init(p.clientState.CryptoSuite)
 	mySlot, err := neff.ClientVerifySigAndRecognizeSlot(p.clientState.ephemeralPrivateKey, p.clientState.TrusteePublicKey, msg.Base, msg.EphPks, msg.GetSignatures())
 	p.clientState.EphemeralPublicKeys = msg.EphPks
 	if err != nil {
@@ -632,6 +832,24 @@ func (p *PriFiLibClientInstance) Received_REL_CLI_TELL_EPH_PKS_AND_TRUSTEES_SIG(
 		log.Error(e)
 	}
 
+	if p.clientState.DCNetType == "Verifiable" {
+		H, err := dcnet.CombineVerifiableDCNetKeys(p.clientState.CryptoSuite, msg.GetVerifiableDCNetKeys())
+		if err != nil {
+			e := "Client " + strconv.Itoa(p.clientState.ID) + "; Can't set up the verifiable DC-net, err is " + err.Error()
+			log.Error(e)
+			return errors.New(e)
+		}
+		p.clientState.DCNet.SetVerifiableDCNet(dcnet.NewVerifiableDCNet(p.clientState.CryptoSuite, H, msg.Base, msg.EphPks, p.clientState.ephemeralPrivateKey, mySlot))
+	}
+
+	//the equivocation protection proves the ownership of our slot with our pseudonym, and we sign our reservations
+	//with it
+	p.clientState.DCNet.SetSlotPseudonyms(msg.Base, msg.EphPks, p.clientState.ephemeralPrivateKey, mySlot)
+	p.clientState.pseudonymBase = msg.Base
+
+	//prepare the pads of the next rounds in the background
+	p.clientState.DCNet.StartPadPrecomputation(p.clientState.DCNetPrecomputedRounds)
+
 	//prepare for commmunication
 	p.clientState.MySlot = mySlot
 	p.clientState.RoundNo = int32(0)
@@ -653,15 +871,8 @@ func (p *PriFiLibClientInstance) Received_REL_CLI_TELL_EPH_PKS_AND_TRUSTEES_SIG(
 	log.Lvl3("Client", p.clientState.ID, "ready to communicate.")
 
 	//produce a blank cell (we could embed data, but let's keep the code simple, one wasted message is not much)
-	slotOwner := false
-	if p.clientState.ID == 0 {
-		slotOwner = true // we need one guy that takes the responsability for this first slot
-	}
 	payloadSize := p.clientState.PayloadSize
 
-	if p.clientState.EquivocationProtectionEnabled && slotOwner {
-		payloadSize -= 16
-	}
 	data := make([]byte, payloadSize)
 	if p.clientState.DisruptionProtectionEnabled {
 		// Making space for the b_echo_last
@@ -683,7 +894,16 @@ func (p *PriFiLibClientInstance) Received_REL_CLI_TELL_EPH_PKS_AND_TRUSTEES_SIG(
 		data = append(slice_b_echo_last, data2...)
 	}
 
-	upstreamCell, plainPayload := p.clientState.DCNet.EncodeForRound(0, slotOwner, data)
+	p.commitToEpochSeeds()
+	var upstreamCell, plainPayload []byte
+	if p.clientState.DCNet.IsVerifiable() {
+		// nobody owns the first round of the verifiable DC-net, since the relay cannot know who client 0 is
+		upstreamCell, plainPayload = p.clientState.DCNet.VerifiableEncodeForRound(0, -1, nil)
+	} else {
+		// nobody owns the first round either: the relay cannot know who client 0 is, and client 0 could not prove
+		// it owns a slot with the equivocation protection
+		upstreamCell, plainPayload = p.clientState.DCNet.EncodeForSlot(0, -1, data)
+	}
 	if p.clientState.EquivocationProtectionEnabled && p.clientState.DisruptionProtectionEnabled {
 		// Saving data for possible disruption
 		p.clientState.LastMessage = plainPayload
@@ -61,6 +61,25 @@ func newTestMessageSenderWrapper(msgSender net.MessageSender) *net.MessageSender
 	return msw
 }
 
+// addTrusteesSessionKeys adds the session keys of the trustees, signed by their long-term keys, to the parameters
+// sent to the client, and returns the session private keys
+func addTrusteesSessionKeys(t *testing.T, msg *net.ALL_ALL_PARAMETERS, trusteesPrivKeys []kyber.Scalar) []kyber.Scalar {
+	nonce := msg.BytesValueOrElse("SessionNonce", nil)
+	sessionPrivKeys := make([]kyber.Scalar, len(trusteesPrivKeys))
+	msg.TrusteesSessionPks = make([]kyber.Point, len(trusteesPrivKeys))
+	msg.TrusteesSessionPkSigs = make([]net.ByteArray, len(trusteesPrivKeys))
+	for j, priv := range trusteesPrivKeys {
+		pk, sessionPriv, sig, err := crypto.NewSessionKeyPair(config.CryptoSuite, priv, crypto.SessionKeyTrustee, j, nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessionPrivKeys[j] = sessionPriv
+		msg.TrusteesSessionPks[j] = pk
+		msg.TrusteesSessionPkSigs[j] = net.ByteArray{Bytes: sig}
+	}
+	return sessionPrivKeys
+}
+
 func TestClient(t *testing.T) {
 
 	msgSender := new(TestMessageSender)
@@ -107,10 +126,11 @@ func TestClient(t *testing.T) {
 	trusteesPubKeys := make([]kyber.Point, nTrustees)
 	trusteesPrivKeys := make([]kyber.Scalar, nTrustees)
 	for i := 0; i < nTrustees; i++ {
-		trusteesPubKeys[i], trusteesPrivKeys[i] = crypto.NewKeyPair()
+		trusteesPubKeys[i], trusteesPrivKeys[i] = crypto.NewKeyPair(config.CryptoSuite)
 	}
 
 	msg.TrusteesPks = trusteesPubKeys
+	trusteesSessionPrivKeys := addTrusteesSessionKeys(t, msg, trusteesPrivKeys)
 
 	if err := client.ReceivedMessage(*msg); err != nil {
 		t.Error("Client should be able to receive this message:", err)
@@ -143,16 +163,24 @@ func TestClient(t *testing.T) {
 	if len(cs.TrusteePublicKey) != nTrustees {
 		t.Error("Len(TrusteePKs) should be equal to NTrustees")
 	}
-	if len(cs.sharedSecrets) != nTrustees {
-		t.Error("Len(SharedSecrets) should be equal to NTrustees")
-	}
 
+	// the shared secrets are not kept, but the seeds of the first epoch are derived from them; they are shared by the
+	// session keys, not by the long-term keys
+	if len(sentToRelay) == 0 {
+		t.Fatal("Client should have sent a CLI_REL_TELL_PK_AND_EPH_PK to the relay")
+	}
+	mySessionPk := sentToRelay[0].(*net.CLI_REL_TELL_PK_AND_EPH_PK).SessionPk
+	r := dcnet.NewDCNetEntity(0, dcnet.DCNET_RELAY, upCellSize, false, nil, config.CryptoSuite)
+	r.SetSessionContext(dcnet.SessionContext{Nonce: cs.SessionNonce, EpochLength: int32(cs.DCNetEpochLength)})
 	for i := 0; i < nTrustees; i++ {
 		if !cs.TrusteePublicKey[i].Equal(trusteesPubKeys[i]) {
 			t.Error("Pub key", i, "has not been stored correctly")
 		}
-		myPrivKey := cs.privateKey
-		if !cs.sharedSecrets[i].Equal(config.CryptoSuite.Point().Mul(myPrivKey, trusteesPubKeys[i])) {
+		_, seed, err := cs.DCNet.EpochSeed(i, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(r.EpochRoundPad(seed, 0), r.RoundPad(config.CryptoSuite.Point().Mul(trusteesSessionPrivKeys[i], mySessionPk), clientID, i, 0)) {
 			t.Error("Shared secret", i, "has not been computed correctly")
 		}
 	}
@@ -182,15 +210,18 @@ func TestClient(t *testing.T) {
 	if !msg3.Pk.Equal(cs.PublicKey) {
 		t.Error("Client did not send his ephemeral public key")
 	}
+	if err := crypto.VerifySessionKey(config.CryptoSuite, cs.PublicKey, crypto.SessionKeyClient, clientID, cs.SessionNonce, msg3.SessionPk, msg3.SessionPkSig); err != nil {
+		t.Error("Client did not sign its session key,", err)
+	}
 
 	//neff shuffle
 	n := new(scheduler.NeffShuffle)
-	n.Init()
+	n.Init(config.CryptoSuite)
 	n.RelayView.Init(nTrustees)
 	trustees := make([]*scheduler.NeffShuffle, nTrustees)
 	for i := 0; i < nTrustees; i++ {
 		trustees[i] = new(scheduler.NeffShuffle)
-		trustees[i].Init()
+		trustees[i].Init(config.CryptoSuite)
 		trustees[i].TrusteeView.Init(i, trusteesPrivKeys[i], trusteesPubKeys[i])
 	}
 	n.RelayView.AddClient(cs.EphemeralPublicKey)
@@ -207,7 +238,7 @@ func TestClient(t *testing.T) {
 	toSend3, _ := n.RelayView.SendTranscript()
 	parsed3 := toSend3.(*net.REL_TRU_TELL_TRANSCRIPT)
 	for j := 0; j < nTrustees; j++ {
-		toSend4, _ := trustees[j].TrusteeView.ReceivedTranscriptFromRelay(parsed3.Bases, parsed3.GetKeys(), parsed3.GetProofs())
+		toSend4, _ := trustees[j].TrusteeView.ReceivedTranscriptFromRelay(parsed3.InitialEphPks, parsed3.Bases, parsed3.GetKeys(), parsed3.GetProofs())
 		parsed4 := toSend4.(*net.TRU_REL_SHUFFLE_SIG)
 		n.RelayView.ReceivedSignatureFromTrustee(parsed4.TrusteeID, parsed4.Sig)
 	}
@@ -227,11 +258,14 @@ func TestClient(t *testing.T) {
 		t.Error("should have instanciated BufferedRoundData")
 	}
 
-	//Should send a CLI_REL_UPSTREAM_DATA
-	if len(sentToRelay) == 0 {
-		t.Error("Client should have sent a CLI_REL_UPSTREAM_DATA to the relay")
+	//Should send a CLI_REL_UPSTREAM_DATA, after committing to the seeds of the first epoch
+	if len(sentToRelay) != 2 {
+		t.Fatal("Client should have sent a CLI_REL_SEED_COMMITMENTS and a CLI_REL_UPSTREAM_DATA to the relay")
+	}
+	if commitments := sentToRelay[0].(*net.CLI_REL_SEED_COMMITMENTS); commitments.Epoch != 0 || len(commitments.Commitments) != nTrustees {
+		t.Error("Client should commit to a seed per trustee in epoch 0")
 	}
-	msg6 := sentToRelay[0].(*net.CLI_REL_UPSTREAM_DATA)
+	msg6 := sentToRelay[1].(*net.CLI_REL_UPSTREAM_DATA)
 
 	sentToRelay = make([]interface{}, 0)
 	if msg6.ClientID != clientID {
@@ -240,7 +274,7 @@ func TestClient(t *testing.T) {
 	if msg6.RoundID != int32(0) {
 		t.Error("Client sent a wrong RoundID")
 	}
-	if len(msg6.Data) != upCellSize+8 {
+	if len(msg6.Data) != upCellSize+12 {
 		t.Error("Client sent a payload with a wrong size")
 	}
 	if cs.RoundNo != int32(1) {
@@ -279,7 +313,7 @@ func TestClient(t *testing.T) {
 	if msg8.RoundID != int32(1) {
 		t.Error("Client sent a wrong RoundID")
 	}
-	if len(msg8.Data) != upCellSize+8 {
+	if len(msg8.Data) != upCellSize+12 {
 		t.Error("Client sent a payload with a wrong size")
 	}
 	if cs.RoundNo != int32(2) {
@@ -357,7 +391,7 @@ func TestClient(t *testing.T) {
 	if msg10.RoundID != int32(4) {
 		t.Error("Client sent a wrong RoundID")
 	}
-	if len(msg10.Data) != upCellSize+8 {
+	if len(msg10.Data) != upCellSize+12 {
 		t.Error("Client sent a payload with a wrong size")
 	}
 	if cs.RoundNo != int32(5) { //we did round 3 already
@@ -400,7 +434,7 @@ func TestClient(t *testing.T) {
 	if latencyMsg.RoundID != int32(5) {
 		t.Error("Client sent a wrong RoundID")
 	}
-	if len(latencyMsg.Data) != upCellSize+8 {
+	if len(latencyMsg.Data) != upCellSize+12 {
 		t.Error("Client sent a payload with a wrong size")
 	}
 
@@ -467,10 +501,11 @@ func TestClient2(t *testing.T) {
 	trusteesPubKeys := make([]kyber.Point, nTrustees)
 	trusteesPrivKeys := make([]kyber.Scalar, nTrustees)
 	for i := 0; i < nTrustees; i++ {
-		trusteesPubKeys[i], trusteesPrivKeys[i] = crypto.NewKeyPair()
+		trusteesPubKeys[i], trusteesPrivKeys[i] = crypto.NewKeyPair(config.CryptoSuite)
 	}
 
 	msg.TrusteesPks = trusteesPubKeys
+	addTrusteesSessionKeys(t, msg, trusteesPrivKeys)
 
 	if err := client.ReceivedMessage(*msg); err != nil {
 		t.Error("Client should be able to receive this message:", err)
@@ -485,12 +520,12 @@ func TestClient2(t *testing.T) {
 
 	//neff shuffle
 	n := new(scheduler.NeffShuffle)
-	n.Init()
+	n.Init(config.CryptoSuite)
 	n.RelayView.Init(nTrustees)
 	trustees := make([]*scheduler.NeffShuffle, nTrustees)
 	for i := 0; i < nTrustees; i++ {
 		trustees[i] = new(scheduler.NeffShuffle)
-		trustees[i].Init()
+		trustees[i].Init(config.CryptoSuite)
 		trustees[i].TrusteeView.Init(i, trusteesPrivKeys[i], trusteesPubKeys[i])
 	}
 	n.RelayView.AddClient(cs.EphemeralPublicKey)
@@ -507,7 +542,7 @@ func TestClient2(t *testing.T) {
 	toSend3, _ := n.RelayView.SendTranscript()
 	parsed3 := toSend3.(*net.REL_TRU_TELL_TRANSCRIPT)
 	for j := 0; j < nTrustees; j++ {
-		toSend4, _ := trustees[j].TrusteeView.ReceivedTranscriptFromRelay(parsed3.Bases, parsed3.GetKeys(), parsed3.GetProofs())
+		toSend4, _ := trustees[j].TrusteeView.ReceivedTranscriptFromRelay(parsed3.InitialEphPks, parsed3.Bases, parsed3.GetKeys(), parsed3.GetProofs())
 		parsed4 := toSend4.(*net.TRU_REL_SHUFFLE_SIG)
 		n.RelayView.ReceivedSignatureFromTrustee(parsed4.TrusteeID, parsed4.Sig)
 	}
@@ -520,11 +555,14 @@ func TestClient2(t *testing.T) {
 		t.Error("Should be able to receive this message,", err4)
 	}
 
-	//Should send a CLI_REL_UPSTREAM_DATA
-	if len(sentToRelay) == 0 {
-		t.Error("Client should have sent a CLI_REL_UPSTREAM_DATA to the relay")
+	//Should send a CLI_REL_UPSTREAM_DATA, after committing to the seeds of the first epoch
+	if len(sentToRelay) != 2 {
+		t.Fatal("Client should have sent a CLI_REL_SEED_COMMITMENTS and a CLI_REL_UPSTREAM_DATA to the relay")
+	}
+	if commitments := sentToRelay[0].(*net.CLI_REL_SEED_COMMITMENTS); commitments.Epoch != 0 || len(commitments.Commitments) != nTrustees {
+		t.Error("Client should commit to a seed per trustee in epoch 0")
 	}
-	msg6 := sentToRelay[0].(*net.CLI_REL_UPSTREAM_DATA)
+	msg6 := sentToRelay[1].(*net.CLI_REL_UPSTREAM_DATA)
 	sentToRelay = make([]interface{}, 0)
 	if msg6.ClientID != clientID {
 		t.Error("Client sent a wrong ID")
@@ -532,7 +570,7 @@ func TestClient2(t *testing.T) {
 	if msg6.RoundID != int32(0) {
 		t.Error("Client sent a wrong RoundID")
 	}
-	if len(msg6.Data) != upCellSize+8 {
+	if len(msg6.Data) != upCellSize+12 {
 		t.Error("Client sent a payload with a wrong size")
 	}
 	if cs.RoundNo != int32(1) {
@@ -597,12 +635,14 @@ func TestDisruptionClient(t *testing.T) {
 	msg.Add("UseUDP", true)
 	msg.Add("DCNetType", dcNetType)
 	msg.Add("DisruptionProtectionEnabled", disruptionProtection)
+	msg.Add("DCNetEpochLength", 2)
 	trusteesPubKeys := make([]kyber.Point, nTrustees)
 	trusteesPrivKeys := make([]kyber.Scalar, nTrustees)
 	for i := 0; i < nTrustees; i++ {
-		trusteesPubKeys[i], trusteesPrivKeys[i] = crypto.NewKeyPair()
+		trusteesPubKeys[i], trusteesPrivKeys[i] = crypto.NewKeyPair(config.CryptoSuite)
 	}
 	msg.TrusteesPks = trusteesPubKeys
+	trusteesSessionPrivKeys := addTrusteesSessionKeys(t, msg, trusteesPrivKeys)
 
 	if err := client.ReceivedMessage(*msg); err != nil {
 		t.Error("Client should be able to receive this message:", err)
@@ -616,17 +656,17 @@ func TestDisruptionClient(t *testing.T) {
 	if len(sentToRelay) == 0 {
 		t.Error("Client should have sent a CLI_REL_TELL_PK_AND_EPH_PK to the relay")
 	}
-	_ = sentToRelay[0].(*net.CLI_REL_TELL_PK_AND_EPH_PK)
+	mySessionPk := sentToRelay[0].(*net.CLI_REL_TELL_PK_AND_EPH_PK).SessionPk
 	sentToRelay = make([]interface{}, 0)
 
 	//neff shuffle
 	n := new(scheduler.NeffShuffle)
-	n.Init()
+	n.Init(config.CryptoSuite)
 	n.RelayView.Init(nTrustees)
 	trustees := make([]*scheduler.NeffShuffle, nTrustees)
 	for i := 0; i < nTrustees; i++ {
 		trustees[i] = new(scheduler.NeffShuffle)
-		trustees[i].Init()
+		trustees[i].Init(config.CryptoSuite)
 		trustees[i].TrusteeView.Init(i, trusteesPrivKeys[i], trusteesPubKeys[i])
 	}
 	n.RelayView.AddClient(cs.EphemeralPublicKey)
@@ -643,7 +683,7 @@ func TestDisruptionClient(t *testing.T) {
 	toSend3, _ := n.RelayView.SendTranscript()
 	parsed3 := toSend3.(*net.REL_TRU_TELL_TRANSCRIPT)
 	for j := 0; j < nTrustees; j++ {
-		toSend4, _ := trustees[j].TrusteeView.ReceivedTranscriptFromRelay(parsed3.Bases, parsed3.GetKeys(), parsed3.GetProofs())
+		toSend4, _ := trustees[j].TrusteeView.ReceivedTranscriptFromRelay(parsed3.InitialEphPks, parsed3.Bases, parsed3.GetKeys(), parsed3.GetProofs())
 		parsed4 := toSend4.(*net.TRU_REL_SHUFFLE_SIG)
 		n.RelayView.ReceivedSignatureFromTrustee(parsed4.TrusteeID, parsed4.Sig)
 	}
@@ -660,11 +700,14 @@ func TestDisruptionClient(t *testing.T) {
 		t.Error("should have a slot", cs.MySlot)
 	}
 
-	//Should send a CLI_REL_UPSTREAM_DATA
-	if len(sentToRelay) == 0 {
-		t.Error("Client should have sent a CLI_REL_UPSTREAM_DATA to the relay")
+	//Should send a CLI_REL_UPSTREAM_DATA, after committing to the seeds of the first epoch
+	if len(sentToRelay) != 2 {
+		t.Fatal("Client should have sent a CLI_REL_SEED_COMMITMENTS and a CLI_REL_UPSTREAM_DATA to the relay")
+	}
+	if commitments := sentToRelay[0].(*net.CLI_REL_SEED_COMMITMENTS); commitments.Epoch != 0 || len(commitments.Commitments) != nTrustees {
+		t.Error("Client should commit to a seed per trustee in epoch 0")
 	}
-	msg6 := sentToRelay[0].(*net.CLI_REL_UPSTREAM_DATA)
+	msg6 := sentToRelay[1].(*net.CLI_REL_UPSTREAM_DATA)
 	sentToRelay = make([]interface{}, 0)
 	if msg6.ClientID != clientID {
 		t.Error("Client sent a wrong ID")
@@ -672,7 +715,7 @@ func TestDisruptionClient(t *testing.T) {
 	if msg6.RoundID != int32(0) {
 		t.Error("Client sent a wrong RoundID")
 	}
-	if len(msg6.Data) != upCellSize+8 {
+	if len(msg6.Data) != upCellSize+12 {
 		t.Error("Client sent a payload with a wrong size")
 	}
 	if cs.RoundNo != int32(1) {
@@ -682,24 +725,22 @@ func TestDisruptionClient(t *testing.T) {
 
 	//set up the DC-nets
 
-	sharedSecrets_t1 := make([]kyber.Point, 1)
-	sharedSecrets_t1[0] = cs.sharedSecrets[0]
-	sharedSecrets_t2 := make([]kyber.Point, 1)
-	sharedSecrets_t2[0] = cs.sharedSecrets[1]
-
-	t1 := dcnet.NewDCNetEntity(1, dcnet.DCNET_TRUSTEE, upCellSize, true, sharedSecrets_t1)
-	t2 := dcnet.NewDCNetEntity(2, dcnet.DCNET_TRUSTEE, upCellSize, true, sharedSecrets_t2)
+	// the relay derives the pads shared by the client and each trustee in this session, the keys change every 2 rounds
+	r := dcnet.NewDCNetEntity(0, dcnet.DCNET_RELAY, upCellSize, false, nil, config.CryptoSuite)
+	r.SetSessionContext(dcnet.SessionContext{Nonce: cs.SessionNonce, EpochLength: 2})
 
-	x := t1.TrusteeEncodeForRound(0)
-
-	pad1 := dcnet.DCNetCipherFromBytes(x)
-	pad2 := dcnet.DCNetCipherFromBytes(t2.TrusteeEncodeForRound(0))
+	sharedSecrets := make([]kyber.Point, nTrustees)
+	for i := range sharedSecrets {
+		sharedSecrets[i] = config.CryptoSuite.Point().Mul(trusteesSessionPrivKeys[i], mySessionPk)
+	}
+	pad1 := r.RoundPad(sharedSecrets[0], clientID, 0, 0)
+	pad2 := r.RoundPad(sharedSecrets[1], clientID, 1, 0)
 	clientPad := dcnet.DCNetCipherFromBytes(msg6.Data)
 
 	dcNetDecoded := make([]byte, upCellSize)
 	i = 0
 	for i < len(dcNetDecoded) {
-		dcNetDecoded[i] = pad1.Payload[i] ^ pad2.Payload[i] ^ clientPad.Payload[i]
+		dcNetDecoded[i] = pad1[i] ^ pad2[i] ^ clientPad.Payload[i]
 		i++
 	}
 	b_echo_last := dcNetDecoded[0]
@@ -727,14 +768,14 @@ func TestDisruptionClient(t *testing.T) {
 	sentToRelay = make([]interface{}, 0)
 
 	//dcnet.old decode
-	pad1 = dcnet.DCNetCipherFromBytes(t1.TrusteeEncodeForRound(1))
-	pad2 = dcnet.DCNetCipherFromBytes(t2.TrusteeEncodeForRound(1))
+	pad1 = r.RoundPad(sharedSecrets[0], clientID, 0, 1)
+	pad2 = r.RoundPad(sharedSecrets[1], clientID, 1, 1)
 	clientPad = dcnet.DCNetCipherFromBytes(msg8.Data)
 
 	dcNetDecoded = make([]byte, upCellSize)
 	i = 0
 	for i < len(dcNetDecoded) {
-		dcNetDecoded[i] = pad1.Payload[i] ^ pad2.Payload[i] ^ clientPad.Payload[i]
+		dcNetDecoded[i] = pad1[i] ^ pad2[i] ^ clientPad.Payload[i]
 		i++
 	}
 
@@ -757,17 +798,22 @@ func TestDisruptionClient(t *testing.T) {
 	if err != nil {
 		t.Error("Client should be able to receive this data")
 	}
-	msg10 := sentToRelay[0].(*net.CLI_REL_UPSTREAM_DATA)
+	// round 2 is the first of epoch 1, the client commits to its seeds first
+	epoch1 := sentToRelay[0].(*net.CLI_REL_SEED_COMMITMENTS)
+	if epoch1.Epoch != 1 {
+		t.Error("Client should commit to the seeds of epoch 1, not", epoch1.Epoch)
+	}
+	msg10 := sentToRelay[1].(*net.CLI_REL_UPSTREAM_DATA)
 	sentToRelay = make([]interface{}, 0)
 
 	//dcnet decode
-	pad1 = dcnet.DCNetCipherFromBytes(t1.TrusteeEncodeForRound(2))
-	pad2 = dcnet.DCNetCipherFromBytes(t2.TrusteeEncodeForRound(2))
+	pad1 = r.RoundPad(sharedSecrets[0], clientID, 0, 2)
+	pad2 = r.RoundPad(sharedSecrets[1], clientID, 1, 2)
 	clientPad = dcnet.DCNetCipherFromBytes(msg10.Data)
 	dcNetDecoded = make([]byte, upCellSize)
 	i = 0
 	for i < len(dcNetDecoded) {
-		dcNetDecoded[i] = pad1.Payload[i] ^ pad2.Payload[i] ^ clientPad.Payload[i]
+		dcNetDecoded[i] = pad1[i] ^ pad2[i] ^ clientPad.Payload[i]
 		i++
 	}
 
@@ -776,5 +822,143 @@ func TestDisruptionClient(t *testing.T) {
 		t.Error("The b_echo_last flag should be 1, now its:", b_echo_last)
 	}
 
+	// the relay asks for the seed shared with trustee 1 in the epoch of round 2 only, it gives the pad of that round
+	msg11 := net.REL_ALL_REVEAL_SHARED_SECRETS{
+		EntityID: 1,
+		RoundID:  2,
+	}
+	if err := client.ReceivedMessage(msg11); err != nil {
+		t.Error("Client should be able to receive this message:", err)
+	}
+	msg12 := sentToRelay[0].(*net.CLI_REL_EPOCH_SEED)
+	sentToRelay = make([]interface{}, 0)
+	if msg12.ClientID != clientID || msg12.TrusteeID != 1 || msg12.Epoch != 1 {
+		t.Error("Client sent the seed of a wrong epoch or trustee")
+	}
+	if !bytes.Equal(r.EpochRoundPad(msg12.Seed, 2), pad2) {
+		t.Error("The seed of the epoch should give the pad of round 2")
+	}
+	if !bytes.Equal(dcnet.SeedCommitment(msg12.Seed, 1, clientID, 1), epoch1.Commitments[1]) {
+		t.Error("The seed should match the commitment of the client")
+	}
+
 	t.SkipNow() //we started a goroutine, let's kill everything, we're good
 }
+
+func TestClientCoverReservations(t *testing.T) {
+
+	msw := newTestMessageSenderWrapper(new(TestMessageSender))
+	dataForDCNet := make(chan []byte, 6)
+	client := NewClient(false, false, dataForDCNet, make(chan []byte, 3), false, "./", msw)
+
+	msg := new(net.ALL_ALL_PARAMETERS)
+	msg.ForceParams = true
+	msg.Add("NClients", 2)
+	msg.Add("NTrustees", 1)
+	msg.Add("PayloadSize", 100)
+	msg.Add("NextFreeClientID", 0)
+	msg.Add("DCNetType", "Simple")
+	msg.Add("CoverReservationPolicy", scheduler.COVER_POLICY_NONE)
+	trusteePk, trusteePriv := crypto.NewKeyPair(config.CryptoSuite)
+	msg.TrusteesPks = []kyber.Point{trusteePk}
+	addTrusteesSessionKeys(t, msg, []kyber.Scalar{trusteePriv})
+	if err := client.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Client should be able to receive this message:", err)
+	}
+
+	// without data, we only reserve if the policy says so
+	if client.WantsToTransmit() {
+		t.Error("Client has nothing to send, and no cover policy")
+	}
+	dataForDCNet <- []byte{1, 2, 3}
+	if !client.WantsToTransmit() {
+		t.Error("Client has data to send")
+	}
+	if data, isData := scheduler.CellData(client.nextUpstreamContent(100)); !isData || !bytes.Equal(data, []byte{1, 2, 3}) {
+		t.Error("Client should send its data, flagged as such")
+	}
+	if cell := client.nextUpstreamContent(100); len(cell) != 100 {
+		t.Error("Client should send a full cover cell when it has nothing to send")
+	} else if _, isData := scheduler.CellData(cell); isData {
+		t.Error("Client should not flag a cover cell as data")
+	}
+
+	msg.Add("CoverReservationPolicy", scheduler.COVER_POLICY_CONSTANT_RATE)
+	if err := client.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Client should be able to receive this message:", err)
+	}
+	if !client.WantsToTransmit() {
+		t.Error("With the ConstantRate policy, client should always reserve")
+	}
+
+	msg.Add("CoverReservationPolicy", "Always")
+	if err := client.ReceivedMessage(*msg); err == nil {
+		t.Error("Client should refuse an unknown cover policy")
+	}
+}
+
+func TestClientSessionKeys(t *testing.T) {
+
+	msw := newTestMessageSenderWrapper(new(TestMessageSender))
+	sentToRelay = make([]interface{}, 0)
+	client := NewClient(false, false, make(chan []byte, 6), make(chan []byte, 3), false, "./", msw)
+
+	msg := new(net.ALL_ALL_PARAMETERS)
+	msg.ForceParams = true
+	msg.Add("NClients", 2)
+	msg.Add("NTrustees", 2)
+	msg.Add("PayloadSize", 100)
+	msg.Add("NextFreeClientID", 1)
+	msg.Add("DCNetType", "Simple")
+	msg.Add("SessionNonce", dcnet.NewSessionNonce())
+	trusteesPubKeys := make([]kyber.Point, 2)
+	trusteesPrivKeys := make([]kyber.Scalar, 2)
+	for i := range trusteesPubKeys {
+		trusteesPubKeys[i], trusteesPrivKeys[i] = crypto.NewKeyPair(config.CryptoSuite)
+	}
+	msg.TrusteesPks = trusteesPubKeys
+
+	// the relay cannot make us share secrets with a key that the trustee did not sign
+	if err := client.ReceivedMessage(*msg); err == nil {
+		t.Error("Client should refuse trustees without session keys")
+	}
+	addTrusteesSessionKeys(t, msg, trusteesPrivKeys)
+	msg.TrusteesSessionPks[1], _ = crypto.NewKeyPair(config.CryptoSuite)
+	if err := client.ReceivedMessage(*msg); err == nil {
+		t.Error("Client should refuse a session key not signed by the trustee")
+	}
+	addTrusteesSessionKeys(t, msg, []kyber.Scalar{trusteesPrivKeys[1], trusteesPrivKeys[0]})
+	if err := client.ReceivedMessage(*msg); err == nil {
+		t.Error("Client should refuse the session key of another trustee")
+	}
+	nonce := msg.BytesValueOrElse("SessionNonce", nil)
+	msg.Add("SessionNonce", dcnet.NewSessionNonce())
+	addTrusteesSessionKeys(t, msg, trusteesPrivKeys)
+	oldPk, _, oldSig, err := crypto.NewSessionKeyPair(config.CryptoSuite, trusteesPrivKeys[0], crypto.SessionKeyTrustee, 0, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.TrusteesSessionPks[0], msg.TrusteesSessionPkSigs[0] = oldPk, net.ByteArray{Bytes: oldSig}
+	if err := client.ReceivedMessage(*msg); err == nil {
+		t.Error("Client should refuse a session key of another session")
+	}
+	if len(sentToRelay) != 0 {
+		t.Fatal("Client should not send its keys before it accepts the trustees' session keys")
+	}
+
+	addTrusteesSessionKeys(t, msg, trusteesPrivKeys)
+	if err := client.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Client should be able to receive this message:", err)
+	}
+	if len(sentToRelay) != 1 {
+		t.Fatal("Client should have sent a CLI_REL_TELL_PK_AND_EPH_PK to the relay")
+	}
+	sent := sentToRelay[0].(*net.CLI_REL_TELL_PK_AND_EPH_PK)
+	if sent.SessionPk.Equal(client.clientState.PublicKey) {
+		t.Error("Client should derive the secrets from a fresh session key")
+	}
+	if err := crypto.VerifySessionKey(config.CryptoSuite, client.clientState.PublicKey, crypto.SessionKeyClient, 1, client.clientState.SessionNonce,
+		sent.SessionPk, sent.SessionPkSig); err != nil {
+		t.Error("Client should sign its session key for this session,", err)
+	}
+}
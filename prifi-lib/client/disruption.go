@@ -2,14 +2,11 @@ package client
 
 import (
 	"bytes"
-	"fmt"
-	"github.com/dedis/prifi/prifi-lib/config"
 	"github.com/dedis/prifi/prifi-lib/net"
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/proof"
 	"gopkg.in/dedis/onet.v2/log"
 	"strconv"
-	"time"
 )
 
 /*
@@ -25,7 +22,7 @@ func (p *PriFiLibClientInstance) Received_REL_ALL_DISRUPTION_REVEAL(msg net.REL_
 	var pred_array []proof.Predicate
 	sval := make(map[string]kyber.Scalar)
 	pval := make(map[string]kyber.Point)
-	suite := config.CryptoSuite
+	suite := p.clientState.CryptoSuite
 	B := suite.Point().Base()
 	pval["B"] = B
 	for i, prg := range PRGs {
@@ -64,72 +61,6 @@ func (p *PriFiLibClientInstance) Received_REL_ALL_DISRUPTION_REVEAL(msg net.REL_
 	return nil
 }
 
-/*
-* Received_REL_ALL_REVEAL_SHARED_SECRETS handles REL_ALL_REVEAL_SHARED_SECRETS messages.
-* The method gets the shared secret and sends it to the relay.
- */
-func (p *PriFiLibClientInstance) Received_REL_ALL_REVEAL_SHARED_SECRETS(msg net.REL_ALL_REVEAL_SHARED_SECRETS) error {
-	log.Lvl1("Disruption Phase 2: Received a reveal secret message for trustee", msg.EntityID)
-	// TODO: NIZK
-	// TODO: check that the relay asks for the correct entity, and not a honest entity. There should be a signature check on the TRU_REL_DISRUPTION_REVEAL the relay received (and forwarded to the client)
-	secret := p.clientState.sharedSecrets[msg.EntityID]
-
-	// as a pseudorandom base point multiplied by our private key.
-	suite := config.CryptoSuite
-	X := make([]kyber.Point, 1)
-	X[0] = p.clientState.PublicKey
-	B := suite.Point().Base() //BACK
-	// Generate the proof predicate: an OR branch for each public key.
-	sec := map[string]kyber.Scalar{"x": p.clientState.privateKey} //BACK
-	pub := map[string]kyber.Point{"B": B, "BT": p.clientState.TrusteePublicKey[msg.EntityID], "T": p.clientState.sharedSecrets[msg.EntityID]}
-	preds := make([]proof.Predicate, len(X))
-	for i := range X {
-		name := fmt.Sprintf("X[%d]", i) // "X[0]","X[1]",...
-		pub[name] = X[i]                // public point value
-
-		// Predicate indicates knowledge of the private key for X[i]
-		// and correspondence of the key with the linkage tag
-		preds[i] = proof.And(proof.Rep(name, "x", "B"), proof.Rep("T", "x", "BT"))
-	}
-	pred := proof.Or(preds...) // make a big Or predicate
-
-	// The prover needs to know which Or branch (mine) is actually true.
-	choice := make(map[proof.Predicate]int)
-	choice[pred] = 0
-
-	// Generate the signature
-	M := "SHAREDKEY"
-	prover := pred.Prover(suite, sec, pub, choice)
-	NIZK, _ := proof.HashProve(suite, M, prover)
-
-	// Verify the signature
-	verifier := pred.Verifier(suite, pub)
-	err := proof.HashVerify(suite, M, verifier, NIZK)
-	if err != nil {
-		log.Lvl1("signature failed to verify: ", err)
-	}
-	log.Lvl1("Linkable Ring Signature verified.")
-
-	toSend := &net.CLI_REL_SHARED_SECRET{
-		ClientID:  p.clientState.ID,
-		TrusteeID: msg.EntityID,
-		Secret:    secret,
-		NIZK:      make([]byte, 0),
-		Pub:       pub,
-	}
-
-	if p.clientState.ForceDisruptionSinceRound3 && p.clientState.ID == 0 {
-		//this client is hesitant to answer as he will get caught
-		//CV->LB: How do we handle this in the relay?
-		time.Sleep(1 * time.Second)
-		// this is just to let the honest trustee answer and see what happens
-	}
-
-	p.messageSender.SendToRelayWithLog(toSend, "Sent secret to relay")
-	log.Lvl1("Reveling secret with trustee", msg.EntityID)
-	return nil
-}
-
 func (p *PriFiLibClientInstance) handlePossibleDisruption(msg net.REL_CLI_DOWNSTREAM_DATA) error {
 	if p.clientState.RoundNo-1 == p.clientState.MyLastRound {
 
@@ -201,3 +132,50 @@ func (p *PriFiLibClientInstance) handlePossibleDisruption(msg net.REL_CLI_DOWNST
 
 	return nil
 }
+
+/*
+* Received_REL_ALL_REVEAL_SHARED_SECRETS handles REL_ALL_REVEAL_SHARED_SECRETS messages.
+* The method sends to the relay the seed of the pads shared with the trustee in the key epoch of the blamed round. The
+* seed only gives the pads of that epoch, and the relay checks it against our commitment (see commitToEpochSeeds). Our
+* shared secrets are erased once the session starts, they are never revealed.
+ */
+func (p *PriFiLibClientInstance) Received_REL_ALL_REVEAL_SHARED_SECRETS(msg net.REL_ALL_REVEAL_SHARED_SECRETS) error {
+	log.Lvl1("Disruption Phase 2: Received a reveal seed message for trustee", msg.EntityID, "round", msg.RoundID)
+	epoch, seed, err := p.clientState.DCNet.EpochSeed(msg.EntityID, msg.RoundID)
+	if err != nil {
+		// we send an empty seed, the relay will blame us
+		log.Error("Disruption Phase 2: cannot reveal the seed of epoch", epoch, ":", err)
+	}
+
+	toSend := &net.CLI_REL_EPOCH_SEED{
+		ClientID:  p.clientState.ID,
+		TrusteeID: msg.EntityID,
+		Epoch:     epoch,
+		Seed:      seed,
+	}
+	p.messageSender.SendToRelayWithLog(toSend, "Sent the seed of epoch "+strconv.Itoa(int(epoch))+" to relay")
+	return nil
+}
+
+/*
+* commitToEpochSeeds sends to the relay the commitments to the seeds of the pads shared with each trustee in the key
+* epoch of the current round, if this round is our first of the epoch. The seed we may reveal in a blame must match them.
+ */
+func (p *PriFiLibClientInstance) commitToEpochSeeds() {
+	epoch := p.clientState.DCNet.EpochOfRound(p.clientState.RoundNo)
+	if epoch <= p.clientState.committedEpoch {
+		return
+	}
+	_, commitments, err := p.clientState.DCNet.EpochSeedCommitments(p.clientState.RoundNo)
+	if err != nil {
+		log.Error("Client", p.clientState.ID, ": cannot commit to the seeds of epoch", epoch, ":", err)
+		return
+	}
+	p.clientState.committedEpoch = epoch
+	toSend := &net.CLI_REL_SEED_COMMITMENTS{
+		ClientID:    p.clientState.ID,
+		Epoch:       epoch,
+		Commitments: commitments,
+	}
+	p.messageSender.SendToRelayWithLog(toSend, "(epoch "+strconv.Itoa(int(epoch))+")")
+}
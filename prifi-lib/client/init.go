@@ -12,6 +12,7 @@ package client
  * - REL_CLI_TELL_TRUSTEES_PK - the trustee's identities. We react by sending our identity + ephemeral identity
  * - REL_CLI_TELL_EPH_PKS_AND_TRUSTEES_SIG - the shuffle from the trustees. We do some check, if they pass, we can communicate. We send the first round to the relay.
  * - REL_CLI_DOWNSTREAM_DATA - the data from the relay, for one round. We react by finishing the round (sending our data to the relay)
+ * - REL_CLI_RESHUFFLE_REQUEST - the relay reshuffles the slots. We send a new ephemeral key, and get a new slot from an announced round on (see reshuffle.go)
  *
  * local functions :
  *
@@ -23,12 +24,15 @@ package client
 
 import (
 	"errors"
+	"github.com/dedis/prifi/prifi-lib/config"
 	"github.com/dedis/prifi/prifi-lib/crypto"
 	"github.com/dedis/prifi/prifi-lib/dcnet"
 	prifilog "github.com/dedis/prifi/prifi-lib/log"
 	"github.com/dedis/prifi/prifi-lib/net"
+	"github.com/dedis/prifi/prifi-lib/scheduler"
 	"github.com/dedis/prifi/prifi-lib/utils"
 	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/suites"
 	"go.dedis.ch/onet/v3/log"
 	"reflect"
 	"strings"
@@ -57,9 +61,9 @@ type ClientState struct {
 	nClients                      int
 	nTrustees                     int
 	PayloadSize                   int
+	WindowSize                    int // number of rounds the relay keeps open at once
 	privateKey                    kyber.Scalar
 	PublicKey                     kyber.Point
-	sharedSecrets                 []kyber.Point
 	TrusteePublicKey              []kyber.Point
 	UseSocksProxy                 bool
 	UseUDP                        bool
@@ -71,6 +75,21 @@ type ClientState struct {
 	LastWantToSend                time.Time
 	EquivocationProtectionEnabled bool
 	EphemeralPublicKeys           []kyber.Point
+	DCNetType                     string
+	DCNetParallelism              int
+	DCNetPRG                      dcnet.PRG
+	DCNetPrecomputedRounds        int
+	SessionNonce                  []byte       // chosen by the relay for each session, the pads are derived from it
+	DCNetEpochLength              int          // number of rounds after which the DC-net keys are ratcheted, 0 = never
+	CryptoSuite                   suites.Suite // the suite of the session, chosen by the relay
+	slotScheduler                 scheduler.SlotScheduler_Client
+	coverPolicy                   scheduler.CoverPolicy         // when we reserve a cell with nothing to send
+	reshuffle                     *reshuffle                    // the reshuffle of our slot in progress, nil if none
+	signedReservations            *scheduler.SignedReservations // nil if the reservations are not signed (see reservations.go)
+	pseudonymBase                 kyber.Point                   // the base of the pseudonyms of the slots, output of the shuffle
+	myReservations                map[int32][]byte              // our last signed reservations, by round
+	reservationBlame              *reservationBlame             // the jammed bit of our reservation to blame, nil if none
+	committedEpoch                int32                         // the last key epoch whose seeds we committed to, -1 if none
 	// TEST DISRUPTION
 	ForceDisruptionSinceRound3 bool
 	AllreadyDisrupted          bool
@@ -103,7 +122,10 @@ func NewClient(doLatencyTest bool, dataOutputEnabled bool, dataForDCNet chan []b
 	clientState := new(ClientState)
 
 	//instantiates the static stuff
-	clientState.PublicKey, clientState.privateKey = crypto.NewKeyPair()
+	clientState.CryptoSuite = config.CryptoSuite
+	clientState.PublicKey, clientState.privateKey = crypto.NewKeyPair(clientState.CryptoSuite)
+	clientState.slotScheduler = new(scheduler.BitMaskSlotScheduler).NewClient()
+	clientState.coverPolicy, _ = scheduler.NewCoverPolicy(scheduler.COVER_POLICY_TAIL, 0, scheduler.COVER_DEFAULT_TAIL)
 	//clientState.StartStopReceiveBroadcast = make(chan bool) //this should stay nil, !=nil -> we have a listener goroutine active
 	clientState.LatencyTest = &prifilog.LatencyTests{
 		DoLatencyTests:       doLatencyTest,
@@ -172,9 +194,17 @@ func (p *PriFiLibClientInstance) ReceivedMessage(msg interface{}) error {
 			err = p.Received_REL_CLI_UDP_DOWNSTREAM_DATA(typedMsg)
 		}
 	case net.REL_CLI_TELL_EPH_PKS_AND_TRUSTEES_SIG:
-		if p.stateMachine.AssertState("EPH_KEYS_SENT") {
+		if typedMsg.ShuffleEpoch > 0 {
+			if p.stateMachine.AssertState("READY") {
+				err = p.Received_REL_CLI_RESHUFFLE_RESULT(typedMsg)
+			}
+		} else if p.stateMachine.AssertState("EPH_KEYS_SENT") {
 			err = p.Received_REL_CLI_TELL_EPH_PKS_AND_TRUSTEES_SIG(typedMsg)
 		}
+	case net.REL_CLI_RESHUFFLE_REQUEST:
+		if p.stateMachine.AssertState("READY") {
+			err = p.Received_REL_CLI_RESHUFFLE_REQUEST(typedMsg)
+		}
 	case net.REL_ALL_DISRUPTION_REVEAL:
 		if p.stateMachine.AssertState("READY") {
 			err = p.Received_REL_ALL_DISRUPTION_REVEAL(typedMsg)
@@ -183,6 +213,14 @@ func (p *PriFiLibClientInstance) ReceivedMessage(msg interface{}) error {
 		if p.stateMachine.AssertState("READY") {
 			err = p.Received_REL_ALL_REVEAL_SHARED_SECRETS(typedMsg)
 		}
+	case net.REL_CLI_CORRUPTED_RESERVATIONS:
+		if p.stateMachine.AssertState("READY") {
+			err = p.Received_REL_CLI_CORRUPTED_RESERVATIONS(typedMsg)
+		}
+	case net.REL_ALL_RESERVATION_REVEAL:
+		if p.stateMachine.AssertState("READY") {
+			err = p.Received_REL_ALL_RESERVATION_REVEAL(typedMsg)
+		}
 	default:
 		err = errors.New("Unrecognized message, type" + reflect.TypeOf(msg).String())
 	}
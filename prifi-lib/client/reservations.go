@@ -0,0 +1,126 @@
+package client
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+
+	"github.com/dedis/prifi/prifi-lib/net"
+	"github.com/dedis/prifi/prifi-lib/scheduler"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// reservationBlame is the bit of our reservation set by a jammer, that we blame in the next cell we own
+type reservationBlame struct {
+	roundID int32
+	bitPos  int
+}
+
+// signReservation signs our contribution to the reservation vector of the current round with the pseudonym of our
+// slot, and keeps it to find the bits a jammer would set
+func (p *PriFiLibClientInstance) signReservation(contribution []byte) []byte {
+	if p.clientState.MySlot < 0 {
+		return contribution
+	}
+	signed, err := p.clientState.signedReservations.Sign(p.clientState.RoundNo, contribution, p.clientState.MySlot, p.clientState.pseudonymBase, p.clientState.ephemeralPrivateKey)
+	if err != nil {
+		// our slot is opened for one cell, as if our reservation was altered
+		log.Error("Client", p.clientState.ID, ": could not sign our reservation in round", p.clientState.RoundNo, ",", err)
+		return contribution
+	}
+
+	p.clientState.myReservations[p.clientState.RoundNo] = signed
+	if len(p.clientState.myReservations) > scheduler.RESERVATION_ROUNDS_KEPT {
+		rounds := make([]int, 0, len(p.clientState.myReservations))
+		for k := range p.clientState.myReservations {
+			rounds = append(rounds, int(k))
+		}
+		sort.Ints(rounds)
+		for _, k := range rounds[:len(rounds)-scheduler.RESERVATION_ROUNDS_KEPT] {
+			delete(p.clientState.myReservations, int32(k))
+		}
+	}
+	return signed
+}
+
+/*
+Received_REL_CLI_CORRUPTED_RESERVATIONS handles REL_CLI_CORRUPTED_RESERVATIONS messages, the decoded reservation vector
+of a round in which some reservations were altered. If a bit we left at 0 in our reservation was set, we blame it in
+the next cell we own.
+*/
+func (p *PriFiLibClientInstance) Received_REL_CLI_CORRUPTED_RESERVATIONS(msg net.REL_CLI_CORRUPTED_RESERVATIONS) error {
+	if p.clientState.signedReservations == nil {
+		return errors.New("Client " + strconv.Itoa(p.clientState.ID) + " : the reservations are not signed in this session")
+	}
+	mine, found := p.clientState.myReservations[msg.RoundID]
+	if !found {
+		log.Lvl2("Client", p.clientState.ID, ": some reservations were altered in round", msg.RoundID, ", but we did not sign ours")
+		return nil
+	}
+
+	bitPos := p.clientState.signedReservations.BlamableBit(mine, msg.Reservations, p.clientState.MySlot)
+	if bitPos < 0 {
+		log.Lvl2("Client", p.clientState.ID, ": some reservations were altered in round", msg.RoundID, ", none of our bits was set")
+		return nil
+	}
+	log.Error("Client", p.clientState.ID, ": our reservation was altered in round", msg.RoundID, ", blaming bit", bitPos)
+	p.clientState.reservationBlame = &reservationBlame{roundID: msg.RoundID, bitPos: bitPos}
+	return nil
+}
+
+// nextReservationBlame returns the payload blaming the jammer of our reservation, nil if we have nothing to blame or
+// if the blame does not fit in actualPayloadSize bytes
+func (p *PriFiLibClientInstance) nextReservationBlame(actualPayloadSize int) []byte {
+	b := p.clientState.reservationBlame
+	if b == nil || scheduler.ReservationBlameSize(p.clientState.CryptoSuite) > actualPayloadSize {
+		return nil
+	}
+	p.clientState.reservationBlame = nil
+
+	sig, err := p.clientState.signedReservations.SignBlame(b.roundID, b.bitPos, p.clientState.pseudonymBase, p.clientState.ephemeralPrivateKey)
+	if err != nil {
+		log.Error("Client", p.clientState.ID, ": could not sign the blame of round", b.roundID, ",", err)
+		return nil
+	}
+	log.Lvl1("Client", p.clientState.ID, ": blaming bit", b.bitPos, "of the reservations of round", b.roundID, "in round", p.clientState.RoundNo)
+	return scheduler.EncodeReservationBlame(b.roundID, b.bitPos, sig)
+}
+
+/*
+Received_REL_ALL_RESERVATION_REVEAL handles REL_ALL_RESERVATION_REVEAL messages. The owner of a slot blamed a bit of the
+reservations; if we took part in this open/closed round, we reveal the bits of our pads at this position, and consent
+to the trustees revealing theirs.
+*/
+func (p *PriFiLibClientInstance) Received_REL_ALL_RESERVATION_REVEAL(msg net.REL_ALL_RESERVATION_REVEAL) error {
+	sr := p.clientState.signedReservations
+	if sr == nil {
+		return errors.New("Client " + strconv.Itoa(p.clientState.ID) + " : the reservations are not signed in this session")
+	}
+	// a reveal in a round carrying data would tell who sent it
+	if _, found := p.clientState.myReservations[msg.RoundID]; !found {
+		return errors.New("Client " + strconv.Itoa(p.clientState.ID) + " : refusing to reveal our pads in round " + strconv.Itoa(int(msg.RoundID)) + ", not an open/closed round we took part in")
+	}
+	if err := sr.VerifyBlame(msg.RoundID, msg.BitPos, msg.Signature, p.clientState.pseudonymBase, p.clientState.EphemeralPublicKeys); err != nil {
+		return errors.New("Client " + strconv.Itoa(p.clientState.ID) + " : refusing to reveal our pads, the blame is not signed by the owner of bit " + strconv.Itoa(msg.BitPos) + ", " + err.Error())
+	}
+
+	bits, err := p.clientState.DCNet.PadBitsOfRound(msg.RoundID, msg.BitPos)
+	if err != nil {
+		return errors.New("Client " + strconv.Itoa(p.clientState.ID) + " : cannot reveal our pads, " + err.Error())
+	}
+	consent, err := scheduler.SignRevealConsent(p.clientState.CryptoSuite, msg.RoundID, msg.BitPos, p.clientState.privateKey)
+	if err != nil {
+		return err
+	}
+	log.Lvl1("Client", p.clientState.ID, ": revealing our pads at bit", msg.BitPos, "of the reservations of round", msg.RoundID)
+
+	toSend := &net.CLI_REL_RESERVATION_REVEAL{
+		ClientID: p.clientState.ID,
+		RoundID:  msg.RoundID,
+		BitPos:   msg.BitPos,
+		Bits:     bits,
+		Consent:  consent,
+	}
+	p.messageSender.SendToRelayWithLog(toSend, "(round "+strconv.Itoa(int(msg.RoundID))+")")
+	return nil
+}
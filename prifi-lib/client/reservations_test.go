@@ -0,0 +1,110 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/dedis/prifi/prifi-lib/config"
+	"github.com/dedis/prifi/prifi-lib/crypto"
+	"github.com/dedis/prifi/prifi-lib/net"
+	"github.com/dedis/prifi/prifi-lib/scheduler"
+	"go.dedis.ch/kyber/v3"
+)
+
+func TestClientSignedReservations(t *testing.T) {
+
+	msw := newTestMessageSenderWrapper(new(TestMessageSender))
+	sentToRelay = make([]interface{}, 0)
+	client := NewClient(false, false, make(chan []byte, 6), make(chan []byte, 3), false, "./", msw)
+
+	msg := new(net.ALL_ALL_PARAMETERS)
+	msg.ForceParams = true
+	msg.Add("NClients", 2)
+	msg.Add("NTrustees", 1)
+	msg.Add("PayloadSize", 200)
+	msg.Add("NextFreeClientID", 0)
+	msg.Add("DCNetType", "Simple")
+	msg.Add("SignedReservations", true)
+	trusteePk, trusteePriv := crypto.NewKeyPair(config.CryptoSuite)
+	msg.TrusteesPks = []kyber.Point{trusteePk}
+	addTrusteesSessionKeys(t, msg, []kyber.Scalar{trusteePriv})
+	if err := client.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Client should be able to receive this message:", err)
+	}
+	sr := client.clientState.signedReservations
+	if sr == nil {
+		t.Fatal("Client should sign its reservations")
+	}
+
+	// we own slot 1 of the shuffle
+	base, _ := crypto.NewKeyPair(config.CryptoSuite)
+	pseudonyms := make([]kyber.Point, 2)
+	pseudonymPrivs := make([]kyber.Scalar, 2)
+	for i := range pseudonyms {
+		pseudonymPrivs[i] = config.CryptoSuite.Scalar().Pick(config.CryptoSuite.RandomStream())
+		pseudonyms[i] = config.CryptoSuite.Point().Mul(pseudonymPrivs[i], base)
+	}
+	client.clientState.MySlot = 1
+	client.clientState.pseudonymBase = base
+	client.clientState.EphemeralPublicKeys = pseudonyms
+	client.clientState.ephemeralPrivateKey = pseudonymPrivs[1]
+	client.stateMachine.ChangeState("READY")
+	sentToRelay = make([]interface{}, 0)
+
+	// we do not reserve a cell in round 3, but a jammer opens our slot
+	client.clientState.RoundNo = 3
+	mine := client.signReservation(make([]byte, new(scheduler.BitMaskSlotScheduler).ContributionSize(2)))
+	if len(mine) != sr.Size() {
+		t.Fatal("Our reservation should be signed")
+	}
+	jammed := append([]byte(nil), mine...)
+	jammed[0] |= 2
+	if err := client.ReceivedMessage(net.REL_CLI_CORRUPTED_RESERVATIONS{RoundID: 4, Reservations: jammed}); err != nil || client.clientState.reservationBlame != nil {
+		t.Error("Client did not sign a reservation in round 4, it has nothing to blame")
+	}
+	if err := client.ReceivedMessage(net.REL_CLI_CORRUPTED_RESERVATIONS{RoundID: 3, Reservations: jammed}); err != nil {
+		t.Fatal(err)
+	}
+	if client.clientState.reservationBlame == nil || client.clientState.reservationBlame.bitPos != 1 {
+		t.Fatal("Client should blame bit 1 of round 3")
+	}
+	if !client.WantsToTransmit() {
+		t.Error("Client should reserve a cell for the blame")
+	}
+
+	// the blame takes our next cell, if it fits
+	if client.nextReservationBlame(10) != nil || client.clientState.reservationBlame == nil {
+		t.Error("The blame does not fit in 10 bytes, it should wait for the next cell")
+	}
+	roundID, bitPos, sig, ok := scheduler.DecodeReservationBlame(client.nextReservationBlame(200), crypto.SchnorrSignatureSize(config.CryptoSuite))
+	if !ok || roundID != 3 || bitPos != 1 {
+		t.Fatal("Client should blame bit 1 of round 3 in its cell")
+	}
+	if err := sr.VerifyBlame(roundID, bitPos, sig, base, pseudonyms); err != nil {
+		t.Error("The blame should be signed with the pseudonym of slot 1:", err)
+	}
+	if client.clientState.reservationBlame != nil {
+		t.Error("Client should blame only once")
+	}
+
+	// we only reveal our pads in the open/closed rounds we took part in, for a blame signed by the owner of the bit
+	if err := client.ReceivedMessage(net.REL_ALL_RESERVATION_REVEAL{RoundID: 5, BitPos: bitPos, Signature: sig}); err == nil {
+		t.Error("Client should refuse to reveal its pads in round 5")
+	}
+	otherSig, _ := sr.SignBlame(3, bitPos, base, pseudonymPrivs[0])
+	if err := client.ReceivedMessage(net.REL_ALL_RESERVATION_REVEAL{RoundID: 3, BitPos: bitPos, Signature: otherSig}); err == nil {
+		t.Error("Client should refuse a blame not signed by the owner of bit 1")
+	}
+	if len(sentToRelay) != 0 {
+		t.Fatal("Client should not reveal anything")
+	}
+	if err := client.ReceivedMessage(net.REL_ALL_RESERVATION_REVEAL{RoundID: 3, BitPos: bitPos, Signature: sig}); err != nil {
+		t.Fatal(err)
+	}
+	reveal := sentToRelay[0].(*net.CLI_REL_RESERVATION_REVEAL)
+	if reveal.RoundID != 3 || reveal.BitPos != bitPos || len(reveal.Bits) != 1 {
+		t.Error("Client should reveal the bit of its pad with the trustee")
+	}
+	if err := scheduler.VerifyRevealConsent(config.CryptoSuite, 3, bitPos, reveal.Consent, client.clientState.PublicKey); err != nil {
+		t.Error("Client should consent to the reveal with its long-term key:", err)
+	}
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/dedis/prifi/prifi-lib/crypto"
+	"github.com/dedis/prifi/prifi-lib/net"
+	"github.com/dedis/prifi/prifi-lib/scheduler"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// reshuffle holds our new ephemeral key while the relay reshuffles the slots, then our new slot
+type reshuffle struct {
+	epoch               int
+	ephemeralPrivateKey kyber.Scalar
+	ephemeralPublicKey  kyber.Point
+	slot                int           // our slot in the new shuffle, -1 until the result is received
+	ephemeralPublicKeys []kyber.Point // the pseudonyms of the new slots
+	switchRound         int32         // the first round using the new slots
+}
+
+/*
+Received_REL_CLI_RESHUFFLE_REQUEST handles REL_CLI_RESHUFFLE_REQUEST messages. The relay reshuffles the slots in the
+background; we pick a new ephemeral key, and send it to the relay to be shuffled. We keep our current slot until the
+new ones are announced.
+*/
+func (p *PriFiLibClientInstance) Received_REL_CLI_RESHUFFLE_REQUEST(msg net.REL_CLI_RESHUFFLE_REQUEST) error {
+	if p.clientState.reshuffle != nil && msg.ShuffleEpoch <= p.clientState.reshuffle.epoch {
+		return errors.New("Client " + strconv.Itoa(p.clientState.ID) + " : already sent our key for shuffle epoch " + strconv.Itoa(msg.ShuffleEpoch))
+	}
+
+	r := &reshuffle{epoch: msg.ShuffleEpoch, slot: -1}
+	r.ephemeralPublicKey, r.ephemeralPrivateKey = crypto.NewKeyPair(p.clientState.CryptoSuite)
+	p.clientState.reshuffle = r
+
+	toSend := &net.CLI_REL_RESHUFFLE_EPH_PK{
+		ClientID:     p.clientState.ID,
+		ShuffleEpoch: r.epoch,
+		EphPk:        r.ephemeralPublicKey,
+	}
+	p.messageSender.SendToRelayWithLog(toSend, "(shuffle epoch "+strconv.Itoa(r.epoch)+")")
+	return nil
+}
+
+/*
+Received_REL_CLI_RESHUFFLE_RESULT handles REL_CLI_TELL_EPH_PKS_AND_TRUSTEES_SIG messages of a reshuffle. Like in the
+setup, we check that every trustee signed the shuffle and locate our new slot; we use it from the announced round on.
+*/
+func (p *PriFiLibClientInstance) Received_REL_CLI_RESHUFFLE_RESULT(msg net.REL_CLI_TELL_EPH_PKS_AND_TRUSTEES_SIG) error {
+	r := p.clientState.reshuffle
+	if r == nil || msg.ShuffleEpoch != r.epoch || r.slot >= 0 {
+		return errors.New("Client " + strconv.Itoa(p.clientState.ID) + " : received the slots of shuffle epoch " + strconv.Itoa(msg.ShuffleEpoch) + ", but we are not waiting for them")
+	}
+
+	neff := new(scheduler.NeffShuffle)
+	neff.Init(p.clientState.CryptoSuite)
+	slot, err := neff.ClientVerifySigAndRecognizeSlot(r.ephemeralPrivateKey, p.clientState.TrusteePublicKey, msg.Base, msg.EphPks, msg.GetSignatures())
+	if err != nil {
+		// we keep our current slot, the relay will not complete the switch with the others either if the shuffle is bad
+		p.clientState.reshuffle = nil
+		e := "Client " + strconv.Itoa(p.clientState.ID) + " : can't recognize our slot in shuffle epoch " + strconv.Itoa(r.epoch) + ", err is " + err.Error()
+		log.Error(e)
+		return errors.New(e)
+	}
+	r.slot = slot
+	r.ephemeralPublicKeys = msg.EphPks
+	r.switchRound = msg.SwitchRound
+
+	if r.switchRound < p.clientState.RoundNo {
+		log.Error("Client", p.clientState.ID, ": the slots of shuffle epoch", r.epoch, "are used since round", r.switchRound, ", but we are already in round", p.clientState.RoundNo)
+		p.switchSlotIfDue(p.clientState.RoundNo)
+	}
+	return nil
+}
+
+// switchSlotIfDue starts using our slot of the reshuffle, if roundID is at or after its switch round
+func (p *PriFiLibClientInstance) switchSlotIfDue(roundID int32) {
+	r := p.clientState.reshuffle
+	if r == nil || r.slot < 0 || roundID < r.switchRound {
+		return
+	}
+	p.clientState.MySlot = r.slot
+	p.clientState.ephemeralPrivateKey = r.ephemeralPrivateKey
+	p.clientState.EphemeralPublicKey = r.ephemeralPublicKey
+	p.clientState.EphemeralPublicKeys = r.ephemeralPublicKeys
+	p.clientState.reshuffle = nil
+
+	log.Lvl2("Client", p.clientState.ID, ": using the slots of shuffle epoch", r.epoch, "from round", roundID)
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/dedis/prifi/prifi-lib/config"
+	"github.com/dedis/prifi/prifi-lib/crypto"
+	"github.com/dedis/prifi/prifi-lib/net"
+	"github.com/dedis/prifi/prifi-lib/scheduler"
+	"go.dedis.ch/kyber/v3"
+)
+
+func TestClientReshuffle(t *testing.T) {
+
+	msw := newTestMessageSenderWrapper(new(TestMessageSender))
+	sentToRelay = make([]interface{}, 0)
+	client := NewClient(false, false, make(chan []byte, 6), make(chan []byte, 3), false, "./", msw)
+
+	msg := new(net.ALL_ALL_PARAMETERS)
+	msg.ForceParams = true
+	msg.Add("NClients", 2)
+	msg.Add("NTrustees", 1)
+	msg.Add("PayloadSize", 100)
+	msg.Add("NextFreeClientID", 0)
+	msg.Add("DCNetType", "Simple")
+	trusteePk, trusteePriv := crypto.NewKeyPair(config.CryptoSuite)
+	msg.TrusteesPks = []kyber.Point{trusteePk}
+	addTrusteesSessionKeys(t, msg, []kyber.Scalar{trusteePriv})
+	if err := client.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Client should be able to receive this message:", err)
+	}
+	client.clientState.MySlot = 1
+	sentToRelay = make([]interface{}, 0)
+
+	// the relay asks for a new ephemeral key
+	if err := client.Received_REL_CLI_RESHUFFLE_REQUEST(net.REL_CLI_RESHUFFLE_REQUEST{ShuffleEpoch: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if len(sentToRelay) != 1 {
+		t.Fatal("Client should send a new ephemeral key")
+	}
+	newKey := sentToRelay[0].(*net.CLI_REL_RESHUFFLE_EPH_PK)
+	if newKey.ShuffleEpoch != 1 || newKey.EphPk.Equal(client.clientState.EphemeralPublicKey) {
+		t.Error("Client should send a fresh ephemeral key for shuffle epoch 1")
+	}
+	if err := client.Received_REL_CLI_RESHUFFLE_REQUEST(net.REL_CLI_RESHUFFLE_REQUEST{ShuffleEpoch: 1}); err == nil {
+		t.Error("Client should refuse to send a second key for shuffle epoch 1")
+	}
+
+	// the trustee shuffles our key with another client's, and signs
+	otherKey, _ := crypto.NewKeyPair(config.CryptoSuite)
+	neff := new(scheduler.NeffShuffle)
+	neff.Init(config.CryptoSuite)
+	neff.TrusteeView.Init(0, trusteePriv, trusteePk)
+	shuffled, err := neff.TrusteeView.ReceivedShuffleFromRelay(config.CryptoSuite.Point().Base(), []kyber.Point{newKey.EphPk, otherKey}, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shuffledMsg := shuffled.(*net.TRU_REL_TELL_NEW_BASE_AND_EPH_PKS)
+	signed, err := neff.TrusteeView.ReceivedTranscriptFromRelay([]kyber.Point{newKey.EphPk, otherKey}, []kyber.Point{shuffledMsg.NewBase},
+		[][]kyber.Point{shuffledMsg.NewEphPks}, [][]byte{shuffledMsg.Proof})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := net.REL_CLI_TELL_EPH_PKS_AND_TRUSTEES_SIG{
+		Base:         shuffledMsg.NewBase,
+		EphPks:       shuffledMsg.NewEphPks,
+		TrusteesSigs: []net.ByteArray{{Bytes: signed.(*net.TRU_REL_SHUFFLE_SIG).Sig}},
+		ShuffleEpoch: 1,
+		SwitchRound:  10,
+	}
+	newSlot := 0
+	if !shuffledMsg.NewEphPks[0].Equal(config.CryptoSuite.Point().Mul(neff.TrusteeView.SecretCoeff, newKey.EphPk)) {
+		newSlot = 1
+	}
+
+	forged := result
+	forged.ShuffleEpoch = 2
+	if err := client.Received_REL_CLI_RESHUFFLE_RESULT(forged); err == nil {
+		t.Error("Client should refuse the slots of another shuffle epoch")
+	}
+	if err := client.Received_REL_CLI_RESHUFFLE_RESULT(result); err != nil {
+		t.Fatal(err)
+	}
+
+	// the new slot is used from the switch round on
+	client.switchSlotIfDue(9)
+	if client.clientState.MySlot != 1 || client.clientState.reshuffle == nil {
+		t.Error("Client should keep its slot before the switch round")
+	}
+	client.switchSlotIfDue(10)
+	if client.clientState.MySlot != newSlot || client.clientState.reshuffle != nil {
+		t.Error("Client should use slot", newSlot, "from the switch round, got", client.clientState.MySlot)
+	}
+	if !client.clientState.EphemeralPublicKey.Equal(newKey.EphPk) {
+		t.Error("Client should use its new ephemeral key")
+	}
+}
@@ -7,5 +7,18 @@ import (
 	"go.dedis.ch/kyber/v3/suites"
 )
 
-// the suite used in the prifi-lib
-var CryptoSuite = suites.MustFind("Ed25519")
+// DefaultCryptoSuite is the name of the suite used when the session does not choose one
+const DefaultCryptoSuite = "Ed25519"
+
+// CryptoSuite is the default suite of the prifi-lib. Each session runs with the suite announced by the relay in
+// ALL_ALL_PARAMETERS; this one is only used until the parameters are received, and in the tests
+var CryptoSuite = suites.MustFind(DefaultCryptoSuite)
+
+// FindCryptoSuite returns the kyber suite with this name (e.g. "Ed25519", "P256"), or the default suite if the name
+// is empty
+func FindCryptoSuite(name string) (suites.Suite, error) {
+	if name == "" {
+		name = DefaultCryptoSuite
+	}
+	return suites.Find(name)
+}
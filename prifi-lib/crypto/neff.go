@@ -1,19 +1,37 @@
 package crypto
 
-import (
-	"math/rand"
+/*
+A trustee's step of the shuffle takes the base g and the keys X_1..X_n, picks a secret c and a permutation pi, and
+outputs g' = c * g and Y_i = c * X_pi(i). It proves it in two parts:
+
+- a Neff pair shuffle of the pairs (O, X_i) into (Xbar_i, Ybar_i) = (beta_i * g, X_pi(i) + beta_i * H), where H is a
+  point of unknown discrete log, i.e., Ybar is a permutation of the keys hidden by a fresh ElGamal randomness;
+- that the same c was used everywhere: g' = c * g, Y_i + T_i = c * Ybar_i, with W_i = c * Xbar_i = d_i * g and
+  T_i = d_i * H (hence d_i = c * beta_i, and T_i is the randomness to remove).
 
+The proof contains the points Xbar, Ybar, W, T (in this order, n points each), followed by the NIZK.
+*/
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
-	"github.com/dedis/prifi/prifi-lib/config"
+	"strconv"
+
 	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/proof"
+	"go.dedis.ch/kyber/v3/shuffle"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/kyber/v3/util/random"
 )
 
 // NeffShuffle implements Andrew Neff's verifiable shuffle proof scheme as described in the
 // paper "Verifiable Mixing (Shuffling) of ElGamal Pairs", April 2004.
-// The function randomly shuffles and re-randomizes a set of ElGamal pairs,
-// producing a correctness proof in the process.
-// Returns (Xbar,Ybar), the shuffled and randomized pairs.
-func NeffShuffle(publicKeys []kyber.Point, base kyber.Point, doShufflePositions bool) ([]kyber.Point, kyber.Point, kyber.Scalar, []byte, error) {
+// The function randomly shuffles the public keys and moves them to a new base, producing a correctness proof in the
+// process (see VerifyNeffShuffle).
+// Returns the shuffled keys, the new base, the secret coefficient and the proof.
+func NeffShuffle(suite suites.Suite, publicKeys []kyber.Point, base kyber.Point, doShufflePositions bool) ([]kyber.Point, kyber.Point, kyber.Scalar, []byte, error) {
 
 	if base == nil {
 		return nil, nil, nil, nil, errors.New("Cannot perform a shuffle is base is nil")
@@ -24,30 +42,222 @@ func NeffShuffle(publicKeys []kyber.Point, base kyber.Point, doShufflePositions
 	if len(publicKeys) == 0 {
 		return nil, nil, nil, nil, errors.New("Cannot perform a shuffle is len(publicKeys) is 0")
 	}
-	suite := config.CryptoSuite
+	n := len(publicKeys)
+	rand := suite.RandomStream()
+	H := neffShuffleH(suite)
 
 	//compute new shares
-	secretCoeff := suite.Scalar().Pick(suite.RandomStream())
+	secretCoeff := suite.Scalar().Pick(rand)
 	newBase := suite.Point().Mul(secretCoeff, base)
 
-	//transform the public keys with the secret coeff
-	publicKeys2 := make([]kyber.Point, len(publicKeys))
-	for i := 0; i < len(publicKeys); i++ {
-		oldKey := publicKeys[i]
-		publicKeys2[i] = suite.Point().Mul(secretCoeff, oldKey)
+	//pick the permutation, and re-encrypt the keys. With one key there is nothing to shuffle nor to hide
+	pi := make([]int, n)
+	for i := range pi {
+		pi[i] = i
 	}
-
-	//shuffle the array
 	if doShufflePositions {
-		publicKeys3 := make([]kyber.Point, len(publicKeys2))
-		perm := rand.Perm(len(publicKeys2))
-		for i, v := range perm {
-			publicKeys3[v] = publicKeys2[i]
+		for i := n - 1; i > 0; i-- {
+			j := int(binary.BigEndian.Uint64(random.Bits(64, false, rand)) % uint64(i+1))
+			pi[i], pi[j] = pi[j], pi[i]
+		}
+	}
+	beta := make([]kyber.Scalar, n)
+	for i := range beta {
+		beta[i] = suite.Scalar().Zero()
+		if n > 1 {
+			beta[i].Pick(rand)
 		}
-		publicKeys2 = publicKeys3
 	}
 
-	proof := make([]byte, 50) // TODO : the proof should be done
+	p := newNeffShuffleProof(n)
+	shuffledKeys := make([]kyber.Point, n)
+	d := make([]kyber.Scalar, n)
+	for i := 0; i < n; i++ {
+		b := beta[pi[i]]
+		d[i] = suite.Scalar().Mul(secretCoeff, b)
+		p.Xbar[i] = suite.Point().Mul(b, base)
+		p.Ybar[i] = suite.Point().Add(publicKeys[pi[i]], suite.Point().Mul(b, H))
+		p.W[i] = suite.Point().Mul(d[i], base)
+		p.T[i] = suite.Point().Mul(d[i], H)
+		shuffledKeys[i] = suite.Point().Mul(secretCoeff, publicKeys[pi[i]])
+	}
+
+	pred := neffShufflePredicate(n)
+	sval := map[string]kyber.Scalar{"c": secretCoeff}
+	for i := 0; i < n; i++ {
+		sval["d"+strconv.Itoa(i)] = d[i]
+	}
+	coeffProver := pred.Prover(suite, sval, p.publicPoints(suite, base, newBase, shuffledKeys), nil)
+	prover := func(ctx proof.ProverContext) error {
+		if n > 1 {
+			ps := new(shuffle.PairShuffle).Init(suite, n)
+			if err := ps.Prove(pi, base, H, beta, nullPoints(suite, n), publicKeys, rand, ctx); err != nil {
+				return err
+			}
+		}
+		return coeffProver(ctx)
+	}
+	nizk, err := proof.HashProve(suite, neffShuffleProtocolName(suite, publicKeys, base, shuffledKeys, newBase, p), prover)
+	if err != nil {
+		return nil, nil, nil, nil, errors.New("Could not prove the shuffle, error is " + err.Error())
+	}
+	p.NIZK = nizk
+
+	return shuffledKeys, newBase, secretCoeff, p.marshal(), nil
+}
+
+// VerifyNeffShuffle checks that shuffledKeys and newBase are a permutation of the publicKeys and the base, all
+// multiplied by the same (non-zero) secret coefficient, given the proof returned by NeffShuffle
+func VerifyNeffShuffle(suite suites.Suite, publicKeys []kyber.Point, base kyber.Point, shuffledKeys []kyber.Point, newBase kyber.Point, shuffleProof []byte) error {
 
-	return publicKeys2, newBase, secretCoeff, proof, nil
+	if base == nil || newBase == nil {
+		return errors.New("the base is nil")
+	}
+	n := len(publicKeys)
+	if n == 0 {
+		return errors.New("there are no public keys")
+	}
+	if len(shuffledKeys) != n {
+		return errors.New("there are " + strconv.Itoa(len(shuffledKeys)) + " shuffled keys for " + strconv.Itoa(n) + " public keys")
+	}
+	for i := 0; i < n; i++ {
+		if publicKeys[i] == nil || shuffledKeys[i] == nil {
+			return errors.New("key " + strconv.Itoa(i) + " is nil")
+		}
+	}
+	if newBase.Equal(suite.Point().Null()) {
+		return errors.New("the new base is the neutral element")
+	}
+	p, err := unmarshalNeffShuffleProof(suite, n, shuffleProof)
+	if err != nil {
+		return err
+	}
+
+	H := neffShuffleH(suite)
+	if n == 1 && (!p.Xbar[0].Equal(suite.Point().Null()) || !p.Ybar[0].Equal(publicKeys[0])) {
+		return errors.New("a single key must not be re-encrypted")
+	}
+	coeffVerifier := neffShufflePredicate(n).Verifier(suite, p.publicPoints(suite, base, newBase, shuffledKeys))
+	verifier := func(ctx proof.VerifierContext) error {
+		if n > 1 {
+			ps := new(shuffle.PairShuffle).Init(suite, n)
+			if err := ps.Verify(base, H, nullPoints(suite, n), publicKeys, p.Xbar, p.Ybar, ctx); err != nil {
+				return errors.New("invalid permutation: " + err.Error())
+			}
+		}
+		if err := coeffVerifier(ctx); err != nil {
+			return errors.New("invalid coefficient: " + err.Error())
+		}
+		return nil
+	}
+	return proof.HashVerify(suite, neffShuffleProtocolName(suite, publicKeys, base, shuffledKeys, newBase, p), verifier, p.NIZK)
+}
+
+// neffShuffleProof holds the intermediate points of the shuffle and the NIZK (see the top of this file)
+type neffShuffleProof struct {
+	Xbar []kyber.Point
+	Ybar []kyber.Point
+	W    []kyber.Point
+	T    []kyber.Point
+	NIZK []byte
+}
+
+func newNeffShuffleProof(n int) *neffShuffleProof {
+	return &neffShuffleProof{
+		Xbar: make([]kyber.Point, n),
+		Ybar: make([]kyber.Point, n),
+		W:    make([]kyber.Point, n),
+		T:    make([]kyber.Point, n)}
+}
+
+func (p *neffShuffleProof) points() [][]kyber.Point {
+	return [][]kyber.Point{p.Xbar, p.Ybar, p.W, p.T}
+}
+
+func (p *neffShuffleProof) marshal() []byte {
+	var out []byte
+	for _, points := range p.points() {
+		for _, point := range points {
+			b, err := point.MarshalBinary()
+			if err != nil {
+				panic("Can't marshall a point of the shuffle proof, error is " + err.Error())
+			}
+			out = append(out, b...)
+		}
+	}
+	return append(out, p.NIZK...)
+}
+
+func unmarshalNeffShuffleProof(suite suites.Suite, n int, data []byte) (*neffShuffleProof, error) {
+	pointSize := suite.PointLen()
+	if len(data) < 4*n*pointSize {
+		return nil, errors.New("shuffle proof too short")
+	}
+	p := newNeffShuffleProof(n)
+	for _, points := range p.points() {
+		for i := range points {
+			points[i] = suite.Point()
+			if err := points[i].UnmarshalBinary(data[:pointSize]); err != nil {
+				return nil, errors.New("invalid point in the shuffle proof: " + err.Error())
+			}
+			data = data[pointSize:]
+		}
+	}
+	p.NIZK = data
+	return p, nil
+}
+
+// the points of neffShufflePredicate
+func (p *neffShuffleProof) publicPoints(suite suites.Suite, base, newBase kyber.Point, shuffledKeys []kyber.Point) map[string]kyber.Point {
+	pval := map[string]kyber.Point{"G": base, "G'": newBase, "H": neffShuffleH(suite)}
+	for i := range shuffledKeys {
+		k := strconv.Itoa(i)
+		pval["Ybar"+k] = p.Ybar[i]
+		pval["Xbar"+k] = p.Xbar[i]
+		pval["W"+k] = p.W[i]
+		pval["T"+k] = p.T[i]
+		pval["YT"+k] = suite.Point().Add(shuffledKeys[i], p.T[i])
+	}
+	return pval
+}
+
+// G' = c * G, and for every i: Y_i + T_i = c * Ybar_i, W_i = c * Xbar_i, W_i = d_i * G, T_i = d_i * H
+func neffShufflePredicate(n int) proof.Predicate {
+	preds := []proof.Predicate{proof.Rep("G'", "c", "G")}
+	for i := 0; i < n; i++ {
+		k := strconv.Itoa(i)
+		preds = append(preds,
+			proof.Rep("YT"+k, "c", "Ybar"+k),
+			proof.Rep("W"+k, "c", "Xbar"+k),
+			proof.Rep("W"+k, "d"+k, "G"),
+			proof.Rep("T"+k, "d"+k, "H"))
+	}
+	return proof.And(preds...)
+}
+
+// the second base of the re-encryption, nobody knows its discrete log
+func neffShuffleH(suite suites.Suite) kyber.Point {
+	return suite.Point().Pick(suite.XOF([]byte("PriFi-NeffShuffle-H")))
+}
+
+func nullPoints(suite suites.Suite, n int) []kyber.Point {
+	points := make([]kyber.Point, n)
+	for i := range points {
+		points[i] = suite.Point().Null()
+	}
+	return points
+}
+
+// the proofs do not hash the statement, hence the protocol name binds the inputs and the outputs of the shuffle
+func neffShuffleProtocolName(suite suites.Suite, publicKeys []kyber.Point, base kyber.Point, shuffledKeys []kyber.Point, newBase kyber.Point, p *neffShuffleProof) string {
+	h := sha256.New()
+	statement := append([][]kyber.Point{{base, newBase}, publicKeys, shuffledKeys}, p.points()...)
+	for _, points := range statement {
+		for _, point := range points {
+			if _, err := point.MarshalTo(h); err != nil {
+				panic("Can't marshall a point of the shuffle, error is " + err.Error())
+			}
+		}
+	}
+	return "PriFi-NeffShuffle-" + suite.String() + "-" + hex.EncodeToString(h.Sum(nil))
 }
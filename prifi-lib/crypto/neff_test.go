@@ -18,21 +18,21 @@ func TestNeffErrors(t *testing.T) {
 	clientPks := make([]kyber.Point, nClients)
 	clientPrivKeys := make([]kyber.Scalar, nClients)
 	for i := 0; i < nClients; i++ {
-		pub, priv := NewKeyPair()
+		pub, priv := NewKeyPair(config.CryptoSuite)
 		clientPks[i] = pub
 		clientPrivKeys[i] = priv
 	}
 
 	//each of those call should fail
-	_, _, _, _, err := NeffShuffle(nil, base, true)
+	_, _, _, _, err := NeffShuffle(config.CryptoSuite, nil, base, true)
 	if err == nil {
 		t.Error("NeffShuffle without a public key array should fail")
 	}
-	_, _, _, _, err = NeffShuffle(clientPks, nil, true)
+	_, _, _, _, err = NeffShuffle(config.CryptoSuite, clientPks, nil, true)
 	if err == nil {
 		t.Error("NeffShuffle without a base should fail")
 	}
-	_, _, _, _, err = NeffShuffle(make([]kyber.Point, 0), base, true)
+	_, _, _, _, err = NeffShuffle(config.CryptoSuite, make([]kyber.Point, 0), base, true)
 	if err == nil {
 		t.Error("NeffShuffle with 0 public keys should fail")
 	}
@@ -54,14 +54,13 @@ func TestNeffShuffle(t *testing.T) {
 		clientPks := make([]kyber.Point, nClients)
 		clientPrivKeys := make([]kyber.Scalar, nClients)
 		for i := 0; i < nClients; i++ {
-			pub, priv := NewKeyPair()
+			pub, priv := NewKeyPair(config.CryptoSuite)
 			clientPks[i] = pub
 			clientPrivKeys[i] = priv
 		}
 
 		//shuffle
-		shuffledKeys, newBase, secretCoeff, proof, err := NeffShuffle(clientPks, base, true)
-
+		shuffledKeys, newBase, secretCoeff, proof, err := NeffShuffle(config.CryptoSuite, clientPks, base, true)
 		if err != nil {
 			t.Error(err)
 		}
@@ -77,6 +76,9 @@ func TestNeffShuffle(t *testing.T) {
 		if proof == nil {
 			t.Error("proof is nil")
 		}
+		if err := VerifyNeffShuffle(config.CryptoSuite, clientPks, base, shuffledKeys, newBase, proof); err != nil {
+			t.Error("The shuffle should verify,", err)
+		}
 
 		//now test that the shuffled keys are indeed the old keys in the new base
 		transformedKeys := make([]kyber.Point, nClients)
@@ -105,14 +107,12 @@ func TestNeffShuffle(t *testing.T) {
 		}
 		fmt.Print("Testing distribution for ", nClients, " clients.")
 		for i := 0; i < repetition; i++ {
-			shuffledKeys, newBase, secretCoeff, proof, err = NeffShuffle(clientPks, base, true)
+			shuffledKeys, newBase, secretCoeff, proof, err = NeffShuffle(config.CryptoSuite, clientPks, base, true)
 
 			if err != nil {
 				t.Error("Shouldn't have an error here," + err.Error())
 			}
 
-			//todo : check the proofs !
-			_ = proof
 			_ = secretCoeff
 
 			mapping := make([]int, nClients)
@@ -156,3 +156,79 @@ func TestNeffShuffle(t *testing.T) {
 	}
 
 }
+
+func TestNeffShuffleProof(t *testing.T) {
+
+	suite := config.CryptoSuite
+	base := suite.Point().Base()
+
+	for _, nClients := range []int{1, 2, 5} {
+		clientPks := make([]kyber.Point, nClients)
+		for i := 0; i < nClients; i++ {
+			clientPks[i], _ = NewKeyPair(suite)
+		}
+
+		for _, doShufflePositions := range []bool{true, false} {
+			shuffledKeys, newBase, _, proof, err := NeffShuffle(suite, clientPks, base, doShufflePositions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyNeffShuffle(suite, clientPks, base, shuffledKeys, newBase, proof); err != nil {
+				t.Error("The shuffle of", nClients, "keys should verify,", err)
+			}
+		}
+
+		shuffledKeys, newBase, secretCoeff, proof, err := NeffShuffle(suite, clientPks, base, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// a key replaced by another one breaks the permutation
+		replaced := append([]kyber.Point{}, shuffledKeys...)
+		other, _ := NewKeyPair(suite)
+		replaced[0] = suite.Point().Mul(secretCoeff, other)
+		if VerifyNeffShuffle(suite, clientPks, base, replaced, newBase, proof) == nil {
+			t.Error("A replaced key should not verify")
+		}
+
+		// a key multiplied by another coefficient
+		otherCoeff := append([]kyber.Point{}, shuffledKeys...)
+		otherCoeff[nClients-1] = suite.Point().Mul(suite.Scalar().Pick(suite.RandomStream()), otherCoeff[nClients-1])
+		if VerifyNeffShuffle(suite, clientPks, base, otherCoeff, newBase, proof) == nil {
+			t.Error("A key with another coefficient should not verify")
+		}
+		if VerifyNeffShuffle(suite, clientPks, base, shuffledKeys, suite.Point().Add(newBase, base), proof) == nil {
+			t.Error("A base with another coefficient should not verify")
+		}
+
+		// the proof is bound to its input
+		if VerifyNeffShuffle(suite, replaced, base, shuffledKeys, newBase, proof) == nil {
+			t.Error("The shuffle of other keys should not verify")
+		}
+		if VerifyNeffShuffle(suite, clientPks, base, shuffledKeys, newBase, proof[:len(proof)-1]) == nil {
+			t.Error("A truncated proof should not verify")
+		}
+		if VerifyNeffShuffle(suite, clientPks, base, shuffledKeys[1:], newBase, proof) == nil {
+			t.Error("A missing key should not verify")
+		}
+	}
+
+	// with several keys, a duplicated key is not a permutation, even with a valid coefficient proof
+	clientPks := make([]kyber.Point, 3)
+	for i := range clientPks {
+		clientPks[i], _ = NewKeyPair(suite)
+	}
+	shuffledKeys, newBase, _, proof, err := NeffShuffle(suite, clientPks, base, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shuffledKeys[1] = shuffledKeys[0]
+	if VerifyNeffShuffle(suite, clientPks, base, shuffledKeys, newBase, proof) == nil {
+		t.Error("A duplicated key should not verify")
+	}
+
+	// a coefficient of zero sends every key to the neutral element
+	if VerifyNeffShuffle(suite, clientPks, base, nullPoints(suite, 3), suite.Point().Null(), proof) == nil {
+		t.Error("A zero coefficient should not verify")
+	}
+}
@@ -0,0 +1,79 @@
+package crypto
+
+import (
+	"errors"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/suites"
+)
+
+/*
+ * Schnorr signatures with the pseudonym keys of the slots. The shuffled keys are multiples of the shuffle's output
+ * base, not of the standard base, hence kyber's schnorr package cannot verify them. With B the base, X = x * B:
+ * R = k * B, c = H(B, X, R, msg), s = k + c * x; the signature is (R, s), and s * B = R + c * X.
+ */
+
+// SchnorrSignatureSize returns the length of a signature in this suite
+func SchnorrSignatureSize(suite suites.Suite) int {
+	return suite.PointLen() + suite.ScalarLen()
+}
+
+// SchnorrSign signs msg with privateKey, whose public key is privateKey * base
+func SchnorrSign(suite suites.Suite, base kyber.Point, privateKey kyber.Scalar, msg []byte) ([]byte, error) {
+	k := suite.Scalar().Pick(suite.RandomStream())
+	R := suite.Point().Mul(k, base)
+	X := suite.Point().Mul(privateKey, base)
+	c, err := schnorrChallenge(suite, base, X, R, msg)
+	if err != nil {
+		return nil, err
+	}
+	s := suite.Scalar().Add(k, suite.Scalar().Mul(c, privateKey))
+
+	sig, err := R.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	sBytes, err := s.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append(sig, sBytes...), nil
+}
+
+// SchnorrVerify checks that sig is a signature of msg by the key publicKey, a multiple of base
+func SchnorrVerify(suite suites.Suite, base kyber.Point, publicKey kyber.Point, msg []byte, sig []byte) error {
+	if len(sig) != SchnorrSignatureSize(suite) {
+		return errors.New("the signature has the wrong length")
+	}
+	R := suite.Point()
+	if err := R.UnmarshalBinary(sig[:suite.PointLen()]); err != nil {
+		return err
+	}
+	s := suite.Scalar()
+	if err := s.UnmarshalBinary(sig[suite.PointLen():]); err != nil {
+		return err
+	}
+	c, err := schnorrChallenge(suite, base, publicKey, R, msg)
+	if err != nil {
+		return err
+	}
+
+	left := suite.Point().Mul(s, base)
+	right := suite.Point().Add(R, suite.Point().Mul(c, publicKey))
+	if !left.Equal(right) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// schnorrChallenge hashes the base, the public key, the commitment and the message into a scalar
+func schnorrChallenge(suite suites.Suite, base, publicKey, R kyber.Point, msg []byte) (kyber.Scalar, error) {
+	h := suite.Hash()
+	for _, P := range []kyber.Point{base, publicKey, R} {
+		if _, err := P.MarshalTo(h); err != nil {
+			return nil, err
+		}
+	}
+	h.Write(msg)
+	return suite.Scalar().SetBytes(h.Sum(nil)), nil
+}
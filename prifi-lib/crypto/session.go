@@ -0,0 +1,71 @@
+package crypto
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/suites"
+)
+
+/*
+ * Session keys. The clients and the trustees derive the DC-net secrets from Diffie-Hellman keys picked for one session,
+ * and erase the private keys once the ratchet of the DC-net is set, so that the long-term keys do not give back the
+ * pads of past sessions. The long-term keys only sign the session keys; the signature is bound to the session nonce and
+ * to the owner of the key, hence a session key cannot be replayed in another session, nor pass for another
+ * participant's.
+ */
+
+// domain of the signatures of the session keys
+const sessionKeyDomain = "PriFi-Session-key"
+
+// the roles of the owners of the session keys
+const (
+	SessionKeyClient  = "client"
+	SessionKeyTrustee = "trustee"
+)
+
+// NewSessionKeyPair picks a session key pair, and signs its public key with longTermPrivateKey for the session of
+// nonce nonce, for the participant id of the given role
+func NewSessionKeyPair(suite suites.Suite, longTermPrivateKey kyber.Scalar, role string, id int, nonce []byte) (kyber.Point, kyber.Scalar, []byte, error) {
+	pub, priv := NewKeyPair(suite)
+	msg, err := sessionKeyMessage(role, id, nonce, pub)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	sig, err := SchnorrSign(suite, suite.Point().Base(), longTermPrivateKey, msg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return pub, priv, sig, nil
+}
+
+// VerifySessionKey returns an error if sig is not the signature of sessionPublicKey by longTermPublicKey, for the
+// session of nonce nonce and the participant id of the given role
+func VerifySessionKey(suite suites.Suite, longTermPublicKey kyber.Point, role string, id int, nonce []byte, sessionPublicKey kyber.Point, sig []byte) error {
+	if sessionPublicKey == nil {
+		return errors.New("no session key")
+	}
+	msg, err := sessionKeyMessage(role, id, nonce, sessionPublicKey)
+	if err != nil {
+		return err
+	}
+	return SchnorrVerify(suite, suite.Point().Base(), longTermPublicKey, msg, sig)
+}
+
+// sessionKeyMessage returns what the long-term key signs
+func sessionKeyMessage(role string, id int, nonce []byte, sessionPublicKey kyber.Point) ([]byte, error) {
+	pk, err := sessionPublicKey.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	msg := []byte(sessionKeyDomain)
+	msg = append(msg, byte(len(role)))
+	msg = append(msg, role...)
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header[0:4], uint32(id))
+	binary.BigEndian.PutUint32(header[4:8], uint32(len(nonce)))
+	msg = append(msg, header...)
+	msg = append(msg, nonce...)
+	return append(msg, pk...), nil
+}
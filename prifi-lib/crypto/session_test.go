@@ -0,0 +1,45 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/dedis/prifi/prifi-lib/config"
+)
+
+func TestSessionKey(t *testing.T) {
+
+	nonce := []byte("nonce of the session")
+	pk, priv := NewKeyPair(config.CryptoSuite)
+	otherPk, _ := NewKeyPair(config.CryptoSuite)
+
+	sessionPk, sessionPriv, sig, err := NewSessionKeyPair(config.CryptoSuite, priv, SessionKeyClient, 3, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sessionPk.Equal(pk) || !config.CryptoSuite.Point().Mul(sessionPriv, nil).Equal(sessionPk) {
+		t.Error("The session key pair should be a fresh key pair")
+	}
+	if err := VerifySessionKey(config.CryptoSuite, pk, SessionKeyClient, 3, nonce, sessionPk, sig); err != nil {
+		t.Error(err)
+	}
+
+	// the signature is bound to the signer, the session, the role and the ID
+	if err := VerifySessionKey(config.CryptoSuite, otherPk, SessionKeyClient, 3, nonce, sessionPk, sig); err == nil {
+		t.Error("Should not accept a session key signed by another key")
+	}
+	if err := VerifySessionKey(config.CryptoSuite, pk, SessionKeyClient, 3, []byte("another nonce"), sessionPk, sig); err == nil {
+		t.Error("Should not accept a session key of another session")
+	}
+	if err := VerifySessionKey(config.CryptoSuite, pk, SessionKeyTrustee, 3, nonce, sessionPk, sig); err == nil {
+		t.Error("Should not accept a client's session key as a trustee's")
+	}
+	if err := VerifySessionKey(config.CryptoSuite, pk, SessionKeyClient, 4, nonce, sessionPk, sig); err == nil {
+		t.Error("Should not accept the session key of another client")
+	}
+	if err := VerifySessionKey(config.CryptoSuite, pk, SessionKeyClient, 3, nonce, otherPk, sig); err == nil {
+		t.Error("Should not accept another session key")
+	}
+	if err := VerifySessionKey(config.CryptoSuite, pk, SessionKeyClient, 3, nonce, nil, sig); err == nil {
+		t.Error("Should not accept a missing session key")
+	}
+}
@@ -0,0 +1,218 @@
+package crypto
+
+import (
+	"errors"
+	"strconv"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/encrypt/ecies"
+	"go.dedis.ch/kyber/v3/proof/dleq"
+	"go.dedis.ch/kyber/v3/share"
+	"go.dedis.ch/kyber/v3/suites"
+)
+
+/*
+ * Threshold sharing of a trustee's private key x. The trustee splits x with a Shamir polynomial of degree threshold-1,
+ * and encrypts the m-th share x_m to the m-th trustee. If the trustee disappears, any "threshold" trustees can
+ * compute x_m * C_i for every client key C_i; those partial secrets are interpolated into the DH secrets x * C_i,
+ * without x itself being revealed. The partial secrets (and their proofs, which give them back) are encrypted to the
+ * trustee interpolating them.
+ */
+
+// ShareKey splits privateKey in len(recipients) shares, such that any "threshold" of them can recover the DH secrets
+// of privateKey. The m-th share is encrypted to recipients[m]. Returns the encrypted shares, and the commitments to
+// the sharing polynomial; the first commitment is the public key
+func ShareKey(suite suites.Suite, privateKey kyber.Scalar, threshold int, recipients []kyber.Point) ([][]byte, []kyber.Point, error) {
+	if threshold < 1 || threshold > len(recipients) {
+		return nil, nil, errors.New("threshold must be in [1, " + strconv.Itoa(len(recipients)) + "]")
+	}
+
+	poly := share.NewPriPoly(suite, threshold, privateKey, suite.RandomStream())
+	shares := poly.Shares(len(recipients))
+	encryptedShares := make([][]byte, len(recipients))
+	for m, s := range shares {
+		plain, err := s.V.MarshalBinary()
+		if err != nil {
+			return nil, nil, err
+		}
+		encryptedShares[m], err = ecies.Encrypt(suite, recipients[m], plain, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	_, commitments := poly.Commit(nil).Info()
+	return encryptedShares, commitments, nil
+}
+
+// CheckKeySharing returns an error if the commitments are not those of a sharing of publicKey's private key
+// with this threshold
+func CheckKeySharing(publicKey kyber.Point, commitments []kyber.Point, threshold int) error {
+	if len(commitments) != threshold {
+		return errors.New("expected " + strconv.Itoa(threshold) + " commitments, got " + strconv.Itoa(len(commitments)))
+	}
+	if !commitments[0].Equal(publicKey) {
+		return errors.New("the sharing does not commit to the public key")
+	}
+	return nil
+}
+
+// DecryptKeyShare decrypts the share of index "index" with the private key of its recipient, and checks it against
+// the commitments
+func DecryptKeyShare(suite suites.Suite, privateKey kyber.Scalar, index int, encryptedShare []byte, commitments []kyber.Point) (*share.PriShare, error) {
+	plain, err := ecies.Decrypt(suite, privateKey, encryptedShare, nil)
+	if err != nil {
+		return nil, err
+	}
+	s := &share.PriShare{I: index, V: suite.Scalar()}
+	if err := s.V.UnmarshalBinary(plain); err != nil {
+		return nil, err
+	}
+	if !share.NewPubPoly(suite, nil, commitments).Check(s) {
+		return nil, errors.New("share " + strconv.Itoa(index) + " does not match the commitments")
+	}
+	return s, nil
+}
+
+// PartialDHSecrets returns share * publicKeys[i] for every i, each with a proof that the committed share was used
+func PartialDHSecrets(suite suites.Suite, s *share.PriShare, publicKeys []kyber.Point) ([]kyber.Point, [][]byte, error) {
+	base := suite.Point().Base()
+
+	partials := make([]kyber.Point, len(publicKeys))
+	proofs := make([][]byte, len(publicKeys))
+	for i, pk := range publicKeys {
+		p, _, partial, err := dleq.NewDLEQProof(suite, base, pk, s.V)
+		if err != nil {
+			return nil, nil, err
+		}
+		partials[i] = partial
+		proofs[i], err = marshalDLEQProof(p)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return partials, proofs, nil
+}
+
+// VerifyPartialDHSecrets checks the partial secrets computed by the holder of the share of index "index"
+func VerifyPartialDHSecrets(suite suites.Suite, index int, commitments []kyber.Point, publicKeys []kyber.Point, partials []kyber.Point, proofs [][]byte) error {
+	if len(partials) != len(publicKeys) || len(proofs) != len(publicKeys) {
+		return errors.New("expected " + strconv.Itoa(len(publicKeys)) + " partial secrets and proofs")
+	}
+	base := suite.Point().Base()
+	committedShare := share.NewPubPoly(suite, nil, commitments).Eval(index).V
+
+	for i, pk := range publicKeys {
+		p, err := unmarshalDLEQProof(suite, proofs[i])
+		if err != nil {
+			return err
+		}
+		if err := p.Verify(suite, base, pk, committedShare, partials[i]); err != nil {
+			return errors.New("invalid partial secret " + strconv.Itoa(i) + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+// RecoverDHSecrets interpolates the DH secrets from the (verified) partial secrets of at least "threshold" of the
+// n share holders. partials maps the index of a share to the partial secrets computed with it
+func RecoverDHSecrets(suite suites.Suite, partials map[int][]kyber.Point, threshold, n int) ([]kyber.Point, error) {
+	if len(partials) < threshold {
+		return nil, errors.New("need " + strconv.Itoa(threshold) + " shares, got " + strconv.Itoa(len(partials)))
+	}
+	nSecrets := -1
+	for _, p := range partials {
+		if nSecrets != -1 && len(p) != nSecrets {
+			return nil, errors.New("inconsistent number of partial secrets")
+		}
+		nSecrets = len(p)
+	}
+
+	secrets := make([]kyber.Point, nSecrets)
+	for i := range secrets {
+		pubShares := make([]*share.PubShare, 0, len(partials))
+		for index, p := range partials {
+			pubShares = append(pubShares, &share.PubShare{I: index, V: p[i]})
+		}
+		var err error
+		secrets[i], err = share.RecoverCommit(suite, pubShares, threshold, n)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return secrets, nil
+}
+
+// EncryptPartialDHSecrets encrypts the partial secrets and their proofs to recipient. They are encoded as
+// partial_0 || proof_0 || partial_1 || proof_1 ...
+func EncryptPartialDHSecrets(suite suites.Suite, recipient kyber.Point, partials []kyber.Point, proofs [][]byte) ([]byte, error) {
+	if len(partials) != len(proofs) {
+		return nil, errors.New("expected one proof per partial secret")
+	}
+	plain := make([]byte, 0)
+	for i, partial := range partials {
+		b, err := partial.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		plain = append(plain, b...)
+		plain = append(plain, proofs[i]...)
+	}
+	return ecies.Encrypt(suite, recipient, plain, nil)
+}
+
+// DecryptPartialDHSecrets decrypts the n partial secrets and their proofs encrypted by EncryptPartialDHSecrets. The
+// proofs are not verified
+func DecryptPartialDHSecrets(suite suites.Suite, privateKey kyber.Scalar, encrypted []byte, n int) ([]kyber.Point, [][]byte, error) {
+	plain, err := ecies.Decrypt(suite, privateKey, encrypted, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	proofSize := 2*suite.ScalarLen() + 2*suite.PointLen()
+	if len(plain) != n*(suite.PointLen()+proofSize) {
+		return nil, nil, errors.New("expected " + strconv.Itoa(n) + " partial secrets")
+	}
+	partials := make([]kyber.Point, n)
+	proofs := make([][]byte, n)
+	for i := range partials {
+		partials[i] = suite.Point()
+		if err := partials[i].UnmarshalBinary(plain[:suite.PointLen()]); err != nil {
+			return nil, nil, err
+		}
+		plain = plain[suite.PointLen():]
+		proofs[i] = plain[:proofSize]
+		plain = plain[proofSize:]
+	}
+	return partials, proofs, nil
+}
+
+// a DLEQ proof is encoded as C || R || VG || VH
+func marshalDLEQProof(p *dleq.Proof) ([]byte, error) {
+	out := make([]byte, 0)
+	for _, m := range []kyber.Marshaling{p.C, p.R, p.VG, p.VH} {
+		b, err := m.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b...)
+	}
+	return out, nil
+}
+
+func unmarshalDLEQProof(suite suites.Suite, data []byte) (*dleq.Proof, error) {
+	p := &dleq.Proof{C: suite.Scalar(), R: suite.Scalar(), VG: suite.Point(), VH: suite.Point()}
+	for _, m := range []kyber.Marshaling{p.C, p.R, p.VG, p.VH} {
+		size := m.MarshalSize()
+		if len(data) < size {
+			return nil, errors.New("truncated proof")
+		}
+		if err := m.UnmarshalBinary(data[:size]); err != nil {
+			return nil, err
+		}
+		data = data[size:]
+	}
+	if len(data) != 0 {
+		return nil, errors.New("trailing data after the proof")
+	}
+	return p, nil
+}
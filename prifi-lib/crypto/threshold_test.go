@@ -0,0 +1,94 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/dedis/prifi/prifi-lib/config"
+	"go.dedis.ch/kyber/v3"
+)
+
+func TestThresholdRecovery(t *testing.T) {
+
+	nTrustees := 4
+	threshold := 3
+	nClients := 5
+
+	trusteePks := make([]kyber.Point, nTrustees)
+	trusteePrivs := make([]kyber.Scalar, nTrustees)
+	for j := range trusteePks {
+		trusteePks[j], trusteePrivs[j] = NewKeyPair(config.CryptoSuite)
+	}
+	clientPks := make([]kyber.Point, nClients)
+	for i := range clientPks {
+		clientPks[i], _ = NewKeyPair(config.CryptoSuite)
+	}
+
+	// trustee 0 shares its key, then disappears
+	encryptedShares, commitments, err := ShareKey(config.CryptoSuite, trusteePrivs[0], threshold, trusteePks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckKeySharing(trusteePks[0], commitments, threshold); err != nil {
+		t.Error(err)
+	}
+	if err := CheckKeySharing(trusteePks[1], commitments, threshold); err == nil {
+		t.Error("Commitments should not match another trustee's key")
+	}
+
+	partials := make(map[int][]kyber.Point)
+	for m := 1; m < nTrustees; m++ {
+		s, err := DecryptKeyShare(config.CryptoSuite, trusteePrivs[m], m, encryptedShares[m], commitments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, proofs, err := PartialDHSecrets(config.CryptoSuite, s, clientPks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the partial secrets travel encrypted to the trustee interpolating them, trustee 1
+		encrypted, err := EncryptPartialDHSecrets(config.CryptoSuite, trusteePks[1], p, proofs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := DecryptPartialDHSecrets(config.CryptoSuite, trusteePrivs[2], encrypted, nClients); err == nil {
+			t.Error("Should not decrypt partial secrets encrypted to somebody else")
+		}
+		p, proofs, err = DecryptPartialDHSecrets(config.CryptoSuite, trusteePrivs[1], encrypted, nClients)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyPartialDHSecrets(config.CryptoSuite, m, commitments, clientPks, p, proofs); err != nil {
+			t.Error(err)
+		}
+		// the proofs are bound to the share
+		if err := VerifyPartialDHSecrets(config.CryptoSuite, (m+1)%nTrustees, commitments, clientPks, p, proofs); err == nil {
+			t.Error("Partial secrets should not verify for another share")
+		}
+		partials[m] = p
+
+		if len(partials) < threshold {
+			if _, err := RecoverDHSecrets(config.CryptoSuite, partials, threshold, nTrustees); err == nil {
+				t.Error("Should not recover the secrets with less than threshold shares")
+			}
+		}
+	}
+
+	secrets, err := RecoverDHSecrets(config.CryptoSuite, partials, threshold, nTrustees)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, pk := range clientPks {
+		expected := config.CryptoSuite.Point().Mul(trusteePrivs[0], pk)
+		if !secrets[i].Equal(expected) {
+			t.Error("Wrong DH secret recovered for client", i)
+		}
+	}
+
+	// a share can only be decrypted by its recipient
+	if _, err := DecryptKeyShare(config.CryptoSuite, trusteePrivs[2], 1, encryptedShares[1], commitments); err == nil {
+		t.Error("Should not decrypt somebody else's share")
+	}
+	if _, _, err := ShareKey(config.CryptoSuite, trusteePrivs[0], nTrustees+1, trusteePks); err == nil {
+		t.Error("Should not accept a threshold above the number of trustees")
+	}
+}
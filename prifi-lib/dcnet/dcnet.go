@@ -1,8 +1,8 @@
 package dcnet
 
 import (
+	"errors"
 	"fmt"
-	"github.com/dedis/prifi/prifi-lib/config"
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/suites"
 	"go.dedis.ch/onet/v3/log"
@@ -31,27 +31,56 @@ type DCNetEntity struct {
 	EquivocationProtectionEnabled bool
 	DCNetPayloadSize              int
 
-	cryptoSuite  suites.Suite
-	sharedKeys   []kyber.Point // keys shared with other DC-net members
-	sharedPRNGs  []kyber.XOF   // PRNGs shared with other DC-net members (seeded with sharedKeys)
-	currentRound int32
+	cryptoSuite    suites.Suite
+	sharedKeys     []kyber.Point   // keys shared with other DC-net members, erased by EraseSharedKeys or once the key ratchet leaves epoch 0
+	sessionContext SessionContext  // the public context the seeds are bound to
+	ratchet        *keyRatchet     // the seeds of the pads, derived from sharedKeys, the session context and the epoch
+	currentRound   int32           // the round after the last one encoded
+	parallelism    int             // number of goroutines generating the pads
+	prg            PRG             // expands the shared secrets into pads
+	precomputer    *padPrecomputer //nil if the pads are not precomputed
 
-	//Used by the relay
-	DCNetRoundDecoder *DCNetRoundDecoder //nil if unused
+	//Length of the cells of the rounds announced with a shorter length than DCNetPayloadSize, until they are encoded
+	//(client) or decoded (relay)
+	roundPayloadSizes map[int32]int
+
+	//Used by the relay, one decoder per round being decoded
+	DCNetRoundDecoders map[int32]*DCNetRoundDecoder //nil if unused
 
 	//Equivocation protection
 	equivocationProtection    *EquivocationProtection //nil if unused
 	equivocationContribLength int                     //0 if equivocation protection is disabled
 
+	//Verifiable DC-net
+	verifiableDCNet  *VerifiableDCNet //nil if unused
+	verifiableChunks int              //0 if the verifiable DC-net is not used
+
 	verbose bool
 }
 
-// DCNetRoundDecoder is used by the relay to decode the dcnet ciphers
+// DCNetRoundDecoder is used by the relay to decode the dcnet ciphers of one round.
+// Ciphers are folded in as they arrive, in any order
 type DCNetRoundDecoder struct {
-	currentRoundBeingDecoded int32
-	xorBuffer                []byte
-	equivTrusteeContribs     [][]byte
-	equivClientContribs      [][]byte
+	roundID              int32
+	opened               bool // false while only the trustees' ciphers, sent in advance, are folded in
+	ownerSlot            int  // -1 if nobody owns the slot
+	xorBuffer            []byte
+	equivTrusteeContribs [][]byte
+	equivClientContribs  [][]byte
+	decodedClients       map[int]bool // ciphers already folded in, a second cipher from the same entity is ignored
+	decodedTrustees      map[int]bool
+
+	//Used by the equivocation protection, the verified commitments, and the entities whose proof is invalid
+	equivClientCommitments  map[int]kyber.Point
+	equivTrusteeCommitments map[int]kyber.Point
+	invalidClients          []int
+	invalidTrustees         []int
+
+	//Used by the verifiable DC-net, ciphers are indexed by client/trustee ID
+	pointBuffer              []kyber.Point
+	verifiableClientCiphers  map[int]*VerifiableDCNetCipher
+	verifiableTrusteeCiphers map[int]*VerifiableDCNetCipher
+	verifiableInvalid        bool
 }
 
 // Used by clients, trustees
@@ -60,47 +89,46 @@ func NewDCNetEntity(
 	entity DCNET_ENTITY,
 	PayloadSize int,
 	equivocationProtection bool,
-	sharedKeys []kyber.Point) *DCNetEntity {
+	sharedKeys []kyber.Point,
+	suite suites.Suite) *DCNetEntity {
 
 	e := new(DCNetEntity)
 	e.EntityID = entityID
 	e.Entity = entity
 	e.DCNetPayloadSize = PayloadSize
 	e.EquivocationProtectionEnabled = equivocationProtection
-	e.DCNetRoundDecoder = nil
+	e.DCNetRoundDecoders = nil
 	e.currentRound = 0
+	e.roundPayloadSizes = make(map[int32]int)
 
 	e.verbose = false // todo: wire in the .toml
 
 	if equivocationProtection {
-		e.equivocationProtection = NewEquivocation()
+		e.equivocationProtection = NewEquivocation(suite)
 	}
 
-	e.cryptoSuite = config.CryptoSuite
+	e.cryptoSuite = suite
+	e.SetParallelism(0)
+	e.prg, _ = NewPRG(PRG_XOF, e.cryptoSuite)
 
 	// if the node participates in the DC-net
 	if entity != DCNET_RELAY {
-		e.sharedKeys = sharedKeys
-
-		// Use the provided shared secrets to seed a pseudorandom DC-nets ciphers shared with each peer.
-		e.sharedPRNGs = make([]kyber.XOF, len(sharedKeys))
+		// our copy, its points are zeroed by the key ratchet (see EraseSharedKeys)
+		e.sharedKeys = make([]kyber.Point, len(sharedKeys))
 		for i := range sharedKeys {
+			e.sharedKeys[i] = sharedKeys[i].Clone()
 			e.verbosePrint("key", i, ":", sharedKeys[i])
-			seed, err := sharedKeys[i].MarshalBinary()
-			if err != nil {
-				log.Fatal("Could not extract data from shared key", err)
-			}
-			e.sharedPRNGs[i] = e.cryptoSuite.XOF(seed)
 		}
 	} else {
 		e.sharedKeys = make([]kyber.Point, 0)
-		e.sharedPRNGs = make([]kyber.XOF, 0)
+		e.DCNetRoundDecoders = make(map[int32]*DCNetRoundDecoder)
 	}
+	e.resetRatchet()
 
 	// if the equivocation protection is enabled
 	if equivocationProtection {
 		e.verbosePrint("equivocation = true")
-		e.equivocationProtection = NewEquivocation()
+		e.equivocationProtection = NewEquivocation(suite)
 		zero := e.equivocationProtection.suite.Scalar().Zero()
 		one := e.equivocationProtection.suite.Scalar().One()
 		minusOne := e.equivocationProtection.suite.Scalar().Sub(zero, one) //max value
@@ -138,70 +166,83 @@ func (e *DCNetEntity) verbosePrint(info ...interface{}) {
 	log.Lvl1(s, s2)
 }
 
-// Encodes "Payload" in the correct round. Will skip PRNG material if the round is in the future,
-// and crash if the round is in the past or the Payload is too long
+// Encodes the trustee's pads for the given round. Rounds can be encoded in any order.
 func (e *DCNetEntity) TrusteeEncodeForRound(roundID int32) []byte {
+	if e.verifiableDCNet != nil {
+		return e.verifiableTrusteeEncode(roundID)
+	}
 	upstreamCell, _ := e.EncodeForRound(roundID, false, nil)
 	return upstreamCell
 }
 
-// Encodes "Payload" in the correct round. Will skip PRNG material if the round is in the future,
-// and crash if the round is in the past or the Payload is too long
+// Encodes "Payload" in the given round. Rounds can be encoded in any order, since the pads are derived
+// from the round number; crashes if the Payload is too long.
+// With equivocation protection, the proof of a client that does not own the slot only verifies in rounds nobody
+// owns; clients use EncodeForSlot instead
 func (e *DCNetEntity) EncodeForRound(roundID int32, slotOwner bool, payload []byte) ([]byte, []byte) {
-	if len(payload) > e.DCNetPayloadSize {
-		panic("DCNet: cannot encode Payload of length " + strconv.Itoa(int(len(payload))) + " max length is " + strconv.Itoa(len(payload)))
+	ownerSlot := -1
+	if slotOwner && e.equivocationProtection != nil {
+		ownerSlot = e.equivocationProtection.mySlot
 	}
+	return e.encodeForRound(roundID, ownerSlot, slotOwner, payload)
+}
 
-	if roundID < e.currentRound {
-		sharedKeys := e.sharedKeys
-
-		// Use the provided shared secrets to seed a pseudorandom DC-nets ciphers shared with each peer.
-		sharedPRNGsCopy := make([]kyber.XOF, len(sharedKeys))
-		for i := range sharedKeys {
-			e.verbosePrint("key", i, ":", sharedKeys[i])
-			seed, err := sharedKeys[i].MarshalBinary()
-			if err != nil {
-				log.Fatal("Could not extract data from shared key", err)
-			}
-			sharedPRNGsCopy[i] = e.cryptoSuite.XOF(seed)
-		}
-		round := int32(0)
-		for round < roundID {
-			//discard crypto material
-
-			// consume the PRNGs
-			for i := range e.sharedPRNGs {
-				dummy := make([]byte, e.DCNetPayloadSize)
-				sharedPRNGsCopy[i].XORKeyStream(dummy, dummy)
-			}
-
-			round++
+// Encodes "Payload" in the given round, like EncodeForRound. ownerSlot is the slot owning the round, -1 if nobody owns
+// it; the equivocation protection proofs refer to it. Needs SetSlotPseudonyms if the equivocation protection is enabled
+func (e *DCNetEntity) EncodeForSlot(roundID int32, ownerSlot int, payload []byte) ([]byte, []byte) {
+	// without equivocation protection, the slot owner encodes like everybody else
+	slotOwner := e.equivocationProtection != nil && ownerSlot >= 0 && ownerSlot == e.equivocationProtection.mySlot
+	return e.encodeForRound(roundID, ownerSlot, slotOwner, payload)
+}
 
-		}
-		e.sharedPRNGs = sharedPRNGsCopy
-		e.currentRound = roundID
+// SetSlotPseudonyms gives the output of the shuffle to the equivocation protection, which proves/verifies the
+// ownership of the slots. pseudonymPrivateKey and mySlot are only given by clients; the relay passes nil and -1
+func (e *DCNetEntity) SetSlotPseudonyms(pseudonymBase kyber.Point, pseudonyms []kyber.Point, pseudonymPrivateKey kyber.Scalar, mySlot int) {
+	if e.equivocationProtection != nil {
+		e.equivocationProtection.SetPseudonyms(pseudonymBase, pseudonyms, pseudonymPrivateKey, mySlot)
 	}
+}
 
-	for e.currentRound < roundID {
-		//discard crypto material
-		log.Lvl4("DCNet: Discarding round", e.currentRound)
+// SetRoundPayloadSize sets the length of the cells of round roundID, as announced by the relay. The pads of a shorter
+// cell are the beginning of the pads of a full cell, so the rounds can have different lengths. A payloadSize of 0 (or
+// of at least DCNetPayloadSize) means DCNetPayloadSize. Trustees always encode full cells, the relay only uses their
+// beginning. Not supported by the verifiable DC-net
+func (e *DCNetEntity) SetRoundPayloadSize(roundID int32, payloadSize int) {
+	if payloadSize <= 0 || payloadSize >= e.DCNetPayloadSize {
+		delete(e.roundPayloadSizes, roundID)
+		return
+	}
+	e.roundPayloadSizes[roundID] = payloadSize
+}
 
-		// consume the PRNGs
-		for i := range e.sharedPRNGs {
-			dummy := make([]byte, e.DCNetPayloadSize)
-			e.sharedPRNGs[i].XORKeyStream(dummy, dummy)
-		}
+// RoundPayloadSize returns the length of the cells of round roundID
+func (e *DCNetEntity) RoundPayloadSize(roundID int32) int {
+	if payloadSize, found := e.roundPayloadSizes[roundID]; found {
+		return payloadSize
+	}
+	return e.DCNetPayloadSize
+}
 
-		e.currentRound++
+func (e *DCNetEntity) encodeForRound(roundID int32, ownerSlot int, slotOwner bool, payload []byte) ([]byte, []byte) {
+	payloadSize := e.DCNetPayloadSize
+	if e.Entity == DCNET_CLIENT {
+		payloadSize = e.RoundPayloadSize(roundID)
+		delete(e.roundPayloadSizes, roundID)
 	}
+	if len(payload) > payloadSize {
+		panic("DCNet: cannot encode Payload of length " + strconv.Itoa(int(len(payload))) + " max length is " + strconv.Itoa(payloadSize))
+	}
+
 	var plainPayload []byte
 	var c *DCNetCipher
 	if e.Entity == DCNET_CLIENT {
-		c, plainPayload = e.clientEncode(slotOwner, payload)
+		c, plainPayload = e.clientEncode(roundID, ownerSlot, slotOwner, payload, payloadSize)
 	} else {
-		c = e.trusteeEncode()
+		c = e.trusteeEncode(roundID)
+	}
+	if roundID >= e.currentRound {
+		e.currentRound = roundID + 1
 	}
-	e.currentRound++
 
 	e.verbosePrint("r[", roundID, "]:\n", c.Payload)
 	e.verbosePrint("r[", roundID, "]: equiv\n", c.EquivocationProtectionTag)
@@ -215,16 +256,16 @@ func (e *DCNetEntity) UpdateReceivedMessageHistory(newData []byte) {
 	}
 }
 
-// Encode for clients
-func (e *DCNetEntity) clientEncode(slotOwner bool, payload []byte) (*DCNetCipher, []byte) {
+// Encode for clients, in a cell of payloadSize bytes
+func (e *DCNetEntity) clientEncode(roundID int32, ownerSlot int, slotOwner bool, payload []byte, payloadSize int) (*DCNetCipher, []byte) {
 
 	c := new(DCNetCipher)
 
 	if payload == nil {
-		payload = make([]byte, e.DCNetPayloadSize)
+		payload = make([]byte, payloadSize)
 	} else {
 		// deep clone and pad
-		dcnetPayloadSize := e.DCNetPayloadSize
+		dcnetPayloadSize := payloadSize
 		if e.EquivocationProtectionEnabled && slotOwner {
 			dcnetPayloadSize -= 16
 		}
@@ -234,105 +275,65 @@ func (e *DCNetEntity) clientEncode(slotOwner bool, payload []byte) (*DCNetCipher
 	}
 	c.Payload = payload
 
-	// prepare the pads
-	p_ij := make([][]byte, len(e.sharedPRNGs))
-	for i := range p_ij {
-		p_ij[i] = make([]byte, e.DCNetPayloadSize)
-		e.sharedPRNGs[i].XORKeyStream(p_ij[i], p_ij[i])
+	plainPayload := make([]byte, payloadSize)
+
+	if !e.EquivocationProtectionEnabled {
+		e.xorPadsOfRound(c.Payload, roundID)
+		return c, plainPayload[:]
 	}
-	plainPayload := make([]byte, e.DCNetPayloadSize)
+
+	// prepare the pads
+	pads := e.padsOfRound(roundID)
 
 	// if the equivocation protection is enabled, encrypt the Payload, and add the tag
-	if e.EquivocationProtectionEnabled {
-		payload, sigma_j := e.equivocationProtection.ClientEncryptPayload(slotOwner, payload, p_ij)
-		copy(plainPayload[:], payload)
-		e.verbosePrint("payload\n", payload)
-		e.verbosePrint("sigma_j\n", sigma_j)
-		c.Payload = payload // replace the Payload with the encrypted version
-		c.EquivocationProtectionTag = sigma_j
-	}
+	payload, sigma_j, equivocationProof := e.equivocationProtection.ClientEncryptPayload(roundID, ownerSlot, slotOwner, payload, pads.equivocation)
+	copy(plainPayload[:], payload)
+	e.verbosePrint("payload\n", payload)
+	e.verbosePrint("sigma_j\n", sigma_j)
+	c.Payload = payload // replace the Payload with the encrypted version
+	c.EquivocationProtectionTag = sigma_j
+	c.EquivocationProtectionProof = equivocationProof
 
 	// DC-net encrypt the Payload
-	for i := range p_ij {
-		for k := range c.Payload {
-			c.Payload[k] ^= p_ij[i][k] // XORs in the pads
-		}
-	}
+	xorBytes(c.Payload, pads.sum)
 	return c, plainPayload[:]
 }
 
 // Encode for trustees
-func (e *DCNetEntity) trusteeEncode() *DCNetCipher {
+func (e *DCNetEntity) trusteeEncode(roundID int32) *DCNetCipher {
 	c := new(DCNetCipher)
 
 	c.Payload = make([]byte, e.DCNetPayloadSize)
 
-	// prepare the pads
-	p_ij := make([][]byte, len(e.sharedPRNGs))
-	for i := range p_ij {
-		p_ij[i] = make([]byte, e.DCNetPayloadSize)
-		e.sharedPRNGs[i].XORKeyStream(p_ij[i], p_ij[i])
+	if !e.EquivocationProtectionEnabled {
+		e.xorPadsOfRound(c.Payload, roundID)
+		return c
 	}
 
+	// prepare the pads
+	pads := e.padsOfRound(roundID)
+
 	// DC-net encrypt the Payload
-	for i := range p_ij {
-		for k := range c.Payload {
-			c.Payload[k] ^= p_ij[i][k] // XORs in the pads
-		}
-	}
+	xorBytes(c.Payload, pads.sum)
 
-	// if the equivocation protection is enabled, encrypt the Payload, and add the tag
-	if e.EquivocationProtectionEnabled {
-		sigma_j := e.equivocationProtection.TrusteeGetContribution(p_ij)
-		c.EquivocationProtectionTag = sigma_j
-	}
+	// if the equivocation protection is enabled, add the tag
+	sigma_j, equivocationProof := e.equivocationProtection.TrusteeGetContribution(roundID, pads.equivocation)
+	c.EquivocationProtectionTag = sigma_j
+	c.EquivocationProtectionProof = equivocationProof
 
 	return c
 }
 
 // Function to get the bits from previous round in an exact position.
 func (e *DCNetEntity) GetBitsOfRound(roundID int32, bitPosition int32) (map[int]int, [][]byte) {
-	if roundID >= e.currentRound {
+	if roundID >= e.currentRound || e.seedsOfEpoch(e.EpochOfRound(roundID)) == nil {
 		return nil, nil
 	}
 
-	sharedKeys := e.sharedKeys
-
-	// Use the provided shared secrets to seed a pseudorandom DC-nets ciphers shared with each peer.
-	sharedPRNGsCopy := make([]kyber.XOF, len(sharedKeys))
-	for i := range sharedKeys {
-		e.verbosePrint("key", i, ":", sharedKeys[i])
-		seed, err := sharedKeys[i].MarshalBinary()
-		if err != nil {
-			log.Fatal("Could not extract data from shared key", err)
-		}
-		sharedPRNGsCopy[i] = e.cryptoSuite.XOF(seed)
-	}
-	round := int32(0)
-	for round < roundID {
-		//discard crypto material
-
-		// consume the PRNGs
-		for i := range e.sharedPRNGs {
-			dummy := make([]byte, e.DCNetPayloadSize)
-			sharedPRNGsCopy[i].XORKeyStream(dummy, dummy)
-		}
-
-		round++
-
-	}
-	e.sharedPRNGs = sharedPRNGsCopy
-	e.currentRound = roundID
-
 	rtn := make(map[int]int)
 
-	// prepare the pads
-
-	p_ij := make([][]byte, len(e.sharedPRNGs))
-	for i := range p_ij {
-		p_ij[i] = make([]byte, e.DCNetPayloadSize)
-		e.sharedPRNGs[i].XORKeyStream(p_ij[i], p_ij[i])
-	}
+	// recompute the pads of that round
+	p_ij := e.roundPads(roundID)
 	// DC-net encrypt the Payload
 	for i := range p_ij {
 		bytePosition := int(bitPosition / 8)
@@ -354,65 +355,218 @@ func (e *DCNetEntity) GetBitsOfRound(roundID int32, bitPosition int32) (map[int]
 	return rtn, p_ij
 }
 
-// Used by the relay to start decoding a round
-func (e *DCNetEntity) DecodeStart(roundID int32) {
-	e.DCNetRoundDecoder = new(DCNetRoundDecoder)
-	e.DCNetRoundDecoder.currentRoundBeingDecoded = roundID
-	e.DCNetRoundDecoder.xorBuffer = make([]byte, e.DCNetPayloadSize)
-	e.DCNetRoundDecoder.equivClientContribs = make([][]byte, 0)
-	e.DCNetRoundDecoder.equivTrusteeContribs = make([][]byte, 0)
+// Used by the relay to start decoding a round. Several rounds can be decoded concurrently;
+// restarting a round discards what was decoded for it. ownerSlot is the slot owning the round, -1 if nobody owns it.
+// The cell has the length set by SetRoundPayloadSize, which must be called before. The trustees' ciphers folded in
+// before the round was opened (see DecodeTrusteeInAdvance) are kept
+func (e *DCNetEntity) DecodeStart(roundID int32, ownerSlot int) {
+	d, found := e.DCNetRoundDecoders[roundID]
+	if !found || d.opened {
+		d = e.newRoundDecoder(roundID)
+		e.DCNetRoundDecoders[roundID] = d
+	}
+	d.opened = true
+	d.ownerSlot = ownerSlot
+
+	// the trustees' ciphers are full cells, only their beginning is used in a shorter round
+	d.xorBuffer = d.xorBuffer[:e.RoundPayloadSize(roundID)]
+	delete(e.roundPayloadSizes, roundID)
 }
 
-// called by the relay to decode a client contribution
-func (e *DCNetEntity) DecodeClient(roundID int32, slice []byte) {
+// newRoundDecoder returns an empty decoder for a round, with a full cell
+func (e *DCNetEntity) newRoundDecoder(roundID int32) *DCNetRoundDecoder {
+	d := new(DCNetRoundDecoder)
+	d.roundID = roundID
+	d.ownerSlot = -1
+	d.xorBuffer = make([]byte, e.DCNetPayloadSize)
+	d.equivClientContribs = make([][]byte, 0)
+	d.equivTrusteeContribs = make([][]byte, 0)
+	d.decodedClients = make(map[int]bool)
+	d.decodedTrustees = make(map[int]bool)
+	d.equivClientCommitments = make(map[int]kyber.Point)
+	d.equivTrusteeCommitments = make(map[int]kyber.Point)
+
+	if e.verifiableDCNet != nil {
+		d.pointBuffer = make([]kyber.Point, e.verifiableChunks)
+		for k := range d.pointBuffer {
+			d.pointBuffer[k] = e.cryptoSuite.Point().Null()
+		}
+		d.verifiableClientCiphers = make(map[int]*VerifiableDCNetCipher)
+		d.verifiableTrusteeCiphers = make(map[int]*VerifiableDCNetCipher)
+	}
+	return d
+}
 
-	dcNetCipher := DCNetCipherFromBytes(slice)
+// IsDecoding returns true iff the relay started decoding this round, and did not decode the cell yet
+func (e *DCNetEntity) IsDecoding(roundID int32) bool {
+	d, found := e.DCNetRoundDecoders[roundID]
+	return found && d.opened
+}
 
-	if roundID != e.DCNetRoundDecoder.currentRoundBeingDecoded {
-		panic("Cannot DecodeClient for round" +
-			strconv.Itoa(int(roundID)) + ", we are in round " + strconv.Itoa(int(e.DCNetRoundDecoder.currentRoundBeingDecoded)))
+// DecodeTrusteeInAdvance is called by the relay to decode a trustee contribution for a round that is not opened yet:
+// the trustees send their ciphers ahead of the rounds, and folding them in at once spares keeping them until the round
+// opens. Like DecodeTrustee otherwise
+func (e *DCNetEntity) DecodeTrusteeInAdvance(roundID int32, trusteeID int, slice []byte) error {
+	if _, found := e.DCNetRoundDecoders[roundID]; !found {
+		e.DCNetRoundDecoders[roundID] = e.newRoundDecoder(roundID)
 	}
+	return e.decodeTrustee(e.DCNetRoundDecoders[roundID], trusteeID, slice)
+}
 
-	for i := range dcNetCipher.Payload {
-		e.DCNetRoundDecoder.xorBuffer[i] ^= dcNetCipher.Payload[i]
-	}
+// DecodeCancel discards what was decoded for this round, e.g. if the round timed out, or will never be opened
+func (e *DCNetEntity) DecodeCancel(roundID int32) {
+	delete(e.DCNetRoundDecoders, roundID)
+}
 
-	if e.EquivocationProtectionEnabled {
-		e.DCNetRoundDecoder.equivClientContribs = append(e.DCNetRoundDecoder.equivClientContribs, dcNetCipher.EquivocationProtectionTag)
+// returns the decoder of this round, crashes if we are not decoding it
+func (e *DCNetEntity) roundDecoder(roundID int32) *DCNetRoundDecoder {
+	d, found := e.DCNetRoundDecoders[roundID]
+	if !found || !d.opened {
+		panic("Cannot decode round " + strconv.Itoa(int(roundID)) + ", DecodeStart was not called for it")
 	}
+	return d
 }
 
-// called by the relay to decode a client contribution
-func (e *DCNetEntity) DecodeTrustee(roundID int32, slice []byte) {
+// called by the relay to decode a client contribution. With equivocation protection, returns an error if the
+// client's contribution is not proven well-formed; the cell of this round will then be reported as disrupted
+func (e *DCNetEntity) DecodeClient(roundID int32, clientID int, slice []byte) error {
+
+	d := e.roundDecoder(roundID)
+	if d.decodedClients[clientID] {
+		log.Error("DCNet: already decoded a cipher from client", clientID, "for round", roundID, ", ignoring it")
+		return nil
+	}
+	d.decodedClients[clientID] = true
+
+	if e.verifiableDCNet != nil {
+		d.verifiableClientCiphers[clientID] = e.verifiableDecode(d, slice)
+		return nil
+	}
 
 	dcNetCipher := DCNetCipherFromBytes(slice)
 
-	if roundID != e.DCNetRoundDecoder.currentRoundBeingDecoded {
-		panic("Cannot DecodeClient for round" +
-			strconv.Itoa(int(roundID)) + ", we are in round " + strconv.Itoa(int(e.DCNetRoundDecoder.currentRoundBeingDecoded)))
+	// the clients' ciphers have the length of the round's cells; a cipher of another length is folded in up to it
+	xorBytes(d.xorBuffer[:minInt(len(d.xorBuffer), len(dcNetCipher.Payload))], dcNetCipher.Payload)
+
+	if e.EquivocationProtectionEnabled {
+		commitment, err := e.equivocationProtection.VerifyClientContribution(roundID, d.ownerSlot,
+			dcNetCipher.EquivocationProtectionTag, dcNetCipher.EquivocationProtectionProof)
+		if err != nil {
+			d.invalidClients = append(d.invalidClients, clientID)
+			return errors.New("invalid equivocation contribution from client " + strconv.Itoa(clientID) +
+				" in round " + strconv.Itoa(int(roundID)) + ": " + err.Error())
+		}
+		d.equivClientCommitments[clientID] = commitment
+		d.equivClientContribs = append(d.equivClientContribs, dcNetCipher.EquivocationProtectionTag)
 	}
+	return nil
+}
 
-	for i := range dcNetCipher.Payload {
-		e.DCNetRoundDecoder.xorBuffer[i] ^= dcNetCipher.Payload[i]
+// called by the relay to decode a trustee contribution. With equivocation protection or the verifiable DC-net, returns
+// an error if the trustee's contribution is not proven well-formed; the cell of this round will then be reported as
+// disrupted
+func (e *DCNetEntity) DecodeTrustee(roundID int32, trusteeID int, slice []byte) error {
+	return e.decodeTrustee(e.roundDecoder(roundID), trusteeID, slice)
+}
+
+func (e *DCNetEntity) decodeTrustee(d *DCNetRoundDecoder, trusteeID int, slice []byte) error {
+	roundID := d.roundID
+	if d.decodedTrustees[trusteeID] {
+		log.Error("DCNet: already decoded a cipher from trustee", trusteeID, "for round", roundID, ", ignoring it")
+		return nil
+	}
+	d.decodedTrustees[trusteeID] = true
+
+	if e.verifiableDCNet != nil {
+		return e.verifiableDecodeTrustee(d, trusteeID, slice)
 	}
 
+	dcNetCipher := DCNetCipherFromBytes(slice)
+
+	// the trustees' ciphers are full cells, only their beginning is used in a shorter round
+	xorBytes(d.xorBuffer[:minInt(len(d.xorBuffer), len(dcNetCipher.Payload))], dcNetCipher.Payload)
+
 	if e.EquivocationProtectionEnabled {
-		e.DCNetRoundDecoder.equivTrusteeContribs = append(e.DCNetRoundDecoder.equivTrusteeContribs, dcNetCipher.EquivocationProtectionTag)
+		commitment, err := e.equivocationProtection.VerifyTrusteeContribution(roundID,
+			dcNetCipher.EquivocationProtectionTag, dcNetCipher.EquivocationProtectionProof)
+		if err != nil {
+			d.invalidTrustees = append(d.invalidTrustees, trusteeID)
+			return errors.New("invalid equivocation contribution from trustee " + strconv.Itoa(trusteeID) +
+				" in round " + strconv.Itoa(int(roundID)) + ": " + err.Error())
+		}
+		d.equivTrusteeCommitments[trusteeID] = commitment
+		d.equivTrusteeContribs = append(d.equivTrusteeContribs, dcNetCipher.EquivocationProtectionTag)
 	}
+	return nil
 }
 
-// Called on the relay to decode the cell, after having stored the cryptographic materials
-func (e *DCNetEntity) DecodeCell(isOpenClosedSlot bool) ([]byte, []byte) {
-	//No Equivocation -> just XOR
-	d := e.DCNetRoundDecoder
+// Called on the relay to decode the cell of a round, after having decoded all the ciphers. This ends the decoding of the round.
+// noSlotOwner is true if no client encrypted a payload in this cell (open/closed map, or all slots closed).
+// Returns the decoded payload and the ciphertext; if the cell is disrupted, the decoded payload is nil and the
+// DisruptionEvent tells why
+func (e *DCNetEntity) DecodeCell(roundID int32, noSlotOwner bool) ([]byte, []byte, *DisruptionEvent) {
+	d := e.roundDecoder(roundID)
+	delete(e.DCNetRoundDecoders, roundID)
+
+	if e.verifiableDCNet != nil {
+		decoded := e.verifiableDecodeCell(d)
+		if len(d.invalidTrustees) > 0 {
+			return nil, decoded, &DisruptionEvent{RoundID: roundID, Type: DISRUPTION_INVALID_PROOF, Trustees: d.invalidTrustees}
+		}
+		if d.verifiableInvalid {
+			return nil, decoded, &DisruptionEvent{RoundID: roundID, Type: DISRUPTION_INVALID_CIPHER}
+		}
+		return decoded, decoded, nil
+	}
 
+	//No Equivocation -> just XOR
 	cipherText := d.xorBuffer
-	var decoded []byte
-	if e.EquivocationProtectionEnabled && !isOpenClosedSlot {
-		decoded = e.equivocationProtection.RelayDecode(d.xorBuffer, d.equivTrusteeContribs, d.equivClientContribs)
-	} else {
-		decoded = cipherText
+	if !e.EquivocationProtectionEnabled {
+		return cipherText, cipherText, nil
+	}
+	if len(d.invalidClients) > 0 || len(d.invalidTrustees) > 0 {
+		return nil, cipherText, &DisruptionEvent{RoundID: roundID, Type: DISRUPTION_INVALID_PROOF,
+			Clients: d.invalidClients, Trustees: d.invalidTrustees}
+	}
+	if noSlotOwner {
+		return cipherText, cipherText, nil
 	}
 
-	return decoded, cipherText
+	decoded, err := e.equivocationProtection.RelayDecode(roundID, d.xorBuffer, d.equivTrusteeContribs, d.equivClientContribs)
+	if err != nil {
+		if !commitmentsConsistent(d) {
+			// the proofs are valid, so the key does not match the commitments: a client or a trustee lied about its pads
+			err = errors.New("the clients' and trustees' commitments do not match, " + err.Error())
+		}
+		return nil, cipherText, &DisruptionEvent{RoundID: roundID, Type: DISRUPTION_AUTHENTICATION_FAILED, Err: err}
+	}
+	return decoded, cipherText, nil
+}
+
+// commitmentsConsistent checks that the clients' commitments sum to the trustees' commitments. If they do, the
+// proven contributions add up to the slot owner's key, and a payload failing authentication was altered in the XOR
+func commitmentsConsistent(d *DCNetRoundDecoder) bool {
+	sum := func(commitments map[int]kyber.Point) kyber.Point {
+		var s kyber.Point
+		for _, C := range commitments {
+			if s == nil {
+				s = C.Clone()
+			} else {
+				s.Add(s, C)
+			}
+		}
+		return s
+	}
+	clientsSum, trusteesSum := sum(d.equivClientCommitments), sum(d.equivTrusteeCommitments)
+	if clientsSum == nil || trusteesSum == nil {
+		return clientsSum == trusteesSum
+	}
+	return clientsSum.Equal(trusteesSum)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
 }
@@ -7,26 +7,32 @@ import (
 
 // DCNetCipher is the output of a DC-net round
 type DCNetCipher struct {
-	EquivocationProtectionTag []byte
-	Payload                   []byte
+	EquivocationProtectionTag   []byte
+	EquivocationProtectionProof []byte
+	Payload                     []byte
 }
 
-// Converts the DCNetCipher to []byte
+// Converts the DCNetCipher to []byte. The header holds the start of the tag (-1 if there is none), of the proof,
+// and of the payload
 func (c *DCNetCipher) ToBytes() []byte {
-	out := make([]byte, 8)
+	out := make([]byte, 12)
 	equivocationTagStart := -1
-	payloadStart := 8
+	proofStart := 12
+	payloadStart := 12
 
 	if c.EquivocationProtectionTag != nil {
-		equivocationTagStart = 8
-		payloadStart += len(c.EquivocationProtectionTag)
+		equivocationTagStart = 12
+		proofStart += len(c.EquivocationProtectionTag)
+		payloadStart = proofStart + len(c.EquivocationProtectionProof)
 	}
 
 	binary.BigEndian.PutUint32(out[0:4], uint32(equivocationTagStart))
-	binary.BigEndian.PutUint32(out[4:8], uint32(payloadStart))
+	binary.BigEndian.PutUint32(out[4:8], uint32(proofStart))
+	binary.BigEndian.PutUint32(out[8:12], uint32(payloadStart))
 
 	if c.EquivocationProtectionTag != nil {
 		out = append(out, c.EquivocationProtectionTag...)
+		out = append(out, c.EquivocationProtectionProof...)
 	}
 	out = append(out, c.Payload...)
 
@@ -37,17 +43,17 @@ func (c *DCNetCipher) ToBytes() []byte {
 func DCNetCipherFromBytes(data []byte) *DCNetCipher {
 	c := new(DCNetCipher)
 
-	if len(data) < 8 {
+	if len(data) < 12 {
 		panic("DCNetCipherFromBytes: data too short")
 	}
 
-	minusOneInUint32 := math.MaxInt32
+	equivocationTagStart := binary.BigEndian.Uint32(data[0:4])
+	proofStart := int(binary.BigEndian.Uint32(data[4:8]))
+	payloadStart := int(binary.BigEndian.Uint32(data[8:12]))
 
-	equivocationTagStart := int(binary.BigEndian.Uint32(data[0:4]))
-	payloadStart := int(binary.BigEndian.Uint32(data[4:8]))
-
-	if equivocationTagStart != minusOneInUint32 {
-		c.EquivocationProtectionTag = data[8:payloadStart]
+	if equivocationTagStart != math.MaxUint32 { // -1
+		c.EquivocationProtectionTag = data[12:proofStart]
+		c.EquivocationProtectionProof = data[proofStart:payloadStart]
 	}
 
 	c.Payload = data[payloadStart:]
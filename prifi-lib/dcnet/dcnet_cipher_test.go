@@ -73,4 +73,15 @@ func ChangeLength(length int, t *testing.T) {
 		fmt.Printf("%+v\n", a)
 		fmt.Printf("%+v\n", DCNetCipherFromBytes(a.ToBytes()))
 	}
+	a = DCNetCipher{
+		EquivocationProtectionTag:   randomBytes(length),
+		EquivocationProtectionProof: randomBytes(length),
+		Payload:                     randomBytes(length),
+	}
+	b := DCNetCipherFromBytes(a.ToBytes())
+	if !assertEqual(&a, b) || !bytes.Equal(a.EquivocationProtectionProof, b.EquivocationProtectionProof) {
+		t.Error("DCNetCipher could not be marshalled-unmarshalled")
+		fmt.Printf("%+v\n", a)
+		fmt.Printf("%+v\n", b)
+	}
 }
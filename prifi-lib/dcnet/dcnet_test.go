@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"github.com/dedis/prifi/prifi-lib/config"
 	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/suites"
 	"testing"
+	"time"
 )
 
 type TestGroup struct {
@@ -29,33 +31,68 @@ func TestDCNetCreation(t *testing.T) {
 	nRounds := int32(100)
 	dcNetMessageLength := 100
 
+	// the equivocation protection proves the ownership of each cell, which is much slower: fewer rounds, and in short
+	// mode (e.g., with the race detector), only some sizes
+	equivocationRounds := nRounds / 10
+	if testing.Short() {
+		nRounds /= 5
+	}
 	for nTrustees := 1; nTrustees < 10; nTrustees++ {
 		for nClients := 1; nClients < 10; nClients++ {
-			VariousLevelsOfProtection(t, nRounds, dcNetMessageLength, nClients, nTrustees)
+			withEquivocation := !testing.Short() || (nClients%4 == 1 && nTrustees%4 == 1)
+			VariousLevelsOfProtection(t, nRounds, equivocationRounds, withEquivocation, dcNetMessageLength, nClients, nTrustees)
 		}
 	}
 }
 
-func VariousLevelsOfProtection(t *testing.T, nRounds int32, dcNetMessageSize, NClients, NTrustees int) {
+func VariousLevelsOfProtection(t *testing.T, nRounds, equivocationRounds int32, withEquivocation bool, dcNetMessageSize, NClients, NTrustees int) {
 	tg := NewTestGroup(t, false, dcNetMessageSize, NClients, NTrustees)
 	SimulateRounds(t, tg, nRounds)
-	tg = NewTestGroup(t, true, dcNetMessageSize, NClients, NTrustees)
-	SimulateRounds(t, tg, nRounds)
+	if withEquivocation {
+		tg = NewTestGroup(t, true, dcNetMessageSize, NClients, NTrustees)
+		SimulateRounds(t, tg, equivocationRounds)
+	}
+}
+
+func TestDCNetCryptoSuites(t *testing.T) {
+
+	for _, name := range []string{"P256", "Residue512"} {
+		suite, err := config.FindCryptoSuite(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tg := NewTestGroupInSuite(t, suite, false, 100, 2, 2)
+		SimulateRounds(t, tg, 10)
+		tg = NewTestGroupInSuite(t, suite, true, 100, 2, 2)
+		SimulateRounds(t, tg, 10)
+	}
+
+	if _, err := config.FindCryptoSuite("Curve41417"); err == nil {
+		t.Error("Unknown suites should be refused")
+	}
+	if suite, err := config.FindCryptoSuite(""); err != nil || suite.String() != config.DefaultCryptoSuite {
+		t.Error("The empty name should select the default suite")
+	}
+}
+
+func NewTestGroup(t testing.TB, equivocationProtectionEnabled bool, dcNetMessageSize, nclients, ntrustees int) *TestGroup {
+	return NewTestGroupInSuite(t, config.CryptoSuite, equivocationProtectionEnabled, dcNetMessageSize, nclients, ntrustees)
 }
 
-func NewTestGroup(t *testing.T, equivocationProtectionEnabled bool, dcNetMessageSize, nclients, ntrustees int) *TestGroup {
+// NewTestGroupInSuite creates a test group whose keys and DC-net are in the given suite
+func NewTestGroupInSuite(t testing.TB, suite suites.Suite, equivocationProtectionEnabled bool, dcNetMessageSize, nclients, ntrustees int) *TestGroup {
 
 	// Use a pseudorandom stream from a well-known seed
 	// for all our setup randomness,
 	// so we can reproduce the same keys etc on each node.
-	rand := config.CryptoSuite.XOF([]byte("DCTest"))
+	rand := suite.XOF([]byte("DCTest"))
 
 	nodes := make([]*TestNode, nclients+ntrustees)
-	base := config.CryptoSuite.Point().Base()
+	base := suite.Point().Base()
 	for i := range nodes {
 		nodes[i] = new(TestNode)
-		nodes[i].privKey = config.CryptoSuite.Scalar().Pick(rand)
-		nodes[i].pubKey = config.CryptoSuite.Point().Mul(nodes[i].privKey, base)
+		nodes[i].privKey = suite.Scalar().Pick(rand)
+		nodes[i].pubKey = suite.Point().Mul(nodes[i].privKey, base)
 	}
 
 	clients := nodes[:nclients]
@@ -63,7 +100,7 @@ func NewTestGroup(t *testing.T, equivocationProtectionEnabled bool, dcNetMessage
 
 	relay := new(TestNode)
 	relay.name = "Relay"
-	relay.DCNetEntity = NewDCNetEntity(0, DCNET_RELAY, dcNetMessageSize, equivocationProtectionEnabled, nil)
+	relay.DCNetEntity = NewDCNetEntity(0, DCNET_RELAY, dcNetMessageSize, equivocationProtectionEnabled, nil, suite)
 
 	// Create tables of the clients' and the trustees' public session keys
 	clientsKeys := make([]kyber.Point, nclients)
@@ -83,9 +120,9 @@ func NewTestGroup(t *testing.T, equivocationProtectionEnabled bool, dcNetMessage
 		n.peerKeys = trusteesKeys
 		n.sharedSecrets = make([]kyber.Point, len(n.peerKeys))
 		for i := range n.peerKeys {
-			n.sharedSecrets[i] = config.CryptoSuite.Point().Mul(n.privKey, n.peerKeys[i])
+			n.sharedSecrets[i] = suite.Point().Mul(n.privKey, n.peerKeys[i])
 		}
-		n.DCNetEntity = NewDCNetEntity(i, DCNET_CLIENT, dcNetMessageSize, equivocationProtectionEnabled, n.sharedSecrets)
+		n.DCNetEntity = NewDCNetEntity(i, DCNET_CLIENT, dcNetMessageSize, equivocationProtectionEnabled, n.sharedSecrets, suite)
 	}
 
 	for i, n := range trustees {
@@ -95,10 +132,23 @@ func NewTestGroup(t *testing.T, equivocationProtectionEnabled bool, dcNetMessage
 		n.peerKeys = clientsKeys
 		n.sharedSecrets = make([]kyber.Point, len(n.peerKeys))
 		for i := range n.peerKeys {
-			n.sharedSecrets[i] = config.CryptoSuite.Point().Mul(n.privKey, n.peerKeys[i])
+			n.sharedSecrets[i] = suite.Point().Mul(n.privKey, n.peerKeys[i])
 		}
-		n.DCNetEntity = NewDCNetEntity(i, DCNET_TRUSTEE, dcNetMessageSize, equivocationProtectionEnabled, n.sharedSecrets)
+		n.DCNetEntity = NewDCNetEntity(i, DCNET_TRUSTEE, dcNetMessageSize, equivocationProtectionEnabled, n.sharedSecrets, suite)
+	}
+
+	// client i owns slot i
+	pseudonymBase := suite.Point().Pick(rand)
+	pseudonymPrivateKeys := make([]kyber.Scalar, nclients)
+	pseudonyms := make([]kyber.Point, nclients)
+	for i := range pseudonyms {
+		pseudonymPrivateKeys[i] = suite.Scalar().Pick(rand)
+		pseudonyms[i] = suite.Point().Mul(pseudonymPrivateKeys[i], pseudonymBase)
 	}
+	for i, n := range clients {
+		n.DCNetEntity.SetSlotPseudonyms(pseudonymBase, pseudonyms, pseudonymPrivateKeys[i], i)
+	}
+	relay.DCNetEntity.SetSlotPseudonyms(pseudonymBase, pseudonyms, nil, -1)
 
 	// Create a set of fake history streams for the relay and clients
 	//hist := []byte("xyz")
@@ -141,10 +191,10 @@ func SimulateRounds(t *testing.T, tg *TestGroup, maxRounds int32) {
 			var m []byte
 			if first {
 				//fmt.Println("Embedding message:", message)
-				m, _ = tg.Clients[i].DCNetEntity.EncodeForRound(roundID, true, message)
+				m, _ = tg.Clients[i].DCNetEntity.EncodeForSlot(roundID, 0, message)
 				first = false
 			} else {
-				m, _ = tg.Clients[i].DCNetEntity.EncodeForRound(roundID, false, nil)
+				m, _ = tg.Clients[i].DCNetEntity.EncodeForSlot(roundID, 0, nil)
 			}
 			clientMessages = append(clientMessages, m)
 		}
@@ -156,15 +206,22 @@ func SimulateRounds(t *testing.T, tg *TestGroup, maxRounds int32) {
 		}
 
 		// The relay decodes the cryptographic material
-		tg.Relay.DCNetEntity.DecodeStart(roundID)
-		for _, m := range clientMessages {
-			tg.Relay.DCNetEntity.DecodeClient(roundID, m)
+		tg.Relay.DCNetEntity.DecodeStart(roundID, 0)
+		for i, m := range clientMessages {
+			if err := tg.Relay.DCNetEntity.DecodeClient(roundID, i, m); err != nil {
+				t.Error(err)
+			}
 		}
-		for _, m := range trusteesMessages {
-			tg.Relay.DCNetEntity.DecodeTrustee(roundID, m)
+		for j, m := range trusteesMessages {
+			if err := tg.Relay.DCNetEntity.DecodeTrustee(roundID, j, m); err != nil {
+				t.Error(err)
+			}
 		}
 
-		output, _ := tg.Relay.DCNetEntity.DecodeCell(false)
+		output, _, disruption := tg.Relay.DCNetEntity.DecodeCell(roundID, false)
+		if disruption != nil {
+			t.Error("Honest round reported as disrupted,", disruption)
+		}
 
 		//fmt.Println("-----------------")
 		//fmt.Println(output)
@@ -175,3 +232,470 @@ func SimulateRounds(t *testing.T, tg *TestGroup, maxRounds int32) {
 		}
 	}
 }
+
+func TestRoundPads(t *testing.T) {
+
+	payloadSize := 100
+	tg := NewTestGroup(t, false, payloadSize, 2, 2)
+	trustee := tg.Trustees[0].DCNetEntity
+
+	// pads depend on the round and on the shared key
+	if bytes.Equal(trustee.RoundPad(trustee.sharedKeys[0], 0, 0, 1), trustee.RoundPad(trustee.sharedKeys[0], 0, 0, 2)) {
+		t.Error("Two rounds should not share the same pad")
+	}
+	if bytes.Equal(trustee.RoundPad(trustee.sharedKeys[0], 0, 0, 1), trustee.RoundPad(trustee.sharedKeys[1], 1, 0, 1)) {
+		t.Error("Two peers should not share the same pad")
+	}
+
+	// seeking far ahead, then back, gives the same ciphers as a fresh entity
+	far := trustee.TrusteeEncodeForRound(100000)
+	past := trustee.TrusteeEncodeForRound(3)
+
+	fresh := NewDCNetEntity(0, DCNET_TRUSTEE, payloadSize, false, tg.Trustees[0].sharedSecrets, config.CryptoSuite)
+	if !bytes.Equal(past, fresh.TrusteeEncodeForRound(3)) {
+		t.Error("Re-encoding a past round should give the same cipher")
+	}
+	if !bytes.Equal(far, fresh.TrusteeEncodeForRound(100000)) {
+		t.Error("Encoding a future round should give the same cipher")
+	}
+
+	// the relay re-derives the pads of a past round for the blame
+	_, pads := trustee.GetBitsOfRound(3, 0)
+	for i := range pads {
+		if !bytes.Equal(pads[i], trustee.RoundPad(trustee.sharedKeys[i], i, 0, 3)) {
+			t.Error("GetBitsOfRound should return the pads of the requested round")
+		}
+	}
+	if bits, _ := trustee.GetBitsOfRound(100001, 0); bits != nil {
+		t.Error("GetBitsOfRound should not return bits for rounds not encoded yet")
+	}
+}
+
+func TestPadBitsOfRound(t *testing.T) {
+
+	payloadSize := 100
+	tg := NewTestGroup(t, false, payloadSize, 2, 2)
+	client := tg.Clients[0].DCNetEntity
+	trustee := tg.Trustees[0].DCNetEntity
+
+	// the bit of a cipher is the XOR of the pads' bits, and of the payload's bit
+	payload := []byte{0, 4}
+	clientCipher, _ := client.EncodeForRound(5, true, payload)
+	trusteeCipher := trustee.TrusteeEncodeForRound(5)
+	for _, bitPos := range []int{0, 7, 10, 8*payloadSize - 1} {
+		clientBits, err := client.PadBitsOfRound(5, bitPos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		trusteeBits, err := trustee.PadBitsOfRound(5, bitPos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(clientBits) != 2 || len(trusteeBits) != 2 || clientBits[0] != trusteeBits[0] {
+			t.Error("The client and the trustee should reveal the same bit of their shared pad")
+		}
+
+		clientXOR, trusteeXOR := 0, 0
+		for i := range clientBits {
+			clientXOR ^= clientBits[i]
+			trusteeXOR ^= trusteeBits[i]
+		}
+		payloadBit := 0
+		if bitPos == 10 {
+			payloadBit = 1
+		}
+		if CipherPayloadBit(clientCipher, bitPos) != clientXOR^payloadBit {
+			t.Error("The client's cipher should be its pads XOR its payload at bit", bitPos)
+		}
+		if CipherPayloadBit(trusteeCipher, bitPos) != trusteeXOR {
+			t.Error("The trustee's cipher should be its pads at bit", bitPos)
+		}
+	}
+
+	if _, err := trustee.PadBitsOfRound(5, 8*payloadSize); err == nil {
+		t.Error("There is no bit outside the cells")
+	}
+}
+
+func TestParallelEncoding(t *testing.T) {
+
+	payloadSize := 1001 // not a multiple of the word size
+	for _, equivocation := range []bool{false, true} {
+		keys := randomSharedKeys(7)
+		reference := NewDCNetEntity(0, DCNET_TRUSTEE, payloadSize, equivocation, keys, config.CryptoSuite)
+		reference.SetParallelism(1)
+		expected := DCNetCipherFromBytes(reference.TrusteeEncodeForRound(5)).Payload
+
+		for _, parallelism := range []int{2, 3, 7, 16} {
+			e := NewDCNetEntity(0, DCNET_TRUSTEE, payloadSize, equivocation, keys, config.CryptoSuite)
+			e.SetParallelism(parallelism)
+			if !bytes.Equal(expected, DCNetCipherFromBytes(e.TrusteeEncodeForRound(5)).Payload) {
+				t.Error("Parallelism", parallelism, "changed the pads, equivocation =", equivocation)
+			}
+		}
+	}
+
+	a := randomBytes(13)
+	b := randomBytes(13)
+	expected := make([]byte, 13)
+	for k := range expected {
+		expected[k] = a[k] ^ b[k]
+	}
+	xorBytes(a, b)
+	if !bytes.Equal(a, expected) {
+		t.Error("xorBytes did not XOR correctly")
+	}
+}
+
+func TestConcurrentRoundDecoding(t *testing.T) {
+
+	payloadSize := 100
+	nRounds := int32(4)
+	for _, equivocation := range []bool{false, true} {
+		tg := NewTestGroup(t, equivocation, payloadSize, 3, 2)
+		relay := tg.Relay.DCNetEntity
+		dcNetPayloadSize := payloadSize
+		if equivocation {
+			dcNetPayloadSize -= 16
+		}
+
+		// all rounds are open at the same time, and the ciphers of different rounds are interleaved
+		messages := make([][]byte, nRounds)
+		for r := int32(0); r < nRounds; r++ {
+			messages[r] = randomBytes(dcNetPayloadSize)
+			relay.DecodeStart(r, int(r)%len(tg.Clients))
+		}
+		for j, tr := range tg.Trustees {
+			for r := nRounds - 1; r >= 0; r-- {
+				relay.DecodeTrustee(r, j, tr.DCNetEntity.TrusteeEncodeForRound(r))
+			}
+		}
+		for i, c := range tg.Clients {
+			for r := int32(0); r < nRounds; r++ {
+				owner := int(r)%len(tg.Clients) == i
+				var m []byte
+				if owner {
+					m, _ = c.DCNetEntity.EncodeForSlot(r, int(r)%len(tg.Clients), messages[r])
+				} else {
+					m, _ = c.DCNetEntity.EncodeForSlot(r, int(r)%len(tg.Clients), nil)
+				}
+				relay.DecodeClient(r, i, m)
+				if owner {
+					relay.DecodeClient(r, i, m) // a duplicate is ignored
+				}
+			}
+		}
+
+		// the cells can be decoded in any order
+		for _, r := range []int32{2, 0, 3, 1} {
+			output, _, _ := relay.DecodeCell(r, false)
+			if !bytes.Equal(output, messages[r]) {
+				t.Error("Concurrent decoding failed in round", r, ", equivocation =", equivocation)
+			}
+			if relay.IsDecoding(r) {
+				t.Error("DecodeCell should end the decoding of round", r)
+			}
+		}
+	}
+
+	relay := NewDCNetEntity(0, DCNET_RELAY, payloadSize, false, nil, config.CryptoSuite)
+	relay.DecodeStart(7, -1)
+	relay.DecodeCancel(7)
+	if relay.IsDecoding(7) {
+		t.Error("DecodeCancel should end the decoding of the round")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("DecodeClient should panic for a round which is not being decoded")
+		}
+	}()
+	relay.DecodeClient(7, 0, (&DCNetCipher{Payload: randomBytes(payloadSize)}).ToBytes())
+}
+
+func TestVariableCellSize(t *testing.T) {
+
+	payloadSize := 100
+	sizes := []int{0, 20, 100, 50, 1000, 40}
+	for _, equivocation := range []bool{false, true} {
+		tg := NewTestGroup(t, equivocation, payloadSize, 3, 2)
+		relay := tg.Relay.DCNetEntity
+
+		// each round has its own length, the trustees encode full cells
+		for r := int32(0); r < int32(len(sizes)); r++ {
+			owner := int(r) % len(tg.Clients)
+
+			// in every other round, the trustee ciphers are folded in before the round is opened, and its length known
+			inAdvance := r%2 == 1
+			if inAdvance {
+				for j, tr := range tg.Trustees {
+					relay.DecodeTrusteeInAdvance(r, j, tr.DCNetEntity.TrusteeEncodeForRound(r))
+				}
+				if relay.IsDecoding(r) {
+					t.Error("Round", r, "is not opened yet, only its trustee ciphers are folded in")
+				}
+			}
+
+			relay.SetRoundPayloadSize(r, sizes[r])
+			cellSize := relay.RoundPayloadSize(r)
+			if cellSize != sizes[r] && cellSize != payloadSize {
+				t.Error("Round", r, "should have cells of", sizes[r], "bytes, has", cellSize)
+			}
+			message := randomBytes(cellSize)
+			if equivocation {
+				message = message[:cellSize-16]
+			}
+			relay.DecodeStart(r, owner)
+			if !inAdvance {
+				for j, tr := range tg.Trustees {
+					relay.DecodeTrustee(r, j, tr.DCNetEntity.TrusteeEncodeForRound(r))
+				}
+			}
+			for i, c := range tg.Clients {
+				c.DCNetEntity.SetRoundPayloadSize(r, sizes[r])
+				var m []byte
+				if i == owner {
+					m, _ = c.DCNetEntity.EncodeForSlot(r, owner, message)
+				} else {
+					m, _ = c.DCNetEntity.EncodeForSlot(r, owner, nil)
+				}
+				if len(DCNetCipherFromBytes(m).Payload) != cellSize {
+					t.Error("Client", i, "sent a cell of", len(DCNetCipherFromBytes(m).Payload), "bytes in round", r)
+				}
+				if c.DCNetEntity.RoundPayloadSize(r+1) != payloadSize {
+					t.Error("The length of a round should not change the next ones")
+				}
+				relay.DecodeClient(r, i, m)
+			}
+			output, _, _ := relay.DecodeCell(r, false)
+			if !bytes.Equal(output, message) {
+				t.Error("Decoding a cell of", cellSize, "bytes failed in round", r, ", equivocation =", equivocation)
+			}
+		}
+	}
+}
+
+func TestPadPrecomputation(t *testing.T) {
+
+	payloadSize := 100
+	for _, equivocation := range []bool{false, true} {
+		keys := randomSharedKeys(5)
+		reference := NewDCNetEntity(0, DCNET_TRUSTEE, payloadSize, equivocation, keys, config.CryptoSuite)
+		e := NewDCNetEntity(0, DCNET_TRUSTEE, payloadSize, equivocation, keys, config.CryptoSuite)
+		e.StartPadPrecomputation(4)
+
+		// wait for the buffer to fill up
+		for i := 0; i < 1000 && e.PadPrecomputationStats().Depth < 4; i++ {
+			time.Sleep(time.Millisecond)
+		}
+		if depth := e.PadPrecomputationStats().Depth; depth != 4 {
+			t.Error("The buffer should hold 4 rounds, got", depth)
+		}
+
+		// precomputed pads give the same ciphers, even when rounds are skipped
+		for _, roundID := range []int32{0, 1, 2, 5, 6, 20} {
+			if !sameCipher(reference.TrusteeEncodeForRound(roundID), e.TrusteeEncodeForRound(roundID)) {
+				t.Error("Precomputed pads changed the cipher of round", roundID, ", equivocation =", equivocation)
+			}
+		}
+		stats := e.PadPrecomputationStats()
+		if stats.Hits == 0 || stats.Hits+stats.Misses != 6 {
+			t.Error("Wrong precomputation statistics", stats)
+		}
+
+		// the round 20 was skipped to, the buffer does not hold any older round
+		e.precomputer.Lock()
+		for r := range e.precomputer.buffer {
+			if r <= 20 {
+				t.Error("Round", r, "should have been discarded")
+			}
+		}
+		e.precomputer.Unlock()
+
+		e.StopPadPrecomputation()
+		if e.PadPrecomputationStats().Depth != 0 {
+			t.Error("StopPadPrecomputation should discard the buffered pads")
+		}
+		if !sameCipher(reference.TrusteeEncodeForRound(21), e.TrusteeEncodeForRound(21)) {
+			t.Error("Encoding after StopPadPrecomputation failed")
+		}
+	}
+
+	// clients too, in a full DC-net
+	tg := NewTestGroup(t, false, payloadSize, 3, 2)
+	for _, c := range tg.Clients {
+		c.DCNetEntity.StartPadPrecomputation(2)
+	}
+	for _, tr := range tg.Trustees {
+		tr.DCNetEntity.StartPadPrecomputation(2)
+	}
+	SimulateRounds(t, tg, 10)
+	for _, c := range tg.Clients {
+		c.DCNetEntity.StopPadPrecomputation()
+	}
+	for _, tr := range tg.Trustees {
+		tr.DCNetEntity.StopPadPrecomputation()
+	}
+}
+
+func TestPRGs(t *testing.T) {
+
+	payloadSize := 100
+	var pads [][]byte
+	for _, name := range []string{PRG_XOF, PRG_AES_CTR, PRG_CHACHA20} {
+		prg, err := NewPRG(name, config.CryptoSuite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prg.Name() != name {
+			t.Error("PRG", name, "reports name", prg.Name())
+		}
+
+		for _, equivocation := range []bool{false, true} {
+			tg := NewTestGroup(t, equivocation, payloadSize, 3, 2)
+			tg.Relay.DCNetEntity.SetPRG(prg)
+			for _, c := range tg.Clients {
+				c.DCNetEntity.SetPRG(prg)
+			}
+			for _, tr := range tg.Trustees {
+				tr.DCNetEntity.SetPRG(prg)
+			}
+			SimulateRounds(t, tg, 6)
+
+			if !equivocation {
+				pads = append(pads, tg.Trustees[0].DCNetEntity.RoundPad(config.CryptoSuite.Point().Base(), 0, 0, 1))
+			}
+		}
+	}
+
+	// same secret and round, but different PRGs
+	if bytes.Equal(pads[0], pads[1]) || bytes.Equal(pads[0], pads[2]) || bytes.Equal(pads[1], pads[2]) {
+		t.Error("Different PRGs should give different pads")
+	}
+
+	if prg, err := NewPRG("", config.CryptoSuite); err != nil || prg.Name() != PRG_XOF {
+		t.Error("The default PRG should be the XOF")
+	}
+	if _, err := NewPRG("RC4", config.CryptoSuite); err == nil {
+		t.Error("NewPRG should reject unknown PRGs")
+	}
+}
+
+// the equivocation protection proofs are randomized, only compare the rest of the ciphers
+func sameCipher(a, b []byte) bool {
+	return assertEqual(DCNetCipherFromBytes(a), DCNetCipherFromBytes(b))
+}
+
+func randomSharedKeys(n int) []kyber.Point {
+	keys := make([]kyber.Point, n)
+	for i := range keys {
+		keys[i] = config.CryptoSuite.Point().Pick(config.CryptoSuite.RandomStream())
+	}
+	return keys
+}
+
+// The trustees hold one shared key per client, hence their cost grows with the number of clients
+func BenchmarkTrusteeEncode(b *testing.B) {
+	payloadSize := 5000
+	for _, nClients := range []int{1, 10, 50, 100} {
+		keys := randomSharedKeys(nClients)
+		for _, parallelism := range []int{1, 2, 4, 8} {
+			e := NewDCNetEntity(0, DCNET_TRUSTEE, payloadSize, false, keys, config.CryptoSuite)
+			e.SetParallelism(parallelism)
+			b.Run(fmt.Sprintf("clients=%d/parallelism=%d", nClients, e.parallelism), func(b *testing.B) {
+				b.SetBytes(int64(payloadSize * nClients))
+				for r := 0; r < b.N; r++ {
+					e.TrusteeEncodeForRound(int32(r))
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkClientEncode(b *testing.B) {
+	payloadSize := 5000
+	payload := randomBytes(payloadSize)
+	for _, nTrustees := range []int{1, 5, 10} {
+		keys := randomSharedKeys(nTrustees)
+		for _, parallelism := range []int{1, 2, 4, 8} {
+			e := NewDCNetEntity(0, DCNET_CLIENT, payloadSize, false, keys, config.CryptoSuite)
+			e.SetParallelism(parallelism)
+			b.Run(fmt.Sprintf("trustees=%d/parallelism=%d", nTrustees, e.parallelism), func(b *testing.B) {
+				b.SetBytes(int64(payloadSize * nTrustees))
+				for r := 0; r < b.N; r++ {
+					e.EncodeForRound(int32(r), true, payload)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkRelayDecode(b *testing.B) {
+	payloadSize := 5000
+	relay := NewDCNetEntity(0, DCNET_RELAY, payloadSize, false, nil, config.CryptoSuite)
+	cipher := (&DCNetCipher{Payload: randomBytes(payloadSize)}).ToBytes()
+	for _, nClients := range []int{1, 10, 50, 100} {
+		b.Run(fmt.Sprintf("clients=%d", nClients), func(b *testing.B) {
+			b.SetBytes(int64(payloadSize * nClients))
+			for r := 0; r < b.N; r++ {
+				relay.DecodeStart(int32(r), -1)
+				for i := 0; i < nClients; i++ {
+					relay.DecodeClient(int32(r), i, cipher)
+				}
+				relay.DecodeCell(int32(r), false)
+			}
+		})
+	}
+}
+
+// BenchmarkRelayVerifyEquivocation measures what the equivocation protection costs the relay in each round: the proof
+// of each client and trustee
+func BenchmarkRelayVerifyEquivocation(b *testing.B) {
+	payloadSize := 5000
+	roundID := int32(0)
+	for _, nClients := range []int{1, 10, 50} {
+		tg := NewTestGroup(b, true, payloadSize, nClients, 1)
+		clientCiphers := make([][]byte, nClients)
+		for i, c := range tg.Clients {
+			var payload []byte
+			if i == 0 {
+				payload = randomBytes(payloadSize - 16)
+			}
+			clientCiphers[i], _ = c.DCNetEntity.EncodeForSlot(roundID, 0, payload)
+		}
+		trusteeCipher := tg.Trustees[0].DCNetEntity.TrusteeEncodeForRound(roundID)
+		relay := tg.Relay.DCNetEntity
+		b.Run(fmt.Sprintf("clients=%d", nClients), func(b *testing.B) {
+			for r := 0; r < b.N; r++ {
+				relay.DecodeStart(roundID, 0)
+				for i, cipher := range clientCiphers {
+					if err := relay.DecodeClient(roundID, i, cipher); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if err := relay.DecodeTrustee(roundID, 0, trusteeCipher); err != nil {
+					b.Fatal(err)
+				}
+				if _, _, disruption := relay.DecodeCell(roundID, false); disruption != nil {
+					b.Fatal("Honest round reported as disrupted,", disruption)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPRG(b *testing.B) {
+	payloadSize := 5000
+	keys := randomSharedKeys(10)
+	for _, name := range []string{PRG_XOF, PRG_AES_CTR, PRG_CHACHA20} {
+		prg, _ := NewPRG(name, config.CryptoSuite)
+		e := NewDCNetEntity(0, DCNET_TRUSTEE, payloadSize, false, keys, config.CryptoSuite)
+		e.SetParallelism(1)
+		e.SetPRG(prg)
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(payloadSize * len(keys)))
+			for r := 0; r < b.N; r++ {
+				e.TrusteeEncodeForRound(int32(r))
+			}
+		})
+	}
+}
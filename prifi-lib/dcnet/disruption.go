@@ -0,0 +1,88 @@
+package dcnet
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Why the cell of a round could not be decoded
+type DISRUPTION_TYPE int
+
+const (
+	// The payload of the slot owner failed authentication (equivocation protection): a client or a trustee sent
+	// a wrong cipher, or the ciphers were altered in transit
+	DISRUPTION_AUTHENTICATION_FAILED DISRUPTION_TYPE = iota
+
+	// A cipher of the verifiable DC-net could not be decoded
+	DISRUPTION_INVALID_CIPHER
+
+	// A client or a trustee sent an equivocation protection contribution that is not proven well-formed
+	DISRUPTION_INVALID_PROOF
+)
+
+// DisruptionEvent is returned by DecodeCell when the cell of a round is disrupted. The decoded payload of this
+// round must not be used; the ciphertext is still returned, so that the blame protocol can run on it
+type DisruptionEvent struct {
+	RoundID  int32
+	Type     DISRUPTION_TYPE
+	Err      error // the underlying error, if any
+	Clients  []int // the clients the disruption is attributed to, if known
+	Trustees []int // the trustees the disruption is attributed to, if known
+}
+
+func (d *DisruptionEvent) Error() string {
+	reason := "unknown disruption"
+	switch d.Type {
+	case DISRUPTION_AUTHENTICATION_FAILED:
+		reason = "the payload failed authentication"
+	case DISRUPTION_INVALID_CIPHER:
+		reason = "a cipher is invalid"
+	case DISRUPTION_INVALID_PROOF:
+		reason = "a contribution is not proven well-formed"
+	}
+	s := "round " + strconv.Itoa(int(d.RoundID)) + " is disrupted, " + reason
+	if d.Err != nil {
+		s += " (" + d.Err.Error() + ")"
+	}
+	if len(d.Clients) > 0 {
+		s += ", clients " + fmt.Sprint(d.Clients)
+	}
+	if len(d.Trustees) > 0 {
+		s += ", trustees " + fmt.Sprint(d.Trustees)
+	}
+	return s
+}
+
+// PadBitsOfRound returns bit bitPos (bit bitPos%8 of byte bitPos/8) of the pad shared with each peer in round roundID,
+// so that the relay can tell whose cipher set a bit of the cell. Returns an error if the keys of the round's epoch
+// were erased
+func (e *DCNetEntity) PadBitsOfRound(roundID int32, bitPos int) (map[int]int, error) {
+	if bitPos < 0 || bitPos >= 8*e.DCNetPayloadSize {
+		return nil, errors.New("bit " + strconv.Itoa(bitPos) + " is outside the cells")
+	}
+	if e.seedsOfEpoch(e.EpochOfRound(roundID)) == nil {
+		return nil, errors.New("the keys of epoch " + strconv.Itoa(int(e.EpochOfRound(roundID))) + " were erased")
+	}
+	bits := make(map[int]int)
+	for i, pad := range e.roundPads(roundID) {
+		bits[i] = payloadBit(pad, bitPos)
+	}
+	return bits, nil
+}
+
+// CipherPayloadBit returns bit bitPos of the payload of a cipher, as sent by a client or a trustee
+func CipherPayloadBit(cipher []byte, bitPos int) int {
+	if len(cipher) < 12 {
+		return 0
+	}
+	return payloadBit(DCNetCipherFromBytes(cipher).Payload, bitPos)
+}
+
+// payloadBit returns bit bitPos%8 of byte bitPos/8 of data, 0 if data is too short
+func payloadBit(data []byte, bitPos int) int {
+	if bitPos < 0 || bitPos/8 >= len(data) {
+		return 0
+	}
+	return int(data[bitPos/8]>>uint(bitPos%8)) & 1
+}
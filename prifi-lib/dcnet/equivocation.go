@@ -5,10 +5,13 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
-	"github.com/dedis/prifi/prifi-lib/config"
+	"encoding/binary"
+	"errors"
 	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/proof"
 	"go.dedis.ch/kyber/v3/suites"
 	"go.dedis.ch/onet/v3/log"
+	"strconv"
 )
 
 // Clients compute:
@@ -23,19 +26,46 @@ import (
 //     = SUM_i(h * SUM_j(q_ij)) + k_i - h * SUM_j(SUM_i(q_ij))
 // c = k_i + c'
 //
+// The p_ij are not the DC-net pads, but keystreams derived independently from the same shared secrets (see kdf.go).
+//
+// The payload is encrypted with AES-GCM under k_i; the nonce is derived from the round ID and the history, so that
+// a nonce is never reused across rounds, and a cell replayed in another round, or decoded with another history,
+// fails authentication.
+//
+// Contributions are proven well-formed, so that a wrong contribution can be attributed. With B the base point and
+// H a commitment base whose discrete log w.r.t. B nobody knows, each pad is committed to as Q_ij = q_ij * B + r_ij * H,
+// where the blinding factor r_ij is also derived from the pad; both ends of a pad compute the same commitment.
+//
+// Clients send C_i = SUM_j(Q_ij), and prove that either X_i = kappa_i * B - h * C_i is a multiple of H
+// (i.e., k_i = 0), or that they know the pseudonym private key of the slot owner.
+//
+// Trustees send T_j = SUM_i(Q_ij), and prove that T_j - sigma_j * B is a multiple of H.
+//
+// Relay checks the proofs as the contributions arrive, and that SUM_i(C_i) = SUM_j(T_j); then
+// SUM_i(kappa_i) - h * SUM_j(sigma_j) is the key of the slot owner.
+//
 
 // Equivocation holds the functions needed for equivocation protection
 type EquivocationProtection struct {
-	history    kyber.Scalar
-	randomness kyber.XOF
-	suite      suites.Suite
+	history        kyber.Scalar
+	randomness     kyber.XOF
+	suite          suites.Suite
+	commitmentBase kyber.Point // H
+
+	//The slots, to prove/verify the ownership of a slot
+	pseudonymBase       kyber.Point   // the base of the Neff shuffle output
+	pseudonyms          []kyber.Point // the shuffled ephemeral public keys, one per slot
+	pseudonymPrivateKey kyber.Scalar  //nil if unused
+	mySlot              int           //-1 if unused
 }
 
-// NewEquivocation creates the structure that handle equivocation protection
-func NewEquivocation() *EquivocationProtection {
+// NewEquivocation creates the structure that handle equivocation protection in the given suite
+func NewEquivocation(suite suites.Suite) *EquivocationProtection {
 	e := new(EquivocationProtection)
-	e.suite = config.CryptoSuite
+	e.suite = suite
 	e.history = e.suite.Scalar().One()
+	e.commitmentBase = e.suite.Point().Pick(e.suite.XOF([]byte("PriFi-Equivocation-CommitmentBase")))
+	e.mySlot = -1
 
 	randomKey := make([]byte, 32)
 	rand.Read(randomKey)
@@ -44,6 +74,15 @@ func NewEquivocation() *EquivocationProtection {
 	return e
 }
 
+// SetPseudonyms gives the output of the shuffle. pseudonymPrivateKey and mySlot are only given by clients;
+// trustees and the relay pass nil and -1.
+func (e *EquivocationProtection) SetPseudonyms(pseudonymBase kyber.Point, pseudonyms []kyber.Point, pseudonymPrivateKey kyber.Scalar, mySlot int) {
+	e.pseudonymBase = pseudonymBase
+	e.pseudonyms = pseudonyms
+	e.pseudonymPrivateKey = pseudonymPrivateKey
+	e.mySlot = mySlot
+}
+
 func (e *EquivocationProtection) randomScalar() kyber.Scalar {
 	return e.suite.Scalar().Pick(e.randomness)
 }
@@ -58,25 +97,49 @@ func (e *EquivocationProtection) UpdateHistory(data []byte) {
 	if err != nil {
 		log.Fatal("Could not unmarshall bytes", err)
 	}
-	toBeHashed := make([]byte, len(historyB)+len(data))
+	toBeHashed := make([]byte, 0, len(historyB)+len(data))
+	toBeHashed = append(toBeHashed, historyB...)
+	toBeHashed = append(toBeHashed, data...)
 	newPayload := sha256.Sum256(toBeHashed)
 	e.history.SetBytes(newPayload[:])
 }
 
-// a function that takes a payload x, encrypt it as x' = x + k, and returns x' and kappa = k + history * (sum of the (hashes of pads))
-func (e *EquivocationProtection) ClientEncryptPayload(slotOwner bool, x []byte, p_j [][]byte) ([]byte, []byte) {
-
-	// hash the pads p_i into q_i
-	q_j := make([]kyber.Scalar, len(p_j))
-	for trustee_j := range q_j {
-		q_j[trustee_j] = e.hashInGroup(p_j[trustee_j])
+// the AES-GCM nonce of a round, derived from the round ID and the history
+func (e *EquivocationProtection) nonce(roundID int32) []byte {
+	historyB, err := e.history.MarshalBinary()
+	if err != nil {
+		log.Fatal("Could not marshall the history", err)
 	}
+	roundIDBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(roundIDBytes, uint64(roundID))
+
+	h := sha256.New()
+	h.Write([]byte("prifi-equivocation-nonce"))
+	h.Write(roundIDBytes)
+	h.Write(historyB)
+	return h.Sum(nil)[:12]
+}
 
-	// sum of q_i
+// payloadKey returns the AES key of the payload from the marshalled k_i. It is hashed, since the size of the scalars
+// depends on the suite
+func payloadKey(k []byte) []byte {
+	key := sha256.Sum256(k)
+	return key[:]
+}
+
+// a function that takes a payload x, encrypt it as x' = x + k, and returns x', kappa = k + history * (sum of the (hashes of pads)),
+// and the proof that kappa is well-formed. ownerSlot is the slot owning the round, -1 if nobody owns it
+func (e *EquivocationProtection) ClientEncryptPayload(roundID int32, ownerSlot int, slotOwner bool, x []byte, p_j [][]byte) ([]byte, []byte, []byte) {
+
+	// hash the pads p_i into q_i, and sum them (with their blinding factors)
 	sum := e.suite.Scalar().Zero()
-	for _, p := range q_j {
-		sum = sum.Add(sum, p)
+	blindingSum := e.suite.Scalar().Zero()
+	for trustee_j := range p_j {
+		q, r := e.padScalars(p_j[trustee_j])
+		sum = sum.Add(sum, q)
+		blindingSum = blindingSum.Add(blindingSum, r)
 	}
+	commitment := e.commit(sum, blindingSum)
 
 	product := sum.Mul(sum, e.history)
 
@@ -88,7 +151,7 @@ func (e *EquivocationProtection) ClientEncryptPayload(slotOwner bool, x []byte,
 			log.Fatal("Couldn't marshall", err)
 		}
 
-		return x, kappa_i_bytes
+		return x, kappa_i_bytes, e.ClientProve(roundID, ownerSlot, false, kappa_i, commitment, blindingSum)
 	}
 
 	k_i := e.randomScalar()
@@ -98,50 +161,63 @@ func (e *EquivocationProtection) ClientEncryptPayload(slotOwner bool, x []byte,
 	}
 
 	// encrypt payload
-	// LB->CV: Replace by traditional encryption (AES-GCM or what not) instead of XOR
-
-	block, err := aes.NewCipher(k_i_bytes)
+	block, err := aes.NewCipher(payloadKey(k_i_bytes))
 	if err != nil {
 		panic(err.Error())
 	}
 
-	nonce := make([]byte, 12)
-
 	aesgcm, err := cipher.NewGCM(block)
 	if err != nil {
 		panic(err.Error())
 	}
 
-	x = aesgcm.Seal(nil, nonce, x, nil)
+	x = aesgcm.Seal(nil, e.nonce(roundID), x, nil)
 	// compute kappa
 	kappa_i := k_i.Add(k_i, product)
 	kappa_i_bytes, err := kappa_i.MarshalBinary()
 	if err != nil {
 		log.Fatal("Couldn't marshall", err)
 	}
-	return x, kappa_i_bytes
+	return x, kappa_i_bytes, e.ClientProve(roundID, ownerSlot, true, kappa_i, commitment, blindingSum)
 }
 
-// LB->CV todo
-func (e *EquivocationProtection) ClientProve() []byte {
-
-	return nil
+// ClientProve proves that kappa_i = k_i + history * q_i, where q_i is committed to in C_i = q_i * B + r_i * H,
+// and that either k_i = 0, or we own the slot. The proof carries C_i
+func (e *EquivocationProtection) ClientProve(roundID int32, ownerSlot int, slotOwner bool, kappa kyber.Scalar, commitment kyber.Point, blindingSum kyber.Scalar) []byte {
+	pred := e.clientPredicate(ownerSlot)
+	sval := make(map[string]kyber.Scalar)
+	choice := make(map[proof.Predicate]int)
+	if slotOwner {
+		if e.pseudonymPrivateKey == nil || ownerSlot != e.mySlot {
+			log.Fatal("Equivocation: cannot prove the ownership of slot", ownerSlot)
+		}
+		sval["e"] = e.pseudonymPrivateKey
+		choice[pred] = 1
+	} else {
+		// X = - history * r_i * H
+		sval["x"] = e.suite.Scalar().Neg(e.suite.Scalar().Mul(e.history, blindingSum))
+		choice[pred] = 0
+	}
+	prover := pred.Prover(e.suite, sval, e.clientPublicPoints(ownerSlot, e.clientX(kappa, commitment)), choice)
+	nizk, err := proof.HashProve(e.suite, equivocationProtocolName("Client", roundID), prover)
+	if err != nil {
+		log.Fatal("Could not prove the equivocation contribution", err)
+	}
+	return marshalEquivocationProof(commitment, nizk)
 }
 
-// a function that takes returns the byte[] version of sigma_j
-func (e *EquivocationProtection) TrusteeGetContribution(s_i [][]byte) []byte {
-
-	// hash the pads p_i into q_i
-	q_i := make([]kyber.Scalar, len(s_i))
-	for client_i := range q_i {
-		q_i[client_i] = e.hashInGroup(s_i[client_i])
-	}
+// a function that takes returns the byte[] version of sigma_j, and the proof that it is well-formed
+func (e *EquivocationProtection) TrusteeGetContribution(roundID int32, s_i [][]byte) ([]byte, []byte) {
 
-	// sum of q_i
+	// hash the pads p_i into q_i, and sum them (with their blinding factors)
 	sum := e.suite.Scalar().Zero()
-	for _, p := range q_i {
-		sum = sum.Add(sum, p)
+	blindingSum := e.suite.Scalar().Zero()
+	for client_i := range s_i {
+		q, r := e.padScalars(s_i[client_i])
+		sum = sum.Add(sum, q)
+		blindingSum = blindingSum.Add(blindingSum, r)
 	}
+	commitment := e.commit(sum, blindingSum)
 
 	kappa_j := sum
 
@@ -149,17 +225,127 @@ func (e *EquivocationProtection) TrusteeGetContribution(s_i [][]byte) []byte {
 	if err != nil {
 		log.Fatal("Couldn't marshall", err)
 	}
-	return kappa_j_bytes
+	return kappa_j_bytes, e.TrusteeProve(roundID, kappa_j, commitment, blindingSum)
 }
 
-// LB->CV todo
-func (e *EquivocationProtection) TrusteeProve() []byte {
+// TrusteeProve proves that sigma_j = SUM_i(q_ij), where the q_ij are committed to in T_j = SUM_i(q_ij) * B + SUM_i(r_ij) * H,
+// by proving that T_j - sigma_j * B = SUM_i(r_ij) * H. The proof carries T_j
+func (e *EquivocationProtection) TrusteeProve(roundID int32, sigma kyber.Scalar, commitment kyber.Point, blindingSum kyber.Scalar) []byte {
+	pred := proof.Rep("Y", "r", "H")
+	sval := map[string]kyber.Scalar{"r": blindingSum}
+	pval := map[string]kyber.Point{"Y": e.trusteeY(sigma, commitment), "H": e.commitmentBase}
+	prover := pred.Prover(e.suite, sval, pval, nil)
+	nizk, err := proof.HashProve(e.suite, equivocationProtocolName("Trustee", roundID), prover)
+	if err != nil {
+		log.Fatal("Could not prove the equivocation contribution", err)
+	}
+	return marshalEquivocationProof(commitment, nizk)
+}
+
+// VerifyClientContribution checks the proof of a client's kappa_i. Returns the client's commitment C_i; the sum of
+// the clients' commitments should match the sum of the trustees' commitments
+func (e *EquivocationProtection) VerifyClientContribution(roundID int32, ownerSlot int, kappa []byte, equivocationProof []byte) (kyber.Point, error) {
+	commitment, nizk, err := e.unmarshalEquivocationProof(equivocationProof)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	X := e.clientX(e.suite.Scalar().SetBytes(kappa), commitment)
+	verifier := e.clientPredicate(ownerSlot).Verifier(e.suite, e.clientPublicPoints(ownerSlot, X))
+	if err := proof.HashVerify(e.suite, equivocationProtocolName("Client", roundID), verifier, nizk); err != nil {
+		return nil, err
+	}
+	return commitment, nil
 }
 
-// given all contributions, decodes the payload
-func (e *EquivocationProtection) RelayDecode(encryptedPayload []byte, trusteesContributions [][]byte, clientsContributions [][]byte) []byte {
+// VerifyTrusteeContribution checks the proof of a trustee's sigma_j. Returns the trustee's commitment T_j
+func (e *EquivocationProtection) VerifyTrusteeContribution(roundID int32, sigma []byte, equivocationProof []byte) (kyber.Point, error) {
+	commitment, nizk, err := e.unmarshalEquivocationProof(equivocationProof)
+	if err != nil {
+		return nil, err
+	}
+
+	pval := map[string]kyber.Point{"Y": e.trusteeY(e.suite.Scalar().SetBytes(sigma), commitment), "H": e.commitmentBase}
+	verifier := proof.Rep("Y", "r", "H").Verifier(e.suite, pval)
+	if err := proof.HashVerify(e.suite, equivocationProtocolName("Trustee", roundID), verifier, nizk); err != nil {
+		return nil, err
+	}
+	return commitment, nil
+}
+
+// the statement proven by the clients: either X = x * H (k_i = 0), or they know the private key of the owner's pseudonym
+func (e *EquivocationProtection) clientPredicate(ownerSlot int) proof.Predicate {
+	noKey := proof.Rep("X", "x", "H")
+	if ownerSlot < 0 || ownerSlot >= len(e.pseudonyms) {
+		// if nobody owns the slot, nobody may encrypt
+		return noKey
+	}
+	return proof.Or(noKey, proof.Rep("P", "e", "G"))
+}
+
+// X = kappa_i * B - history * C_i
+func (e *EquivocationProtection) clientX(kappa kyber.Scalar, commitment kyber.Point) kyber.Point {
+	X := e.suite.Point().Mul(kappa, nil)
+	return X.Sub(X, e.suite.Point().Mul(e.history, commitment))
+}
+
+// Y = T_j - sigma_j * B
+func (e *EquivocationProtection) trusteeY(sigma kyber.Scalar, commitment kyber.Point) kyber.Point {
+	Y := e.suite.Point().Mul(sigma, nil)
+	return Y.Sub(commitment, Y)
+}
+
+func (e *EquivocationProtection) clientPublicPoints(ownerSlot int, X kyber.Point) map[string]kyber.Point {
+	pval := map[string]kyber.Point{"X": X, "H": e.commitmentBase}
+	if ownerSlot >= 0 && ownerSlot < len(e.pseudonyms) {
+		pval["P"] = e.pseudonyms[ownerSlot]
+		pval["G"] = e.pseudonymBase
+	}
+	return pval
+}
+
+func equivocationProtocolName(entity string, roundID int32) string {
+	return "PriFi-Equivocation-" + entity + "-" + strconv.Itoa(int(roundID))
+}
+
+// q_ij = H(p_ij) in group, and the blinding factor r_ij of its commitment
+func (e *EquivocationProtection) padScalars(pad []byte) (kyber.Scalar, kyber.Scalar) {
+	h := sha256.New()
+	h.Write([]byte("prifi-equivocation-blinding"))
+	h.Write(pad)
+	return e.hashInGroup(pad), e.hashInGroup(h.Sum(nil))
+}
+
+// commit returns q * B + r * H
+func (e *EquivocationProtection) commit(q, r kyber.Scalar) kyber.Point {
+	c := e.suite.Point().Mul(q, nil)
+	return c.Add(c, e.suite.Point().Mul(r, e.commitmentBase))
+}
+
+// an equivocation proof is encoded as the commitment, followed by the NIZK
+func marshalEquivocationProof(commitment kyber.Point, nizk []byte) []byte {
+	out, err := commitment.MarshalBinary()
+	if err != nil {
+		log.Fatal("Couldn't marshall", err)
+	}
+	return append(out, nizk...)
+}
+
+func (e *EquivocationProtection) unmarshalEquivocationProof(data []byte) (kyber.Point, []byte, error) {
+	pointSize := e.suite.PointLen()
+	if len(data) < pointSize {
+		return nil, nil, errors.New("equivocation proof too short")
+	}
+	commitment := e.suite.Point()
+	if err := commitment.UnmarshalBinary(data[:pointSize]); err != nil {
+		return nil, nil, errors.New("invalid commitment: " + err.Error())
+	}
+	return commitment, data[pointSize:], nil
+}
+
+// given all contributions, decodes the payload. Returns an error if the payload fails authentication, i.e., if a
+// cipher or a contribution was altered
+func (e *EquivocationProtection) RelayDecode(roundID int32, encryptedPayload []byte, trusteesContributions [][]byte, clientsContributions [][]byte) ([]byte, error) {
 
 	//reconstitute the abstract.Point values
 	trustee_kappa_j := make([]kyber.Scalar, len(trusteesContributions))
@@ -207,13 +393,11 @@ func (e *EquivocationProtection) RelayDecode(encryptedPayload []byte, trusteesCo
 		log.Lvl1("history:", e.history)
 		log.Lvl1("prod:", prod)
 		log.Lvl1("k_i:", k_i)
-		return make([]byte, 0)
+		return nil, errors.New("could not recover the key of the slot owner")
 	}
 
 	// decrypt the payload
-	nonce := make([]byte, 12)
-
-	block, err := aes.NewCipher(k_bytes)
+	block, err := aes.NewCipher(payloadKey(k_bytes))
 	if err != nil {
 		panic(err.Error())
 	}
@@ -223,11 +407,10 @@ func (e *EquivocationProtection) RelayDecode(encryptedPayload []byte, trusteesCo
 		panic(err.Error())
 	}
 
-	message, err := aesgcm.Open(nil, nonce, encryptedPayload, nil)
+	message, err := aesgcm.Open(nil, e.nonce(roundID), encryptedPayload, nil)
 	if err != nil {
-		//TODO: Bubble up this disruption in the client
-		message = make([]byte, len(encryptedPayload)-16)
+		return nil, err
 	}
 
-	return message
+	return message, nil
 }
@@ -13,6 +13,9 @@ func TestEquivocation(t *testing.T) {
 
 	rangeTest := []int{100, 1000, 10000}
 	repeat := 100
+	if testing.Short() {
+		repeat = 10
+	}
 
 	for _, dataLen := range rangeTest {
 		log.Lvl1("Testing for data length", dataLen)
@@ -25,9 +28,9 @@ func TestEquivocation(t *testing.T) {
 func equivocationTestForDataLength(t *testing.T, payloadSize int) {
 
 	// set up the Shared secrets
-	tpub, _ := crypto.NewKeyPair()
-	_, c1priv := crypto.NewKeyPair()
-	_, c2priv := crypto.NewKeyPair()
+	tpub, _ := crypto.NewKeyPair(config.CryptoSuite)
+	_, c1priv := crypto.NewKeyPair(config.CryptoSuite)
+	_, c2priv := crypto.NewKeyPair(config.CryptoSuite)
 
 	sharedSecret_c1 := make([]kyber.Point, 1)
 	sharedSecret_c1[0] = config.CryptoSuite.Point().Mul(c1priv, tpub)
@@ -39,9 +42,9 @@ func equivocationTestForDataLength(t *testing.T, payloadSize int) {
 	sharedSecrets_t[1] = config.CryptoSuite.Point().Mul(c2priv, tpub)
 
 	// set up the DC-nets
-	dcnet_Trustee := NewDCNetEntity(0, DCNET_TRUSTEE, payloadSize, false, sharedSecrets_t)
-	dcnet_Client1 := NewDCNetEntity(0, DCNET_CLIENT, payloadSize, false, sharedSecret_c1)
-	dcnet_Client2 := NewDCNetEntity(1, DCNET_CLIENT, payloadSize, false, sharedSecret_c2)
+	dcnet_Trustee := NewDCNetEntity(0, DCNET_TRUSTEE, payloadSize, false, sharedSecrets_t, config.CryptoSuite)
+	dcnet_Client1 := NewDCNetEntity(0, DCNET_CLIENT, payloadSize, false, sharedSecret_c1, config.CryptoSuite)
+	dcnet_Client2 := NewDCNetEntity(1, DCNET_CLIENT, payloadSize, false, sharedSecret_c2, config.CryptoSuite)
 
 	data := randomBytes(payloadSize)
 
@@ -70,10 +73,10 @@ func equivocationTestForDataLength(t *testing.T, payloadSize int) {
 
 	payload := randomBytes(payloadSize)
 
-	e_client0 := NewEquivocation()
-	e_client1 := NewEquivocation()
-	e_trustee := NewEquivocation()
-	e_relay := NewEquivocation()
+	e_client0 := NewEquivocation(config.CryptoSuite)
+	e_client1 := NewEquivocation(config.CryptoSuite)
+	e_trustee := NewEquivocation(config.CryptoSuite)
+	e_relay := NewEquivocation(config.CryptoSuite)
 
 	// set some data as downstream history
 
@@ -85,20 +88,60 @@ func equivocationTestForDataLength(t *testing.T, payloadSize int) {
 	e_trustee.UpdateHistory(historyBytes)
 	e_relay.UpdateHistory(historyBytes)
 
+	// client 0 owns slot 0
+	G := config.CryptoSuite.Point().Pick(config.CryptoSuite.RandomStream())
+	e0 := config.CryptoSuite.Scalar().Pick(config.CryptoSuite.RandomStream())
+	e1 := config.CryptoSuite.Scalar().Pick(config.CryptoSuite.RandomStream())
+	pseudonyms := []kyber.Point{config.CryptoSuite.Point().Mul(e0, G), config.CryptoSuite.Point().Mul(e1, G)}
+	e_client0.SetPseudonyms(G, pseudonyms, e0, 0)
+	e_client1.SetPseudonyms(G, pseudonyms, e1, 1)
+	e_relay.SetPseudonyms(G, pseudonyms, nil, -1)
+
 	// start the actual equivocation
 
 	pads1 := make([][]byte, 1)
 	pads1[0] = padRound1_c1.Payload
-	x_prim1, kappa1 := e_client0.ClientEncryptPayload(true, payload, pads1)
+	x_prim1, kappa1, proof1 := e_client0.ClientEncryptPayload(0, 0, true, payload, pads1)
 
 	pads2 := make([][]byte, 1)
 	pads2[0] = padRound1_c2.Payload
-	_, kappa2 := e_client1.ClientEncryptPayload(false, nil, pads2)
+	_, kappa2, proof2 := e_client1.ClientEncryptPayload(0, 0, false, nil, pads2)
 
 	pads3 := make([][]byte, 2)
 	pads3[0] = padRound1_c1.Payload
 	pads3[1] = padRound1_c2.Payload
-	sigma := e_trustee.TrusteeGetContribution(pads3)
+	sigma, trusteeProof := e_trustee.TrusteeGetContribution(0, pads3)
+
+	// the relay checks the contributions
+	C1, err := e_relay.VerifyClientContribution(0, 0, kappa1, proof1)
+	if err != nil {
+		t.Fatal("The slot owner's contribution should verify,", err)
+	}
+	C2, err := e_relay.VerifyClientContribution(0, 0, kappa2, proof2)
+	if err != nil {
+		t.Fatal("The contribution of client 1 should verify,", err)
+	}
+	T, err := e_relay.VerifyTrusteeContribution(0, sigma, trusteeProof)
+	if err != nil {
+		t.Fatal("The trustee's contribution should verify,", err)
+	}
+	if !config.CryptoSuite.Point().Add(C1, C2).Equal(T) {
+		t.Error("The commitments of the clients and the trustee should match")
+	}
+
+	// the proofs are bound to the contributions, the round and the slot owner
+	if _, err := e_relay.VerifyClientContribution(0, 0, kappa2, proof1); err == nil {
+		t.Error("A proof should not verify for another contribution")
+	}
+	if _, err := e_relay.VerifyClientContribution(1, 0, kappa1, proof1); err == nil {
+		t.Error("A proof should not verify in another round")
+	}
+	if _, err := e_relay.VerifyClientContribution(0, 1, kappa1, proof1); err == nil {
+		t.Error("The slot owner's proof should not verify if somebody else owns the slot")
+	}
+	if _, err := e_relay.VerifyTrusteeContribution(0, kappa1, trusteeProof); err == nil {
+		t.Error("A proof should not verify for another contribution")
+	}
 
 	// relay decodes
 	trusteesContrib := make([][]byte, 1)
@@ -108,11 +151,100 @@ func equivocationTestForDataLength(t *testing.T, payloadSize int) {
 	clientContrib[0] = kappa1
 	clientContrib[1] = kappa2
 
-	payloadPlaintext := e_relay.RelayDecode(x_prim1, trusteesContrib, clientContrib)
+	payloadPlaintext, err := e_relay.RelayDecode(0, x_prim1, trusteesContrib, clientContrib)
+	if err != nil {
+		t.Fatal("RelayDecode failed,", err)
+	}
 
 	if bytes.Compare(payload, payloadPlaintext) != 0 {
 		log.Lvl1(payload)
 		log.Lvl1(payloadPlaintext)
 		t.Error("payloads don't match")
 	}
+
+	// the nonce is bound to the round, the same cell does not decode in another round
+	if _, err := e_relay.RelayDecode(1, x_prim1, trusteesContrib, clientContrib); err == nil {
+		t.Error("A cell should not decode in another round")
+	}
+}
+
+func TestEquivocationDisruption(t *testing.T) {
+
+	payloadSize := 100
+	tg := NewTestGroup(t, true, payloadSize, 2, 2)
+	message := randomBytes(payloadSize - 16)
+
+	for roundID := int32(0); roundID < 4; roundID++ {
+		tg.Relay.DCNetEntity.DecodeStart(roundID, 0)
+		for i, c := range tg.Clients {
+			var m []byte
+			if i == 0 {
+				m, _ = c.DCNetEntity.EncodeForSlot(roundID, 0, message)
+			} else {
+				m, _ = c.DCNetEntity.EncodeForSlot(roundID, 0, nil)
+			}
+			if roundID == 1 && i == 1 {
+				// client 1 flips a bit in the slot of client 0
+				m[len(m)-1] ^= 1
+			}
+			if roundID == 2 && i == 1 {
+				// client 1 adds a key to its contribution
+				c := DCNetCipherFromBytes(m)
+				c.EquivocationProtectionTag[0] ^= 1
+				m = c.ToBytes()
+			}
+			err := tg.Relay.DCNetEntity.DecodeClient(roundID, i, m)
+			if (err != nil) != (roundID == 2 && i == 1) {
+				t.Error("Wrong verification of the contribution of client", i, "in round", roundID, err)
+			}
+		}
+		for j, tr := range tg.Trustees {
+			m := tr.DCNetEntity.TrusteeEncodeForRound(roundID)
+			if roundID == 3 && j == 1 {
+				// trustee 1 sends a wrong contribution
+				c := DCNetCipherFromBytes(m)
+				c.EquivocationProtectionTag[0] ^= 1
+				m = c.ToBytes()
+			}
+			err := tg.Relay.DCNetEntity.DecodeTrustee(roundID, j, m)
+			if (err != nil) != (roundID == 3 && j == 1) {
+				t.Error("Wrong verification of the contribution of trustee", j, "in round", roundID, err)
+			}
+		}
+
+		output, ciphertext, disruption := tg.Relay.DCNetEntity.DecodeCell(roundID, false)
+		if roundID == 0 {
+			if disruption != nil || !bytes.Equal(output, message) {
+				t.Error("Honest round 0 should decode,", disruption)
+			}
+			continue
+		}
+		if disruption == nil {
+			t.Fatal("The disruption of round", roundID, "should be reported")
+		}
+		if output != nil {
+			t.Error("A disrupted round should not produce an output")
+		}
+		if len(ciphertext) != payloadSize {
+			t.Error("The ciphertext of a disrupted round should still be returned for the blame")
+		}
+
+		switch roundID {
+		case 1:
+			if disruption.Type != DISRUPTION_AUTHENTICATION_FAILED || len(disruption.Clients) != 0 {
+				t.Error("Wrong disruption event", disruption)
+			}
+		case 2:
+			if disruption.Type != DISRUPTION_INVALID_PROOF || len(disruption.Clients) != 1 || disruption.Clients[0] != 1 {
+				t.Error("The disruption should be attributed to client 1,", disruption)
+			}
+		case 3:
+			if disruption.Type != DISRUPTION_INVALID_PROOF || len(disruption.Trustees) != 1 || disruption.Trustees[0] != 1 {
+				t.Error("The disruption should be attributed to trustee 1,", disruption)
+			}
+		}
+		if disruption.RoundID != roundID {
+			t.Error("Wrong round in the disruption event", disruption)
+		}
+	}
 }
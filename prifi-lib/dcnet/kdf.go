@@ -0,0 +1,98 @@
+package dcnet
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/crypto/hkdf"
+)
+
+// KDF_VERSION is the version of the key derivation; it is mixed into every seed, so that a change of the derivation
+// never yields the pads of a previous version
+const KDF_VERSION = 1
+
+// length of the seeds derived from the shared secrets
+const seedLength = 32
+
+// domain of the seeds of the equivocation protection; the DC-net pads use padDomain and verifiablePadDomain
+const equivocationPadDomain = "PriFi-Equivocation-pad"
+
+// SessionContext is the public context the shared secrets are bound to. All the members of the DC-net must use the
+// same one. Two sessions with different nonces never share pads, even between the same client and trustee
+type SessionContext struct {
+	Nonce       []byte // chosen by the relay for each session
+	EpochLength int32  // number of rounds of a key epoch (see ratchet.go), 0 if the keys are never ratcheted
+}
+
+// NewSessionNonce returns a random session nonce, to be chosen by the relay and sent to the clients and trustees
+func NewSessionNonce() []byte {
+	nonce := make([]byte, seedLength)
+	if _, err := rand.Read(nonce); err != nil {
+		log.Fatal("Could not generate a session nonce", err)
+	}
+	return nonce
+}
+
+// DeriveSeed derives, from the secret shared by a client and a trustee, the seed of the keystreams of the given domain
+// in a key epoch. The secret is bound to the session by K_0 = HKDF-SHA256(secret, salt=nonce, info=ratchet|0), the
+// chain key of the next epoch is K_e+1 = HKDF-SHA256(K_e, info=ratchet|e+1), and the seed is HKDF-SHA256(K_e,
+// info=domain|e). The info also contains the version, the clientID and the trusteeID
+func DeriveSeed(sharedKey kyber.Point, ctx SessionContext, domain string, epoch int32, clientID, trusteeID int) []byte {
+	key := firstChainKey(sharedKey, ctx, clientID, trusteeID)
+	for e := int32(0); e < epoch; e++ {
+		key = nextChainKey(key, e, clientID, trusteeID)
+	}
+	return epochSeed(key, domain, epoch, clientID, trusteeID)
+}
+
+// deriveKey returns HKDF-SHA256(secret, salt, info=domain|version|epoch|clientID|trusteeID)
+func deriveKey(secret, salt []byte, domain string, epoch int32, clientID, trusteeID int) []byte {
+	info := make([]byte, 0, len(domain)+16)
+	info = append(info, []byte(domain)...)
+	var b [4]byte
+	for _, v := range []uint32{KDF_VERSION, uint32(epoch), uint32(clientID), uint32(trusteeID)} {
+		binary.BigEndian.PutUint32(b[:], v)
+		info = append(info, b[:]...)
+	}
+
+	key := make([]byte, seedLength)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, info), key); err != nil {
+		log.Fatal("Could not derive a seed", err)
+	}
+	return key
+}
+
+// the chain key of epoch 0, bound to the session
+func firstChainKey(sharedKey kyber.Point, ctx SessionContext, clientID, trusteeID int) []byte {
+	return deriveKey(marshalSharedKey(sharedKey), ctx.Nonce, ratchetDomain, 0, clientID, trusteeID)
+}
+
+// the chain key of epoch+1, from the one of epoch. The previous key cannot be computed back
+func nextChainKey(chainKey []byte, epoch int32, clientID, trusteeID int) []byte {
+	return deriveKey(chainKey, nil, ratchetDomain, epoch+1, clientID, trusteeID)
+}
+
+// the seed of the keystreams of a domain in an epoch, from the chain key of that epoch
+func epochSeed(chainKey []byte, domain string, epoch int32, clientID, trusteeID int) []byte {
+	return deriveKey(chainKey, nil, domain, epoch, clientID, trusteeID)
+}
+
+// SetSessionContext binds the shared secrets to the session, and restarts the key ratchet. All the members of the
+// DC-net must use the same context, and it must be set before the first round is encoded (or the pad precomputation
+// started)
+func (e *DCNetEntity) SetSessionContext(ctx SessionContext) {
+	e.sessionContext = ctx
+	e.resetRatchet()
+}
+
+// the IDs of the client and trustee sharing sharedKeys[i]
+func (e *DCNetEntity) peerIDs(i int) (clientID, trusteeID int) {
+	if e.Entity == DCNET_CLIENT {
+		return e.EntityID, i
+	}
+	return i, e.EntityID
+}
@@ -0,0 +1,59 @@
+package dcnet
+
+import (
+	"bytes"
+	"testing"
+)
+
+func setSessionContext(tg *TestGroup, ctx SessionContext) {
+	tg.Relay.DCNetEntity.SetSessionContext(ctx)
+	for _, c := range tg.Clients {
+		c.DCNetEntity.SetSessionContext(ctx)
+	}
+	for _, tr := range tg.Trustees {
+		tr.DCNetEntity.SetSessionContext(ctx)
+	}
+}
+
+func TestSessionContext(t *testing.T) {
+
+	payloadSize := 100
+	tg := NewTestGroup(t, true, payloadSize, 2, 2)
+	client := tg.Clients[0].DCNetEntity
+	trustee := tg.Trustees[1].DCNetEntity
+
+	ctx := SessionContext{Nonce: NewSessionNonce()}
+	setSessionContext(tg, ctx)
+	SimulateRounds(t, tg, 3)
+
+	// both ends of a shared secret derive the same seeds, and the keystreams of each use are independent
+	cs, ts := client.seedsOfEpoch(0), trustee.seedsOfEpoch(0)
+	if !bytes.Equal(cs.pad[1], ts.pad[0]) || !bytes.Equal(cs.equivocation[1], ts.equivocation[0]) {
+		t.Error("Client 0 and trustee 1 should derive the same seeds")
+	}
+	if bytes.Equal(cs.pad[1], cs.equivocation[1]) || bytes.Equal(cs.pad[1], cs.verifiable[1]) {
+		t.Error("The pads and the equivocation protection should use independent seeds")
+	}
+	if bytes.Equal(ts.pad[0], ts.pad[1]) {
+		t.Error("Two peers should not share the same seed")
+	}
+
+	// the relay re-derives the pad of a client and a trustee for the blame
+	if !bytes.Equal(tg.Relay.DCNetEntity.RoundPad(trustee.sharedKeys[0], 0, 1, 5), trustee.roundPads(5)[0]) {
+		t.Error("The relay should derive the same pad as trustee 1")
+	}
+
+	// the same secrets give other pads in another session
+	pad := trustee.roundPads(5)[0]
+	setSessionContext(tg, SessionContext{Nonce: NewSessionNonce()})
+	if bytes.Equal(pad, trustee.roundPads(5)[0]) {
+		t.Error("Pads should not be reused in another session")
+	}
+	SimulateRounds(t, tg, 3)
+
+	// the derivation is deterministic
+	setSessionContext(tg, ctx)
+	if !bytes.Equal(pad, trustee.roundPads(5)[0]) {
+		t.Error("The same context should give the same pads")
+	}
+}
@@ -0,0 +1,145 @@
+package dcnet
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"runtime"
+	"sync"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// domains separating the DC-net pads from any other use of the shared secrets
+const (
+	padDomain           = "PriFi-DCNet-pad"
+	verifiablePadDomain = "PriFi-VerifiableDCNet-pad"
+)
+
+// RoundPad returns the pad derived from the key shared by a client and a trustee, for round roundID, in this
+// entity's session. The pad only depends on (sharedKey, session, IDs, roundID), hence any round can be (re-)computed
+// directly, without generating the pads of the previous rounds; the key is ratcheted up to the epoch of the round.
+func (e *DCNetEntity) RoundPad(sharedKey kyber.Point, clientID, trusteeID int, roundID int32) []byte {
+	seed := DeriveSeed(sharedKey, e.sessionContext, padDomain, e.EpochOfRound(roundID), clientID, trusteeID)
+	return e.EpochRoundPad(seed, roundID)
+}
+
+func marshalSharedKey(sharedKey kyber.Point) []byte {
+	key, err := sharedKey.MarshalBinary()
+	if err != nil {
+		log.Fatal("Could not extract data from shared key", err)
+	}
+	return key
+}
+
+// roundStream returns the PRG's keystream for the domain, the seed derived from the shared secret and the round number
+func (e *DCNetEntity) roundStream(domain string, key []byte, roundID int32) cipher.Stream {
+	seed := make([]byte, 0, len(domain)+len(key)+8)
+	seed = append(seed, []byte(domain)...)
+	seed = append(seed, key...)
+	roundBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(roundBytes, uint64(int64(roundID)))
+	seed = append(seed, roundBytes...)
+	return e.prg.Stream(seed)
+}
+
+// SetPRG sets the PRG generating the pads. All the members of the DC-net must use the same one
+func (e *DCNetEntity) SetPRG(prg PRG) {
+	e.prg = prg
+}
+
+// SetParallelism sets the number of goroutines used to generate the pads; 0 means one per CPU
+func (e *DCNetEntity) SetParallelism(parallelism int) {
+	if parallelism <= 0 {
+		parallelism = runtime.NumCPU()
+	}
+	e.parallelism = parallelism
+}
+
+// forEachPeer calls fn(i) for every peer, spreading the peers over at most e.parallelism goroutines.
+// fn receives the index of the goroutine, in [0, workers)
+func (e *DCNetEntity) forEachPeer(fn func(worker, i int)) (workers int) {
+	n := len(e.sharedKeys)
+	workers = e.parallelism
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			fn(0, i)
+		}
+		return 1
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < n; i += workers {
+				fn(w, i)
+			}
+		}(w)
+	}
+	wg.Wait()
+	return workers
+}
+
+// roundPads returns the pads shared with each peer for round roundID
+func (e *DCNetEntity) roundPads(roundID int32) [][]byte {
+	seeds := e.seedsOfRound(roundID)
+	p_ij := make([][]byte, len(e.sharedKeys))
+	e.forEachPeer(func(worker, i int) {
+		p_ij[i] = make([]byte, e.DCNetPayloadSize)
+		e.roundStream(padDomain, seeds.pad[i], roundID).XORKeyStream(p_ij[i], p_ij[i])
+	})
+	return p_ij
+}
+
+// equivocationRoundPads returns the inputs of the equivocation protection shared with each peer for round roundID.
+// Those are independent of the pads
+func (e *DCNetEntity) equivocationRoundPads(roundID int32) [][]byte {
+	seeds := e.seedsOfRound(roundID)
+	p_ij := make([][]byte, len(e.sharedKeys))
+	for i := range p_ij {
+		p_ij[i] = make([]byte, seedLength)
+		e.roundStream(equivocationPadDomain, seeds.equivocation[i], roundID).XORKeyStream(p_ij[i], p_ij[i])
+	}
+	return p_ij
+}
+
+// xorRoundPads XORs the pads shared with every peer for round roundID into dst.
+// Each goroutine accumulates its pads in its own buffer, those are combined at the end.
+func (e *DCNetEntity) xorRoundPads(dst []byte, roundID int32) {
+	workers := e.parallelism
+	if workers > len(e.sharedKeys) {
+		workers = len(e.sharedKeys)
+	}
+	if workers < 1 {
+		return
+	}
+	seeds := e.seedsOfRound(roundID)
+	accumulators := make([][]byte, workers)
+	for w := range accumulators {
+		accumulators[w] = make([]byte, len(dst))
+	}
+	e.forEachPeer(func(worker, i int) {
+		// XORKeyStream XORs the pad into the accumulator directly
+		e.roundStream(padDomain, seeds.pad[i], roundID).XORKeyStream(accumulators[worker], accumulators[worker])
+	})
+	for _, acc := range accumulators {
+		xorBytes(dst, acc)
+	}
+}
+
+// xorBytes computes dst ^= src, one machine word at a time. len(src) must be >= len(dst)
+func xorBytes(dst, src []byte) {
+	n := len(dst)
+	words := n - n%8
+	for k := 0; k < words; k += 8 {
+		binary.LittleEndian.PutUint64(dst[k:], binary.LittleEndian.Uint64(dst[k:])^binary.LittleEndian.Uint64(src[k:]))
+	}
+	for k := words; k < n; k++ {
+		dst[k] ^= src[k]
+	}
+}
@@ -0,0 +1,177 @@
+package dcnet
+
+import (
+	"fmt"
+	"sync"
+)
+
+// padPrecomputer generates the pads of the next rounds in the background, so that EncodeForRound only has to XOR them.
+// Pads do not depend on the payload, hence they can be computed while the entity waits for the next round.
+type padPrecomputer struct {
+	sync.Mutex
+	cond *sync.Cond
+
+	capacity  int                        // maximum number of rounds buffered
+	nextRound int32                      // the next round to precompute
+	lastTaken int32                      // the last round used by the encoder, older rounds are never needed again
+	buffer    map[int32]*precomputedPads // roundID -> pads
+	stopped   bool
+
+	hits     int64 // rounds encoded with precomputed pads
+	misses   int64 // rounds whose pads were computed inline
+	depthSum int64 // sum of the buffer depths seen by the encoder
+}
+
+// the pads of one round: their XOR, and the inputs of the equivocation protection if it is enabled
+type precomputedPads struct {
+	sum          []byte
+	equivocation [][]byte
+}
+
+// PadPrecomputationStats reports on the pad precomputation buffer
+type PadPrecomputationStats struct {
+	Depth     int     // number of rounds currently buffered
+	Capacity  int     // maximum number of rounds buffered
+	MeanDepth float64 // average number of rounds buffered when a round is encoded
+	Hits      int64   // rounds encoded with precomputed pads
+	Misses    int64   // rounds whose pads were computed on the critical path
+}
+
+func (s PadPrecomputationStats) String() string {
+	return fmt.Sprintf("pad buffer %d/%d (mean %.2f), %d hits, %d misses", s.Depth, s.Capacity, s.MeanDepth, s.Hits, s.Misses)
+}
+
+// StartPadPrecomputation starts generating, in the background, the pads of up to "capacity" rounds ahead of the
+// last round encoded. Does nothing if capacity <= 0, or with the verifiable DC-net. SetParallelism and SetPRG must
+// be called before.
+func (e *DCNetEntity) StartPadPrecomputation(capacity int) {
+	if capacity <= 0 || e.Entity == DCNET_RELAY || e.verifiableDCNet != nil || e.precomputer != nil {
+		return
+	}
+
+	p := new(padPrecomputer)
+	p.cond = sync.NewCond(p)
+	p.capacity = capacity
+	p.nextRound = e.currentRound
+	p.lastTaken = e.currentRound - 1
+	p.buffer = make(map[int32]*precomputedPads)
+	e.precomputer = p
+
+	go e.precomputePads(p)
+}
+
+// StopPadPrecomputation stops the background generation of pads, and discards the buffered ones.
+// The next rounds are encoded as if the precomputation was never started
+func (e *DCNetEntity) StopPadPrecomputation() {
+	p := e.precomputer
+	if p == nil {
+		return
+	}
+	p.Lock()
+	p.stopped = true
+	p.buffer = make(map[int32]*precomputedPads)
+	p.cond.Broadcast()
+	p.Unlock()
+}
+
+// PadPrecomputationStats returns the state of the pad precomputation buffer (zero if not started)
+func (e *DCNetEntity) PadPrecomputationStats() PadPrecomputationStats {
+	p := e.precomputer
+	if p == nil {
+		return PadPrecomputationStats{}
+	}
+	p.Lock()
+	defer p.Unlock()
+	stats := PadPrecomputationStats{Depth: len(p.buffer), Capacity: p.capacity, Hits: p.hits, Misses: p.misses}
+	if p.hits+p.misses > 0 {
+		stats.MeanDepth = float64(p.depthSum) / float64(p.hits+p.misses)
+	}
+	return stats
+}
+
+// the background loop, filling the buffer while it is not full
+func (e *DCNetEntity) precomputePads(p *padPrecomputer) {
+	for {
+		p.Lock()
+		for !p.stopped && len(p.buffer) >= p.capacity {
+			p.cond.Wait()
+		}
+		if p.stopped {
+			p.Unlock()
+			return
+		}
+		roundID := p.nextRound
+		p.nextRound++
+		p.Unlock()
+
+		pads := e.computePads(roundID)
+
+		p.Lock()
+		// the encoder might have moved past this round in the meantime
+		if !p.stopped && roundID > p.lastTaken {
+			p.buffer[roundID] = pads
+		}
+		p.Unlock()
+	}
+}
+
+// takePrecomputedPads returns the precomputed pads of this round, or nil if they are not ready.
+// Rounds are encoded in increasing order, so older buffered rounds are discarded, and the precomputation
+// continues after this round.
+func (e *DCNetEntity) takePrecomputedPads(roundID int32) *precomputedPads {
+	p := e.precomputer
+	if p == nil {
+		return nil
+	}
+	p.Lock()
+	defer p.Unlock()
+	if p.stopped {
+		return nil
+	}
+
+	pads, found := p.buffer[roundID]
+	p.depthSum += int64(len(p.buffer))
+	if roundID > p.lastTaken {
+		p.lastTaken = roundID
+		for r := range p.buffer {
+			if r <= roundID {
+				delete(p.buffer, r)
+			}
+		}
+		if p.nextRound <= roundID {
+			p.nextRound = roundID + 1
+		}
+		p.cond.Broadcast()
+	}
+
+	if found {
+		p.hits++
+	} else {
+		p.misses++
+	}
+	return pads
+}
+
+// computePads computes the pads of the round
+func (e *DCNetEntity) computePads(roundID int32) *precomputedPads {
+	pads := new(precomputedPads)
+	pads.sum = make([]byte, e.DCNetPayloadSize)
+	e.xorRoundPads(pads.sum, roundID)
+	if e.EquivocationProtectionEnabled {
+		pads.equivocation = e.equivocationRoundPads(roundID)
+	}
+	return pads
+}
+
+// padsOfRound returns the pads of the round, using the precomputed ones if available
+func (e *DCNetEntity) padsOfRound(roundID int32) *precomputedPads {
+	if pads := e.takePrecomputedPads(roundID); pads != nil {
+		return pads
+	}
+	return e.computePads(roundID)
+}
+
+// xorPadsOfRound XORs the pads of the round into dst, using the precomputed ones if available
+func (e *DCNetEntity) xorPadsOfRound(dst []byte, roundID int32) {
+	xorBytes(dst, e.padsOfRound(roundID).sum)
+}
@@ -0,0 +1,84 @@
+package dcnet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"errors"
+
+	"go.dedis.ch/kyber/v3/suites"
+	"golang.org/x/crypto/chacha20"
+)
+
+// Names of the available PRGs, as negotiated in ALL_ALL_PARAMETERS
+const (
+	PRG_XOF      = "XOF"
+	PRG_AES_CTR  = "AES-CTR"
+	PRG_CHACHA20 = "ChaCha20"
+)
+
+// PRG expands a seed into the keystream used as DC-net pad
+type PRG interface {
+	// Name returns the name of this PRG, as negotiated in ALL_ALL_PARAMETERS
+	Name() string
+	// Stream returns the keystream derived from seed
+	Stream(seed []byte) cipher.Stream
+}
+
+// NewPRG returns the PRG called name. An empty name selects the suite's XOF, the historical default
+func NewPRG(name string, suite suites.Suite) (PRG, error) {
+	switch name {
+	case "", PRG_XOF:
+		return &xofPRG{suite: suite}, nil
+	case PRG_AES_CTR:
+		return new(aesCTRPRG), nil
+	case PRG_CHACHA20:
+		return new(chacha20PRG), nil
+	}
+	return nil, errors.New("unknown DC-net PRG " + name)
+}
+
+// the XOF of the crypto suite, seeded with the seed itself
+type xofPRG struct {
+	suite suites.Suite
+}
+
+func (p *xofPRG) Name() string {
+	return PRG_XOF
+}
+
+func (p *xofPRG) Stream(seed []byte) cipher.Stream {
+	return p.suite.XOF(seed)
+}
+
+// AES-256 in counter mode, keyed with SHA-256(seed). The key is never reused, hence the zero IV
+type aesCTRPRG struct{}
+
+func (p *aesCTRPRG) Name() string {
+	return PRG_AES_CTR
+}
+
+func (p *aesCTRPRG) Stream(seed []byte) cipher.Stream {
+	key := sha256.Sum256(seed)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		panic(err.Error())
+	}
+	return cipher.NewCTR(block, make([]byte, aes.BlockSize))
+}
+
+// ChaCha20, keyed with SHA-256(seed). The key is never reused, hence the zero nonce
+type chacha20PRG struct{}
+
+func (p *chacha20PRG) Name() string {
+	return PRG_CHACHA20
+}
+
+func (p *chacha20PRG) Stream(seed []byte) cipher.Stream {
+	key := sha256.Sum256(seed)
+	c, err := chacha20.NewUnauthenticatedCipher(key[:], make([]byte, chacha20.NonceSize))
+	if err != nil {
+		panic(err.Error())
+	}
+	return c
+}
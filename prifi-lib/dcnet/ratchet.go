@@ -0,0 +1,196 @@
+package dcnet
+
+/*
+The key ratchet gives forward secrecy to the DC-net. A session is split in epochs of SessionContext.EpochLength rounds.
+The seeds of the pads of an epoch are derived from the chain key of the epoch, and the chain key is replaced by the next
+one (a one-way function of it) when the first round of the next epoch is needed.
+
+The clients and the trustees erase the shared secrets as soon as the session context is set (see EraseSharedKeys), and
+the ratchet erases them anyway when it leaves epoch 0; the entity then only keeps the chain key of the last epoch and
+the seeds of the last two epochs, the previous epoch being kept for the rounds still in flight. Someone who later reads
+the state of the entity learns the pads of those two epochs, but not the pads of the older ones. Hence the epoch length
+must be larger than the number of rounds encoded ahead of the oldest round in flight (the window, plus the precomputed
+rounds); encoding a round of a forgotten epoch panics.
+
+The blame of the disruption protection never needs the shared secrets: the client and the trustee reveal the seed of
+one epoch (see EpochSeed), which the relay checks against the commitments they sent before the epoch (see
+SeedCommitment). The shared secrets are not derived from the long-term keys either, but from session keys picked for
+one session, which the long-term keys only sign (see crypto.NewSessionKeyPair); the session private keys are erased as
+soon as the session context is set, hence the long-term keys do not give back the pads of past sessions. Threshold
+trustees are the exception: the shares of their session keys, and the partial secrets of a missing trustee, are only
+decrypted when a trustee goes missing, hence they are encrypted to the long-term keys of the trustees, and
+TrusteeThreshold long-term keys give back the session key of a trustee.
+*/
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+
+	"go.dedis.ch/kyber/v3"
+)
+
+// domain of the chain keys
+const ratchetDomain = "PriFi-Ratchet"
+
+// domain of the commitments to the seeds
+const seedCommitmentDomain = "PriFi-Seed-commitment"
+
+// the seeds of one epoch, one per peer
+type epochSeeds struct {
+	pad          [][]byte
+	verifiable   [][]byte
+	equivocation [][]byte // nil entries if the equivocation protection is disabled
+}
+
+// keyRatchet holds the chain keys, and the seeds of the epochs still used. The encoder and the pad precomputation use
+// it concurrently
+type keyRatchet struct {
+	sync.Mutex
+	epoch     int32                 // epoch of chainKeys
+	chainKeys [][]byte              // one per peer
+	seeds     map[int32]*epochSeeds // the seeds of epochs epoch-1 and epoch, if they were derived
+}
+
+// resetRatchet derives the chain keys of epoch 0 from the shared secrets. Panics if the shared secrets were already
+// erased
+func (e *DCNetEntity) resetRatchet() {
+	r := new(keyRatchet)
+	r.chainKeys = make([][]byte, len(e.sharedKeys))
+	r.seeds = make(map[int32]*epochSeeds)
+	for i, k := range e.sharedKeys {
+		if k == nil {
+			panic("DCNet: the shared secrets were erased, the session context cannot be set anymore")
+		}
+		clientID, trusteeID := e.peerIDs(i)
+		r.chainKeys[i] = firstChainKey(k, e.sessionContext, clientID, trusteeID)
+	}
+	e.ratchet = r
+}
+
+// EraseSharedKeys zeroes and forgets the shared secrets, once the chain keys of epoch 0 are derived from them: they
+// would give back every chain key. The session context cannot be set afterwards
+func (e *DCNetEntity) EraseSharedKeys() {
+	e.ratchet.Lock()
+	defer e.ratchet.Unlock()
+	eraseKeys(e.sharedKeys)
+}
+
+// eraseKeys zeroes the points, and removes them from keys
+func eraseKeys(keys []kyber.Point) {
+	for i, k := range keys {
+		if k != nil {
+			k.Null()
+		}
+		keys[i] = nil
+	}
+}
+
+// EpochOfRound returns the key epoch of the round
+func (e *DCNetEntity) EpochOfRound(roundID int32) int32 {
+	if e.sessionContext.EpochLength <= 0 || roundID < 0 {
+		return 0
+	}
+	return roundID / e.sessionContext.EpochLength
+}
+
+// seedsOfEpoch returns the seeds of the epoch, ratcheting forward if needed; returns nil if the epoch was erased
+func (e *DCNetEntity) seedsOfEpoch(epoch int32) *epochSeeds {
+	r := e.ratchet
+	r.Lock()
+	defer r.Unlock()
+
+	if s, found := r.seeds[epoch]; found {
+		return s
+	}
+	if epoch < r.epoch {
+		return nil
+	}
+	if epoch > r.epoch {
+		for r.epoch < epoch {
+			for i := range r.chainKeys {
+				clientID, trusteeID := e.peerIDs(i)
+				r.chainKeys[i] = nextChainKey(r.chainKeys[i], r.epoch, clientID, trusteeID)
+			}
+			r.epoch++
+		}
+		// the shared secrets would give back every chain key
+		eraseKeys(e.sharedKeys)
+		for old := range r.seeds {
+			if old < epoch-1 {
+				delete(r.seeds, old)
+			}
+		}
+	}
+
+	s := new(epochSeeds)
+	n := len(r.chainKeys)
+	s.pad = make([][]byte, n)
+	s.verifiable = make([][]byte, n)
+	s.equivocation = make([][]byte, n)
+	for i, k := range r.chainKeys {
+		clientID, trusteeID := e.peerIDs(i)
+		s.pad[i] = epochSeed(k, padDomain, epoch, clientID, trusteeID)
+		s.verifiable[i] = epochSeed(k, verifiablePadDomain, epoch, clientID, trusteeID)
+		if e.EquivocationProtectionEnabled {
+			s.equivocation[i] = epochSeed(k, equivocationPadDomain, epoch, clientID, trusteeID)
+		}
+	}
+	r.seeds[epoch] = s
+	return s
+}
+
+// seedsOfRound returns the seeds of the epoch of the round; panics if the epoch was erased
+func (e *DCNetEntity) seedsOfRound(roundID int32) *epochSeeds {
+	s := e.seedsOfEpoch(e.EpochOfRound(roundID))
+	if s == nil {
+		panic("DCNet: cannot encode round " + strconv.Itoa(int(roundID)) + ", the keys of epoch " +
+			strconv.Itoa(int(e.EpochOfRound(roundID))) + " were erased")
+	}
+	return s
+}
+
+// EpochSeed returns the seed of the pads shared with a peer in the epoch of the round, and the epoch. Revealing it
+// only reveals the pads of that peer in that epoch, the other epochs cannot be derived from it. Returns an error if
+// the epoch was erased
+func (e *DCNetEntity) EpochSeed(peer int, roundID int32) (int32, []byte, error) {
+	epoch := e.EpochOfRound(roundID)
+	if peer < 0 || peer >= len(e.sharedKeys) {
+		return epoch, nil, errors.New("no peer " + strconv.Itoa(peer))
+	}
+	s := e.seedsOfEpoch(epoch)
+	if s == nil {
+		return epoch, nil, errors.New("the keys of epoch " + strconv.Itoa(int(epoch)) + " were erased")
+	}
+	return epoch, s.pad[peer], nil
+}
+
+// EpochSeedCommitments returns the commitments to the seeds of the pads shared with each peer in the epoch of the
+// round (see SeedCommitment), and the epoch. Returns an error if the epoch was erased
+func (e *DCNetEntity) EpochSeedCommitments(roundID int32) (int32, [][]byte, error) {
+	epoch := e.EpochOfRound(roundID)
+	s := e.seedsOfEpoch(epoch)
+	if s == nil {
+		return epoch, nil, errors.New("the keys of epoch " + strconv.Itoa(int(epoch)) + " were erased")
+	}
+	commitments := make([][]byte, len(s.pad))
+	for i, seed := range s.pad {
+		clientID, trusteeID := e.peerIDs(i)
+		commitments[i] = SeedCommitment(seed, epoch, clientID, trusteeID)
+	}
+	return epoch, commitments, nil
+}
+
+// SeedCommitment returns the commitment of a client or a trustee to the seed of the pads they share in an epoch. It is
+// sent to the relay before the epoch is used, so that the seed revealed in a blame can be checked; the seed is random,
+// hence the commitment says nothing of it
+func SeedCommitment(seed []byte, epoch int32, clientID, trusteeID int) []byte {
+	return deriveKey(seed, nil, seedCommitmentDomain, epoch, clientID, trusteeID)
+}
+
+// EpochRoundPad returns the pad of round roundID, derived from the seed of its epoch (see EpochSeed)
+func (e *DCNetEntity) EpochRoundPad(seed []byte, roundID int32) []byte {
+	pad := make([]byte, e.DCNetPayloadSize)
+	e.roundStream(padDomain, seed, roundID).XORKeyStream(pad, pad)
+	return pad
+}
@@ -0,0 +1,144 @@
+package dcnet
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestKeyRatchet(t *testing.T) {
+
+	payloadSize := 100
+	tg := NewTestGroup(t, false, payloadSize, 2, 2)
+	client := tg.Clients[0].DCNetEntity
+	trustee := tg.Trustees[1].DCNetEntity
+	longTermSecret := tg.Trustees[1].sharedSecrets[0]
+
+	ctx := SessionContext{Nonce: NewSessionNonce(), EpochLength: 4}
+	setSessionContext(tg, ctx)
+	if client.EpochOfRound(3) != 0 || client.EpochOfRound(4) != 1 || client.EpochOfRound(-1) != 0 {
+		t.Error("Wrong epochs of the rounds")
+	}
+
+	// the cells decode across the epochs
+	SimulateRounds(t, tg, 10)
+
+	// client 0 and trustee 1 agree on the seed of the epoch, it gives the pads of that epoch only
+	epoch, clientSeed, err := client.EpochSeed(1, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, trusteeSeed, err := trustee.EpochSeed(0, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if epoch != 2 || !bytes.Equal(clientSeed, trusteeSeed) {
+		t.Error("Client 0 and trustee 1 should reveal the same seed for epoch 2")
+	}
+	if !bytes.Equal(tg.Relay.DCNetEntity.EpochRoundPad(trusteeSeed, 9), trustee.roundPads(9)[0]) {
+		t.Error("The seed of the epoch should give the pad of round 9")
+	}
+	if bytes.Equal(tg.Relay.DCNetEntity.EpochRoundPad(trusteeSeed, 5), trustee.roundPads(5)[0]) {
+		t.Error("The seed of epoch 2 should not give the pads of epoch 1")
+	}
+
+	// the seed matches the commitments of both, and only in its epoch
+	_, clientCommitments, err := client.EpochSeedCommitments(9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, trusteeCommitments, _ := trustee.EpochSeedCommitments(9)
+	if c := SeedCommitment(clientSeed, 2, 0, 1); !bytes.Equal(c, clientCommitments[1]) || !bytes.Equal(c, trusteeCommitments[0]) {
+		t.Error("The seed of epoch 2 should match the commitments of client 0 and trustee 1")
+	}
+	if bytes.Equal(SeedCommitment(clientSeed, 1, 0, 1), clientCommitments[1]) {
+		t.Error("A commitment should be bound to its epoch")
+	}
+
+	// the relay ratchets the long-term secret up to the epoch of the round
+	if !bytes.Equal(tg.Relay.DCNetEntity.RoundPad(longTermSecret, 0, 1, 9), trustee.roundPads(9)[0]) {
+		t.Error("The relay should derive the same pad as trustee 1")
+	}
+
+	// the secrets and the keys of the epochs before the previous one are erased
+	for _, k := range trustee.sharedKeys {
+		if k != nil {
+			t.Error("The shared secrets should be erased once the ratchet left epoch 0")
+		}
+	}
+	if _, _, err := trustee.EpochSeed(0, 3); err == nil {
+		t.Error("The keys of epoch 0 should be erased")
+	}
+	if bits, _ := trustee.GetBitsOfRound(2, 0); bits != nil {
+		t.Error("The bits of an erased epoch cannot be recomputed")
+	}
+	if _, _, err := trustee.EpochSeed(0, 5); err != nil {
+		t.Error("The keys of the previous epoch should still be there,", err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("Encoding a round of an erased epoch should panic")
+		}
+	}()
+	trustee.TrusteeEncodeForRound(1)
+}
+
+func TestEraseSharedKeys(t *testing.T) {
+
+	payloadSize := 100
+	tg := NewTestGroup(t, false, payloadSize, 2, 2)
+	setSessionContext(tg, SessionContext{Nonce: NewSessionNonce(), EpochLength: 4})
+	trustee := tg.Trustees[0].DCNetEntity
+	longTermSecret := tg.Trustees[0].sharedSecrets[1].Clone()
+
+	// the entity erases its copy only, and still encodes the rounds of the session
+	for _, c := range tg.Clients {
+		c.DCNetEntity.EraseSharedKeys()
+	}
+	for _, tr := range tg.Trustees {
+		tr.DCNetEntity.EraseSharedKeys()
+	}
+	for _, k := range trustee.sharedKeys {
+		if k != nil {
+			t.Error("The shared secrets should be erased")
+		}
+	}
+	if !tg.Trustees[0].sharedSecrets[1].Equal(longTermSecret) {
+		t.Error("Erasing the shared secrets should not change the points of the caller")
+	}
+	SimulateRounds(t, tg, 6)
+	if !bytes.Equal(tg.Relay.DCNetEntity.RoundPad(longTermSecret, 1, 0, 5), trustee.roundPads(5)[1]) {
+		t.Error("The pads should still be derived from the erased shared secrets")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Setting the session context once the shared secrets are erased should panic")
+		}
+	}()
+	trustee.SetSessionContext(SessionContext{Nonce: NewSessionNonce(), EpochLength: 4})
+}
+
+func TestKeyRatchetEquivocation(t *testing.T) {
+
+	payloadSize := 100
+	tg := NewTestGroup(t, true, payloadSize, 2, 2)
+	setSessionContext(tg, SessionContext{Nonce: NewSessionNonce(), EpochLength: 2})
+	client := tg.Clients[1].DCNetEntity
+	trustee := tg.Trustees[0].DCNetEntity
+
+	// the cells decode and authenticate across the epochs
+	SimulateRounds(t, tg, 8)
+
+	// the seeds of the equivocation protection are ratcheted with the pads
+	var previous []byte
+	for _, epoch := range []int32{3, 4, 6} {
+		cs, ts := client.seedsOfEpoch(epoch), trustee.seedsOfEpoch(epoch)
+		if !bytes.Equal(cs.equivocation[0], ts.equivocation[1]) || !bytes.Equal(cs.pad[0], ts.pad[1]) {
+			t.Error("Client 1 and trustee 0 should derive the same seeds in epoch", epoch)
+		}
+		if bytes.Equal(cs.equivocation[0], previous) {
+			t.Error("The seeds should change with the epoch")
+		}
+		previous = cs.equivocation[0]
+	}
+}
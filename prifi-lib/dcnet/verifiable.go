@@ -0,0 +1,473 @@
+package dcnet
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/proof"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// The verifiable DC-net works on group elements instead of bytes. The payload is cut in chunks
+// that are embedded in points, and the pads are scalars derived from the shared secrets.
+// B is the base point, H is a commitment base whose discrete log w.r.t. B nobody knows.
+//
+// Clients compute, for each chunk k:
+// C_ik = p_ik * B + M_ik, where p_ik = SUM_j(p_ijk), and M_ik embeds the chunk if i owns the slot (identity otherwise)
+// Q_ik = p_ik * H
+// and prove that either log_B(C_ik) = log_H(Q_ik) for all k (the cipher carries no message),
+// or that they know the pseudonym private key of the slot owner.
+//
+// Trustees compute:
+// T_jk = - SUM_i(p_ijk) * B, and for each client, Q_ijk = p_ijk * H
+// and prove that they know the p_ijk such that -T_jk = SUM_i(p_ijk) * B and Q_ijk = p_ijk * H for all i, k, i.e.
+// that their commitments are those of the pads in their cipher.
+//
+// Relay checks each trustee's proof as its cipher arrives, computes:
+// M_k = SUM_i(C_ik) + SUM_j(T_jk)
+// and verifies each client's proof against Q_ik = SUM_j(Q_ijk). A client is only blamed when the commitments of every
+// trustee are proven: a trustee with an invalid cipher is blamed instead, and its commitments do not blame anyone.
+
+// VerifiableDCNet holds the public parameters (and, for clients, the secrets) needed for the verifiable DC-net
+type VerifiableDCNet struct {
+	suite          suites.Suite
+	commitmentBase kyber.Point   // H = SUM_j(H_j), combined from the trustees' keys
+	pseudonymBase  kyber.Point   // the base of the Neff shuffle output
+	pseudonyms     []kyber.Point // the shuffled ephemeral public keys, one per slot
+
+	//Used by the clients only
+	pseudonymPrivateKey kyber.Scalar //nil if unused
+	mySlot              int          //-1 if unused
+}
+
+// VerifiableDCNetCipher is the output of a verifiable DC-net round
+type VerifiableDCNetCipher struct {
+	Ciphers     []kyber.Point // one per chunk
+	Commitments []kyber.Point // one per chunk for clients, one per client and chunk for trustees
+	Proof       []byte
+}
+
+// NewVerifiableDCNetKey returns a random share H_j = h_j * B of the commitment base; h_j is discarded
+func NewVerifiableDCNetKey(suite suites.Suite) []byte {
+	h := suite.Scalar().Pick(suite.RandomStream())
+	key, err := suite.Point().Mul(h, nil).MarshalBinary()
+	if err != nil {
+		log.Fatal("Could not marshal the verifiable DC-net key", err)
+	}
+	return key
+}
+
+// CombineVerifiableDCNetKeys computes the commitment base H as the sum of the trustees' shares
+func CombineVerifiableDCNetKeys(suite suites.Suite, keys [][]byte) (kyber.Point, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no verifiable DC-net keys")
+	}
+	H := suite.Point().Null()
+	for j, k := range keys {
+		Hj := suite.Point()
+		if err := Hj.UnmarshalBinary(k); err != nil {
+			return nil, errors.New("invalid verifiable DC-net key " + strconv.Itoa(j) + ": " + err.Error())
+		}
+		H.Add(H, Hj)
+	}
+	if H.Equal(suite.Point().Null()) {
+		return nil, errors.New("verifiable DC-net keys sum to the identity")
+	}
+	return H, nil
+}
+
+// NewVerifiableDCNet creates the parameters of the verifiable DC-net. pseudonymPrivateKey and mySlot
+// are only given by clients; trustees and the relay pass nil and -1.
+func NewVerifiableDCNet(suite suites.Suite, commitmentBase, pseudonymBase kyber.Point, pseudonyms []kyber.Point,
+	pseudonymPrivateKey kyber.Scalar, mySlot int) *VerifiableDCNet {
+	v := new(VerifiableDCNet)
+	v.suite = suite
+	v.commitmentBase = commitmentBase
+	v.pseudonymBase = pseudonymBase
+	v.pseudonyms = pseudonyms
+	v.pseudonymPrivateKey = pseudonymPrivateKey
+	v.mySlot = mySlot
+	return v
+}
+
+// SetVerifiableDCNet switches this entity to the verifiable DC-net
+func (e *DCNetEntity) SetVerifiableDCNet(v *VerifiableDCNet) {
+	e.verifiableDCNet = v
+	e.verifiableChunks = numberOfChunks(v.suite, e.DCNetPayloadSize)
+}
+
+// GetVerifiableDCNet returns the verifiable DC-net parameters of this entity, nil if unused
+func (e *DCNetEntity) GetVerifiableDCNet() *VerifiableDCNet {
+	return e.verifiableDCNet
+}
+
+// IsVerifiable returns true iff this entity uses the verifiable DC-net
+func (e *DCNetEntity) IsVerifiable() bool {
+	return e.verifiableDCNet != nil
+}
+
+// number of points needed to embed payloadSize bytes
+func numberOfChunks(suite suites.Suite, payloadSize int) int {
+	embedLen := suite.Point().EmbedLen()
+	return (payloadSize + embedLen - 1) / embedLen
+}
+
+// verifiablePads returns the scalar pads shared with peer i for a round, one per chunk
+func (e *DCNetEntity) verifiablePads(i int, roundID int32) []kyber.Scalar {
+	stream := e.roundStream(verifiablePadDomain, e.seedsOfRound(roundID).verifiable[i], roundID)
+	pads := make([]kyber.Scalar, e.verifiableChunks)
+	for k := range pads {
+		pads[k] = e.cryptoSuite.Scalar().Pick(stream)
+	}
+	return pads
+}
+
+// VerifiableEncodeForRound is used by the clients to encode "payload" in round roundID of the verifiable DC-net.
+// ownerSlot is the slot owning the round, or -1 if nobody owns it. Contrary to EncodeForRound,
+// pads are derived from the round number, hence rounds can be encoded in any order.
+func (e *DCNetEntity) VerifiableEncodeForRound(roundID int32, ownerSlot int, payload []byte) ([]byte, []byte) {
+	v := e.verifiableDCNet
+	if v == nil {
+		panic("DCNet: VerifiableEncodeForRound called, but the verifiable DC-net is not set")
+	}
+	if len(payload) > e.DCNetPayloadSize {
+		panic("DCNet: cannot encode Payload of length " + strconv.Itoa(len(payload)) + " max length is " + strconv.Itoa(e.DCNetPayloadSize))
+	}
+	slotOwner := ownerSlot >= 0 && ownerSlot == v.mySlot
+
+	plainPayload := make([]byte, e.DCNetPayloadSize)
+	if slotOwner {
+		copy(plainPayload, payload)
+	}
+
+	// sum the pads shared with each trustee
+	p_k := make([]kyber.Scalar, e.verifiableChunks)
+	for k := range p_k {
+		p_k[k] = e.cryptoSuite.Scalar().Zero()
+	}
+	for j := range e.sharedKeys {
+		pads := e.verifiablePads(j, roundID)
+		for k := range p_k {
+			p_k[k].Add(p_k[k], pads[k])
+		}
+	}
+
+	c := new(VerifiableDCNetCipher)
+	c.Ciphers = make([]kyber.Point, e.verifiableChunks)
+	commitments := make([]kyber.Point, e.verifiableChunks)
+	embedLen := e.cryptoSuite.Point().EmbedLen()
+	for k := range c.Ciphers {
+		c.Ciphers[k] = e.cryptoSuite.Point().Mul(p_k[k], nil)
+		commitments[k] = e.cryptoSuite.Point().Mul(p_k[k], v.commitmentBase)
+		if slotOwner {
+			start := k * embedLen
+			end := start + embedLen
+			if end > len(plainPayload) {
+				end = len(plainPayload)
+			}
+			m := e.cryptoSuite.Point().Embed(plainPayload[start:end], e.cryptoSuite.RandomStream())
+			c.Ciphers[k].Add(c.Ciphers[k], m)
+		}
+	}
+
+	pred, pval := v.predicate(c.Ciphers, commitments, ownerSlot)
+	sval := make(map[string]kyber.Scalar)
+	choice := make(map[proof.Predicate]int)
+	if slotOwner {
+		sval["e"] = v.pseudonymPrivateKey
+		choice[pred] = 1
+	} else {
+		for k := range p_k {
+			sval["p"+strconv.Itoa(k)] = p_k[k]
+		}
+		choice[pred] = 0
+	}
+	prover := pred.Prover(v.suite, sval, pval, choice)
+	nizk, err := proof.HashProve(v.suite, verifiableProtocolName(roundID), prover)
+	if err != nil {
+		log.Fatal("Could not prove the verifiable DC-net cipher", err)
+	}
+	c.Proof = nizk
+
+	e.verbosePrint("r[", roundID, "]: verifiable, ", len(c.Ciphers), " chunks, owner=", slotOwner)
+
+	if !slotOwner {
+		return c.ToBytes(), nil
+	}
+	return c.ToBytes(), plainPayload
+}
+
+// verifiableTrusteeEncode is used by the trustees, it outputs the pads and the per-client commitments
+func (e *DCNetEntity) verifiableTrusteeEncode(roundID int32) []byte {
+	v := e.verifiableDCNet
+
+	c := new(VerifiableDCNetCipher)
+	c.Ciphers = make([]kyber.Point, e.verifiableChunks)
+	c.Commitments = make([]kyber.Point, len(e.sharedKeys)*e.verifiableChunks)
+
+	sum := make([]kyber.Scalar, e.verifiableChunks)
+	for k := range sum {
+		sum[k] = e.cryptoSuite.Scalar().Zero()
+	}
+	for i := range e.sharedKeys {
+		pads := e.verifiablePads(i, roundID)
+		for k := range pads {
+			sum[k].Add(sum[k], pads[k])
+			c.Commitments[i*e.verifiableChunks+k] = e.cryptoSuite.Point().Mul(pads[k], v.commitmentBase)
+		}
+	}
+	for k := range sum {
+		c.Ciphers[k] = e.cryptoSuite.Point().Mul(e.cryptoSuite.Scalar().Neg(sum[k]), nil)
+	}
+
+	pred, pval := v.trusteePredicate(c.Ciphers, c.Commitments, len(e.sharedKeys))
+	sval := make(map[string]kyber.Scalar)
+	for i := range e.sharedKeys {
+		pads := e.verifiablePads(i, roundID)
+		for k := range pads {
+			sval[trusteePadName(i, k)] = pads[k]
+		}
+	}
+	prover := pred.Prover(v.suite, sval, pval, nil)
+	nizk, err := proof.HashProve(v.suite, verifiableTrusteeProtocolName(e.EntityID, roundID), prover)
+	if err != nil {
+		log.Fatal("Could not prove the verifiable DC-net trustee cipher", err)
+	}
+	c.Proof = nizk
+
+	return c.ToBytes()
+}
+
+// trusteePredicate returns the statement proven by the trustees, and the public points it refers to: the pads
+// committed to for each of the nClients clients sum to the opposite of the trustee's cipher
+func (v *VerifiableDCNet) trusteePredicate(ciphers, commitments []kyber.Point, nClients int) (proof.Predicate, map[string]kyber.Point) {
+	pval := make(map[string]kyber.Point)
+	pval["B"] = v.suite.Point().Base()
+	pval["H"] = v.commitmentBase
+
+	reps := make([]proof.Predicate, 0, len(ciphers)*(nClients+1))
+	for k := range ciphers {
+		ks := strconv.Itoa(k)
+		pval["T"+ks] = v.suite.Point().Neg(ciphers[k])
+		sum := make([]string, 0, 2*nClients)
+		for i := 0; i < nClients; i++ {
+			pad := trusteePadName(i, k)
+			pval["Q"+pad] = commitments[i*len(ciphers)+k]
+			sum = append(sum, pad, "B")
+			reps = append(reps, proof.Rep("Q"+pad, pad, "H"))
+		}
+		reps = append(reps, proof.Rep("T"+ks, sum...))
+	}
+	return proof.And(reps...), pval
+}
+
+// the name of the pad shared with client i for chunk k, in the trustees' proofs
+func trusteePadName(i, k int) string {
+	return "p" + strconv.Itoa(i) + "_" + strconv.Itoa(k)
+}
+
+// predicate returns the statement proven by the clients, and the public points it refers to
+func (v *VerifiableDCNet) predicate(ciphers, commitments []kyber.Point, ownerSlot int) (proof.Predicate, map[string]kyber.Point) {
+	pval := make(map[string]kyber.Point)
+	pval["B"] = v.suite.Point().Base()
+	pval["H"] = v.commitmentBase
+
+	reps := make([]proof.Predicate, 0, 2*len(ciphers))
+	for k := range ciphers {
+		ks := strconv.Itoa(k)
+		pval["C"+ks] = ciphers[k]
+		pval["Q"+ks] = commitments[k]
+		reps = append(reps, proof.Rep("C"+ks, "p"+ks, "B"), proof.Rep("Q"+ks, "p"+ks, "H"))
+	}
+	noMessage := proof.And(reps...)
+
+	// if nobody owns the slot, nobody may transmit
+	if ownerSlot < 0 || ownerSlot >= len(v.pseudonyms) {
+		return noMessage, pval
+	}
+	pval["P"] = v.pseudonyms[ownerSlot]
+	pval["G"] = v.pseudonymBase
+
+	return proof.Or(noMessage, proof.Rep("P", "e", "G")), pval
+}
+
+func verifiableProtocolName(roundID int32) string {
+	return "PriFi-VerifiableDCNet-" + strconv.Itoa(int(roundID))
+}
+
+func verifiableTrusteeProtocolName(trusteeID int, roundID int32) string {
+	return "PriFi-VerifiableDCNet-Trustee-" + strconv.Itoa(trusteeID) + "-" + strconv.Itoa(int(roundID))
+}
+
+// Called on the relay to verify the clients' proofs for a round, after having decoded all the ciphers and before DecodeCell.
+// Returns the IDs of the clients whose cipher is missing or not well-formed. If the cipher of a trustee is missing or
+// not proven, the clients cannot be verified, and none is returned; DecodeCell blames the trustee.
+func (e *DCNetEntity) VerifyClientCiphers(roundID int32, ownerSlot int) []int {
+	d := e.roundDecoder(roundID)
+	v := e.verifiableDCNet
+	nClients := len(v.pseudonyms)
+	badClients := make([]int, 0)
+
+	if len(d.invalidTrustees) > 0 || len(d.verifiableTrusteeCiphers) == 0 {
+		log.Error("DCNet: the commitments of the trustees are not proven in round", roundID, ", cannot verify the clients")
+		return badClients
+	}
+
+	// Q_ik = SUM_j(Q_ijk), the trustees' commitments are proven when their cipher arrives
+	commitments := make([][]kyber.Point, nClients)
+	for i := range commitments {
+		commitments[i] = make([]kyber.Point, e.verifiableChunks)
+		for k := range commitments[i] {
+			commitments[i][k] = e.cryptoSuite.Point().Null()
+			for _, t := range d.verifiableTrusteeCiphers {
+				commitments[i][k].Add(commitments[i][k], t.Commitments[i*e.verifiableChunks+k])
+			}
+		}
+	}
+
+	for i := 0; i < nClients; i++ {
+		c := d.verifiableClientCiphers[i]
+		if c == nil || len(c.Ciphers) != e.verifiableChunks {
+			badClients = append(badClients, i)
+			continue
+		}
+
+		pred, pval := v.predicate(c.Ciphers, commitments[i], ownerSlot)
+		verifier := pred.Verifier(v.suite, pval)
+		if err := proof.HashVerify(v.suite, verifiableProtocolName(roundID), verifier, c.Proof); err != nil {
+			badClients = append(badClients, i)
+		}
+	}
+
+	return badClients
+}
+
+// decode a trustee's verifiable cipher, checks the proof of its commitments, and adds the cipher points to the round's
+// sum. Returns an error if the cipher is not well-formed or not proven; the cell of this round will then be reported
+// as disrupted by this trustee
+func (e *DCNetEntity) verifiableDecodeTrustee(d *DCNetRoundDecoder, trusteeID int, slice []byte) error {
+	v := e.verifiableDCNet
+	nClients := len(v.pseudonyms)
+
+	c, err := VerifiableDCNetCipherFromBytes(e.cryptoSuite, slice)
+	if err == nil && (len(c.Ciphers) != e.verifiableChunks || len(c.Commitments) != nClients*e.verifiableChunks) {
+		err = errors.New("wrong number of ciphers or commitments")
+	}
+	if err == nil {
+		pred, pval := v.trusteePredicate(c.Ciphers, c.Commitments, nClients)
+		verifier := pred.Verifier(v.suite, pval)
+		err = proof.HashVerify(v.suite, verifiableTrusteeProtocolName(trusteeID, d.roundID), verifier, c.Proof)
+	}
+	if err != nil {
+		d.verifiableInvalid = true
+		d.invalidTrustees = append(d.invalidTrustees, trusteeID)
+		return errors.New("invalid verifiable cipher from trustee " + strconv.Itoa(trusteeID) + " in round " +
+			strconv.Itoa(int(d.roundID)) + ": " + err.Error())
+	}
+
+	for k := range c.Ciphers {
+		d.pointBuffer[k].Add(d.pointBuffer[k], c.Ciphers[k])
+	}
+	d.verifiableTrusteeCiphers[trusteeID] = c
+	return nil
+}
+
+// decode a client's verifiable cipher, and adds the cipher points to the round's sum
+func (e *DCNetEntity) verifiableDecode(d *DCNetRoundDecoder, slice []byte) *VerifiableDCNetCipher {
+	c, err := VerifiableDCNetCipherFromBytes(e.cryptoSuite, slice)
+	if err != nil || len(c.Ciphers) != e.verifiableChunks {
+		log.Error("DCNet: could not decode verifiable cipher", err)
+		d.verifiableInvalid = true
+		return nil
+	}
+	for k := range c.Ciphers {
+		d.pointBuffer[k].Add(d.pointBuffer[k], c.Ciphers[k])
+	}
+	return c
+}
+
+// extract the data embedded in the sum of the ciphers
+func (e *DCNetEntity) verifiableDecodeCell(d *DCNetRoundDecoder) []byte {
+	out := make([]byte, 0, e.DCNetPayloadSize)
+	embedLen := e.cryptoSuite.Point().EmbedLen()
+	null := e.cryptoSuite.Point().Null()
+
+	for k := range d.pointBuffer {
+		chunk := make([]byte, embedLen)
+		if !d.verifiableInvalid && !d.pointBuffer[k].Equal(null) {
+			data, err := d.pointBuffer[k].Data()
+			if err != nil {
+				log.Error("DCNet: chunk", k, "does not contain embedded data", err)
+			} else {
+				copy(chunk, data)
+			}
+		}
+		out = append(out, chunk...)
+	}
+
+	return out[:e.DCNetPayloadSize]
+}
+
+// Converts the VerifiableDCNetCipher to []byte
+func (c *VerifiableDCNetCipher) ToBytes() []byte {
+	out := make([]byte, 0)
+	out = appendPoints(out, c.Ciphers)
+	out = appendPoints(out, c.Commitments)
+	out = append(out, c.Proof...)
+	return out
+}
+
+func appendPoints(out []byte, points []kyber.Point) []byte {
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, uint32(len(points)))
+	out = append(out, header...)
+	for _, p := range points {
+		b, err := p.MarshalBinary()
+		if err != nil {
+			log.Fatal("Could not marshal point", err)
+		}
+		out = append(out, b...)
+	}
+	return out
+}
+
+func readPoints(suite suites.Suite, data []byte) ([]kyber.Point, []byte, error) {
+	if len(data) < 4 {
+		return nil, nil, errors.New("data too short")
+	}
+	n := int(binary.BigEndian.Uint32(data[0:4]))
+	data = data[4:]
+	pointLen := suite.PointLen()
+	if n < 0 || n > len(data)/pointLen {
+		return nil, nil, errors.New("invalid number of points " + strconv.Itoa(n))
+	}
+	points := make([]kyber.Point, n)
+	for i := range points {
+		points[i] = suite.Point()
+		if err := points[i].UnmarshalBinary(data[i*pointLen : (i+1)*pointLen]); err != nil {
+			return nil, nil, err
+		}
+	}
+	return points, data[n*pointLen:], nil
+}
+
+// Decodes some bytes into a VerifiableDCNetCipher, whose points are in the given suite
+func VerifiableDCNetCipherFromBytes(suite suites.Suite, data []byte) (*VerifiableDCNetCipher, error) {
+	c := new(VerifiableDCNetCipher)
+	var err error
+	c.Ciphers, data, err = readPoints(suite, data)
+	if err != nil {
+		return nil, err
+	}
+	c.Commitments, data, err = readPoints(suite, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 {
+		c.Proof = data
+	}
+	return c, nil
+}
@@ -0,0 +1,214 @@
+package dcnet
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dedis/prifi/prifi-lib/config"
+	"go.dedis.ch/kyber/v3"
+)
+
+// sets up the verifiable DC-net on a test group, in the suite of the group; client i owns slot i
+func setupVerifiableTestGroup(t *testing.T, tg *TestGroup) {
+	suite := tg.Relay.DCNetEntity.cryptoSuite
+	keys := make([][]byte, len(tg.Trustees))
+	for j := range keys {
+		keys[j] = NewVerifiableDCNetKey(suite)
+	}
+	H, err := CombineVerifiableDCNetKeys(suite, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	G := suite.Point().Pick(suite.RandomStream())
+	privKeys := make([]kyber.Scalar, len(tg.Clients))
+	pseudonyms := make([]kyber.Point, len(tg.Clients))
+	for i := range privKeys {
+		privKeys[i] = suite.Scalar().Pick(suite.RandomStream())
+		pseudonyms[i] = suite.Point().Mul(privKeys[i], G)
+	}
+
+	for i, c := range tg.Clients {
+		c.DCNetEntity.SetVerifiableDCNet(NewVerifiableDCNet(suite, H, G, pseudonyms, privKeys[i], i))
+	}
+	for _, tr := range tg.Trustees {
+		tr.DCNetEntity.SetVerifiableDCNet(NewVerifiableDCNet(suite, H, G, pseudonyms, nil, -1))
+	}
+	tg.Relay.DCNetEntity.SetVerifiableDCNet(NewVerifiableDCNet(suite, H, G, pseudonyms, nil, -1))
+}
+
+func TestVerifiableDCNet(t *testing.T) {
+
+	payloadSize := 100
+	nClients := 3
+	nTrustees := 2
+
+	// the points are embedded in the suite of the session
+	for _, name := range []string{"Ed25519", "P256"} {
+		suite, err := config.FindCryptoSuite(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tg := NewTestGroupInSuite(t, suite, false, payloadSize, nClients, nTrustees)
+		setupVerifiableTestGroup(t, tg)
+
+		// rounds are not encoded in order on purpose
+		for _, roundID := range []int32{0, 3, 1, 2, 7} {
+			ownerSlot := int(roundID%int32(nClients+1)) - 1 // -1 means nobody owns the round
+			message := randomBytes(payloadSize)
+
+			tg.Relay.DCNetEntity.DecodeStart(roundID, ownerSlot)
+			for i, c := range tg.Clients {
+				var m []byte
+				if i == ownerSlot {
+					m, _ = c.DCNetEntity.VerifiableEncodeForRound(roundID, ownerSlot, message)
+				} else {
+					m, _ = c.DCNetEntity.VerifiableEncodeForRound(roundID, ownerSlot, nil)
+				}
+				tg.Relay.DCNetEntity.DecodeClient(roundID, i, m)
+			}
+			for j, tr := range tg.Trustees {
+				tg.Relay.DCNetEntity.DecodeTrustee(roundID, j, tr.DCNetEntity.TrusteeEncodeForRound(roundID))
+			}
+
+			if bad := tg.Relay.DCNetEntity.VerifyClientCiphers(roundID, ownerSlot); len(bad) != 0 {
+				t.Error("Honest clients", bad, "failed the verification in round", roundID)
+			}
+
+			output, _, disruption := tg.Relay.DCNetEntity.DecodeCell(roundID, false)
+			if disruption != nil {
+				t.Error("Honest round reported as disrupted,", disruption)
+			}
+			expected := make([]byte, payloadSize)
+			if ownerSlot >= 0 {
+				expected = message
+			}
+			if !bytes.Equal(output, expected) {
+				t.Error("Verifiable DC-net encoding failed in round", roundID, "with", name)
+			}
+		}
+	}
+}
+
+func TestVerifiableDCNetDetectsDisruption(t *testing.T) {
+
+	payloadSize := 50
+	tg := NewTestGroup(t, false, payloadSize, 3, 2)
+	setupVerifiableTestGroup(t, tg)
+
+	roundID := int32(5)
+	ownerSlot := 0
+
+	tg.Relay.DCNetEntity.DecodeStart(roundID, ownerSlot)
+	m, _ := tg.Clients[0].DCNetEntity.VerifiableEncodeForRound(roundID, ownerSlot, randomBytes(payloadSize))
+	tg.Relay.DCNetEntity.DecodeClient(roundID, 0, m)
+
+	// client 1 pretends to own the slot to jam it
+	m, _ = tg.Clients[1].DCNetEntity.VerifiableEncodeForRound(roundID, 1, randomBytes(payloadSize))
+	tg.Relay.DCNetEntity.DecodeClient(roundID, 1, m)
+
+	m, _ = tg.Clients[2].DCNetEntity.VerifiableEncodeForRound(roundID, ownerSlot, nil)
+	tg.Relay.DCNetEntity.DecodeClient(roundID, 2, m)
+
+	for j, tr := range tg.Trustees {
+		tg.Relay.DCNetEntity.DecodeTrustee(roundID, j, tr.DCNetEntity.TrusteeEncodeForRound(roundID))
+	}
+
+	bad := tg.Relay.DCNetEntity.VerifyClientCiphers(roundID, ownerSlot)
+	if len(bad) != 1 || bad[0] != 1 {
+		t.Error("Should have detected client 1 as disruptive, got", bad)
+	}
+
+	// the next round, where everyone behaves, is not blamed on client 1
+	roundID++
+	tg.Relay.DCNetEntity.DecodeStart(roundID, ownerSlot)
+	for i, c := range tg.Clients {
+		var payload []byte
+		if i == ownerSlot {
+			payload = randomBytes(payloadSize)
+		}
+		m, _ = c.DCNetEntity.VerifiableEncodeForRound(roundID, ownerSlot, payload)
+		tg.Relay.DCNetEntity.DecodeClient(roundID, i, m)
+	}
+	for j, tr := range tg.Trustees {
+		tg.Relay.DCNetEntity.DecodeTrustee(roundID, j, tr.DCNetEntity.TrusteeEncodeForRound(roundID))
+	}
+	if bad := tg.Relay.DCNetEntity.VerifyClientCiphers(roundID, ownerSlot); len(bad) != 0 {
+		t.Error("No client disrupted the next round, got", bad)
+	}
+}
+
+func TestVerifiableDCNetBlamesTrustee(t *testing.T) {
+
+	payloadSize := 50
+	tg := NewTestGroup(t, false, payloadSize, 3, 2)
+	setupVerifiableTestGroup(t, tg)
+	suite := tg.Relay.DCNetEntity.cryptoSuite
+	relay := tg.Relay.DCNetEntity
+
+	for _, tamper := range []string{"commitment", "truncated"} {
+		roundID := int32(5)
+		ownerSlot := 0
+		relay.DecodeStart(roundID, ownerSlot)
+		for i, c := range tg.Clients {
+			var payload []byte
+			if i == ownerSlot {
+				payload = randomBytes(payloadSize)
+			}
+			m, _ := c.DCNetEntity.VerifiableEncodeForRound(roundID, ownerSlot, payload)
+			relay.DecodeClient(roundID, i, m)
+		}
+		if err := relay.DecodeTrustee(roundID, 0, tg.Trustees[0].DCNetEntity.TrusteeEncodeForRound(roundID)); err != nil {
+			t.Error("Honest trustee 0 should be accepted, but", err)
+		}
+
+		// trustee 1 changes its commitments to client 2's pads to frame it, or sends a cipher without them
+		c, err := VerifiableDCNetCipherFromBytes(suite, tg.Trustees[1].DCNetEntity.TrusteeEncodeForRound(roundID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tamper == "commitment" {
+			c.Commitments[2*len(c.Ciphers)] = suite.Point().Pick(suite.RandomStream())
+		} else {
+			c.Commitments = c.Commitments[:len(c.Ciphers)]
+		}
+		if err := relay.DecodeTrustee(roundID, 1, c.ToBytes()); err == nil {
+			t.Error("The", tamper, "of trustee 1 should be refused")
+		}
+
+		if bad := relay.VerifyClientCiphers(roundID, ownerSlot); len(bad) != 0 {
+			t.Error("Clients should not be blamed on unproven commitments, got", bad)
+		}
+		_, _, disruption := relay.DecodeCell(roundID, false)
+		if disruption == nil || len(disruption.Trustees) != 1 || disruption.Trustees[0] != 1 || len(disruption.Clients) != 0 {
+			t.Error("The round should be reported as disrupted by trustee 1, got", disruption)
+		}
+	}
+}
+
+func TestVerifiableDCNetCipherEncoding(t *testing.T) {
+
+	suite := config.CryptoSuite
+	c := new(VerifiableDCNetCipher)
+	c.Ciphers = []kyber.Point{suite.Point().Pick(suite.RandomStream()), suite.Point().Base()}
+	c.Commitments = []kyber.Point{suite.Point().Null()}
+	c.Proof = randomBytes(20)
+
+	c2, err := VerifiableDCNetCipherFromBytes(config.CryptoSuite, c.ToBytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c2.Ciphers) != 2 || !c2.Ciphers[0].Equal(c.Ciphers[0]) || !c2.Ciphers[1].Equal(c.Ciphers[1]) {
+		t.Error("Ciphers not decoded correctly")
+	}
+	if len(c2.Commitments) != 1 || !c2.Commitments[0].Equal(c.Commitments[0]) {
+		t.Error("Commitments not decoded correctly")
+	}
+	if !bytes.Equal(c2.Proof, c.Proof) {
+		t.Error("Proof not decoded correctly")
+	}
+
+	if _, err := VerifiableDCNetCipherFromBytes(config.CryptoSuite, []byte{0, 0, 0, 9}); err == nil {
+		t.Error("Should not decode a truncated cipher")
+	}
+}
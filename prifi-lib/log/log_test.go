@@ -2,6 +2,7 @@ package log
 
 import (
 	"testing"
+	"time"
 )
 
 func TestBWStatistics(t *testing.T) {
@@ -21,6 +22,20 @@ func TestLatencyStatistics(t *testing.T) {
 	b.Report()
 }
 
+func TestPacingStatistics(t *testing.T) {
+	b := NewPacingStatistics()
+	b.AddTick(false, 0)
+	b.AddTick(true, 10*time.Millisecond)
+	b.AddTick(true, 30*time.Millisecond)
+	b.AddMissedTick()
+	if n, wait := b.DataWaited(); n != 2 || wait != 20*time.Millisecond {
+		t.Error("Data waited twice, for 20 ms on average; got", n, wait)
+	}
+	if b.Report() == "" {
+		t.Error("The first report should be printed")
+	}
+}
+
 func TestUtils(t *testing.T) {
 	//round
 	if Round(float64(6.3)) != 6 {
@@ -0,0 +1,80 @@
+package log
+
+import (
+	"fmt"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+)
+
+// PacingStatistics holds how the rounds opened on the clock of the relay's round pacing
+type PacingStatistics struct {
+	nextReport  time.Time
+	period      time.Duration
+	reportNo    int
+	ticks       int
+	missedTicks int
+	dataWaited  int
+	totalWait   time.Duration
+	maxWait     time.Duration
+}
+
+// NewPacingStatistics create a new PacingStatistics struct, with a period (for reporting) of 5 second
+func NewPacingStatistics() *PacingStatistics {
+	fiveSec := time.Duration(5) * time.Second
+	stats := PacingStatistics{
+		nextReport: time.Now(),
+		period:     fiveSec,
+		reportNo:   0}
+	return &stats
+}
+
+// AddTick records a tick which opened a round. If data was waiting, wait is how long it waited for the tick
+func (stats *PacingStatistics) AddTick(dataWaited bool, wait time.Duration) {
+	stats.ticks++
+	if !dataWaited {
+		return
+	}
+	stats.dataWaited++
+	stats.totalWait += wait
+	if wait > stats.maxWait {
+		stats.maxWait = wait
+	}
+}
+
+// AddMissedTick records a tick which could not open a round, as the window was full
+func (stats *PacingStatistics) AddMissedTick() {
+	stats.missedTicks++
+}
+
+// DataWaited returns the number of ticks at which data was waiting, and the mean wait
+func (stats *PacingStatistics) DataWaited() (int, time.Duration) {
+	if stats.dataWaited == 0 {
+		return 0, 0
+	}
+	return stats.dataWaited, stats.totalWait / time.Duration(stats.dataWaited)
+}
+
+// Report prints (if t>period=5 seconds have passed since the last report) all the information
+func (stats *PacingStatistics) Report() string {
+	now := time.Now()
+	if now.After(stats.nextReport) {
+
+		share := 0.0
+		if stats.ticks > 0 {
+			share = RoundWithPrecision(100*float64(stats.dataWaited)/float64(stats.ticks), 2)
+		}
+		_, meanWait := stats.DataWaited()
+
+		//human-readable output
+		str := fmt.Sprintf("[%v] Pacing: %v rounds opened on a tick, data waited in %v (%v%%), for %v ms on average (max %v ms); %v ticks missed (window full)",
+			stats.reportNo, stats.ticks, stats.dataWaited, share, meanWait.Nanoseconds()/1e6, stats.maxWait.Nanoseconds()/1e6, stats.missedTicks)
+		log.Lvl1(str)
+
+		stats.nextReport = now.Add(stats.period)
+		stats.reportNo++
+
+		return str
+	}
+	return ""
+}
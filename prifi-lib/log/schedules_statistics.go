@@ -32,13 +32,11 @@ func NewSchedulesStatistics() *SchedulesStatistics {
 }
 
 //AddLatency adds a latency to the stored latency array, and removes the oldest one if there are more than MAX_LATENCY_STORED
-func (stats *SchedulesStatistics) AddSchedule(newSchedule map[int]bool) {
+func (stats *SchedulesStatistics) AddSchedule(newSchedule map[int]int) {
 	scheduleLength := 0
 
-	for _, v := range newSchedule {
-		if v {
-			scheduleLength++
-		}
+	for _, cells := range newSchedule {
+		scheduleLength += cells
 	}
 
 	stats.scheduleLengthRepartitions[scheduleLength]++
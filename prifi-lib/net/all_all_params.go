@@ -1,16 +1,20 @@
 package net
 
 import (
+	"encoding/hex"
+
 	"go.dedis.ch/kyber/v3"
 )
 
 // ALL_ALL_PARAMETERS message contains all the parameters used by the protocol.
 type ALL_ALL_PARAMETERS struct {
-	TrusteesPks []kyber.Point // only filled when the relay sends this to the clients
-	ForceParams bool
-	ParamsInt   map[string]int
-	ParamsStr   map[string]string
-	ParamsBool  map[string]bool
+	TrusteesPks           []kyber.Point // only filled when the relay sends this to the clients
+	TrusteesSessionPks    []kyber.Point // only filled when the relay sends this to the clients
+	TrusteesSessionPkSigs []ByteArray   // only filled when the relay sends this to the clients
+	ForceParams           bool
+	ParamsInt             map[string]int
+	ParamsStr             map[string]string
+	ParamsBool            map[string]bool
 }
 
 /**
@@ -33,6 +37,8 @@ func (m *ALL_ALL_PARAMETERS) Add(key string, val interface{}) {
 			m.ParamsBool = make(map[string]bool)
 		}
 		m.ParamsBool[key] = typedVal
+	case []byte: // sent as a hex string
+		m.Add(key, hex.EncodeToString(typedVal))
 	}
 
 }
@@ -66,3 +72,15 @@ func (m *ALL_ALL_PARAMETERS) StringValueOrElse(key string, elseVal string) strin
 	}
 	return elseVal
 }
+
+/**
+ * From the message, returns the "data[key]" if it exists and was added as []byte, or "elseVal"
+ */
+func (m *ALL_ALL_PARAMETERS) BytesValueOrElse(key string, elseVal []byte) []byte {
+	if val, ok := m.ParamsStr[key]; ok {
+		if b, err := hex.DecodeString(val); err == nil {
+			return b
+		}
+	}
+	return elseVal
+}
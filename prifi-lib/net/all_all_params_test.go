@@ -12,6 +12,7 @@ func TestUtils(t *testing.T) {
 	m.Add("key1", "val1")
 	m.Add("key2", 123)
 	m.Add("key3", true)
+	m.Add("key4", []byte{1, 2, 255})
 
 	if m.ParamsStr["key1"] != "val1" {
 		t.Error("key1 should equals val1")
@@ -32,6 +33,9 @@ func TestUtils(t *testing.T) {
 	if m.BoolValueOrElse("key3", false) != true {
 		t.Error("key3 should equals true")
 	}
+	if b := m.BytesValueOrElse("key4", nil); len(b) != 3 || b[0] != 1 || b[2] != 255 {
+		t.Error("key4 should equals [1 2 255]")
+	}
 
 	if m.StringValueOrElse("key5", "else") != "else" {
 		t.Error("non-existent key should return elseVal")
@@ -42,6 +46,12 @@ func TestUtils(t *testing.T) {
 	if m.BoolValueOrElse("key7", false) != false {
 		t.Error("non-existent key should return elseVal")
 	}
+	if m.BytesValueOrElse("key8", []byte{7}) == nil {
+		t.Error("non-existent key should return elseVal")
+	}
+	if m.BytesValueOrElse("key1", nil) != nil {
+		t.Error("a key that is not hex-encoded should return elseVal")
+	}
 }
 
 func TestEncodeDecodeStdMessage(t *testing.T) {
@@ -29,6 +29,19 @@ import (
 // TRU_REL_TELL_NEW_BASE_AND_EPH_PKS
 // TRU_REL_TELL_PK
 // REL_TRU_TELL_RATE_CHANGE
+// TRU_REL_KEY_SHARES
+// REL_TRU_RECOVER_TRUSTEE
+// TRU_TRU_PING
+// TRU_TRU_PONG
+// TRU_TRU_RECOVERY_PARTIALS
+// TRU_REL_TRUSTEE_REPLACED
+// REL_CLI_RESHUFFLE_REQUEST
+// CLI_REL_RESHUFFLE_EPH_PK
+// REL_TRU_TELL_SKIPPED_ROUNDS
+// REL_CLI_CORRUPTED_RESERVATIONS
+// REL_ALL_RESERVATION_REVEAL
+// CLI_REL_RESERVATION_REVEAL
+// TRU_REL_RESERVATION_REVEAL
 
 //not used yet :
 // REL_CLI_DOWNSTREAM_DATA
@@ -41,9 +54,11 @@ type ALL_ALL_SHUTDOWN struct {
 // CLI_REL_TELL_PK_AND_EPH_PK message contains the public key and ephemeral key of a client
 // and is sent to the relay.
 type CLI_REL_TELL_PK_AND_EPH_PK struct {
-	ClientID int
-	Pk       kyber.Point
-	EphPk    kyber.Point
+	ClientID     int
+	Pk           kyber.Point
+	EphPk        kyber.Point
+	SessionPk    kyber.Point // the DC-net secrets of the session are derived from it
+	SessionPkSig []byte      // the signature of SessionPk by Pk, see crypto.NewSessionKeyPair
 }
 
 // CLI_REL_UPSTREAM_DATA message contains the upstream data of a client for a given round
@@ -70,6 +85,16 @@ type REL_CLI_DOWNSTREAM_DATA struct {
 	Data                       []byte
 	FlagResync                 bool
 	FlagOpenClosedRequest      bool
+	UpstreamPayloadSize        int   // length of the upstream cells of this round, 0 for the session's PayloadSize
+	SubCellOwners              []int // if the upstream cell is split in sub-cells, the owner of each (-1 if none)
+}
+
+// SubCellSize returns the length of each sub-cell of an upstream payload of payloadSize bytes
+func (m *REL_CLI_DOWNSTREAM_DATA) SubCellSize(payloadSize int) int {
+	if len(m.SubCellOwners) == 0 {
+		return payloadSize
+	}
+	return payloadSize / len(m.SubCellOwners)
 }
 
 //Converts []ByteArray -> [][]byte and returns it
@@ -81,20 +106,37 @@ func (m *REL_CLI_TELL_EPH_PKS_AND_TRUSTEES_SIG) GetSignatures() [][]byte {
 	return out
 }
 
+//Converts []ByteArray -> [][]byte and returns it
+func (m *REL_CLI_TELL_EPH_PKS_AND_TRUSTEES_SIG) GetVerifiableDCNetKeys() [][]byte {
+	out := make([][]byte, 0)
+	for k := range m.VerifiableDCNetKeys {
+		out = append(out, m.VerifiableDCNetKeys[k].Bytes)
+	}
+	return out
+}
+
 // REL_CLI_TELL_EPH_PKS_AND_TRUSTEES_SIG message contains the ephemeral public keys and the signatures
 // of the trustees and is sent by the relay to the client.
+// A ShuffleEpoch > 0 is the result of a reshuffle, the clients switch to it in round SwitchRound.
 type REL_CLI_TELL_EPH_PKS_AND_TRUSTEES_SIG struct {
-	Base         kyber.Point
-	EphPks       []kyber.Point
-	TrusteesSigs []ByteArray
+	Base                kyber.Point
+	EphPks              []kyber.Point
+	TrusteesSigs        []ByteArray
+	VerifiableDCNetKeys []ByteArray
+	ShuffleEpoch        int   // 0 for the shuffle of the setup
+	SwitchRound         int32 // the first round using this shuffle, only if ShuffleEpoch > 0
 }
 
 // REL_TRU_TELL_CLIENTS_PKS_AND_EPH_PKS_AND_BASE message contains the public keys and ephemeral keys
 // of the clients and is sent by the relay to the trustees.
+// A ShuffleEpoch > 0 is a reshuffle of new ephemeral keys during the session, Pks is then empty.
 type REL_TRU_TELL_CLIENTS_PKS_AND_EPH_PKS_AND_BASE struct {
-	Pks    []kyber.Point
-	EphPks []kyber.Point
-	Base   kyber.Point
+	Pks           []kyber.Point
+	SessionPks    []kyber.Point
+	SessionPkSigs []ByteArray
+	EphPks        []kyber.Point
+	Base          kyber.Point
+	ShuffleEpoch  int // 0 for the shuffle of the setup
 }
 
 //protobuf can't handle [][]abstract.Point, so we do []PublicKeyArray
@@ -125,12 +167,27 @@ func (m *REL_TRU_TELL_TRANSCRIPT) GetProofs() [][]byte {
 	return out
 }
 
+//Converts []ByteArray -> [][]byte and returns it
+func (m *REL_TRU_TELL_TRANSCRIPT) GetVerifiableDCNetKeys() [][]byte {
+	out := make([][]byte, 0)
+	for k := range m.VerifiableDCNetKeys {
+		out = append(out, m.VerifiableDCNetKeys[k].Bytes)
+	}
+	return out
+}
+
 // REL_TRU_TELL_TRANSCRIPT message contains all the shuffles perfomrmed in a Neff shuffle round.
 // It is sent by the relay to the trustees to be verified.
 type REL_TRU_TELL_TRANSCRIPT struct {
-	Bases  []kyber.Point
-	EphPks []PublicKeyArray
-	Proofs []ByteArray
+	InitialEphPks         []kyber.Point // the clients' keys, before the first shuffle
+	Bases                 []kyber.Point
+	EphPks                []PublicKeyArray
+	Proofs                []ByteArray
+	VerifiableDCNetKeys   []ByteArray
+	TrusteesPks           []kyber.Point // only set with threshold trustees, the trustees share their session keys with each other
+	TrusteesSessionPks    []kyber.Point // only set with threshold trustees
+	TrusteesSessionPkSigs []ByteArray   // only set with threshold trustees
+	ShuffleEpoch          int           // 0 for the shuffle of the setup
 }
 
 // TRU_REL_DC_CIPHER message contains the DC-net cipher of a trustee for a given round and is sent to the relay.
@@ -142,8 +199,9 @@ type TRU_REL_DC_CIPHER struct {
 
 // TRU_REL_SHUFFLE_SIG contains the signatures shuffled by a trustee and is sent to the relay.
 type TRU_REL_SHUFFLE_SIG struct {
-	TrusteeID int
-	Sig       []byte
+	TrusteeID    int
+	Sig          []byte
+	ShuffleEpoch int // 0 for the shuffle of the setup
 }
 
 // REL_TRU_TELL_RATE_CHANGE message asks the trustees to update their window capacity to adapt their
@@ -152,6 +210,13 @@ type REL_TRU_TELL_RATE_CHANGE struct {
 	WindowCapacity int
 }
 
+// REL_TRU_TELL_SKIPPED_ROUNDS message tells the trustees that the rounds FirstRound to LastRound (included) will
+// not be opened, as all slots are closed, and is sent by the relay. The trustees send no cipher for them.
+type REL_TRU_TELL_SKIPPED_ROUNDS struct {
+	FirstRound int32
+	LastRound  int32
+}
+
 // TRU_REL_TELL_NEW_BASE_AND_EPH_PKS message contains the new ephemeral key of a trustee and
 // is sent to the relay.
 type TRU_REL_TELL_NEW_BASE_AND_EPH_PKS struct {
@@ -159,12 +224,29 @@ type TRU_REL_TELL_NEW_BASE_AND_EPH_PKS struct {
 	NewEphPks          []kyber.Point
 	Proof              []byte
 	VerifiableDCNetKey []byte
+	ShuffleEpoch       int // 0 for the shuffle of the setup
+}
+
+// REL_CLI_RESHUFFLE_REQUEST asks the clients for new ephemeral keys, to be shuffled in shuffle epoch ShuffleEpoch
+// while the current one keeps communicating, and is sent by the relay.
+type REL_CLI_RESHUFFLE_REQUEST struct {
+	ShuffleEpoch int
 }
 
-// TRU_REL_TELL_PK message contains the public key of a trustee and is sent to the relay.
+// CLI_REL_RESHUFFLE_EPH_PK contains the new ephemeral key of a client for shuffle epoch ShuffleEpoch,
+// and is sent to the relay.
+type CLI_REL_RESHUFFLE_EPH_PK struct {
+	ClientID     int
+	ShuffleEpoch int
+	EphPk        kyber.Point
+}
+
+// TRU_REL_TELL_PK message contains the public key and the session key of a trustee and is sent to the relay.
 type TRU_REL_TELL_PK struct {
-	TrusteeID int
-	Pk        kyber.Point
+	TrusteeID    int
+	Pk           kyber.Point
+	SessionPk    kyber.Point // the DC-net secrets of the session are derived from it
+	SessionPkSig []byte      // the signature of SessionPk by Pk, see crypto.NewSessionKeyPair
 }
 
 /*
@@ -193,7 +275,8 @@ func (m *REL_CLI_DOWNSTREAM_DATA_UDP) ToBytes() ([]byte, error) {
 
 	//convert the message to bytes
 	hashLen := len(m.REL_CLI_DOWNSTREAM_DATA.HashOfPreviousUpstreamData)
-	buf := make([]byte, 4+4+4+hashLen+len(m.REL_CLI_DOWNSTREAM_DATA.Data)+4+4)
+	nSubCells := len(m.REL_CLI_DOWNSTREAM_DATA.SubCellOwners)
+	buf := make([]byte, 4+4+4+hashLen+4+4*nSubCells+len(m.REL_CLI_DOWNSTREAM_DATA.Data)+4+4+4)
 
 	resyncInt := 0
 	if m.REL_CLI_DOWNSTREAM_DATA.FlagResync {
@@ -204,7 +287,7 @@ func (m *REL_CLI_DOWNSTREAM_DATA_UDP) ToBytes() ([]byte, error) {
 		openclosedInt = 1
 	}
 
-	// [0:4 roundID] [4:8 OwnershipID] [8:12 Length of Hash] [Variable: Hash] [8:end-8 data] [end-8:end-4 resyncFlag] [end-4:end openClosedFlag]
+	// [0:4 roundID] [4:8 OwnershipID] [8:12 Length of Hash] [Variable: Hash] [4: number of sub-cells] [4 per sub-cell: owner] [Variable:end-12 data] [end-12:end-8 upstreamPayloadSize] [end-8:end-4 resyncFlag] [end-4:end openClosedFlag]
 	binary.BigEndian.PutUint32(buf[0:4], uint32(m.REL_CLI_DOWNSTREAM_DATA.RoundID))
 	binary.BigEndian.PutUint32(buf[4:8], uint32(m.REL_CLI_DOWNSTREAM_DATA.OwnershipID))
 	binary.BigEndian.PutUint32(buf[8:12], uint32(hashLen))
@@ -213,10 +296,17 @@ func (m *REL_CLI_DOWNSTREAM_DATA_UDP) ToBytes() ([]byte, error) {
 		copy(buf[12:12+hashLen], m.REL_CLI_DOWNSTREAM_DATA.HashOfPreviousUpstreamData)
 		startIndex += hashLen
 	}
+	binary.BigEndian.PutUint32(buf[startIndex:startIndex+4], uint32(nSubCells))
+	startIndex += 4
+	for _, owner := range m.REL_CLI_DOWNSTREAM_DATA.SubCellOwners {
+		binary.BigEndian.PutUint32(buf[startIndex:startIndex+4], uint32(owner))
+		startIndex += 4
+	}
 
+	binary.BigEndian.PutUint32(buf[len(buf)-12:len(buf)-8], uint32(m.REL_CLI_DOWNSTREAM_DATA.UpstreamPayloadSize))
 	binary.BigEndian.PutUint32(buf[len(buf)-8:len(buf)-4], uint32(resyncInt)) //todo : to be coded on one byte
 	binary.BigEndian.PutUint32(buf[len(buf)-4:], uint32(openclosedInt))       //todo : to be coded on one byte
-	copy(buf[startIndex:len(buf)-8], m.REL_CLI_DOWNSTREAM_DATA.Data)
+	copy(buf[startIndex:len(buf)-12], m.REL_CLI_DOWNSTREAM_DATA.Data)
 
 	return buf, nil
 
@@ -225,20 +315,36 @@ func (m *REL_CLI_DOWNSTREAM_DATA_UDP) ToBytes() ([]byte, error) {
 // FromBytes decodes the message contained in the message's byteEncoded field.
 func (m *REL_CLI_DOWNSTREAM_DATA_UDP) FromBytes(buffer []byte) (interface{}, error) {
 
-	//the smallest message is 4 bytes, indicating a length of 0
-	if len(buffer) < 8 { //4 (roundID) + 4 (flagResync)
-		e := "Messages.go : FromBytes() : cannot decode, smaller than 8 bytes"
+	//the smallest message has no hash and no data
+	if len(buffer) < 28 { //4 (roundID) + 4 (OwnershipID) + 4 (Length of Hash) + 4 (number of sub-cells) + 4 (upstreamPayloadSize) + 4 (flagResync) + 4 (flagOpenClosed)
+		e := "Messages.go : FromBytes() : cannot decode, smaller than 28 bytes"
 		return REL_CLI_DOWNSTREAM_DATA_UDP{}, errors.New(e)
 	}
 
-	// [0:4 roundID] [4:8 OwnershipID] [8:12 Length of Hash] [Variable: Hash] [8:end-8 data] [end-8:end-4 resyncFlag] [end-4:end openClosedFlag]
+	// [0:4 roundID] [4:8 OwnershipID] [8:12 Length of Hash] [Variable: Hash] [4: number of sub-cells] [4 per sub-cell: owner] [Variable:end-12 data] [end-12:end-8 upstreamPayloadSize] [end-8:end-4 resyncFlag] [end-4:end openClosedFlag]
 	roundID := int32(binary.BigEndian.Uint32(buffer[0:4]))
 	ownerShipID := int(binary.BigEndian.Uint32(buffer[4:8]))
 	hashLen := int(binary.BigEndian.Uint32(buffer[8:12]))
+	if hashLen < 0 || 12+hashLen+4 > len(buffer)-12 {
+		e := "Messages.go : FromBytes() : cannot decode, invalid hash length"
+		return REL_CLI_DOWNSTREAM_DATA_UDP{}, errors.New(e)
+	}
+	nSubCells := int(binary.BigEndian.Uint32(buffer[12+hashLen : 12+hashLen+4]))
+	dataStart := 12 + hashLen + 4 + 4*nSubCells
+	if nSubCells < 0 || dataStart > len(buffer)-12 {
+		e := "Messages.go : FromBytes() : cannot decode, invalid number of sub-cells"
+		return REL_CLI_DOWNSTREAM_DATA_UDP{}, errors.New(e)
+	}
+	var subCellOwners []int
+	for i := 0; i < nSubCells; i++ {
+		pos := 12 + hashLen + 4 + 4*i
+		subCellOwners = append(subCellOwners, int(int32(binary.BigEndian.Uint32(buffer[pos:pos+4]))))
+	}
+	upstreamPayloadSize := int(binary.BigEndian.Uint32(buffer[len(buffer)-12 : len(buffer)-8]))
 	flagResyncInt := int(binary.BigEndian.Uint32(buffer[len(buffer)-8 : len(buffer)-4]))
 	flagOpenClosedInt := int(binary.BigEndian.Uint32(buffer[len(buffer)-4:]))
 	hashOfPreviousUpstreamData := buffer[12 : 12+hashLen]
-	data := buffer[12+hashLen : len(buffer)-8]
+	data := buffer[dataStart : len(buffer)-12]
 
 	flagResync := false
 	if flagResyncInt == 1 {
@@ -249,7 +355,7 @@ func (m *REL_CLI_DOWNSTREAM_DATA_UDP) FromBytes(buffer []byte) (interface{}, err
 		flagOpenClosed = true
 	}
 
-	innerMessage := REL_CLI_DOWNSTREAM_DATA{roundID, ownerShipID, hashOfPreviousUpstreamData, data, flagResync, flagOpenClosed}
+	innerMessage := REL_CLI_DOWNSTREAM_DATA{roundID, ownerShipID, hashOfPreviousUpstreamData, data, flagResync, flagOpenClosed, upstreamPayloadSize, subCellOwners}
 	resultMessage := REL_CLI_DOWNSTREAM_DATA_UDP{innerMessage}
 
 	return resultMessage, nil
@@ -293,25 +399,124 @@ type TRU_REL_DISRUPTION_REVEAL struct {
 	Pval      map[string]kyber.Point
 }
 
-// REL_ALL_REVEAL_SHARED_SECRETS contains request ro reveal the shared secret with the specified recipient, and is sent by the relay
+// REL_ALL_REVEAL_SHARED_SECRETS contains request ro reveal the secret shared with the specified recipient, and is sent by the relay.
+// Only the seed of the pads of the key epoch of round RoundID is revealed (see CLI_REL_EPOCH_SEED), the shared secrets are erased
 type REL_ALL_REVEAL_SHARED_SECRETS struct {
 	EntityID int
+	RoundID  int32
 }
 
-// CLI_REL_SHARED_SECRET contains the shared secret requested by the relay, with a proof we computed it correctly
-type CLI_REL_SHARED_SECRET struct {
+// CLI_REL_EPOCH_SEED contains the seed of the pads shared with a trustee in one key epoch, requested by the relay.
+// Seed is empty if the keys of the epoch were erased
+type CLI_REL_EPOCH_SEED struct {
 	ClientID  int
 	TrusteeID int
-	Secret    kyber.Point
-	NIZK      []byte
-	Pub       map[string]kyber.Point
+	Epoch     int32
+	Seed      []byte
 }
 
-// TRU_REL_SHARED_SECRET contains the shared secret requested by the relay, with a proof we computed it correctly
-type TRU_REL_SHARED_SECRET struct {
+// TRU_REL_EPOCH_SEED contains the seed of the pads shared with a client in one key epoch, requested by the relay.
+// Seed is empty if the keys of the epoch were erased
+type TRU_REL_EPOCH_SEED struct {
 	TrusteeID int
 	ClientID  int
-	Secret    kyber.Point
-	NIZK      []byte
-	Pub       map[string]kyber.Point
+	Epoch     int32
+	Seed      []byte
+}
+
+// CLI_REL_SEED_COMMITMENTS contains the commitments to the seeds of the pads shared with each trustee in one key epoch,
+// sent before the first cipher of the epoch (see dcnet.SeedCommitment)
+type CLI_REL_SEED_COMMITMENTS struct {
+	ClientID    int
+	Epoch       int32
+	Commitments [][]byte
+}
+
+// TRU_REL_SEED_COMMITMENTS contains the commitments to the seeds of the pads shared with each client in one key epoch,
+// sent before the first cipher of the epoch (see dcnet.SeedCommitment)
+type TRU_REL_SEED_COMMITMENTS struct {
+	TrusteeID   int
+	Epoch       int32
+	Commitments [][]byte
+}
+
+// TRU_REL_KEY_SHARES contains the shares of a trustee's session private key, each encrypted to another trustee, with the
+// commitments to the sharing polynomial, and is sent to the relay when the trustees are threshold trustees
+type TRU_REL_KEY_SHARES struct {
+	TrusteeID       int
+	EncryptedShares []ByteArray
+	Commitments     []kyber.Point
+}
+
+// REL_TRU_RECOVER_TRUSTEE asks a trustee to use its share of a missing trustee's session key to compute the partial
+// secrets shared by the missing trustee and the clients, and is sent by the relay. The partial secrets are sent to the
+// substitute trustee, which computes the missing trustee's ciphers from round FirstRoundID on
+type REL_TRU_RECOVER_TRUSTEE struct {
+	MissingTrusteeID    int
+	SubstituteTrusteeID int
+	FirstRoundID        int32
+	EncryptedShare      []byte
+	Commitments         []kyber.Point
+}
+
+// TRU_TRU_PING checks that a trustee is online, and is sent directly to it by another trustee, not through the relay
+type TRU_TRU_PING struct {
+	TrusteeID int
+}
+
+// TRU_TRU_PONG answers a TRU_TRU_PING, and is sent directly to the trustee that asked
+type TRU_TRU_PONG struct {
+	TrusteeID int
+}
+
+// TRU_TRU_RECOVERY_PARTIALS contains the partial secrets of a missing trustee, computed with our share of its key,
+// with one proof per client that they were computed correctly. They are encrypted to the substitute trustee, and sent
+// directly to it
+type TRU_TRU_RECOVERY_PARTIALS struct {
+	TrusteeID         int
+	MissingTrusteeID  int
+	EncryptedPartials []byte
+}
+
+// TRU_REL_TRUSTEE_REPLACED tells the relay that we recovered the secrets of a missing trustee, and send its ciphers
+// from now on
+type TRU_REL_TRUSTEE_REPLACED struct {
+	TrusteeID        int
+	MissingTrusteeID int
+}
+
+// REL_CLI_CORRUPTED_RESERVATIONS contains the decoded reservation vector of an open/closed round in which some
+// reservations were altered, and is sent by the relay. The owners of the altered slots look for the bits they can blame
+type REL_CLI_CORRUPTED_RESERVATIONS struct {
+	RoundID      int32
+	Reservations []byte
+}
+
+// REL_ALL_RESERVATION_REVEAL asks to reveal the pads at a bit of the reservation vector of an open/closed round, as
+// blamed by the owner of the bit's slot, and is sent by the relay. Sent to the trustees, it carries the consent of
+// each client to the reveal, indexed by client ID
+type REL_ALL_RESERVATION_REVEAL struct {
+	RoundID   int32
+	BitPos    int
+	Signature []byte // the blame, signed by the owner of the bit's slot
+	Consents  []ByteArray
+}
+
+// CLI_REL_RESERVATION_REVEAL contains the bits of the pads shared with each trustee at the blamed bit, with the
+// client's consent to the reveal, and is sent to the relay
+type CLI_REL_RESERVATION_REVEAL struct {
+	ClientID int
+	RoundID  int32
+	BitPos   int
+	Bits     map[int]int
+	Consent  []byte
+}
+
+// TRU_REL_RESERVATION_REVEAL contains the bits of the pads shared with each client at the blamed bit, and is sent to
+// the relay
+type TRU_REL_RESERVATION_REVEAL struct {
+	TrusteeID int
+	RoundID   int32
+	BitPos    int
+	Bits      map[int]int
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/rand"
 	"errors"
+	"github.com/dedis/prifi/prifi-lib/config"
 	"github.com/dedis/prifi/prifi-lib/crypto"
 	"go.dedis.ch/kyber/v3"
 	"testing"
@@ -126,8 +127,8 @@ func TestTELL_TRANSCRIPT_Message(t *testing.T) {
 
 	msg := new(REL_TRU_TELL_TRANSCRIPT)
 	pks := make([]kyber.Point, 2)
-	pks[0], _ = crypto.NewKeyPair()
-	pks[1], _ = crypto.NewKeyPair()
+	pks[0], _ = crypto.NewKeyPair(config.CryptoSuite)
+	pks[1], _ = crypto.NewKeyPair(config.CryptoSuite)
 	msg.EphPks = make([]PublicKeyArray, 1)
 	msg.EphPks[0] = PublicKeyArray{Keys: pks}
 
@@ -152,6 +153,8 @@ func TestUDPMessage(t *testing.T) {
 	content.FlagResync = true
 	content.Data = genDataSlice()
 	content.FlagOpenClosedRequest = true
+	content.UpstreamPayloadSize = 64
+	content.SubCellOwners = []int{3, -1, 0}
 
 	msg.SetContent(*content)
 
@@ -186,6 +189,18 @@ func TestUDPMessage(t *testing.T) {
 	if !bytes.Equal(parsedMsg.Data, content.Data) {
 		t.Error("Data unparsed incorrectly")
 	}
+	if parsedMsg.FlagOpenClosedRequest != content.FlagOpenClosedRequest {
+		t.Error("FlagOpenClosedRequest unparsed incorrectly")
+	}
+	if parsedMsg.UpstreamPayloadSize != content.UpstreamPayloadSize {
+		t.Error("UpstreamPayloadSize unparsed incorrectly")
+	}
+	if len(parsedMsg.SubCellOwners) != 3 || parsedMsg.SubCellOwners[0] != 3 || parsedMsg.SubCellOwners[1] != -1 || parsedMsg.SubCellOwners[2] != 0 {
+		t.Error("SubCellOwners unparsed incorrectly")
+	}
+	if parsedMsg.SubCellSize(100) != 33 {
+		t.Error("Each of the 3 sub-cells of a 100-byte payload should have 33 bytes, got", parsedMsg.SubCellSize(100))
+	}
 
 	//this should fail, cannot read the size if len<4
 	void = new(REL_CLI_DOWNSTREAM_DATA_UDP)
@@ -62,6 +62,13 @@ func NewPriFiRelay(dataOutputEnabled bool, dataForClients chan []byte, dataFromD
 	return p
 }
 
+// SetDisruptorHandler sets the function the relay calls with the clients it found disrupting the session
+func (p *PriFiLibInstance) SetDisruptorHandler(handler func([]int)) {
+	if r, ok := p.specializedLibInstance.(*relay.PriFiLibRelayInstance); ok {
+		r.SetDisruptorHandler(handler)
+	}
+}
+
 // NewPriFiTrustee creates a new PriFi trustee
 func NewPriFiTrustee(neverSlowDown bool, alwaysSlowDown bool, baseSleepTime int, msgSender net.MessageSender) *PriFiLibInstance {
 	//msw := newMessageSenderWrapper(msgSender)
@@ -25,7 +25,8 @@ type BufferableRoundManager struct {
 	clientAckMap  map[int]bool
 	trusteeAckMap map[int]bool
 
-	//hold the real data. map(trustee/clientID -> map( roundID -> data))
+	//hold the real data. map(trustee/clientID -> map( roundID -> data)). The data is nil once the cipher has been decoded,
+	//only its reception is remembered
 	bufferedClientCiphers  map[int]map[int32][]byte
 	bufferedTrusteeCiphers map[int]map[int32][]byte
 
@@ -35,6 +36,9 @@ type BufferableRoundManager struct {
 	//remember who was the last owner, next is this+1
 	lastOwner int
 
+	//number of owners of a round, each owning a sub-cell. 1 unless the rounds are split in sub-cells
+	ownersPerRound int
+
 	//initially equal to 1 (the first round where the relay has downstream data), then happens after schedule
 	nextOCSlotRound int32
 
@@ -44,8 +48,14 @@ type BufferableRoundManager struct {
 	//when we open a round, we keep the start time to measure round duration
 	openRounds map[int32]time.Time
 
-	//holds the schedule, i.e. which ownerslot will be skipped in the future. Keys are in [0, nclients[
-	storedOwnerSchedule map[int]bool
+	//holds the schedule, i.e. how many cells each ownerslot gets per period (0 = skipped). Keys are in [0, nSlots[
+	storedOwnerSchedule map[int]int
+
+	//the cells each ownerslot still gets in this period of the schedule
+	remainingCells map[int]int
+
+	//the rounds that will never be opened, as all slots are closed. Their IDs are skipped
+	skippedRounds map[int32]bool
 
 	//stop/resume functions when we have too much/little ciphers
 	DoSendStopResumeMessages bool
@@ -157,6 +167,7 @@ func NewBufferableRoundManager(nClients, nTrustees, maxNumberOfConcurrentRounds
 	b.maxNumberOfConcurrentRounds = maxNumberOfConcurrentRounds
 	b.lastRoundClosed = -1 // next is round 0
 	b.lastOwner = -1       // next is client 0
+	b.ownersPerRound = 1
 	b.nextOCSlotRound = 1  // first is 1, the first downstream data from relay
 
 	b.resetACKmaps()
@@ -164,6 +175,7 @@ func NewBufferableRoundManager(nClients, nTrustees, maxNumberOfConcurrentRounds
 	b.dataAlreadySent = make(map[int32]*net.REL_CLI_DOWNSTREAM_DATA)
 	b.openRounds = make(map[int32]time.Time)
 	b.storedOwnerSchedule = nil
+	b.skippedRounds = make(map[int32]bool)
 
 	b.bufferedClientCiphers = make(map[int]map[int32][]byte)
 	b.bufferedTrusteeCiphers = make(map[int]map[int32][]byte)
@@ -209,7 +221,7 @@ func (b *BufferableRoundManager) NextRoundToOpen() int32 {
 	return b.nextRoundToOpen()
 }
 
-// NextRoundToOpen returns the next round to open. If none are open, uses the "lastRoundClosed"+1. Does not skip the planned closed rounds.
+// NextRoundToOpen returns the next round to open. If none are open, uses the "lastRoundClosed"+1. Skips the planned closed rounds.
 func (b *BufferableRoundManager) nextRoundToOpen() int32 {
 	anyRoundOpen, currentRound := b.currentRound()
 
@@ -220,11 +232,11 @@ func (b *BufferableRoundManager) nextRoundToOpen() int32 {
 		nextRoundCandidate = currentRound + 1
 	}
 
-	// shift while that round is already opened
+	// shift while that round is already opened, or skipped
 	_, found := b.openRounds[nextRoundCandidate]
 
 	// check already opened
-	for found {
+	for found || b.skippedRounds[nextRoundCandidate] {
 		nextRoundCandidate++
 		_, found = b.openRounds[nextRoundCandidate]
 	}
@@ -232,6 +244,48 @@ func (b *BufferableRoundManager) nextRoundToOpen() int32 {
 	return nextRoundCandidate
 }
 
+// CanOpenNextRound returns true if the next round to open is in the window, i.e., less than maxNumberOfConcurrentRounds
+// rounds after the current one. Skipped rounds count in the window, as the clients apply the schedules a window after
+// their request
+func (b *BufferableRoundManager) CanOpenNextRound() bool {
+	b.Lock()
+	defer b.Unlock()
+
+	anyRoundOpen, currentRound := b.currentRound()
+	if !anyRoundOpen {
+		return true
+	}
+	return len(b.openRounds) < b.maxNumberOfConcurrentRounds &&
+		b.nextRoundToOpen() < currentRound+int32(b.maxNumberOfConcurrentRounds)
+}
+
+// SkipRounds marks the rounds firstRound to lastRound (included) as never opened, and discards their buffered ciphers
+func (b *BufferableRoundManager) SkipRounds(firstRound, lastRound int32) {
+	b.Lock()
+	defer b.Unlock()
+
+	for roundID := firstRound; roundID <= lastRound; roundID++ {
+		b.skippedRounds[roundID] = true
+		for _, ciphers := range b.bufferedClientCiphers {
+			delete(ciphers, roundID)
+		}
+		for _, ciphers := range b.bufferedTrusteeCiphers {
+			delete(ciphers, roundID)
+		}
+	}
+	for trusteeID := range b.bufferedTrusteeCiphers {
+		b.sendRateChangeIfNeeded(trusteeID)
+	}
+}
+
+// IsRoundSkipped returns true if the round will never be opened
+func (b *BufferableRoundManager) IsRoundSkipped(roundID int32) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.skippedRounds[roundID]
+}
+
 // UpdateAndGetNextOwnerID returns the next slot owner.
 func (b *BufferableRoundManager) UpdateAndGetNextOwnerID() int {
 	b.Lock()
@@ -240,9 +294,34 @@ func (b *BufferableRoundManager) UpdateAndGetNextOwnerID() int {
 	return b.updateAndGetNextOwnerID()
 }
 
+// SetOwnersPerRound sets the number of sub-cells of a round, each with its own owner
+func (b *BufferableRoundManager) SetOwnersPerRound(ownersPerRound int) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.ownersPerRound = ownersPerRound
+}
+
+// UpdateAndGetNextOwnerIDs computes the owners of the sub-cells of the next round, -1 for a sub-cell nobody owns
+func (b *BufferableRoundManager) UpdateAndGetNextOwnerIDs() []int {
+	b.Lock()
+	defer b.Unlock()
+
+	owners := make([]int, b.ownersPerRound)
+	for i := range owners {
+		owners[i] = b.updateAndGetNextOwnerID()
+	}
+	return owners
+}
+
 func (b *BufferableRoundManager) updateAndGetNextOwnerID() int {
 
-	nextOwnerIDCandidate := (b.lastOwner + 1) % b.nClients
+	// the schedule might have more slots than clients
+	nSlots := b.nClients
+	if len(b.storedOwnerSchedule) > 0 {
+		nSlots = len(b.storedOwnerSchedule)
+	}
+	nextOwnerIDCandidate := (b.lastOwner + 1) % nSlots
 
 	if b.storedOwnerSchedule == nil || len(b.storedOwnerSchedule) == 0 {
 
@@ -250,24 +329,37 @@ func (b *BufferableRoundManager) updateAndGetNextOwnerID() int {
 		return nextOwnerIDCandidate // valid since no schedule
 	}
 
-	open, found := b.storedOwnerSchedule[nextOwnerIDCandidate]
-
-	// check if disabled in the schedule, iterate until find a non-closed slot (or go further than the schedule in time)
-	loopCount := 0
-	for found && !open {
-		nextOwnerIDCandidate = (nextOwnerIDCandidate + 1) % b.nClients
-		open, found = b.storedOwnerSchedule[nextOwnerIDCandidate]
-
-		if loopCount == len(b.storedOwnerSchedule) {
+	// the slots are served in turns, one cell per turn, until they got all their cells. Hence a slot asking for many
+	// cells does not delay the others by more than one turn. Then, the period restarts
+	if !b.hasRemainingCells() {
+		for slot, cells := range b.storedOwnerSchedule {
+			b.remainingCells[slot] = cells
+		}
+		if !b.hasRemainingCells() {
 			return -1 // all slots closed
 		}
-		loopCount++
 	}
+	for loopCount := 0; b.remainingCells[nextOwnerIDCandidate] <= 0; loopCount++ {
+		if loopCount == nSlots {
+			return -1 // the cells left are outside of the schedule
+		}
+		nextOwnerIDCandidate = (nextOwnerIDCandidate + 1) % nSlots
+	}
+	b.remainingCells[nextOwnerIDCandidate]--
 
 	b.lastOwner = nextOwnerIDCandidate
 	return nextOwnerIDCandidate
 }
 
+func (b *BufferableRoundManager) hasRemainingCells() bool {
+	for _, cells := range b.remainingCells {
+		if cells > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 // Open next round, fetch the buffered ciphers, reset the ACK map
 func (b *BufferableRoundManager) OpenNextRound() int32 {
 	b.Lock()
@@ -290,6 +382,13 @@ func (b *BufferableRoundManager) OpenNextRound() int32 {
 	b.dataAlreadySent[roundID] = nil
 	b.openRounds[roundID] = time.Now()
 
+	//forget the skipped rounds we passed
+	for skippedRoundID := range b.skippedRounds {
+		if skippedRoundID < roundID {
+			delete(b.skippedRounds, skippedRoundID)
+		}
+	}
+
 	//if no round was opened before, then by opening this one, you need to pull the already-buffered ciphers
 	if !anyRoundOpen {
 		b.resetACKmaps()
@@ -309,7 +408,27 @@ func (b *BufferableRoundManager) OpenNextRound() int32 {
 	return roundID
 }
 
-// CloseRound finalizes this round, returning all ciphers stored, then increasing the round number. Should only be called when HasAllCiphersForCurrentRound() == true
+// TakeBufferedCiphers returns the ciphers received for the given round and not decoded yet, indexed by client/trustee ID.
+// Their data is discarded, but their reception is still remembered
+func (b *BufferableRoundManager) TakeBufferedCiphers(roundID int32) (map[int][]byte, map[int][]byte) {
+	b.Lock()
+	defer b.Unlock()
+
+	return takeFromBuffer(b.bufferedClientCiphers, roundID), takeFromBuffer(b.bufferedTrusteeCiphers, roundID)
+}
+
+func takeFromBuffer(buffer map[int]map[int32][]byte, roundID int32) map[int][]byte {
+	out := make(map[int][]byte)
+	for entityID, ciphers := range buffer {
+		if data := ciphers[roundID]; data != nil {
+			out[entityID] = data
+			ciphers[roundID] = nil
+		}
+	}
+	return out
+}
+
+// CollectRoundData returns the ciphers stored for the current round (nil for the ciphers already decoded), and discards them
 func (b *BufferableRoundManager) CollectRoundData() ([][]byte, [][]byte, error) {
 	b.Lock()
 	defer b.Unlock()
@@ -460,26 +579,62 @@ func (b *BufferableRoundManager) NextDownstreamRoundForOpenClosedRequest() int32
 	return b.nextOCSlotRound
 }
 
-// SetStoredRoundSchedule stores the schedule, and resets the nextOwner to be 0
-func (b *BufferableRoundManager) SetStoredRoundSchedule(s map[int]bool) {
+// SetStoredRoundSchedule stores the schedule (the number of cells of each slot), and resets the nextOwner to be 0
+func (b *BufferableRoundManager) SetStoredRoundSchedule(s map[int]int) {
 	b.Lock()
 	defer b.Unlock()
 
 	b.storedOwnerSchedule = s
 
 	//next OCSlotRound is right at the end of this schedule. maxKey != nClients
-	numberOfOpenSlots := 0
-	for _, isSlotOpen := range s {
-		if isSlotOpen {
-			numberOfOpenSlots++
+	numberOfCells := 0
+	b.remainingCells = make(map[int]int)
+	for slot, cells := range s {
+		if cells > 0 {
+			numberOfCells += cells
+			b.remainingCells[slot] = cells
 		}
 	}
 
 	b.lastOwner = -1 //this resets the owner schedule
 
 	_, currentRoundID := b.currentRound()
-	//there will be numberOfOpenSlots after this one for data, then, next one is OC slot
-	b.nextOCSlotRound = currentRoundID + int32(numberOfOpenSlots) + int32(b.maxNumberOfConcurrentRounds) + 1
+	//there will be numberOfCells after this one for data (fewer rounds with sub-cells), then, next one is OC slot
+	numberOfRounds := (numberOfCells + b.ownersPerRound - 1) / b.ownersPerRound
+	b.nextOCSlotRound = currentRoundID + int32(numberOfRounds) + int32(b.maxNumberOfConcurrentRounds) + 1
+
+	//all slots closed, the rounds would have no owner. The next one is directly an OC slot
+	if numberOfRounds == 0 {
+		b.nextOCSlotRound = b.nextRoundToOpen()
+	}
+}
+
+// IsScheduleClosed returns true if there is a schedule, and all its slots are closed: no round has an owner
+func (b *BufferableRoundManager) IsScheduleClosed() bool {
+	b.Lock()
+	defer b.Unlock()
+
+	if len(b.storedOwnerSchedule) == 0 {
+		return false // the owners take turns
+	}
+	for _, cells := range b.storedOwnerSchedule {
+		if cells > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ResetSchedule forgets the stored schedule, whose slots no longer exist (e.g., the slots were reshuffled). The owners
+// take turns until the next schedule, and the next round to open is an open/closed request
+func (b *BufferableRoundManager) ResetSchedule() {
+	b.Lock()
+	defer b.Unlock()
+
+	b.storedOwnerSchedule = nil
+	b.remainingCells = nil
+	b.lastOwner = -1
+	b.nextOCSlotRound = b.nextRoundToOpen()
 }
 
 // SetDataAlreadySent sets the "DataAlreadySent" field for the given round
@@ -510,6 +665,18 @@ func (b *BufferableRoundManager) GetDataAlreadySent(roundID int32) *net.REL_CLI_
 
 // AddTrusteeCipher adds a trustee cipher for a given round
 func (b *BufferableRoundManager) AddTrusteeCipher(roundID int32, trusteeID int, data []byte) error {
+	if data == nil {
+		return errors.New("Can't accept a nil trustee cipher")
+	}
+	return b.addTrusteeCipher(roundID, trusteeID, data)
+}
+
+// AddDecodedTrusteeCipher records the reception of a trustee cipher that the caller already decoded; the cipher itself is not stored
+func (b *BufferableRoundManager) AddDecodedTrusteeCipher(roundID int32, trusteeID int) error {
+	return b.addTrusteeCipher(roundID, trusteeID, nil)
+}
+
+func (b *BufferableRoundManager) addTrusteeCipher(roundID int32, trusteeID int, data []byte) error {
 	b.Lock()
 	defer b.Unlock()
 
@@ -518,12 +685,12 @@ func (b *BufferableRoundManager) AddTrusteeCipher(roundID int32, trusteeID int,
 	//	log.Fatal("Can't add trustee cipher, no round opened")
 	//}
 
-	if data == nil {
-		return errors.New("Can't accept a nil trustee cipher")
-	}
 	if roundID < currendRound {
 		return errors.New("Can't accept a trustee cipher in the past")
 	}
+	if b.skippedRounds[roundID] {
+		return errors.New("Can't accept a trustee cipher for a skipped round")
+	}
 	b.addToBuffer(&b.bufferedTrusteeCiphers, roundID, trusteeID, data)
 
 	if roundID == currendRound {
@@ -537,6 +704,18 @@ func (b *BufferableRoundManager) AddTrusteeCipher(roundID int32, trusteeID int,
 
 // AddClientCipher adds a client cipher for a given round
 func (b *BufferableRoundManager) AddClientCipher(roundID int32, clientID int, data []byte) error {
+	if data == nil {
+		return errors.New("Can't accept a nil client cipher")
+	}
+	return b.addClientCipher(roundID, clientID, data)
+}
+
+// AddDecodedClientCipher records the reception of a client cipher that the caller already decoded; the cipher itself is not stored
+func (b *BufferableRoundManager) AddDecodedClientCipher(roundID int32, clientID int) error {
+	return b.addClientCipher(roundID, clientID, nil)
+}
+
+func (b *BufferableRoundManager) addClientCipher(roundID int32, clientID int, data []byte) error {
 
 	b.Lock()
 	defer b.Unlock()
@@ -547,12 +726,12 @@ func (b *BufferableRoundManager) AddClientCipher(roundID int32, clientID int, da
 		log.Fatal("Can't add client cipher, no round opened")
 	}
 
-	if data == nil {
-		return errors.New("Can't accept a nil client cipher")
-	}
 	if roundID < currendRound {
 		return errors.New("Can't accept a client cipher in the past")
 	}
+	if b.skippedRounds[roundID] {
+		return errors.New("Can't accept a client cipher for a skipped round")
+	}
 	b.addToBuffer(&b.bufferedClientCiphers, roundID, clientID, data)
 
 	if roundID == currendRound {
@@ -611,6 +790,19 @@ func (b *BufferableRoundManager) MissingCiphersForCurrentRound() ([]int, []int)
 	return clientMissing, trusteeMissing
 }
 
+// OpenRounds returns the IDs of the open rounds, in increasing order
+func (b *BufferableRoundManager) OpenRounds() []int32 {
+	b.Lock()
+	defer b.Unlock()
+
+	rounds := make([]int32, 0, len(b.openRounds))
+	for roundID := range b.openRounds {
+		rounds = append(rounds, roundID)
+	}
+	sort.Slice(rounds, func(i, j int) bool { return rounds[i] < rounds[j] })
+	return rounds
+}
+
 // IsRoundOpenend checks if we are in the given round (ie, used to check if we are stuck)
 func (b *BufferableRoundManager) IsRoundOpenend(roundID int32) bool {
 	b.Lock()
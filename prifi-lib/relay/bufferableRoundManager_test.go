@@ -64,10 +64,10 @@ func TestOwnerSlots(test *testing.T) {
 
 	//relay sends an OC slot request
 	//client 0 and 2 reserve
-	schedule := make(map[int]bool)
-	schedule[0] = true
-	schedule[1] = false
-	schedule[2] = true
+	schedule := make(map[int]int)
+	schedule[0] = 1
+	schedule[1] = 0
+	schedule[2] = 1
 	//non-specified are false/closed by definition
 
 	b.SetStoredRoundSchedule(schedule)
@@ -105,6 +105,122 @@ func TestOwnerSlots(test *testing.T) {
 	}
 }
 
+func TestDemandWeightedOwnerSlots(test *testing.T) {
+
+	window := 1
+	nClients := 4
+	nTrustees := 1
+	b := NewBufferableRoundManager(nClients, nTrustees, window)
+	b.OpenNextRound()
+
+	//slot 0 asks for 3 cells, slot 2 for one; slot 2 gets its cell before slot 0 is done, then the turns go on
+	b.SetStoredRoundSchedule(map[int]int{0: 3, 1: 0, 2: 1, 3: 0})
+	if b.NextDownstreamRoundForOpenClosedRequest() != 0+4+1+1 {
+		test.Error("The next OC round should come after the 4 cells, got", b.NextDownstreamRoundForOpenClosedRequest())
+	}
+	expected := []int{0, 2, 0, 0, 2, 0, 0, 0}
+	for i, owner := range expected {
+		if got := b.UpdateAndGetNextOwnerID(); got != owner {
+			test.Error("Owner", i, "should be", owner, "got", got)
+		}
+	}
+
+	//every slot closed, the next round asks for a new schedule
+	b.SetStoredRoundSchedule(map[int]int{0: 0, 1: 0, 2: 0, 3: 0})
+	if b.NextDownstreamRoundForOpenClosedRequest() != 1 {
+		test.Error("The next OC round should be the next round to open, got", b.NextDownstreamRoundForOpenClosedRequest())
+	}
+	if b.UpdateAndGetNextOwnerID() != -1 {
+		test.Error("All slots are closed, there should be no owner")
+	}
+}
+
+func TestSubCellOwners(test *testing.T) {
+
+	window := 1
+	nClients := 4
+	nTrustees := 1
+	b := NewBufferableRoundManager(nClients, nTrustees, window)
+	b.SetOwnersPerRound(2)
+	b.OpenNextRound()
+
+	//without schedule, the sub-cells go round-robin
+	for i, expected := range [][]int{{0, 1}, {2, 3}, {0, 1}} {
+		owners := b.UpdateAndGetNextOwnerIDs()
+		if len(owners) != 2 || owners[0] != expected[0] || owners[1] != expected[1] {
+			test.Error("Round", i, "should have owners", expected, "got", owners)
+		}
+	}
+
+	//with two owners per round, the 5 cells take 3 rounds; the schedule restarts once every cell was given
+	b.SetStoredRoundSchedule(map[int]int{0: 3, 1: 0, 2: 2, 3: 0})
+	if b.NextDownstreamRoundForOpenClosedRequest() != 0+3+1+1 {
+		test.Error("The next OC round should come after 3 rounds, got", b.NextDownstreamRoundForOpenClosedRequest())
+	}
+	for i, expected := range [][]int{{0, 2}, {0, 2}, {0, 2}} {
+		owners := b.UpdateAndGetNextOwnerIDs()
+		if owners[0] != expected[0] || owners[1] != expected[1] {
+			test.Error("Round", i, "should have owners", expected, "got", owners)
+		}
+	}
+	//a sub-cell nobody owns has owner -1
+	b.SetStoredRoundSchedule(map[int]int{0: 0, 1: 0, 2: 0, 3: 0})
+	if owners := b.UpdateAndGetNextOwnerIDs(); owners[0] != -1 || owners[1] != -1 {
+		test.Error("All slots are closed, there should be no owner, got", owners)
+	}
+}
+
+func TestSkippedRounds(test *testing.T) {
+
+	window := 3
+	nClients := 2
+	nTrustees := 1
+	b := NewBufferableRoundManager(nClients, nTrustees, window)
+	data := []byte{1, 2, 3}
+
+	//all slots closed
+	b.OpenNextRound()
+	b.SetStoredRoundSchedule(map[int]int{0: 0, 1: 0})
+	if !b.IsScheduleClosed() {
+		test.Error("All slots are closed, the schedule should be closed")
+	}
+	b.AddTrusteeCipher(2, 0, data)
+	b.SkipRounds(1, 2)
+	if !b.IsRoundSkipped(1) || !b.IsRoundSkipped(2) || b.IsRoundSkipped(3) {
+		test.Error("Rounds 1 and 2 should be skipped")
+	}
+	if b.NumberOfBufferedCiphers(0) != 0 {
+		test.Error("The ciphers of the skipped rounds should be discarded")
+	}
+	if b.AddTrusteeCipher(1, 0, data) == nil || b.AddClientCipher(2, 0, data) == nil {
+		test.Error("The ciphers of the skipped rounds should be refused")
+	}
+
+	//the next round is 3, but it is a window after round 0
+	if b.NextRoundToOpen() != 3 {
+		test.Error("The next round to open should be 3, got", b.NextRoundToOpen())
+	}
+	if b.CanOpenNextRound() {
+		test.Error("Round 3 should not be opened while round 0 is open")
+	}
+	b.AddClientCipher(0, 0, data)
+	b.AddClientCipher(0, 1, data)
+	b.AddTrusteeCipher(0, 0, data)
+	b.CloseRound()
+	if !b.CanOpenNextRound() || b.OpenNextRound() != 3 {
+		test.Error("Round 3 should be opened once round 0 is closed")
+	}
+	if b.IsRoundSkipped(1) {
+		test.Error("The skipped rounds we passed should be forgotten")
+	}
+
+	//the owners take turns without schedule
+	b.ResetSchedule()
+	if b.IsScheduleClosed() {
+		test.Error("Without schedule, the owners take turns")
+	}
+}
+
 func TestRoundSuccessionWithSchedule(test *testing.T) {
 
 	window := 10
@@ -158,9 +274,9 @@ func TestRoundSuccessionWithSchedule(test *testing.T) {
 	}
 
 	//setting a round to closed should *not* skip it, only change ownership stuff
-	s := make(map[int]bool, 2)
-	s[2] = false
-	s[4] = false
+	s := make(map[int]int, 2)
+	s[2] = 0
+	s[4] = 0
 	b.SetStoredRoundSchedule(s)
 	if b.storedOwnerSchedule == nil || len(b.storedOwnerSchedule) != len(s) || b.storedOwnerSchedule[0] != s[0] {
 		test.Error("b.storedOwnerSchedule should be s")
@@ -437,6 +553,60 @@ func TestCipherBuffering(test *testing.T) {
 	}
 }
 
+func TestDecodedCiphers(test *testing.T) {
+
+	nClients := 2
+	nTrustees := 1
+	b := NewBufferableRoundManager(nClients, nTrustees, 2)
+	b.OpenNextRound()
+	b.OpenNextRound()
+
+	clientSlice := genDataSlice()
+	trusteeSlice := genDataSlice()
+
+	//round 1 is not decoded yet, its ciphers are buffered
+	b.AddClientCipher(1, 1, clientSlice)
+	b.AddTrusteeCipher(1, 0, trusteeSlice)
+
+	//round 0 is decoded on arrival, only the reception is recorded
+	b.AddDecodedClientCipher(0, 0)
+	b.AddDecodedClientCipher(0, 1)
+	b.AddDecodedTrusteeCipher(0, 0)
+	if !b.HasAllCiphersForCurrentRound() {
+		test.Error("BufferManager does have all ciphers")
+	}
+	clients, trustees := b.TakeBufferedCiphers(0)
+	if len(clients) != 0 || len(trustees) != 0 {
+		test.Error("Decoded ciphers should not be stored")
+	}
+	if err := b.AddDecodedClientCipher(-1, 0); err == nil {
+		test.Error("Shouldn't be able to add a cipher in the past")
+	}
+	if err := b.CloseRound(); err != nil {
+		test.Error("BufferManager should be able to finalize round", err)
+	}
+
+	//taking the ciphers of round 1 does not forget their reception
+	clients, trustees = b.TakeBufferedCiphers(1)
+	if len(clients) != 1 || !bytes.Equal(clients[1], clientSlice) {
+		test.Error("TakeBufferedCiphers should return the client cipher of round 1")
+	}
+	if len(trustees) != 1 || !bytes.Equal(trustees[0], trusteeSlice) {
+		test.Error("TakeBufferedCiphers should return the trustee cipher of round 1")
+	}
+	clients, trustees = b.TakeBufferedCiphers(1)
+	if len(clients) != 0 || len(trustees) != 0 {
+		test.Error("TakeBufferedCiphers should return the ciphers only once")
+	}
+	c, t := b.MissingCiphersForCurrentRound()
+	if len(c) != 1 || c[0] != 0 || len(t) != 0 {
+		test.Error("BufferManager did not compute correctly the missing ciphers", c, t)
+	}
+	if b.NumberOfBufferedCiphers(0) != 1 {
+		test.Error("Number of ciphers for trustee 0 should be 1")
+	}
+}
+
 func TestRateLimiter(test *testing.T) {
 
 	window := 100
@@ -1,12 +1,14 @@
 package relay
 
 import (
-	"github.com/dedis/prifi/prifi-lib/config"
+	"bytes"
+	"errors"
+
+	"github.com/dedis/prifi/prifi-lib/dcnet"
 	"github.com/dedis/prifi/prifi-lib/net"
-	"go.dedis.ch/kyber/v3"
+	"github.com/dedis/prifi/prifi-lib/scheduler"
 	"go.dedis.ch/onet/v3/log"
 
-	"fmt"
 	"go.dedis.ch/kyber/v3/proof"
 	"strconv"
 )
@@ -14,7 +16,7 @@ import (
 // Received_CLI_REL_BLAME
 func (p *PriFiLibRelayInstance) Received_CLI_REL_DISRUPTION_BLAME(msg net.CLI_REL_DISRUPTION_BLAME) error {
 	pred := proof.Rep("X", "x", "B")
-	suite := config.CryptoSuite
+	suite := p.relayState.CryptoSuite
 	//B := suite.Point().Base()
 	/*for _, key := range(p.relayState.EphemeralPublicKeys) {
 		pval := map[string]kyber.Point{"B": B, "X": key}
@@ -43,6 +45,7 @@ func (p *PriFiLibRelayInstance) Received_CLI_REL_DISRUPTION_BLAME(msg net.CLI_RE
 	}
 	p.relayState.blamingData.RoundID = msg.RoundID
 	p.relayState.blamingData.BitPos = msg.BitPos
+	p.relayState.blamingData.ScheduleRound = false
 
 	// broadcast to all trustees
 	for j := 0; j < p.relayState.nTrustees; j++ {
@@ -73,7 +76,7 @@ func (p *PriFiLibRelayInstance) Received_CLI_REL_DISRUPTION_REVEAL(msg net.CLI_R
 
 	log.Lvl1("Disruption Phase 1: Received bits from Client", msg.ClientID, "value", msg.Bits)
 	var pred_array []proof.Predicate
-	suite := config.CryptoSuite
+	suite := p.relayState.CryptoSuite
 	for i := 1; i < p.relayState.nTrustees; i++ {
 		i_string := strconv.Itoa(i)
 		pred_array = append(pred_array, proof.Rep("T"+i_string, "t"+i_string, "B"))
@@ -95,14 +98,7 @@ func (p *PriFiLibRelayInstance) Received_CLI_REL_DISRUPTION_REVEAL(msg net.CLI_R
 		log.Lvl1("Disruption Phase 1: Trustee", msg.ClientID, ", is consistent with itself, checking mismatches with all trustees...")
 		mismatch := p.checkMismatchingPairs()
 		if mismatch {
-			toClient := &net.REL_ALL_REVEAL_SHARED_SECRETS{
-				EntityID: p.relayState.blamingData.TrusteeID,
-			}
-			toTrustee := &net.REL_ALL_REVEAL_SHARED_SECRETS{
-				EntityID: p.relayState.blamingData.ClientID,
-			}
-			p.messageSender.SendToTrusteeWithLog(p.relayState.blamingData.ClientID, toTrustee, "")
-			p.messageSender.SendToClientWithLog(p.relayState.blamingData.TrusteeID, toClient, "")
+			p.requestSharedSecrets()
 		} else {
 			log.Fatal("Disruption Phase 2: No mismatching pairs ? this should never occur.")
 		}
@@ -124,7 +120,7 @@ func (p *PriFiLibRelayInstance) Received_TRU_REL_DISRUPTION_REVEAL(msg net.TRU_R
 	log.Lvl1("Disruption Phase 1: Received bits from Trustee", msg.TrusteeID, "value", msg.Bits)
 
 	var pred_array []proof.Predicate
-	suite := config.CryptoSuite
+	suite := p.relayState.CryptoSuite
 	for i := 1; i < p.relayState.nTrustees; i++ {
 		i_string := strconv.Itoa(i)
 		pred_array = append(pred_array, proof.Rep("T"+i_string, "t"+i_string, "B"))
@@ -145,14 +141,7 @@ func (p *PriFiLibRelayInstance) Received_TRU_REL_DISRUPTION_REVEAL(msg net.TRU_R
 		log.Lvl1("Disruption Phase 1: Trustee", msg.TrusteeID, ", is consistent with itself, checking mismatches with all clients...")
 		mismatch := p.checkMismatchingPairs()
 		if mismatch {
-			toClient := &net.REL_ALL_REVEAL_SHARED_SECRETS{
-				EntityID: p.relayState.blamingData.TrusteeID,
-			}
-			toTrustee := &net.REL_ALL_REVEAL_SHARED_SECRETS{
-				EntityID: p.relayState.blamingData.ClientID,
-			}
-			p.messageSender.SendToTrusteeWithLog(p.relayState.blamingData.ClientID, toTrustee, "")
-			p.messageSender.SendToClientWithLog(p.relayState.blamingData.TrusteeID, toClient, "")
+			p.requestSharedSecrets()
 		} else {
 			log.Fatal("Disruption Phase 2: No mismatching pairs ? this should never occur.")
 		}
@@ -210,107 +199,225 @@ func (p *PriFiLibRelayInstance) checkMismatchingPairs() bool {
 }
 
 /*
-Received_TRU_REL_SHARED_SECRETS handles TRU_REL_SECRET messages
-Check the NIZK, if correct regenerate the cipher up to the disrupted round and check if this trustee is the disruptor
+requestSharedSecrets asks the client and the trustee whose bits mismatch to reveal the seed of their pads in the key
+epoch of the blamed round, which says nothing of the other epochs. Their shared secrets are erased, they cannot be
+revealed.
 */
-func (p *PriFiLibRelayInstance) Received_TRU_REL_SHARED_SECRETS(msg net.TRU_REL_SHARED_SECRET) error {
-	log.Lvl1("Disruption Phase 2: Received shared secret from Trustee", msg.TrusteeID, "for client", msg.ClientID, "value", msg.Secret)
-
-	M := "SHAREDKEY"
-	X := make([]kyber.Point, 1)
-	X[0] = p.relayState.trustees[msg.TrusteeID].PublicKey
-	preds := make([]proof.Predicate, len(X))
-	for i := range X {
-		name := fmt.Sprintf("X[%d]", i) // "X[0]","X[1]",...
-		msg.Pub[name] = X[i]            // public point value
-
-		// Predicate indicates knowledge of the private key for X[i]
-		// and correspondence of the key with the linkage tag
-		preds[i] = proof.And(proof.Rep(name, "x", "B"), proof.Rep("T", "x", "BT"))
-	}
-	pred := proof.Or(preds...) // make a big Or predicate
-	suite := config.CryptoSuite
-	// Verify the signature
-	verifier := pred.Verifier(suite, msg.Pub)
-	err := proof.HashVerify(suite, M, verifier, msg.NIZK)
-	if err != nil {
-		log.Error("signature failed to verify: ", err)
+func (p *PriFiLibRelayInstance) requestSharedSecrets() {
+	b := &p.relayState.blamingData
+	b.ClientEpochSeed, b.TrusteeEpochSeed = nil, nil
+	b.ClientSeedRevealed, b.TrusteeSeedRevealed = false, false
+
+	toClient := &net.REL_ALL_REVEAL_SHARED_SECRETS{
+		EntityID: b.TrusteeID,
+		RoundID:  b.RoundID,
 	}
-	log.Lvl3("Linkable Ring Signature verified.")
+	toTrustee := &net.REL_ALL_REVEAL_SHARED_SECRETS{
+		EntityID: b.ClientID,
+		RoundID:  b.RoundID,
+	}
+	p.messageSender.SendToClientWithLog(b.ClientID, toClient, "")
+	p.messageSender.SendToTrusteeWithLog(b.TrusteeID, toTrustee, "")
+}
 
-	val := p.replayRounds(msg.Secret)
-	if val != p.relayState.blamingData.TrusteeBitRevealed {
-		log.Fatal("Disruption Phase 2: Disruptor is Trustee", msg.TrusteeID, ".")
-	} else {
-		log.Lvl1("Disruption Phase 2: Trustee", msg.TrusteeID, "didn't lie, so it should be Client", msg.ClientID, ".")
+/*
+Received_CLI_REL_EPOCH_SEED handles CLI_REL_EPOCH_SEED messages, the seed of the pads a client shares with a trustee in
+the key epoch of the blamed round. Once the trustee's seed is received too, they are compared.
+*/
+func (p *PriFiLibRelayInstance) Received_CLI_REL_EPOCH_SEED(msg net.CLI_REL_EPOCH_SEED) error {
+	b := &p.relayState.blamingData
+	if msg.ClientID != b.ClientID || msg.TrusteeID != b.TrusteeID || msg.Epoch != p.relayState.DCNet.EpochOfRound(b.RoundID) {
+		return errors.New("Relay : unexpected epoch seed from client " + strconv.Itoa(msg.ClientID) + " for trustee " +
+			strconv.Itoa(msg.TrusteeID) + " in epoch " + strconv.Itoa(int(msg.Epoch)))
+	}
+	log.Lvl1("Disruption Phase 2: Received the seed of epoch", msg.Epoch, "from Client", msg.ClientID, "for Trustee", msg.TrusteeID)
+
+	b.ClientEpochSeed = msg.Seed
+	b.ClientSeedRevealed = true
+	if b.TrusteeSeedRevealed {
+		p.replayEpoch()
 	}
 	return nil
 }
 
 /*
-Received_CLI_REL_SHARED_SECRET handles CLI_REL_SECRET messages
-Check the NIZK, if correct regenerate the cipher up to the disrupted round and check if this client is the disruptor
+Received_TRU_REL_EPOCH_SEED handles TRU_REL_EPOCH_SEED messages, the seed of the pads a trustee shares with a client in
+the key epoch of the blamed round. Once the client's seed is received too, they are compared.
 */
-func (p *PriFiLibRelayInstance) Received_CLI_REL_SHARED_SECRET(msg net.CLI_REL_SHARED_SECRET) error {
-	log.Lvl1("Disruption Phase 2: Received shared secret from Client", msg.ClientID, "for Trustee", msg.TrusteeID, "value", msg.Secret)
-
-	M := "SHAREDKEY"
-	X := make([]kyber.Point, 1)
-	X[0] = p.relayState.trustees[msg.TrusteeID].PublicKey
-	preds := make([]proof.Predicate, len(X))
-	for i := range X {
-		name := fmt.Sprintf("X[%d]", i) // "X[0]","X[1]",...
-		msg.Pub[name] = X[i]            // public point value
-
-		// Predicate indicates knowledge of the private key for X[i]
-		// and correspondence of the key with the linkage tag
-		preds[i] = proof.And(proof.Rep(name, "x", "B"), proof.Rep("T", "x", "BT"))
-	}
-	pred := proof.Or(preds...) // make a big Or predicate
-	suite := config.CryptoSuite
-	// Verify the signature
-	verifier := pred.Verifier(suite, msg.Pub)
-	err := proof.HashVerify(suite, M, verifier, msg.NIZK)
-	if err != nil {
-		log.Error("signature failed to verify: ", err)
+func (p *PriFiLibRelayInstance) Received_TRU_REL_EPOCH_SEED(msg net.TRU_REL_EPOCH_SEED) error {
+	b := &p.relayState.blamingData
+	if msg.ClientID != b.ClientID || msg.TrusteeID != b.TrusteeID || msg.Epoch != p.relayState.DCNet.EpochOfRound(b.RoundID) {
+		return errors.New("Relay : unexpected epoch seed from trustee " + strconv.Itoa(msg.TrusteeID) + " for client " +
+			strconv.Itoa(msg.ClientID) + " in epoch " + strconv.Itoa(int(msg.Epoch)))
 	}
-	log.Lvl3("Linkable Ring Signature verified.")
+	log.Lvl1("Disruption Phase 2: Received the seed of epoch", msg.Epoch, "from Trustee", msg.TrusteeID, "for Client", msg.ClientID)
 
-	val := p.replayRounds(msg.Secret)
-	if val != p.relayState.blamingData.ClientBitRevealed {
-		log.Fatal("Disruption Phase 2: Disruptor is Client", msg.ClientID, ".")
-	} else {
-		log.Lvl1("Disruption Phase 2: Client", msg.ClientID, "didn't lie, so it should be Client", msg.TrusteeID, ".")
+	b.TrusteeEpochSeed = msg.Seed
+	b.TrusteeSeedRevealed = true
+	if b.ClientSeedRevealed {
+		p.replayEpoch()
 	}
 	return nil
 }
 
 /*
-replayRounds takes the secret revealed by a user and recomputes until the disrupted bit
+replayEpoch recomputes the disrupted bit from the epoch seeds revealed by the client and the trustee. Each seed must
+match the commitment its sender made before the epoch was decoded, otherwise the sender lied (or withheld its
+commitment). If both seeds match, they are the real one, unless the client and the trustee committed to different
+seeds, and the one whose bit differs from the pad lied.
 */
-func (p *PriFiLibRelayInstance) replayRounds(secret kyber.Point) int {
-	seed, err := secret.MarshalBinary()
+func (p *PriFiLibRelayInstance) replayEpoch() {
+	b := &p.relayState.blamingData
+	epoch := p.relayState.DCNet.EpochOfRound(b.RoundID)
+	switch {
+	case !p.seedMatchesCommitment(true, b.ClientID, b.TrusteeID, epoch, b.ClientEpochSeed):
+		log.Error("Disruption Phase 2: Client", b.ClientID, "revealed a seed it did not commit to in epoch", epoch)
+		p.disruptorFound(true, b.ClientID)
+	case !p.seedMatchesCommitment(false, b.ClientID, b.TrusteeID, epoch, b.TrusteeEpochSeed):
+		log.Error("Disruption Phase 2: Trustee", b.TrusteeID, "revealed a seed it did not commit to in epoch", epoch)
+		p.disruptorFound(false, b.TrusteeID)
+	case !bytes.Equal(b.ClientEpochSeed, b.TrusteeEpochSeed):
+		// their pads never cancelled in this epoch; one of them committed to a wrong seed, we cannot tell which
+		if b.ScheduleRound {
+			log.Error("Disruption Phase 2: Client", b.ClientID, "and Trustee", b.TrusteeID, "committed to different seeds in epoch", epoch)
+			return
+		}
+		log.Fatal("Disruption Phase 2: Client", b.ClientID, "and Trustee", b.TrusteeID, "committed to different seeds in epoch", epoch, ", one of them is the disruptor.")
+	default:
+		val := p.blamedPadBit(p.relayState.DCNet.EpochRoundPad(b.ClientEpochSeed, b.RoundID))
+		if val != b.ClientBitRevealed {
+			p.disruptorFound(true, b.ClientID)
+		} else {
+			p.disruptorFound(false, b.TrusteeID)
+		}
+	}
+}
+
+// the commitments of the clients and the trustees to the seeds of their pads in one key epoch
+type seedCommitments struct {
+	clients  map[int][][]byte // clientID -> one commitment per trustee
+	trustees map[int][][]byte // trusteeID -> one commitment per client
+}
+
+// Received_CLI_REL_SEED_COMMITMENTS handles CLI_REL_SEED_COMMITMENTS messages, the commitments of a client to the seeds
+// of its pads in a key epoch
+func (p *PriFiLibRelayInstance) Received_CLI_REL_SEED_COMMITMENTS(msg net.CLI_REL_SEED_COMMITMENTS) error {
+	if msg.ClientID < 0 || msg.ClientID >= p.relayState.nClients || len(msg.Commitments) != p.relayState.nTrustees {
+		return errors.New("Relay : invalid seed commitments from client " + strconv.Itoa(msg.ClientID))
+	}
+	c, err := p.openSeedCommitments(msg.Epoch)
 	if err != nil {
-		log.Fatal("Could not extract data from shared key", err)
+		return errors.New("Relay : refusing the seed commitments of client " + strconv.Itoa(msg.ClientID) + ", " + err.Error())
+	}
+	if _, found := c.clients[msg.ClientID]; found {
+		return errors.New("Relay : client " + strconv.Itoa(msg.ClientID) + " already committed to its seeds of epoch " + strconv.Itoa(int(msg.Epoch)))
 	}
-	sharedPRNG := config.CryptoSuite.XOF(seed)
+	c.clients[msg.ClientID] = msg.Commitments
+	return nil
+}
 
-	round := int32(0)
-	disruptive_round := p.relayState.blamingData.RoundID
-	for round < disruptive_round {
+// Received_TRU_REL_SEED_COMMITMENTS handles TRU_REL_SEED_COMMITMENTS messages, the commitments of a trustee to the seeds
+// of its pads in a key epoch
+func (p *PriFiLibRelayInstance) Received_TRU_REL_SEED_COMMITMENTS(msg net.TRU_REL_SEED_COMMITMENTS) error {
+	if msg.TrusteeID < 0 || msg.TrusteeID >= p.relayState.nTrustees || len(msg.Commitments) != p.relayState.nClients {
+		return errors.New("Relay : invalid seed commitments from trustee " + strconv.Itoa(msg.TrusteeID))
+	}
+	c, err := p.openSeedCommitments(msg.Epoch)
+	if err != nil {
+		return errors.New("Relay : refusing the seed commitments of trustee " + strconv.Itoa(msg.TrusteeID) + ", " + err.Error())
+	}
+	if _, found := c.trustees[msg.TrusteeID]; found {
+		return errors.New("Relay : trustee " + strconv.Itoa(msg.TrusteeID) + " already committed to its seeds of epoch " + strconv.Itoa(int(msg.Epoch)))
+	}
+	c.trustees[msg.TrusteeID] = msg.Commitments
+	return nil
+}
 
-		dummy := make([]byte, p.relayState.DCNet.DCNetPayloadSize)
-		sharedPRNG.XORKeyStream(dummy, dummy)
-		round++
+// openSeedCommitments returns the commitments of the epoch, or an error if a round of the epoch was already decoded: a
+// commitment made after seeing the outcome of a round binds nothing
+func (p *PriFiLibRelayInstance) openSeedCommitments(epoch int32) (*seedCommitments, error) {
+	if epoch <= p.relayState.lastDecodedEpoch {
+		return nil, errors.New("epoch " + strconv.Itoa(int(epoch)) + " was already decoded")
+	}
+	c, found := p.relayState.seedCommitments[epoch]
+	if !found {
+		c = &seedCommitments{clients: make(map[int][][]byte), trustees: make(map[int][][]byte)}
+		p.relayState.seedCommitments[epoch] = c
+	}
+	return c, nil
+}
 
+// seedMatchesCommitment returns true if the seed revealed by the client (or the trustee) of the pair is the one it
+// committed to in the epoch
+func (p *PriFiLibRelayInstance) seedMatchesCommitment(isClient bool, clientID, trusteeID int, epoch int32, seed []byte) bool {
+	c, found := p.relayState.seedCommitments[epoch]
+	if !found || len(seed) == 0 {
+		return false
+	}
+	commitments, peer := c.trustees[trusteeID], clientID
+	if isClient {
+		commitments, peer = c.clients[clientID], trusteeID
+	}
+	if commitments == nil {
+		return false
 	}
+	return bytes.Equal(commitments[peer], dcnet.SeedCommitment(seed, epoch, clientID, trusteeID))
+}
 
-	p_ij := make([]byte, p.relayState.DCNet.DCNetPayloadSize)
-	sharedPRNG.XORKeyStream(p_ij, p_ij)
+/*
+disruptorFound ends the blame with its verdict. A disrupting client is excluded, and a disrupting trustee stops the
+relay, while a client or a trustee corrupting the reservations is reported, the open/closed rounds keep working (see
+reservations.go).
+*/
+func (p *PriFiLibRelayInstance) disruptorFound(isClient bool, entityID int) {
+	if p.relayState.blamingData.ScheduleRound {
+		p.reservationDisruptorFound(isClient, entityID)
+	} else if isClient {
+		p.excludeDisruptors([]int{entityID})
+	} else {
+		log.Fatal("Disruption Phase 2: Disruptor is Trustee", entityID, ".")
+	}
+}
 
+// SetDisruptorHandler sets the function called with the clients found disrupting the session (by the blame of the
+// disruption protection, or by the verification of the verifiable DC-net), which restarts the session without them
+func (p *PriFiLibRelayInstance) SetDisruptorHandler(handler func([]int)) {
+	p.relayState.disruptorHandler = handler
+}
+
+// excludeDisruptors ends the session, and restarts it without the clients found disrupting it. Without a handler to
+// exclude them, the relay stops, as the disruptors would jam every session
+func (p *PriFiLibRelayInstance) excludeDisruptors(clientIDs []int) {
+	if p.relayState.disruptorHandler == nil {
+		log.Fatal("Disruption: disruptors are clients", clientIDs, ", and they cannot be excluded.")
+	}
+	if p.stateMachine.State() == "SHUTDOWN" {
+		return // the session is already ending, the other disruptors are caught in the next one
+	}
+	log.Error("Disruption: disruptors are clients", clientIDs, ", restarting the session without them.")
+
+	// no more rounds in this session; the handler stops the relay, which waits until we are done with this message
+	p.stateMachine.ChangeState("SHUTDOWN")
+	go p.relayState.disruptorHandler(clientIDs)
+}
+
+/*
+blamedPadBit returns the bit of the pad at the blamed position. In an open/closed round, the bits are numbered like
+the reservations' (see scheduler.Bit)
+*/
+func (p *PriFiLibRelayInstance) blamedPadBit(p_ij []byte) int {
+	if p.relayState.blamingData.ScheduleRound {
+		return scheduler.Bit(p_ij, p.relayState.blamingData.BitPos)
+	}
+	return padBit(p_ij, p.relayState.blamingData.BitPos)
+}
+
+/*
+padBit returns the bit of the pad at the disrupted position
+*/
+func padBit(p_ij []byte, bitPosition int) int {
 	var rtn int
 
-	bitPosition := p.relayState.blamingData.BitPos
 	bytePosition := int(bitPosition/8) + 1
 	byte_toGet := p_ij[bytePosition]
 	bitInByte := (8-bitPosition%8)%8 - 1
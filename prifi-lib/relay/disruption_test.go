@@ -0,0 +1,153 @@
+package relay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/prifi/prifi-lib/dcnet"
+	"github.com/dedis/prifi/prifi-lib/net"
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestEpochSeedsBlame(t *testing.T) {
+
+	timeoutHandler := func(clients, trustees []int) { log.Error(clients, trustees) }
+	msw := newTestMessageSenderWrapper(new(TestMessageSender))
+	sentToClient = make([]interface{}, 0)
+	sentToTrustee = make([]interface{}, 0)
+	relay := NewRelay(false, make(chan []byte, 6), make(chan []byte, 3), make(chan interface{}, 1), timeoutHandler, msw)
+
+	msg := new(net.ALL_ALL_PARAMETERS)
+	msg.ForceParams = true
+	msg.Add("NClients", 2)
+	msg.Add("NTrustees", 2)
+	msg.Add("PayloadSize", 100)
+	msg.Add("WindowSize", 1)
+	msg.Add("RelayTrusteeCacheHighBound", 5)
+	msg.Add("DCNetEpochLength", 3)
+	if err := relay.ReceivedMessage(*msg); err == nil {
+		t.Error("The epochs should be longer than the rounds in flight, the relay should refuse 3 rounds")
+	}
+	msg.Add("DCNetEpochLength", 6)
+	if err := relay.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Relay should be able to receive this message, but", err)
+	}
+	relay.relayState.DCNet = dcnet.NewDCNetEntity(0, dcnet.DCNET_RELAY, 100, false, nil, relay.relayState.CryptoSuite)
+	relay.relayState.DCNet.SetSessionContext(relay.sessionContext())
+
+	excluded := make(chan []int, 2)
+	relay.SetDisruptorHandler(func(clients []int) { excluded <- clients })
+	relay.stateMachine.ChangeState("COMMUNICATING")
+
+	// client 1 and trustee 0 commit to their seeds of epoch 2 before it is decoded
+	seed := []byte{1, 2, 3}
+	other := dcnet.SeedCommitment([]byte{4}, 2, 0, 0)
+	if err := relay.ReceivedMessage(net.CLI_REL_SEED_COMMITMENTS{ClientID: 1, Epoch: 2, Commitments: [][]byte{dcnet.SeedCommitment(seed, 2, 1, 0), other}}); err != nil {
+		t.Error(err)
+	}
+	if err := relay.ReceivedMessage(net.TRU_REL_SEED_COMMITMENTS{TrusteeID: 0, Epoch: 2, Commitments: [][]byte{other, dcnet.SeedCommitment(seed, 2, 1, 0)}}); err != nil {
+		t.Error(err)
+	}
+	if err := relay.ReceivedMessage(net.CLI_REL_SEED_COMMITMENTS{ClientID: 1, Epoch: 2, Commitments: [][]byte{other, other}}); err == nil {
+		t.Error("Relay should refuse a second commitment")
+	}
+	if err := relay.ReceivedMessage(net.TRU_REL_SEED_COMMITMENTS{TrusteeID: 1, Epoch: 2, Commitments: [][]byte{other}}); err == nil {
+		t.Error("Relay should refuse a commitment per client missing")
+	}
+	relay.relayState.lastDecodedEpoch = 2
+	if err := relay.ReceivedMessage(net.TRU_REL_SEED_COMMITMENTS{TrusteeID: 1, Epoch: 2, Commitments: [][]byte{other, other}}); err == nil {
+		t.Error("Relay should refuse a commitment to the seeds of a decoded epoch")
+	}
+
+	// client 1 and trustee 0 revealed different bits for round 13, they are asked for the seed of epoch 2 only
+	relay.relayState.blamingData = BlamingData{RoundID: 13, BitPos: 3, ClientID: 1, ClientBitRevealed: 1, TrusteeID: 0, TrusteeBitRevealed: 0}
+	relay.requestSharedSecrets()
+	for _, sent := range []interface{}{sentToClient[0], sentToTrustee[0]} {
+		request := sent.(*net.REL_ALL_REVEAL_SHARED_SECRETS)
+		if request.RoundID != 13 {
+			t.Error("Relay should ask for the seed of the epoch of round 13")
+		}
+	}
+	if sentToClient[0].(*net.REL_ALL_REVEAL_SHARED_SECRETS).EntityID != 0 || sentToTrustee[0].(*net.REL_ALL_REVEAL_SHARED_SECRETS).EntityID != 1 {
+		t.Error("Relay should ask the client for the seed shared with the trustee, and vice versa")
+	}
+	sentToClient = make([]interface{}, 0)
+	sentToTrustee = make([]interface{}, 0)
+
+	// seeds of another pair or another epoch are refused
+	if err := relay.Received_CLI_REL_EPOCH_SEED(net.CLI_REL_EPOCH_SEED{ClientID: 0, TrusteeID: 0, Epoch: 2, Seed: []byte{1}}); err == nil {
+		t.Error("Relay should refuse the seed of client 0")
+	}
+	if err := relay.Received_TRU_REL_EPOCH_SEED(net.TRU_REL_EPOCH_SEED{TrusteeID: 0, ClientID: 1, Epoch: 1, Seed: []byte{1}}); err == nil {
+		t.Error("Relay should refuse the seed of epoch 1")
+	}
+
+	// the client reveals a seed it did not commit to: it lied
+	if err := relay.Received_CLI_REL_EPOCH_SEED(net.CLI_REL_EPOCH_SEED{ClientID: 1, TrusteeID: 0, Epoch: 2, Seed: []byte{1}}); err != nil {
+		t.Error(err)
+	}
+	if len(excluded) != 0 {
+		t.Error("Relay should wait for the trustee's seed")
+	}
+	if err := relay.Received_TRU_REL_EPOCH_SEED(net.TRU_REL_EPOCH_SEED{TrusteeID: 0, ClientID: 1, Epoch: 2, Seed: seed}); err != nil {
+		t.Error(err)
+	}
+	expectExcluded(t, excluded, 1)
+	if len(sentToClient) != 0 || len(sentToTrustee) != 0 {
+		t.Error("Relay should never ask for the long-term secret")
+	}
+
+	// both reveal the seed they committed to, the pad shows that the client lied about its bit
+	relay.stateMachine.ChangeState("COMMUNICATING")
+	bit := relay.blamedPadBit(relay.relayState.DCNet.EpochRoundPad(seed, 13))
+	relay.relayState.blamingData = BlamingData{RoundID: 13, BitPos: 3, ClientID: 1, ClientBitRevealed: 1 - bit, TrusteeID: 0, TrusteeBitRevealed: bit}
+	relay.requestSharedSecrets()
+	relay.Received_TRU_REL_EPOCH_SEED(net.TRU_REL_EPOCH_SEED{TrusteeID: 0, ClientID: 1, Epoch: 2, Seed: seed})
+	relay.Received_CLI_REL_EPOCH_SEED(net.CLI_REL_EPOCH_SEED{ClientID: 1, TrusteeID: 0, Epoch: 2, Seed: seed})
+	expectExcluded(t, excluded, 1)
+}
+
+// expectExcluded checks that the disruptor handler was called with the client only
+func expectExcluded(t *testing.T, excluded chan []int, clientID int) {
+	select {
+	case clients := <-excluded:
+		if len(clients) != 1 || clients[0] != clientID {
+			t.Error("Client", clientID, "should be excluded, got", clients)
+		}
+	case <-time.After(time.Second):
+		t.Error("Client", clientID, "should be excluded")
+	}
+}
+
+func TestDisruptorsExcluded(t *testing.T) {
+
+	timeoutHandler := func(clients, trustees []int) { log.Error(clients, trustees) }
+	msw := newTestMessageSenderWrapper(new(TestMessageSender))
+	relay := NewRelay(false, make(chan []byte, 6), make(chan []byte, 3), make(chan interface{}, 1), timeoutHandler, msw)
+
+	excluded := make(chan []int, 2)
+	relay.SetDisruptorHandler(func(clients []int) { excluded <- clients })
+	relay.stateMachine.ChangeState("COMMUNICATING")
+
+	// the blame found client 1, the session restarts without it
+	relay.disruptorFound(true, 1)
+	select {
+	case clients := <-excluded:
+		if len(clients) != 1 || clients[0] != 1 {
+			t.Error("Client 1 should be excluded, got", clients)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The disruptor should be excluded")
+	}
+	if relay.stateMachine.State() != "SHUTDOWN" {
+		t.Error("The session should end, it was disrupted")
+	}
+
+	// the session is ending, it is not restarted twice
+	relay.excludeDisruptors([]int{0})
+	select {
+	case clients := <-excluded:
+		t.Error("The session is already restarting, got", clients)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
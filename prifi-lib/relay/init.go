@@ -12,12 +12,16 @@ Then, this file simple handle the answer to the different message kind :
 - TRU_REL_TELL_PK - when a trustee connects, he tells us his public key
 - CLI_REL_TELL_PK_AND_EPH_PK - when they receive the list of the trustees, each clients tells his identity. when we have all client's IDs,
 								  we send them to the trustees to shuffle (Schedule protocol)
-- TRU_REL_TELL_NEW_BASE_AND_EPH_PKS - when we receive the result of one shuffle, we forward it to the next trustee
+- TRU_REL_TELL_NEW_BASE_AND_EPH_PKS - when we receive the result of one shuffle, we verify it and forward it to the next trustee
 - TRU_REL_SHUFFLE_SIG - when the shuffle has been done by all trustee, we send the transcript, and they answer with a signature, which we
 						   broadcast to the clients
 - CLI_REL_UPSTREAM_DATA - data for the DC-net
 - REL_CLI_UDP_DOWNSTREAM_DATA - is NEVER received here, but casted to CLI_REL_UPSTREAM_DATA by messages.go
 - TRU_REL_DC_CIPHER - data for the DC-net
+- CLI_REL_RESHUFFLE_EPH_PK - new ephemeral keys of the clients, shuffled in the background to reshuffle the slots (see reshuffle.go)
+- CLI_REL_RESERVATION_REVEAL, TRU_REL_RESERVATION_REVEAL - the pads at a blamed bit of the reservations (see reservations.go)
+
+While all slots are closed, the next open/closed request is held back without blocking the messages (see openclosed.go).
 
 local functions :
 
@@ -34,20 +38,39 @@ considered disconnected
 import (
 	"errors"
 
+	"github.com/dedis/prifi/prifi-lib/config"
 	"github.com/dedis/prifi/prifi-lib/dcnet"
 	prifilog "github.com/dedis/prifi/prifi-lib/log"
 	"github.com/dedis/prifi/prifi-lib/net"
 	"github.com/dedis/prifi/prifi-lib/scheduler"
 	"github.com/dedis/prifi/prifi-lib/utils"
 	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/suites"
 	"go.dedis.ch/onet/v3/log"
 
 	"github.com/dedis/prifi/prifi-lib/crypto"
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 )
 
+// MIN_CELL_PAYLOAD_SIZE is the length of the shortest upstream cell announced with variable cell sizes, and of the
+// shortest sub-cell. It fits a latency-test message, even with the equivocation protection
+const MIN_CELL_PAYLOAD_SIZE = 64
+
+// RESHUFFLE_SWITCH_DELAY is the number of rounds, beyond the rounds in flight, between the announcement of a reshuffle
+// and the first round using the new slots. The clients must receive the announcement before that round
+const RESHUFFLE_SWITCH_DELAY = 10
+
+// RESHUFFLE_TIMEOUT is how long a reshuffle may take until its new slots are announced. After that, e.g., when a client
+// never sent its new key or a trustee never shuffled, the reshuffle is dropped and the next one may start
+const RESHUFFLE_TIMEOUT = 60 * time.Second
+
+// OPENCLOSED_WAKE_UP_POLL is how often a relay waiting before an open/closed request checks whether it has downstream
+// data for the clients, which ends the wait (see openclosed.go)
+const OPENCLOSED_WAKE_UP_POLL = 10 * time.Millisecond
+
 // PriFiLibInstance contains the mutable state of a PriFi entity.
 type PriFiLibRelayInstance struct {
 	messageSender *net.MessageSenderWrapper
@@ -71,18 +94,25 @@ func NewRelay(dataOutputEnabled bool, dataForClients chan []byte, dataFromDCNet
 	relayState.ExperimentResultData = make([]string, 0)
 	relayState.PriorityDataForClients = make(chan []byte, 10) // This is used for relay's control message (like latency-tests) d
 	relayState.schedulesStatistics = prifilog.NewSchedulesStatistics()
+	relayState.pacingStatistics = prifilog.NewPacingStatistics()
 	relayState.timeStatistics = make(map[string]*prifilog.TimeStatistics)
 	relayState.timeStatistics["round-duration"] = prifilog.NewTimeStatistics()
 	relayState.timeStatistics["waiting-on-clients"] = prifilog.NewTimeStatistics()
 	relayState.timeStatistics["waiting-on-trustees"] = prifilog.NewTimeStatistics()
 	relayState.timeStatistics["sending-data"] = prifilog.NewTimeStatistics()
 	relayState.timeStatistics["pcap-delay"] = prifilog.NewTimeStatistics()
-	relayState.PublicKey, relayState.privateKey = crypto.NewKeyPair()
-	relayState.slotScheduler = new(scheduler.BitMaskSlotScheduler_Relay)
+	relayState.CryptoSuite = config.CryptoSuite
+	relayState.PublicKey, relayState.privateKey = crypto.NewKeyPair(relayState.CryptoSuite)
+	relayState.SlotScheduler = scheduler.SLOT_SCHEDULER_BITMASK
+	relayState.slotScheduler = new(scheduler.BitMaskSlotScheduler).NewRelay()
+	relayState.OpenClosedSlotsMaxCellsPerSlot = 1
+	relayState.SubCellsPerRound = 1
+	relayState.CoverReservationPolicy = scheduler.COVER_POLICY_TAIL
+	relayState.CoverReservationTail = int(scheduler.COVER_DEFAULT_TAIL / time.Millisecond)
 	relayState.roundManager = new(BufferableRoundManager)
 	relayState.processingLock = *new(sync.Mutex)
 	neffShuffle := new(scheduler.NeffShuffle)
-	neffShuffle.Init()
+	neffShuffle.Init(relayState.CryptoSuite)
 	relayState.neffShuffle = neffShuffle.RelayView
 	relayState.Name = "Relay"
 
@@ -116,6 +146,8 @@ type NodeRepresentation struct {
 	Connected          bool
 	PublicKey          kyber.Point
 	EphemeralPublicKey kyber.Point
+	SessionPublicKey   kyber.Point // the DC-net secrets are derived from it
+	SessionPkSig       []byte      // the signature of SessionPublicKey by PublicKey
 }
 
 // BlamingData is a struct used in the blame phase of the disruption protection.
@@ -127,6 +159,15 @@ type BlamingData struct {
 	ClientBitRevealed  int
 	TrusteeID          int
 	TrusteeBitRevealed int
+
+	// the seeds of the key epoch of the round revealed by the client and the trustee, empty if they were erased
+	ClientEpochSeed     []byte
+	TrusteeEpochSeed    []byte
+	ClientSeedRevealed  bool
+	TrusteeSeedRevealed bool
+
+	// true if the blamed round is an open/closed round, whose bits are numbered like the reservations'
+	ScheduleRound bool
 }
 
 // RelayState contains the mutable state of the relay.
@@ -161,23 +202,43 @@ type RelayState struct {
 	ExperimentResultChannel                chan interface{}
 	ExperimentResultData                   []string
 	timeoutHandler                         func([]int, []int)
+	disruptorHandler                       func([]int) // restarts the session without the clients found disrupting it, see SetDisruptorHandler
 	bitrateStatistics                      *prifilog.BitrateStatistics
 	schedulesStatistics                    *prifilog.SchedulesStatistics
 	timeStatistics                         map[string]*prifilog.TimeStatistics
-	slotScheduler                          *scheduler.BitMaskSlotScheduler_Relay
+	slotScheduler                          scheduler.SlotScheduler_Relay
 	dcNetType                              string
 	time0                                  uint64
 	pcapLogger                             *utils.PCAPLog
 	DisruptionProtectionEnabled            bool
 	OpenClosedSlotsMinDelayBetweenRequests int
+	OpenClosedSlotsMaxDelayBetweenRequests int            // the longest wait (ms) before an open/closed request, while all slots are closed
+	OpenClosedSlotsMaxCellsPerSlot         int            // the cells a slot gets at most per schedule, however many it asked for
 	OpenClosedSlotsRequestsRoundID         map[int32]bool // contains roundID -> true if that round should be a OC slot request
 	numberOfConsecutiveFailedRounds        int
 	MaxNumberOfConsecutiveFailedRounds     int // Kill the protocol if that many rounds fail consecutively
 	ProcessingLoopSleepTime                int
+	RoundPacingPeriod                      int // if more than 0, the rounds are opened on a clock of that period (ms), see pacing.go
 	RoundTimeOut                           int //The timeout before retransmission (UDP) and/or considering the round failed
 	TrusteeCacheLowBound                   int // Number of ciphertexts buffered by trustees. When <= TRUSTEE_CACHE_LOWBOUND, resume sending
 	TrusteeCacheHighBound                  int // Number of ciphertexts buffered by trustees. When >= TRUSTEE_CACHE_HIGHBOUND, stop sending
 	EquivocationProtectionEnabled          bool
+	DCNetParallelism                       int          // number of goroutines generating the pads on clients and trustees, 0 = one per CPU
+	DCNetPRG                               string       // the PRG expanding the shared secrets into pads, see dcnet.NewPRG
+	DCNetPrecomputedRounds                 int          // number of rounds of pads precomputed by clients and trustees, 0 = disabled
+	DCNetEpochLength                       int          // number of rounds after which the DC-net keys are ratcheted, 0 = never
+	TrusteeThreshold                       int          // number of trustees needed to replace a missing one, 0 = every trustee is needed
+	SessionNonce                           []byte       // chosen for each session, the pads are derived from it (see dcnet.SessionContext)
+	CryptoSuite                            suites.Suite // the suite of the session, announced in the parameters (see config.FindCryptoSuite)
+	SlotScheduler                          string       // the open/closed slots scheduler, see scheduler.NewSlotScheduler
+	UseVariableCellSize                    bool         // the length of the upstream cells of each round is announced in REL_CLI_DOWNSTREAM_DATA
+	slotPayloadSizes                       map[int]int  // the cell length asked for by each slot in the last schedule, 0 for PayloadSize
+	SubCellsPerRound                       int          // number of sub-cells of the upstream cells, each with its own owner; 1 = disabled
+	ReshufflePeriodRounds                  int          // number of rounds after which the slots are reshuffled, 0 = never
+	ReshufflePeriodSeconds                 int          // number of seconds after which the slots are reshuffled, 0 = never
+	CoverReservationPolicy                 string       // when the idle clients reserve a cell anyway, see scheduler.NewCoverPolicy
+	CoverReservationProbability            int          // the percentage of the open/closed requests with a cover reservation, for the Random policy
+	CoverReservationTail                   int          // ms during which the clients keep reserving after their last activity, for the Tail policy
 
 	// sync
 	processingLock sync.Mutex // either we treat a message, or a timeout, never both
@@ -185,20 +246,51 @@ type RelayState struct {
 	//disruption protection
 	LastMessageOfClients       map[int32][]byte
 	BEchoFlags                 map[int32]byte
-	CiphertextsHistoryTrustees map[int32]map[int32][]byte
-	CiphertextsHistoryClients  map[int32]map[int32][]byte
+	CiphertextsHistoryTrustees map[int32]map[int32][]byte // only filled if disruption protection is enabled, last nClients rounds
+	CiphertextsHistoryClients  map[int32]map[int32][]byte // (and the trustees' ciphers sent in advance)
 	DisruptionReveal           bool
 	clientBitMap               map[int]map[int]int
 	trusteeBitMap              map[int]map[int]int
 	blamingData                BlamingData
+	seedCommitments            map[int32]*seedCommitments // key epoch -> the commitments to the seeds of the epoch
+	lastDecodedEpoch           int32                      // the epoch of the last round decoded, the commitments to its seeds are closed
 	EphemeralPublicKeys        []kyber.Point
 
 	//disruption testing
 	ForceDisruptionSinceRound3 bool
 
-	//Used for verifiable DC-net, part of the dcnet.old/owned.go
+	//signed reservations, nil if the open/closed rounds are not protected (see reservations.go)
+	signedReservations    *scheduler.SignedReservations
+	pseudonymBase         kyber.Point                 // the base of the pseudonyms of the slots, output of the shuffle
+	pseudonyms            []kyber.Point               // the pseudonym of each slot
+	reservationRounds     map[int32]*reservationRound // the open/closed rounds whose reservations were altered
+	reservationReveal     *reservationReveal          // the reveal in progress, nil if none
+	reservationDisruptors map[int]int                 // clientID -> number of times it was found corrupting the reservations
+
+	//Used for verifiable DC-net
 	VerifiableDCNetKeys [][]byte
 	nVkeysCollected     int
+
+	//slots reshuffling
+	shuffleEpoch           int        // the shuffle epoch of the current slots, 0 while the slots are the setup's ones
+	lastReshuffleEpoch     int        // the shuffle epoch of the last reshuffle started; a dropped one is not reused
+	shuffleEpochFirstRound int32      // the first round using the slots of the current shuffle epoch
+	shuffleEpochStart      time.Time  // when the current shuffle epoch started
+	reshuffle              *reshuffle // the reshuffle in progress, nil if none
+
+	//cadence of the open/closed requests
+	openClosedIdleDelay time.Duration // the wait after the last schedule, doubled for each consecutive one with all slots closed
+	openClosedWaiting   bool          // true while the next rounds are held back, see waitBeforeNextOpenClosedRequest
+	openClosedWaitID    int           // identifies the last wait, a wait that was cancelled does not open rounds
+
+	//round pacing
+	pacingID         int                        // identifies the clock of this session, the clock of a previous one stops
+	pacingReadySince time.Time                  // since when the window has room for the next round, zero if it has none
+	pacingStatistics *prifilog.PacingStatistics // how often, and how long, data waited for a tick
+
+	//threshold trustees
+	trusteeKeySharings map[int]*trusteeKeySharing // trusteeID -> sharing of its key among the trustees
+	trusteeRecoveries  map[int]*trusteeRecovery   // trusteeID -> recovery of a missing trustee
 }
 
 // ReceivedMessage must be called when a PriFi host receives a message.
@@ -228,18 +320,34 @@ func (p *PriFiLibRelayInstance) ReceivedMessage(msg interface{}) error {
 		if p.stateMachine.AssertState("COMMUNICATING") {
 			err = p.Received_TRU_REL_DISRUPTION_REVEAL(typedMsg)
 		}
-	case net.CLI_REL_SHARED_SECRET:
+	case net.CLI_REL_EPOCH_SEED:
 		if p.stateMachine.AssertState("COMMUNICATING") {
-			err = p.Received_CLI_REL_SHARED_SECRET(typedMsg)
+			err = p.Received_CLI_REL_EPOCH_SEED(typedMsg)
 		}
-	case net.TRU_REL_SHARED_SECRET:
+	case net.TRU_REL_EPOCH_SEED:
 		if p.stateMachine.AssertState("COMMUNICATING") {
-			err = p.Received_TRU_REL_SHARED_SECRETS(typedMsg)
+			err = p.Received_TRU_REL_EPOCH_SEED(typedMsg)
+		}
+	case net.CLI_REL_SEED_COMMITMENTS:
+		if p.stateMachine.AssertState("COMMUNICATING") {
+			err = p.Received_CLI_REL_SEED_COMMITMENTS(typedMsg)
+		}
+	case net.TRU_REL_SEED_COMMITMENTS:
+		if p.stateMachine.AssertStateOrState("COMMUNICATING", "COLLECTING_SHUFFLE_SIGNATURES") {
+			err = p.Received_TRU_REL_SEED_COMMITMENTS(typedMsg)
 		}
 	case net.CLI_REL_OPENCLOSED_DATA:
 		if p.stateMachine.AssertState("COMMUNICATING") {
 			err = p.Received_CLI_REL_OPENCLOSED_DATA(typedMsg)
 		}
+	case net.TRU_REL_KEY_SHARES:
+		if p.stateMachine.AssertStateOrState("COLLECTING_SHUFFLE_SIGNATURES", "COMMUNICATING") {
+			err = p.Received_TRU_REL_KEY_SHARES(typedMsg)
+		}
+	case net.TRU_REL_TRUSTEE_REPLACED:
+		if p.stateMachine.AssertState("COMMUNICATING") {
+			err = p.Received_TRU_REL_TRUSTEE_REPLACED(typedMsg)
+		}
 	case net.TRU_REL_DC_CIPHER:
 		if p.stateMachine.AssertStateOrState("COMMUNICATING", "COLLECTING_SHUFFLE_SIGNATURES") {
 			err = p.Received_TRU_REL_DC_CIPHER(typedMsg)
@@ -253,17 +361,37 @@ func (p *PriFiLibRelayInstance) ReceivedMessage(msg interface{}) error {
 			err = p.Received_CLI_REL_TELL_PK_AND_EPH_PK(typedMsg)
 		}
 	case net.TRU_REL_TELL_NEW_BASE_AND_EPH_PKS:
-		if p.stateMachine.AssertState("COLLECTING_SHUFFLES") {
+		if typedMsg.ShuffleEpoch > 0 {
+			if p.stateMachine.AssertState("COMMUNICATING") {
+				err = p.Received_TRU_REL_RESHUFFLE(typedMsg)
+			}
+		} else if p.stateMachine.AssertState("COLLECTING_SHUFFLES") {
 			err = p.Received_TRU_REL_TELL_NEW_BASE_AND_EPH_PKS(typedMsg)
 		}
 	case net.TRU_REL_SHUFFLE_SIG:
-		if p.stateMachine.AssertState("COLLECTING_SHUFFLE_SIGNATURES") {
+		if typedMsg.ShuffleEpoch > 0 {
+			if p.stateMachine.AssertState("COMMUNICATING") {
+				err = p.Received_TRU_REL_RESHUFFLE_SIG(typedMsg)
+			}
+		} else if p.stateMachine.AssertState("COLLECTING_SHUFFLE_SIGNATURES") {
 			err = p.Received_TRU_REL_SHUFFLE_SIG(typedMsg)
 		}
+	case net.CLI_REL_RESHUFFLE_EPH_PK:
+		if p.stateMachine.AssertState("COMMUNICATING") {
+			err = p.Received_CLI_REL_RESHUFFLE_EPH_PK(typedMsg)
+		}
 	case net.CLI_REL_DISRUPTION_BLAME:
 		if p.stateMachine.AssertState("COMMUNICATING") {
 			err = p.Received_CLI_REL_DISRUPTION_BLAME(typedMsg)
 		}
+	case net.CLI_REL_RESERVATION_REVEAL:
+		if p.stateMachine.AssertState("COMMUNICATING") {
+			err = p.Received_CLI_REL_RESERVATION_REVEAL(typedMsg)
+		}
+	case net.TRU_REL_RESERVATION_REVEAL:
+		if p.stateMachine.AssertState("COMMUNICATING") {
+			err = p.Received_TRU_REL_RESERVATION_REVEAL(typedMsg)
+		}
 	default:
 		err = errors.New("Unrecognized message, type" + reflect.TypeOf(msg).String())
 	}
@@ -0,0 +1,116 @@
+package relay
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/dedis/prifi/prifi-lib/net"
+	"go.dedis.ch/onet/v3/log"
+)
+
+/*
+Cadence of the open/closed requests. Under load, some slot is open after each schedule round, and the next rounds are
+opened right away: a new request follows each schedule, whose length is what the slots asked for. When all slots are
+closed, the network is idle, and the relay waits before the next request: OpenClosedSlotsMinDelayBetweenRequests first,
+then twice as long after each consecutive idle schedule, up to OpenClosedSlotsMaxDelayBetweenRequests. The first
+reservation resets the wait, and the next request directly follows its schedule again.
+
+An idle request is how the relay learns that a client wants to send again, the wait is the latency of a client going
+from idle to active. With variable cell sizes, a request is only as long as the clients' contributions: such short
+probes are cheap, and the relay keeps sending them every OpenClosedSlotsMinDelayBetweenRequests instead of backing off.
+Only requests of full cells back off.
+
+The wait does not block the relay, which keeps processing messages (e.g., the ciphers of the rounds in flight); only
+the opening of new rounds is held back. The wait ends early when the relay gets downstream data for the clients, as
+they are likely to answer it.
+
+Closed slots get no round at all. While all slots are closed, every round the relay opens is a request; the clients
+apply its schedule a window after it, and the rounds in between, which would have no owner, are skipped: their IDs are
+never opened, no downstream data is sent and no cipher is computed for them. The clients see the round IDs jump, and
+the trustees are told with REL_TRU_TELL_SKIPPED_ROUNDS. As the pads are derived from the round IDs, nobody needs the
+pads of the skipped rounds.
+*/
+
+// nextOpenClosedDelay returns the wait before the next open/closed request, given whether the last schedule has an open
+// slot. The wait doubles for each consecutive idle schedule, unless the requests are short probes. Paced rounds do not
+// wait, the clock sets their timing
+func (p *PriFiLibRelayInstance) nextOpenClosedDelay(hasOpenSlot bool) time.Duration {
+	if hasOpenSlot || p.relayState.RoundPacingPeriod > 0 {
+		p.relayState.openClosedIdleDelay = 0
+		return 0
+	}
+
+	minDelay := time.Duration(p.relayState.OpenClosedSlotsMinDelayBetweenRequests) * time.Millisecond
+	maxDelay := time.Duration(p.relayState.OpenClosedSlotsMaxDelayBetweenRequests) * time.Millisecond
+	if p.upstreamPayloadSize(-1, true) > 0 {
+		p.relayState.openClosedIdleDelay = minDelay
+		return minDelay
+	}
+	delay := 2 * p.relayState.openClosedIdleDelay
+	if delay < minDelay {
+		delay = minDelay
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	p.relayState.openClosedIdleDelay = delay
+	return delay
+}
+
+// waitBeforeNextOpenClosedRequest holds back the opening of new rounds for delay, or until we have downstream data
+func (p *PriFiLibRelayInstance) waitBeforeNextOpenClosedRequest(delay time.Duration) {
+	p.relayState.openClosedWaitID++
+	p.relayState.openClosedWaiting = true
+	go p.endOpenClosedWait(p.relayState.openClosedWaitID, time.Now().Add(delay))
+}
+
+// endOpenClosedWait opens the next rounds when the wait waitID is over, unless it was cancelled in the meantime
+func (p *PriFiLibRelayInstance) endOpenClosedWait(waitID int, deadline time.Time) {
+	for remaining := time.Until(deadline); remaining > 0 && !p.hasDataForClients(); remaining = time.Until(deadline) {
+		if remaining > OPENCLOSED_WAKE_UP_POLL {
+			remaining = OPENCLOSED_WAKE_UP_POLL
+		}
+		time.Sleep(remaining)
+	}
+
+	// never open rounds while treating a message (or a timeout)
+	p.relayState.processingLock.Lock()
+	defer p.relayState.processingLock.Unlock()
+
+	if waitID != p.relayState.openClosedWaitID || !p.relayState.openClosedWaiting {
+		return
+	}
+	p.relayState.openClosedWaiting = false
+	if p.stateMachine.State() != "COMMUNICATING" {
+		return
+	}
+
+	log.Lvl3("Relay : done waiting, opening the next open/closed request")
+	p.downstreamPhase_sendMany()
+}
+
+// hasDataForClients returns true if some downstream data waits to be sent to the clients
+func (p *PriFiLibRelayInstance) hasDataForClients() bool {
+	return len(p.relayState.PriorityDataForClients) > 0 || len(p.relayState.DataForClients) > 0
+}
+
+// skipClosedRounds skips the rounds after the open/closed request requestRoundID, up to the first one using its
+// schedule, and tells the trustees
+func (p *PriFiLibRelayInstance) skipClosedRounds(requestRoundID int32) {
+	firstRound := requestRoundID + 1
+	lastRound := requestRoundID + int32(p.relayState.WindowSize) - 1
+	if lastRound < firstRound {
+		return // the window is 1, the schedule applies from the next round
+	}
+	p.relayState.roundManager.SkipRounds(firstRound, lastRound)
+	for roundID := firstRound; roundID <= lastRound; roundID++ {
+		p.relayState.DCNet.DecodeCancel(roundID) // the trustee ciphers sent in advance
+	}
+	log.Lvl3("Relay : all slots are closed, skipping rounds", firstRound, "to", lastRound)
+
+	toSend := &net.REL_TRU_TELL_SKIPPED_ROUNDS{FirstRound: firstRound, LastRound: lastRound}
+	for j := 0; j < p.relayState.nTrustees; j++ {
+		p.messageSender.SendToTrusteeWithLog(j, toSend, "(trustee "+strconv.Itoa(j+1)+", rounds "+
+			strconv.Itoa(int(firstRound))+" to "+strconv.Itoa(int(lastRound))+")")
+	}
+}
@@ -0,0 +1,157 @@
+package relay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/prifi/prifi-lib/config"
+	"github.com/dedis/prifi/prifi-lib/dcnet"
+	"github.com/dedis/prifi/prifi-lib/net"
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestOpenClosedCadence(t *testing.T) {
+
+	timeoutHandler := func(clients, trustees []int) { log.Error(clients, trustees) }
+	msw := newTestMessageSenderWrapper(new(TestMessageSender))
+	sentToClient = make([]interface{}, 0)
+	sentToTrustee = make([]interface{}, 0)
+	dataForClients := make(chan []byte, 6)
+	relay := NewRelay(false, dataForClients, make(chan []byte, 3), make(chan interface{}, 1), timeoutHandler, msw)
+
+	msg := new(net.ALL_ALL_PARAMETERS)
+	msg.ForceParams = true
+	msg.Add("NClients", 2)
+	msg.Add("NTrustees", 1)
+	msg.Add("PayloadSize", 100)
+	msg.Add("WindowSize", 2)
+	msg.Add("DCNetType", "Simple")
+	msg.Add("UseOpenClosedSlots", true)
+	msg.Add("OpenClosedSlotsMinDelayBetweenRequests", 10)
+	msg.Add("OpenClosedSlotsMaxDelayBetweenRequests", 40)
+	msg.Add("RelayRoundTimeOut", 3600*1000) // the round we open must not time out during the next tests
+	if err := relay.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Relay should be able to receive this message, but", err)
+	}
+
+	// the wait doubles while the network is idle, and is reset by the first reservation
+	for i, expected := range []int{10, 20, 40, 40} {
+		if delay := relay.nextOpenClosedDelay(false); delay != time.Duration(expected)*time.Millisecond {
+			t.Error("Idle schedule", i, "should be followed by a wait of", expected, "ms, got", delay)
+		}
+	}
+	if delay := relay.nextOpenClosedDelay(true); delay != 0 {
+		t.Error("A schedule with an open slot should be followed by the next request right away, got", delay)
+	}
+	if delay := relay.nextOpenClosedDelay(false); delay != 10*time.Millisecond {
+		t.Error("The back-off should restart from the minimum, got", delay)
+	}
+
+	// while waiting, the relay holds back the next round, which asks for a new schedule
+	relay.relayState.DCNet = dcnet.NewDCNetEntity(0, dcnet.DCNET_RELAY, 100, false, nil, config.CryptoSuite)
+	relay.relayState.roundManager.SetStoredRoundSchedule(map[int]int{0: 0, 1: 0})
+	relay.stateMachine.ChangeState("COMMUNICATING")
+	relay.relayState.processingLock.Lock()
+	relay.waitBeforeNextOpenClosedRequest(time.Hour)
+	relay.downstreamPhase_sendMany()
+	relay.relayState.processingLock.Unlock()
+	if len(sentToClient) != 0 {
+		t.Fatal("Relay should not open a round while waiting")
+	}
+
+	// downstream data ends the wait early
+	dataForClients <- []byte{1, 2, 3}
+	time.Sleep(10 * OPENCLOSED_WAKE_UP_POLL)
+	relay.relayState.processingLock.Lock()
+	defer relay.relayState.processingLock.Unlock()
+	if relay.relayState.openClosedWaiting || len(sentToClient) != 2 {
+		t.Fatal("Relay should stop waiting when it has data for the clients")
+	}
+	if !sentToClient[0].(*net.REL_CLI_DOWNSTREAM_DATA).FlagOpenClosedRequest {
+		t.Error("The round after an idle schedule should ask for a new schedule")
+	}
+
+	// the next round would have no owner, it is skipped; the trustees are told, and the next round is outside the window
+	if len(sentToTrustee) != 1 {
+		t.Fatal("Relay should tell the trustee about the skipped round")
+	}
+	skipped := sentToTrustee[0].(*net.REL_TRU_TELL_SKIPPED_ROUNDS)
+	if skipped.FirstRound != 1 || skipped.LastRound != 1 || !relay.relayState.roundManager.IsRoundSkipped(1) {
+		t.Error("Round 1 should be skipped, got", skipped.FirstRound, "to", skipped.LastRound)
+	}
+	if relay.relayState.roundManager.NextRoundToOpen() != 2 || relay.relayState.roundManager.CanOpenNextRound() {
+		t.Error("Round 2 should only be opened once the request is decoded")
+	}
+}
+
+func TestOpenClosedIdleToActiveLatency(t *testing.T) {
+
+	timeoutHandler := func(clients, trustees []int) { log.Error(clients, trustees) }
+	msw := newTestMessageSenderWrapper(new(TestMessageSender))
+	sentToClient = make([]interface{}, 0)
+	sentToTrustee = make([]interface{}, 0)
+	relay := NewRelay(false, make(chan []byte, 6), make(chan []byte, 3), make(chan interface{}, 1), timeoutHandler, msw)
+
+	minDelay, maxDelay := 10, 5000
+	msg := new(net.ALL_ALL_PARAMETERS)
+	msg.ForceParams = true
+	msg.Add("NClients", 2)
+	msg.Add("NTrustees", 1)
+	msg.Add("PayloadSize", 1000)
+	msg.Add("WindowSize", 1)
+	msg.Add("DCNetType", "Simple")
+	msg.Add("UseOpenClosedSlots", true)
+	msg.Add("OpenClosedSlotsMinDelayBetweenRequests", minDelay)
+	msg.Add("OpenClosedSlotsMaxDelayBetweenRequests", maxDelay)
+	msg.Add("RelayRoundTimeOut", 3600*1000)
+	if err := relay.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Relay should be able to receive this message, but", err)
+	}
+
+	// requests of full cells back off up to the maximum
+	var delay time.Duration
+	for i := 0; i < 20; i++ {
+		delay = relay.nextOpenClosedDelay(false)
+	}
+	if delay != time.Duration(maxDelay)*time.Millisecond {
+		t.Error("Requests of full cells should back off up to the maximum, got", delay)
+	}
+
+	msg.Add("UseVariableCellSize", true)
+	if err := relay.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Relay should be able to receive this message, but", err)
+	}
+
+	// after a long idle period, the requests are short probes sent at the minimum delay
+	for i := 0; i < 20; i++ {
+		delay = relay.nextOpenClosedDelay(false)
+	}
+	if delay != time.Duration(minDelay)*time.Millisecond {
+		t.Error("Short requests should not back off, got a wait of", delay)
+	}
+
+	// a client wanting to send gets the next request within the minimum delay, not the maximum one
+	relay.relayState.DCNet = dcnet.NewDCNetEntity(0, dcnet.DCNET_RELAY, 1000, false, nil, config.CryptoSuite)
+	relay.relayState.roundManager.SetStoredRoundSchedule(map[int]int{0: 0, 1: 0})
+	relay.stateMachine.ChangeState("COMMUNICATING")
+	start := time.Now()
+	relay.relayState.processingLock.Lock()
+	relay.waitBeforeNextOpenClosedRequest(delay)
+	relay.relayState.processingLock.Unlock()
+	var request *net.REL_CLI_DOWNSTREAM_DATA
+	for request == nil {
+		if time.Since(start) > time.Duration(maxDelay)*time.Millisecond/2 {
+			t.Fatal("Relay did not send the next request within", time.Since(start))
+		}
+		time.Sleep(OPENCLOSED_WAKE_UP_POLL)
+		relay.relayState.processingLock.Lock()
+		if len(sentToClient) > 0 {
+			request = sentToClient[0].(*net.REL_CLI_DOWNSTREAM_DATA)
+		}
+		relay.relayState.processingLock.Unlock()
+	}
+	if !request.FlagOpenClosedRequest || request.UpstreamPayloadSize == 0 {
+		t.Error("The next round should be a short open/closed request")
+	}
+	log.Lvl1("Idle-to-active latency:", time.Since(start))
+}
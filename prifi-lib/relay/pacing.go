@@ -0,0 +1,112 @@
+package relay
+
+import (
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+)
+
+/*
+Round pacing. By default, the relay opens the next rounds as soon as the ciphers of the previous ones arrive (or
+RelayProcessingLoopSleepTime later): the timing of the rounds follows the traffic, and shows a network observer when
+the clients are active. With RoundPacingPeriod > 0, the relay opens the rounds on a fixed clock instead, one round per
+tick, whatever the load.
+
+Every round looks the same: the downstream cells are padded to DownstreamCellSize, as with UseDummyDataDown, and the
+clients with nothing to send fill their cells anyway (the slot owner sends a cover cell, see scheduler/cover.go). The
+open/closed requests follow the clock too, there is no back-off while all slots are closed.
+
+A tick is missed when the window is full, i.e., the rounds in flight are not over: the period is too short for the
+network and the nodes. Conversely, data the relay could have sent right away waits for the next tick; the relay
+reports how often, and for how long, in its statistics.
+*/
+
+// startRoundPacing starts the clock opening the rounds, if the rounds are paced
+func (p *PriFiLibRelayInstance) startRoundPacing() {
+	if p.relayState.RoundPacingPeriod <= 0 {
+		return
+	}
+	p.relayState.pacingID++
+	p.relayState.pacingReadySince = time.Time{}
+	period := time.Duration(p.relayState.RoundPacingPeriod) * time.Millisecond
+	log.Lvl2("Relay : opening the rounds every", period)
+	go p.roundPacingClock(p.relayState.pacingID, period)
+}
+
+// roundPacingClock opens a round at each tick, until the clock pacingID is replaced or the relay shuts down
+func (p *PriFiLibRelayInstance) roundPacingClock(pacingID int, period time.Duration) {
+	nextTick := time.Now().Add(period)
+	var dataSince time.Time // when we first saw downstream data waiting for the tick
+	for {
+		for remaining := time.Until(nextTick); remaining > 0; remaining = time.Until(nextTick) {
+			if dataSince.IsZero() && p.hasDataForClients() {
+				dataSince = time.Now()
+			}
+			if remaining > OPENCLOSED_WAKE_UP_POLL {
+				remaining = OPENCLOSED_WAKE_UP_POLL
+			}
+			time.Sleep(remaining)
+		}
+
+		// never open rounds while treating a message (or a timeout)
+		p.relayState.processingLock.Lock()
+		if pacingID != p.relayState.pacingID || p.stateMachine.State() == "SHUTDOWN" {
+			p.relayState.processingLock.Unlock()
+			return
+		}
+		if p.stateMachine.State() == "COMMUNICATING" {
+			p.openPacedRound(dataSince)
+		}
+		// the ticks that passed while we were busy are missed, the clock does not catch up
+		for nextTick = nextTick.Add(period); !nextTick.After(time.Now()); nextTick = nextTick.Add(period) {
+			p.relayState.pacingStatistics.AddMissedTick()
+		}
+		p.relayState.processingLock.Unlock()
+		dataSince = time.Time{}
+	}
+}
+
+// openPacedRound opens the next round at a tick, if the window has room for it. dataSince is when we first saw
+// downstream data waiting for this tick, if any
+func (p *PriFiLibRelayInstance) openPacedRound(dataSince time.Time) {
+	if !p.pacingWindowHasRoom() {
+		log.Lvl3("Relay : the window is full, missing a tick")
+		p.relayState.pacingStatistics.AddMissedTick()
+		return
+	}
+
+	// the data waited for the tick since it arrived, or since the window had room for it, whichever is later
+	now := time.Now()
+	dataWaited := p.hasDataForClients()
+	var wait time.Duration
+	if dataWaited {
+		since := dataSince
+		if since.IsZero() {
+			since = now
+		}
+		if readySince := p.relayState.pacingReadySince; !readySince.IsZero() && readySince.After(since) {
+			since = readySince
+		}
+		wait = now.Sub(since)
+	}
+	p.relayState.pacingStatistics.AddTick(dataWaited, wait)
+
+	log.Lvl3("Relay : tick, opening the next round")
+	p.relayState.pacingReadySince = time.Time{}
+	p.downstreamPhase1_openRoundAndSendData()
+	p.notePacingReady()
+}
+
+// notePacingReady records since when the window has room for the next round, which only opens at the next tick
+func (p *PriFiLibRelayInstance) notePacingReady() {
+	if p.relayState.pacingReadySince.IsZero() && p.pacingWindowHasRoom() {
+		p.relayState.pacingReadySince = time.Now()
+	}
+}
+
+// pacingWindowHasRoom returns true if the window allows to open the next round
+func (p *PriFiLibRelayInstance) pacingWindowHasRoom() bool {
+	return !p.relayState.openClosedWaiting &&
+		p.relayState.numberOfNonAckedDownstreamPackets < p.relayState.WindowSize &&
+		p.relayState.roundManager.CanOpenNextRound()
+}
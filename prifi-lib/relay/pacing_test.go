@@ -0,0 +1,94 @@
+package relay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/prifi/prifi-lib/config"
+	"github.com/dedis/prifi/prifi-lib/dcnet"
+	"github.com/dedis/prifi/prifi-lib/net"
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestRoundPacing(t *testing.T) {
+
+	timeoutHandler := func(clients, trustees []int) { log.Error(clients, trustees) }
+	msw := newTestMessageSenderWrapper(new(TestMessageSender))
+	sentToClient = make([]interface{}, 0)
+	sentToTrustee = make([]interface{}, 0)
+	dataForClients := make(chan []byte, 6)
+	relay := NewRelay(false, dataForClients, make(chan []byte, 3), make(chan interface{}, 1), timeoutHandler, msw)
+
+	msg := new(net.ALL_ALL_PARAMETERS)
+	msg.ForceParams = true
+	msg.Add("NClients", 2)
+	msg.Add("NTrustees", 1)
+	msg.Add("PayloadSize", 100)
+	msg.Add("DownstreamCellSize", 500)
+	msg.Add("WindowSize", 1)
+	msg.Add("DCNetType", "Simple")
+	msg.Add("RoundPacingPeriod", -1)
+	msg.Add("RelayRoundTimeOut", 3600*1000) // the rounds we open must not time out during the test
+	if err := relay.ReceivedMessage(*msg); err == nil {
+		t.Error("Relay should refuse a negative pacing period")
+	}
+	msg.Add("RoundPacingPeriod", 20)
+	if err := relay.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Relay should be able to receive this message, but", err)
+	}
+	if delay := relay.nextOpenClosedDelay(false); delay != 0 {
+		t.Error("Paced rounds should not wait before the next open/closed request, got", delay)
+	}
+
+	// the relay does not open a round when the previous one is over, but notes that it could
+	relay.relayState.DCNet = dcnet.NewDCNetEntity(0, dcnet.DCNET_RELAY, 100, false, nil, config.CryptoSuite)
+	relay.stateMachine.ChangeState("COMMUNICATING")
+	relay.relayState.processingLock.Lock()
+	relay.downstreamPhase_sendMany()
+	if len(sentToClient) != 0 {
+		t.Fatal("Relay should only open paced rounds at a tick")
+	}
+	if relay.relayState.pacingReadySince.IsZero() {
+		t.Error("Relay should note since when the window has room")
+	}
+
+	// at the tick, the data that waited is sent in a full cell
+	seen := time.Now()
+	dataForClients <- []byte{1, 2, 3}
+	time.Sleep(5 * time.Millisecond)
+	relay.openPacedRound(seen)
+	if len(sentToClient) != 2 {
+		t.Fatal("Relay should open a round at the tick")
+	}
+	if data := sentToClient[0].(*net.REL_CLI_DOWNSTREAM_DATA).Data; len(data) != 500 || data[0] != 1 {
+		t.Error("Paced rounds should carry full downstream cells, got", len(data), "bytes")
+	}
+	if n, wait := relay.relayState.pacingStatistics.DataWaited(); n != 1 || wait < 5*time.Millisecond {
+		t.Error("The data should have waited for the tick, got", n, wait)
+	}
+
+	// the window is full, the tick is missed
+	relay.openPacedRound(time.Time{})
+	if len(sentToClient) != 2 {
+		t.Error("Relay should not open a round beyond the window")
+	}
+
+	// the clock opens the next round once the window has room, with dummy data
+	relay.relayState.roundManager.ForceCloseRound()
+	relay.relayState.numberOfNonAckedDownstreamPackets = 0
+	relay.startRoundPacing()
+	relay.relayState.processingLock.Unlock()
+	time.Sleep(100 * time.Millisecond)
+	relay.relayState.processingLock.Lock()
+	defer relay.relayState.processingLock.Unlock()
+	relay.stateMachine.ChangeState("SHUTDOWN") // stops the clock
+	if len(sentToClient) != 4 {
+		t.Fatal("Relay should open a single round on its clock, as the window is 1; got", len(sentToClient)/2)
+	}
+	if data := sentToClient[2].(*net.REL_CLI_DOWNSTREAM_DATA).Data; len(data) != 500 || data[0] != 0 {
+		t.Error("A paced round without data should carry a dummy cell")
+	}
+	if n, _ := relay.relayState.pacingStatistics.DataWaited(); n != 1 {
+		t.Error("No data waited for this tick")
+	}
+}
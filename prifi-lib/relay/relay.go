@@ -12,7 +12,7 @@ Then, this file simple handle the answer to the different message kind :
 - TRU_REL_TELL_PK - when a trustee connects, he tells us his public key
 - CLI_REL_TELL_PK_AND_EPH_PK - when they receive the list of the trustees, each clients tells his identity. when we have all client's IDs,
 								  we send them to the trustees to shuffle (Schedule protocol)
-- TRU_REL_TELL_NEW_BASE_AND_EPH_PKS - when we receive the result of one shuffle, we forward it to the next trustee
+- TRU_REL_TELL_NEW_BASE_AND_EPH_PKS - when we receive the result of one shuffle, we verify it and forward it to the next trustee
 - TRU_REL_SHUFFLE_SIG - when the shuffle has been done by all trustee, we send the transcript, and they answer with a signature, which we
 						   broadcast to the clients
 - CLI_REL_UPSTREAM_DATA - data for the DC-net
@@ -42,9 +42,11 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"github.com/dedis/prifi/prifi-lib/config"
+	"github.com/dedis/prifi/prifi-lib/crypto"
 	"github.com/dedis/prifi/prifi-lib/dcnet"
 	prifilog "github.com/dedis/prifi/prifi-lib/log"
 	"github.com/dedis/prifi/prifi-lib/net"
+	"github.com/dedis/prifi/prifi-lib/scheduler"
 	"github.com/dedis/prifi/prifi-lib/utils"
 	"github.com/dedis/prifi/utils"
 	"go.dedis.ch/kyber/v3"
@@ -101,17 +103,175 @@ func (p *PriFiLibRelayInstance) Received_ALL_ALL_PARAMETERS(msg net.ALL_ALL_PARA
 	dcNetType := msg.StringValueOrElse("DCNetType", p.relayState.dcNetType)
 	disruptionProtection := msg.BoolValueOrElse("DisruptionProtectionEnabled", false)
 	openClosedSlotsMinDelayBetweenRequests := msg.IntValueOrElse("OpenClosedSlotsMinDelayBetweenRequests", p.relayState.OpenClosedSlotsMinDelayBetweenRequests)
+	openClosedSlotsMaxDelayBetweenRequests := msg.IntValueOrElse("OpenClosedSlotsMaxDelayBetweenRequests", p.relayState.OpenClosedSlotsMaxDelayBetweenRequests)
+	openClosedSlotsMaxCellsPerSlot := msg.IntValueOrElse("OpenClosedSlotsMaxCellsPerSlot", p.relayState.OpenClosedSlotsMaxCellsPerSlot)
 	maxNumberOfConsecutiveFailedRounds := msg.IntValueOrElse("RelayMaxNumberOfConsecutiveFailedRounds", p.relayState.MaxNumberOfConsecutiveFailedRounds)
 	processingLoopSleepTime := msg.IntValueOrElse("RelayProcessingLoopSleepTime", p.relayState.ProcessingLoopSleepTime)
+	roundPacingPeriod := msg.IntValueOrElse("RoundPacingPeriod", p.relayState.RoundPacingPeriod)
 	roundTimeOut := msg.IntValueOrElse("RelayRoundTimeOut", p.relayState.RoundTimeOut)
 	trusteeCacheLowBound := msg.IntValueOrElse("RelayTrusteeCacheLowBound", p.relayState.TrusteeCacheLowBound)
 	trusteeCacheHighBound := msg.IntValueOrElse("RelayTrusteeCacheHighBound", p.relayState.TrusteeCacheHighBound)
 	equivocationProtectionEnabled := msg.BoolValueOrElse("EquivocationProtectionEnabled", p.relayState.EquivocationProtectionEnabled)
 	ForceDisruptionSinceRound3 := msg.BoolValueOrElse("ForceDisruptionSinceRound3", false)
+	dcNetParallelism := msg.IntValueOrElse("DCNetParallelism", p.relayState.DCNetParallelism)
+	dcNetPRG := msg.StringValueOrElse("DCNetPRG", p.relayState.DCNetPRG)
+	dcNetPrecomputedRounds := msg.IntValueOrElse("DCNetPrecomputedRounds", p.relayState.DCNetPrecomputedRounds)
+	dcNetEpochLength := msg.IntValueOrElse("DCNetEpochLength", p.relayState.DCNetEpochLength)
+	trusteeThreshold := msg.IntValueOrElse("TrusteeThreshold", p.relayState.TrusteeThreshold)
+	cryptoSuite := msg.StringValueOrElse("CryptoSuite", p.relayState.CryptoSuite.String())
+	slotSchedulerName := msg.StringValueOrElse("SlotScheduler", p.relayState.SlotScheduler)
+	useVariableCellSize := msg.BoolValueOrElse("UseVariableCellSize", p.relayState.UseVariableCellSize)
+	subCellsPerRound := msg.IntValueOrElse("SubCellsPerRound", p.relayState.SubCellsPerRound)
+	reshufflePeriodRounds := msg.IntValueOrElse("ReshufflePeriodRounds", p.relayState.ReshufflePeriodRounds)
+	reshufflePeriodSeconds := msg.IntValueOrElse("ReshufflePeriodSeconds", p.relayState.ReshufflePeriodSeconds)
+	coverReservationPolicy := msg.StringValueOrElse("CoverReservationPolicy", p.relayState.CoverReservationPolicy)
+	coverReservationProbability := msg.IntValueOrElse("CoverReservationProbability", p.relayState.CoverReservationProbability)
+	coverReservationTail := msg.IntValueOrElse("CoverReservationTail", p.relayState.CoverReservationTail)
 
 	if payloadSize < 1 {
 		return errors.New("payloadSize cannot be 0")
 	}
+	if openClosedSlotsMaxCellsPerSlot < 1 {
+		openClosedSlotsMaxCellsPerSlot = 1
+	}
+	if roundPacingPeriod < 0 {
+		return errors.New("RoundPacingPeriod cannot be negative")
+	}
+	if openClosedSlotsMaxDelayBetweenRequests < openClosedSlotsMinDelayBetweenRequests {
+		// no back-off, the wait is always the minimum
+		openClosedSlotsMaxDelayBetweenRequests = openClosedSlotsMinDelayBetweenRequests
+	}
+
+	// a missing trustee is replaced by "threshold" others, hence there must be enough of them. The session might have
+	// restarted with fewer trustees after a disconnection
+	if trusteeThreshold < 0 {
+		return errors.New("TrusteeThreshold cannot be negative")
+	}
+	if trusteeThreshold > 0 && trusteeThreshold >= nTrustees {
+		log.Lvl1("Relay: TrusteeThreshold is", trusteeThreshold, "but there are only", nTrustees, "trustees; every trustee is needed")
+		trusteeThreshold = 0
+	}
+
+	// the keys of an epoch are erased two epochs later, every round in flight must still have its keys: the window,
+	// the rounds precomputed, and the rounds the trustees sent ahead (which might be blamed)
+	if dcNetEpochLength < 0 {
+		return errors.New("DCNetEpochLength cannot be negative")
+	}
+	if minEpochLength := windowSize + dcNetPrecomputedRounds + trusteeCacheHighBound; dcNetEpochLength > 0 && dcNetEpochLength < minEpochLength {
+		return errors.New("DCNetEpochLength is " + strconv.Itoa(dcNetEpochLength) + " but up to " + strconv.Itoa(minEpochLength) +
+			" rounds can be in flight; use at least " + strconv.Itoa(minEpochLength) + ", or 0 to never ratchet")
+	}
+
+	if dcNetPRG == "" {
+		dcNetPRG = dcnet.PRG_XOF
+	}
+	suite, err := config.FindCryptoSuite(cryptoSuite)
+	if err != nil {
+		return err
+	}
+	if _, err := dcnet.NewPRG(dcNetPRG, suite); err != nil {
+		return err
+	}
+	slotScheduler, err := scheduler.NewSlotScheduler(slotSchedulerName)
+	if err != nil {
+		return err
+	}
+	// without a cover policy (e.g., missing from prifi.toml), the clients keep the historical tail
+	if coverReservationPolicy == "" {
+		coverReservationPolicy = scheduler.COVER_POLICY_TAIL
+		coverReservationTail = int(scheduler.COVER_DEFAULT_TAIL / time.Millisecond)
+	}
+	coverPolicy, err := scheduler.NewCoverPolicy(coverReservationPolicy, coverReservationProbability, time.Duration(coverReservationTail)*time.Millisecond)
+	if err != nil {
+		return err
+	}
+
+	switch dcNetType {
+	case "", "Simple":
+		dcNetType = "Simple"
+	case "Verifiable":
+		// the verifiable DC-net detects disruptions by itself, and works on fixed-size cells
+		if equivocationProtectionEnabled || disruptionProtection || useOpenClosedSlots {
+			return errors.New("the verifiable DC-net does not support EquivocationProtectionEnabled, DisruptionProtectionEnabled or UseOpenClosedSlots; disable them")
+		}
+	default:
+		return errors.New("unknown DCNetType " + dcNetType)
+	}
+
+	// when the clients reserve their own slots, the slots are only known from the open/closed rounds, and are not
+	// the pseudonyms of the shuffle whose ownership the equivocation protection or the verifiable DC-net prove. We do
+	// not turn a protection off behind the operator's back, such settings are refused
+	if !slotScheduler.UsesShuffledSlots() {
+		if dcNetType == "Verifiable" {
+			return errors.New("the " + slotScheduler.Name() + " slot scheduler does not use the slots of the shuffle, which the verifiable DC-net needs")
+		}
+		if !useOpenClosedSlots {
+			return errors.New("the " + slotScheduler.Name() + " slot scheduler needs UseOpenClosedSlots")
+		}
+		if equivocationProtectionEnabled {
+			return errors.New("the " + slotScheduler.Name() + " slot scheduler does not use the slots of the shuffle, whose ownership the equivocation protection proves; disable EquivocationProtectionEnabled")
+		}
+	}
+	// several owners per round: each sub-cell is in clear, the equivocation protection, the disruption protection and
+	// the verifiable DC-net expect a single owner per cell. Each client owns at most one sub-cell, which must fit a
+	// latency-test message
+	if subCellsPerRound < 1 {
+		subCellsPerRound = 1
+	}
+	if subCellsPerRound > 1 && (equivocationProtectionEnabled || disruptionProtection || dcNetType == "Verifiable") {
+		return errors.New("SubCellsPerRound needs a single owner per cell with the equivocation protection, the disruption protection or the verifiable DC-net; disable them, or use one sub-cell")
+	}
+	if maxSubCells := payloadSize / MIN_CELL_PAYLOAD_SIZE; subCellsPerRound > 1 && subCellsPerRound > maxSubCells {
+		return errors.New("SubCellsPerRound is " + strconv.Itoa(subCellsPerRound) + " but only " + strconv.Itoa(maxSubCells) +
+			" sub-cells of at least " + strconv.Itoa(MIN_CELL_PAYLOAD_SIZE) + " bytes fit in PayloadSize " + strconv.Itoa(payloadSize))
+	}
+	// the session might have restarted with fewer clients after a disconnection, a sub-cell nobody can own is useless
+	if subCellsPerRound > nClients {
+		subCellsPerRound = nClients
+	}
+	if subCellsPerRound > 1 && useVariableCellSize {
+		return errors.New("rounds split in sub-cells have the full PayloadSize, they cannot be used with UseVariableCellSize")
+	}
+
+	// the cell length is requested in the open/closed rounds. The disruption protection and the verifiable DC-net
+	// work on full cells
+	if useVariableCellSize && (!useOpenClosedSlots || disruptionProtection || dcNetType == "Verifiable") {
+		return errors.New("UseVariableCellSize needs UseOpenClosedSlots, and neither the disruption protection nor the verifiable DC-net")
+	}
+	// the slots change at a round boundary while the previous rounds are still in flight, but the equivocation
+	// protection, the disruption protection and the verifiable DC-net bind the rounds to the pseudonyms of the slots.
+	// The footprint scheduler does not use the slots of the shuffle, there is nothing to reshuffle
+	if reshufflePeriodRounds < 0 || reshufflePeriodSeconds < 0 {
+		return errors.New("ReshufflePeriodRounds and ReshufflePeriodSeconds cannot be negative")
+	}
+	if (reshufflePeriodRounds > 0 || reshufflePeriodSeconds > 0) &&
+		(equivocationProtectionEnabled || disruptionProtection || dcNetType == "Verifiable" || !slotScheduler.UsesShuffledSlots()) {
+		return errors.New("reshuffling the slots needs the slots of the shuffle, and neither the equivocation protection, the disruption protection nor the verifiable DC-net; " +
+			"disable them, or set ReshufflePeriodRounds and ReshufflePeriodSeconds to 0")
+	}
+	if useOpenClosedSlots && slotScheduler.ContributionSize(nClients) > payloadSize {
+		return errors.New("the " + slotScheduler.Name() + " slot scheduler needs " + strconv.Itoa(slotScheduler.ContributionSize(nClients)) +
+			" bytes for " + strconv.Itoa(nClients) + " clients, but PayloadSize is " + strconv.Itoa(payloadSize))
+	}
+	// with the equivocation or the disruption protection, the open/closed rounds are protected too: the reservations
+	// are signed with the pseudonyms of the slots (see reservations.go). The reservation vector, and a blame in a cell
+	// with the b_echo_last flag and the equivocation protection's tag, must fit, or the settings are refused
+	var signedReservations *scheduler.SignedReservations
+	if useOpenClosedSlots && (equivocationProtectionEnabled || disruptionProtection) {
+		sr, err := scheduler.NewSignedReservations(suite, slotScheduler, nClients)
+		if err != nil {
+			return errors.New("the open/closed rounds cannot be protected: " + err.Error())
+		}
+		size := sr.Size()
+		if blameSize := scheduler.ReservationBlameSize(suite) + 17; blameSize > size {
+			size = blameSize
+		}
+		if size > payloadSize {
+			return errors.New("signing the reservations needs " + strconv.Itoa(size) + " bytes for " + strconv.Itoa(nClients) +
+				" clients, but PayloadSize is " + strconv.Itoa(payloadSize) + "; increase it, or disable the protections")
+		}
+		signedReservations = sr
+	}
 
 	p.relayState.clients = make([]NodeRepresentation, nClients)
 	p.relayState.trustees = make([]NodeRepresentation, nTrustees)
@@ -129,22 +289,69 @@ func (p *PriFiLibRelayInstance) Received_ALL_ALL_PARAMETERS(msg net.ALL_ALL_PARA
 	p.relayState.WindowSize = windowSize
 	p.relayState.numberOfNonAckedDownstreamPackets = 0
 	p.relayState.OpenClosedSlotsMinDelayBetweenRequests = openClosedSlotsMinDelayBetweenRequests
+	p.relayState.OpenClosedSlotsMaxDelayBetweenRequests = openClosedSlotsMaxDelayBetweenRequests
+	p.relayState.OpenClosedSlotsMaxCellsPerSlot = openClosedSlotsMaxCellsPerSlot
+	p.relayState.openClosedIdleDelay = 0
+	p.relayState.openClosedWaiting = false
+	p.relayState.openClosedWaitID++ // a wait of the previous session does not open rounds in this one
 	p.relayState.MaxNumberOfConsecutiveFailedRounds = maxNumberOfConsecutiveFailedRounds
 	p.relayState.ProcessingLoopSleepTime = processingLoopSleepTime
+	p.relayState.RoundPacingPeriod = roundPacingPeriod
+	p.relayState.pacingID++ // the clock of the previous session does not open rounds in this one
+	p.relayState.pacingReadySince = time.Time{}
+	p.relayState.pacingStatistics = prifilog.NewPacingStatistics()
 	p.relayState.RoundTimeOut = roundTimeOut
 	p.relayState.TrusteeCacheLowBound = trusteeCacheLowBound
 	p.relayState.TrusteeCacheHighBound = trusteeCacheHighBound
 	p.relayState.EquivocationProtectionEnabled = equivocationProtectionEnabled
 	p.relayState.ForceDisruptionSinceRound3 = ForceDisruptionSinceRound3
-	p.relayState.MessageHistory = config.CryptoSuite.XOF([]byte("init")) //any non-nil, non-empty, constant array
+	p.relayState.DCNetParallelism = dcNetParallelism
+	p.relayState.DCNetPRG = dcNetPRG
+	p.relayState.DCNetPrecomputedRounds = dcNetPrecomputedRounds
+	p.relayState.DCNetEpochLength = dcNetEpochLength
+	p.relayState.TrusteeThreshold = trusteeThreshold
+	p.relayState.SlotScheduler = slotScheduler.Name()
+	p.relayState.slotScheduler = slotScheduler.NewRelay()
+	p.relayState.CoverReservationPolicy = coverPolicy.Name()
+	p.relayState.CoverReservationProbability = coverReservationProbability
+	p.relayState.CoverReservationTail = coverReservationTail
+	p.relayState.UseVariableCellSize = useVariableCellSize
+	p.relayState.SubCellsPerRound = subCellsPerRound
+	p.relayState.slotPayloadSizes = make(map[int]int)
+	p.relayState.ReshufflePeriodRounds = reshufflePeriodRounds
+	p.relayState.ReshufflePeriodSeconds = reshufflePeriodSeconds
+	p.relayState.shuffleEpoch = 0
+	p.relayState.lastReshuffleEpoch = 0
+	p.relayState.shuffleEpochFirstRound = 0
+	p.relayState.reshuffle = nil
+	p.relayState.signedReservations = signedReservations
+	p.relayState.pseudonymBase = nil
+	p.relayState.pseudonyms = nil
+	p.relayState.reservationRounds = make(map[int32]*reservationRound)
+	p.relayState.reservationReveal = nil
+	p.relayState.reservationDisruptors = make(map[int]int)
+	p.relayState.SessionNonce = dcnet.NewSessionNonce()
+	if suite.String() != p.relayState.CryptoSuite.String() {
+		p.relayState.PublicKey, p.relayState.privateKey = crypto.NewKeyPair(suite)
+	}
+	p.relayState.CryptoSuite = suite
+	neffShuffle := new(scheduler.NeffShuffle)
+	neffShuffle.Init(suite)
+	p.relayState.neffShuffle = neffShuffle.RelayView
+	p.relayState.trusteeKeySharings = make(map[int]*trusteeKeySharing)
+	p.relayState.trusteeRecoveries = make(map[int]*trusteeRecovery)
+	p.relayState.MessageHistory = suite.XOF([]byte("init")) //any non-nil, non-empty, constant array
 	p.relayState.VerifiableDCNetKeys = make([][]byte, nTrustees)
 	p.relayState.nVkeysCollected = 0
 	p.relayState.roundManager = NewBufferableRoundManager(nClients, nTrustees, windowSize)
+	p.relayState.roundManager.SetOwnersPerRound(subCellsPerRound)
 	p.relayState.dcNetType = dcNetType
 	p.relayState.pcapLogger = utils.NewPCAPLog()
 	p.relayState.DisruptionProtectionEnabled = disruptionProtection
 	p.relayState.clientBitMap = make(map[int]map[int]int)
 	p.relayState.trusteeBitMap = make(map[int]map[int]int)
+	p.relayState.seedCommitments = make(map[int32]*seedCommitments)
+	p.relayState.lastDecodedEpoch = -1
 	p.relayState.OpenClosedSlotsRequestsRoundID = make(map[int32]bool)
 	p.relayState.LastMessageOfClients = make(map[int32][]byte)
 	p.relayState.BEchoFlags = make(map[int32]byte)
@@ -157,11 +364,6 @@ func (p *PriFiLibRelayInstance) Received_ALL_ALL_PARAMETERS(msg net.ALL_ALL_PARA
 	for j := int32(0); j < int32(nTrustees); j++ {
 		p.relayState.CiphertextsHistoryTrustees[j] = make(map[int32][]byte)
 	}
-	switch dcNetType {
-	case "Verifiable":
-		panic("Verifiable DCNet not implemented yet")
-	}
-
 	//this should be in NewRelayState, but we need p
 	if !p.relayState.roundManager.DoSendStopResumeMessages {
 		//Add rate-limiting component to buffer manager
@@ -194,6 +396,11 @@ func (p *PriFiLibRelayInstance) Received_ALL_ALL_PARAMETERS(msg net.ALL_ALL_PARA
 	return nil
 }
 
+// sessionContext returns the context the DC-net keys are bound to in this session, as sent to the clients and trustees
+func (p *PriFiLibRelayInstance) sessionContext() dcnet.SessionContext {
+	return dcnet.SessionContext{Nonce: p.relayState.SessionNonce, EpochLength: int32(p.relayState.DCNetEpochLength)}
+}
+
 // ConnectToTrustees connects to the trustees and initializes them with default parameters.
 func (p *PriFiLibRelayInstance) BroadcastParameters() error {
 
@@ -207,6 +414,14 @@ func (p *PriFiLibRelayInstance) BroadcastParameters() error {
 	msg.Add("DCNetType", p.relayState.dcNetType)
 	msg.Add("DisruptionProtectionEnabled", p.relayState.DisruptionProtectionEnabled)
 	msg.Add("EquivocationProtectionEnabled", p.relayState.EquivocationProtectionEnabled)
+	msg.Add("DCNetParallelism", p.relayState.DCNetParallelism)
+	msg.Add("DCNetPRG", p.relayState.DCNetPRG)
+	msg.Add("DCNetPrecomputedRounds", p.relayState.DCNetPrecomputedRounds)
+	msg.Add("DCNetEpochLength", p.relayState.DCNetEpochLength)
+	msg.Add("TrusteeThreshold", p.relayState.TrusteeThreshold)
+	msg.Add("SessionNonce", p.relayState.SessionNonce)
+	msg.Add("CryptoSuite", p.relayState.CryptoSuite.String())
+	msg.Add("SignedReservations", p.relayState.signedReservations != nil)
 	msg.ForceParams = true
 
 	// Send those parameters to all trustees
@@ -229,12 +444,10 @@ If we finished a round (we had collected all data, and called DecodeCell()), we
 Either we send something from the SOCKS/VPN buffer, or we answer the latency-test message if we received any, or we send 1 bit.
 */
 func (p *PriFiLibRelayInstance) Received_CLI_REL_UPSTREAM_DATA(msg net.CLI_REL_UPSTREAM_DATA) error {
-	// CV-LB: I am not sure if this is a good programing practice...
-	if p.relayState.CiphertextsHistoryClients[int32(msg.ClientID)] == nil {
-		p.relayState.CiphertextsHistoryClients[int32(msg.ClientID)] = make(map[int32][]byte)
+	if p.relayState.DisruptionProtectionEnabled {
+		storeCipherForBlame(p.relayState.CiphertextsHistoryClients, msg.ClientID, msg.RoundID, msg.Data)
 	}
-	p.relayState.CiphertextsHistoryClients[int32(msg.ClientID)][msg.RoundID] = msg.Data
-	p.relayState.roundManager.AddClientCipher(msg.RoundID, msg.ClientID, msg.Data)
+	p.addClientCipher(msg.RoundID, msg.ClientID, msg.Data)
 	if p.relayState.roundManager.HasAllCiphersForCurrentRound() {
 		p.upstreamPhase1_processCiphers(true)
 	}
@@ -248,11 +461,10 @@ If it's for this round, we call decode on it, and remember we received it.
 If for a future round we need to Buffer it.
 */
 func (p *PriFiLibRelayInstance) Received_TRU_REL_DC_CIPHER(msg net.TRU_REL_DC_CIPHER) error {
-	if p.relayState.CiphertextsHistoryTrustees[int32(msg.TrusteeID)] == nil {
-		p.relayState.CiphertextsHistoryTrustees[int32(msg.TrusteeID)] = make(map[int32][]byte)
+	if p.relayState.DisruptionProtectionEnabled || p.relayState.signedReservations != nil {
+		storeCipherForBlame(p.relayState.CiphertextsHistoryTrustees, msg.TrusteeID, msg.RoundID, msg.Data)
 	}
-	p.relayState.CiphertextsHistoryTrustees[int32(msg.TrusteeID)][msg.RoundID] = msg.Data
-	p.relayState.roundManager.AddTrusteeCipher(msg.RoundID, msg.TrusteeID, msg.Data)
+	p.addTrusteeCipher(msg.RoundID, msg.TrusteeID, msg.Data)
 	if p.relayState.roundManager.HasAllCiphersForCurrentRound() {
 		p.upstreamPhase1_processCiphers(true)
 	}
@@ -260,10 +472,53 @@ func (p *PriFiLibRelayInstance) Received_TRU_REL_DC_CIPHER(msg net.TRU_REL_DC_CI
 	return nil
 }
 
+// addClientCipher XORs the cipher into its round's accumulator if the round is being decoded; otherwise, the cipher is
+// buffered until the round is opened
+func (p *PriFiLibRelayInstance) addClientCipher(roundID int32, clientID int, data []byte) {
+	if !p.relayState.DCNet.IsDecoding(roundID) {
+		p.relayState.roundManager.AddClientCipher(roundID, clientID, data)
+		return
+	}
+	if err := p.relayState.roundManager.AddDecodedClientCipher(roundID, clientID); err == nil {
+		if err := p.relayState.DCNet.DecodeClient(roundID, clientID, data); err != nil {
+			log.Error("Relay :", err)
+		}
+	}
+}
+
+// addTrusteeCipher XORs the cipher into its round's accumulator. The trustees send their ciphers up to
+// TrusteeCacheHighBound rounds in advance: the ciphers of a round that is not opened yet are folded in at once too,
+// rather than kept until the round opens
+func (p *PriFiLibRelayInstance) addTrusteeCipher(roundID int32, trusteeID int, data []byte) {
+	if err := p.relayState.roundManager.AddDecodedTrusteeCipher(roundID, trusteeID); err != nil {
+		return
+	}
+	var err error
+	if p.relayState.DCNet.IsDecoding(roundID) {
+		err = p.relayState.DCNet.DecodeTrustee(roundID, trusteeID, data)
+	} else {
+		err = p.relayState.DCNet.DecodeTrusteeInAdvance(roundID, trusteeID, data)
+	}
+	if err != nil {
+		log.Error("Relay :", err)
+	}
+}
+
+// storeCipherForBlame keeps the cipher of an entity, for the disruption blame. The history is pruned in upstreamPhase3_finalizeRound
+func storeCipherForBlame(history map[int32]map[int32][]byte, entityID int, roundID int32, data []byte) {
+	if history[int32(entityID)] == nil {
+		history[int32(entityID)] = make(map[int32][]byte)
+	}
+	history[int32(entityID)][roundID] = data
+}
+
 // Received_CLI_REL_OPENCLOSED_DATA handles the reception of the OpenClosed map, which details which
 // pseudonymous clients want to transmit in a given round
 func (p *PriFiLibRelayInstance) Received_CLI_REL_OPENCLOSED_DATA(msg net.CLI_REL_OPENCLOSED_DATA) error {
-	p.relayState.roundManager.AddClientCipher(msg.RoundID, msg.ClientID, msg.OpenClosedData)
+	if p.relayState.signedReservations != nil {
+		storeCipherForBlame(p.relayState.CiphertextsHistoryClients, msg.ClientID, msg.RoundID, msg.OpenClosedData)
+	}
+	p.addClientCipher(msg.RoundID, msg.ClientID, msg.OpenClosedData)
 	if p.relayState.roundManager.HasAllCiphersForCurrentRound() {
 		p.upstreamPhase1_processCiphers(false)
 	}
@@ -271,8 +526,8 @@ func (p *PriFiLibRelayInstance) Received_CLI_REL_OPENCLOSED_DATA(msg net.CLI_REL
 	return nil
 }
 
-// upstreamPhase1_processCiphers collects all DC-net ciphers, and decides what to do with them (is it a OCMap message ?
-// a data message ?)
+// upstreamPhase1_processCiphers is called once all DC-net ciphers of the current round were decoded, and decides what
+// to do with the decoded cell (is it a OCMap message ? a data message ?)
 // it then proceed accordingly, finalizes the round, and calls downstreamPhase_sendMany()
 func (p *PriFiLibRelayInstance) upstreamPhase1_processCiphers(finishedByTrustee bool) {
 
@@ -288,7 +543,7 @@ func (p *PriFiLibRelayInstance) upstreamPhase1_processCiphers(finishedByTrustee
 	roundID := p.relayState.roundManager.CurrentRound()
 	_, isOCRound := p.relayState.OpenClosedSlotsRequestsRoundID[roundID]
 
-	log.Lvl3("Relay has collected all ciphers for round", roundID, "(isOCRound", isOCRound, "), decoding...")
+	log.Lvl3("Relay has decoded all ciphers for round", roundID, "(isOCRound", isOCRound, "), finalizing...")
 
 	// most important switch of this method
 	if isOCRound {
@@ -318,48 +573,78 @@ func (p *PriFiLibRelayInstance) upstreamPhase1_processCiphers(finishedByTrustee
 // downstreamPhase_sendMany starts as many rounds (by opening the round and sending downstream data) as specified
 // by the window
 func (p *PriFiLibRelayInstance) downstreamPhase_sendMany() {
+	// all slots are closed, the next round (an open/closed request) is opened when the wait ends
+	if p.relayState.openClosedWaiting {
+		log.Lvl3("Relay : waiting before the next open/closed request, not opening new rounds")
+		return
+	}
+	// the rounds are paced, the next round is opened at the next tick
+	if p.relayState.RoundPacingPeriod > 0 {
+		p.notePacingReady()
+		return
+	}
+
 	// send the data down
 	for i := p.relayState.numberOfNonAckedDownstreamPackets; i < p.relayState.WindowSize; i++ {
+		// the skipped rounds count in the window
+		if !p.relayState.roundManager.CanOpenNextRound() {
+			break
+		}
 		log.Lvl3("Relay : Gonna send, non-acked packets is", p.relayState.numberOfNonAckedDownstreamPackets, "(window is", p.relayState.WindowSize, ")")
 		p.downstreamPhase1_openRoundAndSendData()
 	}
 }
 
 // upstreamPhase2a_extractOCMap extracts the open-closed request map, updates the inner OCMap stored, potentially
-// sleeps if all slots are closed.
+// waits before the next request if all slots are closed.
 func (p *PriFiLibRelayInstance) upstreamPhase2a_extractOCMap(roundID int32) error {
-	//classical DC-net decoding
-	clientSlices, trusteesSlices, err := p.relayState.roundManager.CollectRoundData()
-	if err != nil {
-		return err
-	}
-	for _, s := range clientSlices {
-		p.relayState.DCNet.DecodeClient(roundID, s)
-	}
-	for _, s := range trusteesSlices {
-		p.relayState.DCNet.DecodeTrustee(roundID, s)
+	//classical DC-net decoding, the ciphers were folded in as they arrived
+	openClosedData, ciphertext, disruption := p.relayState.DCNet.DecodeCell(roundID, true)
+	if disruption != nil {
+		log.Error("Relay :", disruption.Error(), ", closing all slots")
+		openClosedData = make([]byte, len(ciphertext))
 	}
 
-	//here we have the plaintext map
-	openClosedData, _ := p.relayState.DCNet.DecodeCell(true)
+	//the slots were reshuffled since the request, the requests of the old slots are meaningless. The first round with
+	//the new slots asks for a new schedule
+	if roundID < p.relayState.shuffleEpochFirstRound {
+		log.Lvl2("Relay : discarding the open/closed request of round", roundID, "made with the slots of the previous shuffle epoch")
+		return nil
+	}
 
-	//compute the map
-	newSchedule := p.relayState.slotScheduler.Relay_ComputeFinalSchedule(openClosedData, p.relayState.nClients)
-	p.relayState.roundManager.SetStoredRoundSchedule(newSchedule)
-	p.relayState.schedulesStatistics.AddSchedule(newSchedule)
+	//with signed reservations, the slots whose reservation was altered are opened for one cell
+	var corrupted []int
+	if p.relayState.signedReservations != nil {
+		openClosedData, corrupted = p.verifyReservations(roundID, openClosedData, disruption == nil)
+	}
 
-	// if all slots are closed, do not immediately send the next downstream data (which will be a OCSlots schedule)
+	//compute the map. A slot gets the cells it asked for, up to the cap, so that it cannot delay the next schedule (and
+	//the other slots) for too long
+	requests := p.relayState.slotScheduler.Relay_ComputeFinalSchedule(openClosedData, p.relayState.nClients)
+	for _, slot := range corrupted {
+		requests[slot] = scheduler.SlotRequest{Cells: 1}
+	}
+	newSchedule := scheduler.CellsPerSlot(requests)
 	hasOpenSlot := false
-	for _, v := range newSchedule {
-		if v {
+	for slot, cells := range newSchedule {
+		if cells > p.relayState.OpenClosedSlotsMaxCellsPerSlot {
+			newSchedule[slot] = p.relayState.OpenClosedSlotsMaxCellsPerSlot
+		}
+		if cells > 0 {
 			hasOpenSlot = true
-			break
 		}
 	}
-	if !hasOpenSlot {
-		log.Lvl3("All slots closed, sleeping for", p.relayState.OpenClosedSlotsMinDelayBetweenRequests, "ms")
-		d := time.Duration(p.relayState.OpenClosedSlotsMinDelayBetweenRequests) * time.Millisecond
-		time.Sleep(d)
+	p.relayState.slotPayloadSizes = make(map[int]int)
+	for slot, request := range requests {
+		p.relayState.slotPayloadSizes[slot] = request.PayloadSize
+	}
+	p.relayState.roundManager.SetStoredRoundSchedule(newSchedule)
+	p.relayState.schedulesStatistics.AddSchedule(newSchedule)
+
+	// if all slots are closed, do not immediately send the next downstream data (which will be a OCSlots schedule)
+	if delay := p.nextOpenClosedDelay(hasOpenSlot); delay > 0 {
+		log.Lvl3("All slots closed, waiting for", delay, "before the next open/closed request")
+		p.waitBeforeNextOpenClosedRequest(delay)
 	}
 
 	return nil
@@ -372,22 +657,41 @@ func (p *PriFiLibRelayInstance) upstreamPhase2a_extractOCMap(roundID int32) erro
 // If it's a pcap message, update the statistics accordingly
 func (p *PriFiLibRelayInstance) upstreamPhase2b_extractPayload() error {
 
-	// we decode the DC-net cell
+	// we decode the DC-net cell, the ciphers were folded in as they arrived
 	roundID := p.relayState.roundManager.CurrentRound()
-	clientSlices, trusteesSlices, err := p.relayState.roundManager.CollectRoundData()
-	if err != nil {
-		return err
-	}
 
-	//decode all clients and trustees
-	for _, s := range clientSlices {
-		p.relayState.DCNet.DecodeClient(roundID, s)
+	ownerSlot := -1
+	payloadSize := p.relayState.PayloadSize
+	var subCellOwners []int
+	if data := p.relayState.roundManager.GetDataAlreadySent(roundID); data != nil {
+		ownerSlot = data.OwnershipID
+		if data.UpstreamPayloadSize > 0 {
+			payloadSize = data.UpstreamPayloadSize
+		}
+		subCellOwners = data.SubCellOwners
 	}
-	for _, s := range trusteesSlices {
-		p.relayState.DCNet.DecodeTrustee(roundID, s)
+
+	// with the verifiable DC-net, check that only the slot owner transmitted. The clients are only checked against the
+	// commitments of the trustees whose cipher is proven; a trustee whose cipher is not is reported by DecodeCell
+	var disruptiveClients []int
+	if p.relayState.DCNet.IsVerifiable() {
+		disruptiveClients = p.relayState.DCNet.VerifyClientCiphers(roundID, ownerSlot)
 	}
 
-	upstreamPlaintext, ciphertext := p.relayState.DCNet.DecodeCell(false)
+	upstreamPlaintext, ciphertext, disruption := p.relayState.DCNet.DecodeCell(roundID, ownerSlot < 0)
+	if ownerSlot < 0 && p.relayState.EquivocationProtectionEnabled {
+		// all slots were closed, there is no payload
+		upstreamPlaintext = nil
+	}
+	if disruption != nil {
+		// the ciphertext is still hashed below, so the slot owner notices the disruption and can start a blame
+		log.Error("Relay :", disruption.Error(), ", discarding the round's output")
+	}
+	if len(disruptiveClients) > 0 {
+		log.Error("Relay : clients", disruptiveClients, "sent invalid ciphers in round", roundID, ", discarding the round's output")
+		upstreamPlaintext = nil
+		p.excludeDisruptors(disruptiveClients)
+	}
 	if p.relayState.EquivocationProtectionEnabled && p.relayState.DisruptionProtectionEnabled {
 		// Generating and storing the hash from the payload
 		p.relayState.HashOfLastUpstreamMessage = sha256.Sum256([]byte(ciphertext))
@@ -395,7 +699,7 @@ func (p *PriFiLibRelayInstance) upstreamPhase2b_extractPayload() error {
 	}
 	p.relayState.bitrateStatistics.AddUpstreamCell(int64(len(upstreamPlaintext)))
 
-	if p.relayState.DisruptionProtectionEnabled {
+	if p.relayState.DisruptionProtectionEnabled && upstreamPlaintext != nil {
 
 		var b_echo_last byte
 		b_echo_last = upstreamPlaintext[0]
@@ -419,6 +723,7 @@ func (p *PriFiLibRelayInstance) upstreamPhase2b_extractPayload() error {
 
 				p.relayState.blamingData.RoundID = blameRoundID
 				p.relayState.blamingData.BitPos = blameBitPosition
+				p.relayState.blamingData.ScheduleRound = false
 
 				// Broadcast Blame phase 1
 				toSend := &net.REL_ALL_DISRUPTION_REVEAL{
@@ -453,8 +758,52 @@ func (p *PriFiLibRelayInstance) upstreamPhase2b_extractPayload() error {
 		}
 
 	}
+	// the owner of a slot whose reservation was altered blames the jammer in its cell, which is not an output
+	if p.relayState.signedReservations != nil && ownerSlot >= 0 && upstreamPlaintext != nil && p.handleReservationBlame(ownerSlot, upstreamPlaintext) {
+		return nil
+	}
 	log.Lvl4("Decoded cell is", upstreamPlaintext)
 
+	// with sub-cells, each owned sub-cell is a separate output
+	outputs := [][]byte{upstreamPlaintext}
+	if len(subCellOwners) > 1 && upstreamPlaintext != nil {
+		outputs = splitSubCells(upstreamPlaintext, subCellOwners)
+	}
+	// the cover cells only hide when the slots are idle, they are not outputs
+	outputs = cellsData(outputs)
+	for _, output := range outputs {
+		p.handleLatencyAndPcapMessages(output)
+	}
+
+	if upstreamPlaintext != nil {
+		// verify that the decoded payload has the correct size
+		expectedSize := payloadSize
+		if p.relayState.DisruptionProtectionEnabled {
+			// One less because of the b_echo_last flag
+			expectedSize--
+		}
+		if p.relayState.EquivocationProtectionEnabled {
+			expectedSize -= 16
+		}
+		if len(upstreamPlaintext) != expectedSize {
+			e := "Relay : DecodeCell produced wrong-size payload, " + strconv.Itoa(len(upstreamPlaintext)) + "!=" + strconv.Itoa(expectedSize)
+			log.Error(e)
+			return errors.New(e)
+		}
+
+		if p.relayState.DataOutputEnabled {
+			for _, output := range outputs {
+				p.relayState.DataFromDCNet <- output
+			}
+		}
+	}
+
+	return nil
+}
+
+// handleLatencyAndPcapMessages checks if the output of a cell is a latency test message, or a pcap meta message
+func (p *PriFiLibRelayInstance) handleLatencyAndPcapMessages(upstreamPlaintext []byte) {
+
 	// check if we have a latency test message, or a pcap meta message
 	if len(upstreamPlaintext) >= 2 {
 		pattern := int(binary.BigEndian.Uint16(upstreamPlaintext[0:2]))
@@ -506,29 +855,80 @@ func (p *PriFiLibRelayInstance) upstreamPhase2b_extractPayload() error {
 
 		}
 	}
+}
 
-	if upstreamPlaintext != nil {
-		// verify that the decoded payload has the correct size
-		expectedSize := p.relayState.PayloadSize
-		if p.relayState.DisruptionProtectionEnabled {
-			// One less because of the b_echo_last flag
-			expectedSize--
-		}
-		if p.relayState.EquivocationProtectionEnabled {
-			expectedSize -= 16
+// splitSubCells returns the sub-cells of the decoded payload that have an owner
+func splitSubCells(payload []byte, subCellOwners []int) [][]byte {
+	subCellSize := len(payload) / len(subCellOwners)
+	outputs := make([][]byte, 0)
+	for i, owner := range subCellOwners {
+		if owner >= 0 {
+			outputs = append(outputs, payload[i*subCellSize:(i+1)*subCellSize])
 		}
-		if len(upstreamPlaintext) != expectedSize {
-			e := "Relay : DecodeCell produced wrong-size payload, " + strconv.Itoa(len(upstreamPlaintext)) + "!=" + strconv.Itoa(p.relayState.PayloadSize)
-			log.Error(e)
-			return errors.New(e)
+	}
+	return outputs
+}
+
+// cellsData returns the data of the cells which carry some, as flagged in their header; the cover cells are dropped
+// (see scheduler.NewDataCell)
+func cellsData(cells [][]byte) [][]byte {
+	outputs := make([][]byte, 0, len(cells))
+	for _, cell := range cells {
+		if data, isData := scheduler.CellData(cell); isData {
+			outputs = append(outputs, data)
 		}
+	}
+	return outputs
+}
 
-		if p.relayState.DataOutputEnabled {
-			p.relayState.DataFromDCNet <- upstreamPlaintext
+// upstreamPayloadSize returns the length of the upstream cells of a round owned by ownerSlot (-1 if nobody owns it), 0
+// for the session's PayloadSize. With variable cell sizes, the owner gets the length it asked for in the last
+// open/closed round, and the other rounds are as short as possible
+func (p *PriFiLibRelayInstance) upstreamPayloadSize(ownerSlot int, openClosedRequest bool) int {
+	if !p.relayState.UseVariableCellSize {
+		return 0
+	}
+	payloadSize := MIN_CELL_PAYLOAD_SIZE
+	if openClosedRequest {
+		// the clients' contributions to the schedule
+		if p.relayState.signedReservations != nil && p.relayState.signedReservations.Size() > payloadSize {
+			payloadSize = p.relayState.signedReservations.Size()
+		} else if size := p.relayState.slotScheduler.Relay_ContributionSize(p.relayState.nClients); size > payloadSize {
+			payloadSize = size
+		}
+	} else if ownerSlot >= 0 {
+		payloadSize = p.relayState.slotPayloadSizes[ownerSlot]
+		if payloadSize == 0 {
+			return 0
+		}
+		if payloadSize < MIN_CELL_PAYLOAD_SIZE {
+			payloadSize = MIN_CELL_PAYLOAD_SIZE
 		}
 	}
+	if payloadSize >= p.relayState.PayloadSize {
+		return 0
+	}
+	return payloadSize
+}
 
-	return nil
+// startDecodingRound prepares the DC-net to decode a round that was just opened, and folds in the ciphers that were
+// buffered for it (the client ciphers sent before the round opened; the trustee ciphers sent in advance are already
+// folded in). The next ciphers are folded in as they arrive.
+// ownerSlot is the slot owning the round, -1 if nobody owns it
+func (p *PriFiLibRelayInstance) startDecodingRound(roundID int32, ownerSlot int) {
+	p.relayState.DCNet.DecodeStart(roundID, ownerSlot)
+
+	clientCiphers, trusteeCiphers := p.relayState.roundManager.TakeBufferedCiphers(roundID)
+	for clientID, c := range clientCiphers {
+		if err := p.relayState.DCNet.DecodeClient(roundID, clientID, c); err != nil {
+			log.Error("Relay :", err)
+		}
+	}
+	for trusteeID, c := range trusteeCiphers {
+		if err := p.relayState.DCNet.DecodeTrustee(roundID, trusteeID, c); err != nil {
+			log.Error("Relay :", err)
+		}
+	}
 }
 
 // upstreamPhase3_FinalizeRound happens when the data for the upstream round has been collected, and essentially
@@ -550,6 +950,9 @@ func (p *PriFiLibRelayInstance) upstreamPhase3_finalizeRound(roundID int32) erro
 		for k, v := range p.relayState.timeStatistics {
 			p.collectExperimentResult(v.ReportWithInfo(k))
 		}
+		if p.relayState.RoundPacingPeriod > 0 {
+			p.collectExperimentResult(p.relayState.pacingStatistics.Report())
+		}
 		if false && roundID%1000 == 0 {
 			log.Info("Round", roundID, "Relay Memory\n", memoryUsage())
 			memoryUsage2()
@@ -575,23 +978,35 @@ func (p *PriFiLibRelayInstance) upstreamPhase3_finalizeRound(roundID int32) erro
 
 	p.relayState.roundManager.CloseRound()
 
-	// clean history
-	for _, m := range p.relayState.CiphertextsHistoryTrustees {
-		delete(m, roundID)
-	}
-	for _, m := range p.relayState.CiphertextsHistoryClients {
-		delete(m, roundID)
-	}
+	// clean history; a blame can only be about the last nClients rounds
 	earliest := p.relayState.roundManager.lastRoundClosed - int32(p.relayState.nClients)
 	for k := range p.relayState.LastMessageOfClients {
 		if k < earliest {
 			delete(p.relayState.LastMessageOfClients, k)
 		}
 	}
+	for _, m := range p.relayState.CiphertextsHistoryTrustees {
+		for k := range m {
+			if k < earliest {
+				delete(m, k)
+			}
+		}
+	}
+	for _, m := range p.relayState.CiphertextsHistoryClients {
+		for k := range m {
+			if k < earliest {
+				delete(m, k)
+			}
+		}
+	}
 
-	// we just closed that round. If there is any other round opened (window > 1), directly prepare to decode it
-	if roundOpened, nextRoundID := p.relayState.roundManager.currentRound(); roundOpened {
-		p.relayState.DCNet.DecodeStart(nextRoundID)
+	// the seeds of the epoch can no longer be committed to, and the blame no longer needs the commitments of the
+	// epochs before the history
+	p.relayState.lastDecodedEpoch = p.relayState.DCNet.EpochOfRound(roundID)
+	for epoch := range p.relayState.seedCommitments {
+		if epoch < p.relayState.DCNet.EpochOfRound(earliest) {
+			delete(p.relayState.seedCommitments, epoch)
+		}
 	}
 
 	return nil
@@ -640,8 +1055,8 @@ func (p *PriFiLibRelayInstance) downstreamPhase1_openRoundAndSendData() error {
 		}
 	}
 
-	// if we want to use dummy data down, pad to the correct size
-	if p.relayState.UseDummyDataDown && len(downstreamCellContent) < p.relayState.DownstreamCellSize {
+	// if we want to use dummy data down, pad to the correct size. Paced rounds all look the same
+	if (p.relayState.UseDummyDataDown || p.relayState.RoundPacingPeriod > 0) && len(downstreamCellContent) < p.relayState.DownstreamCellSize {
 		data := make([]byte, p.relayState.DownstreamCellSize)
 		copy(data[0:], downstreamCellContent)
 		downstreamCellContent = data
@@ -649,6 +1064,10 @@ func (p *PriFiLibRelayInstance) downstreamPhase1_openRoundAndSendData() error {
 
 	nextDownstreamRoundID := p.relayState.roundManager.NextRoundToOpen()
 
+	// the slots might be reshuffled, in the background and then from an announced round on
+	p.switchShuffleEpochIfDue(nextDownstreamRoundID)
+	p.startReshuffleIfDue(nextDownstreamRoundID)
+
 	// used if we're replaying a pcap. The first message we decode is "time0"
 	if nextDownstreamRoundID == 1 {
 		p.relayState.time0 = uint64(prifilog.MsTimeStampNow())
@@ -657,22 +1076,30 @@ func (p *PriFiLibRelayInstance) downstreamPhase1_openRoundAndSendData() error {
 	// TODO : if something went wrong before, this flag should be used to warn the clients that the config has changed
 	flagResync := false
 
-	// periodically set to True so client can advertise their bitmap
+	// periodically set to True so client can advertise their bitmap. While all slots are closed, no round has an owner,
+	// and every round we open is a request
 	flagOpenClosedRequest := p.relayState.UseOpenClosedSlots &&
-		p.relayState.roundManager.IsNextDownstreamRoundForOpenClosedRequest(p.relayState.nClients)
+		(p.relayState.roundManager.IsNextDownstreamRoundForOpenClosedRequest(p.relayState.nClients) ||
+			p.relayState.roundManager.IsScheduleClosed())
 	if flagOpenClosedRequest {
 		p.relayState.OpenClosedSlotsRequestsRoundID[nextDownstreamRoundID] = true
 	}
 
-	//compute next owner
-	nextOwner := p.relayState.roundManager.UpdateAndGetNextOwnerID()
+	//compute next owner, or the owners of the sub-cells
+	nextOwner := -1
+	var subCellOwners []int
+	if p.relayState.SubCellsPerRound > 1 && !flagOpenClosedRequest {
+		subCellOwners = p.relayState.roundManager.UpdateAndGetNextOwnerIDs()
+	} else {
+		nextOwner = p.relayState.roundManager.UpdateAndGetNextOwnerID()
+	}
 
 	//sending data part
 	timing.StartMeasure("sending-data")
 	if flagOpenClosedRequest {
 		log.Lvl2("Relay is gonna broadcast messages for round "+strconv.Itoa(int(nextDownstreamRoundID))+" (OCRequest=true), owner=", nextOwner, ", len", len(downstreamCellContent))
 	} else {
-		log.Lvl2("Relay is gonna broadcast messages for round "+strconv.Itoa(int(nextDownstreamRoundID))+" (OCRequest=false), owner=", nextOwner, ", len", len(downstreamCellContent))
+		log.Lvl2("Relay is gonna broadcast messages for round "+strconv.Itoa(int(nextDownstreamRoundID))+" (OCRequest=false), owner=", nextOwner, subCellOwners, ", len", len(downstreamCellContent))
 	}
 
 	toSend := &net.REL_CLI_DOWNSTREAM_DATA{
@@ -681,16 +1108,25 @@ func (p *PriFiLibRelayInstance) downstreamPhase1_openRoundAndSendData() error {
 		HashOfPreviousUpstreamData: p.relayState.HashOfLastUpstreamMessage[:],
 		Data:                       downstreamCellContent,
 		FlagResync:                 flagResync,
-		FlagOpenClosedRequest:      flagOpenClosedRequest}
+		FlagOpenClosedRequest:      flagOpenClosedRequest,
+		UpstreamPayloadSize:        p.upstreamPayloadSize(nextOwner, flagOpenClosedRequest),
+		SubCellOwners:              subCellOwners}
 
-	if roundOpened, _ := p.relayState.roundManager.currentRound(); !roundOpened {
-		//prepare for the next round (this empties the dc-net buffer, making them ready for a new round)
-		p.relayState.DCNet.DecodeStart(nextDownstreamRoundID)
+	// in open/closed requests rounds, the clients send their reservation instead of the owner's data
+	ownerSlot := nextOwner
+	if flagOpenClosedRequest {
+		ownerSlot = -1
 	}
-
 	p.relayState.roundManager.OpenNextRound()
+	p.relayState.DCNet.SetRoundPayloadSize(nextDownstreamRoundID, toSend.UpstreamPayloadSize)
+	p.startDecodingRound(nextDownstreamRoundID, ownerSlot)
 	p.relayState.roundManager.SetDataAlreadySent(nextDownstreamRoundID, toSend)
 
+	// the rounds until the schedule of this request applies would have no owner
+	if flagOpenClosedRequest && p.relayState.roundManager.IsScheduleClosed() {
+		p.skipClosedRounds(nextDownstreamRoundID)
+	}
+
 	if !p.relayState.UseUDP {
 		// broadcast to all clients
 		for i := 0; i < p.relayState.nClients; i++ {
@@ -728,7 +1164,7 @@ We do nothing, until we have received one per trustee; Then, we pack them in one
 */
 func (p *PriFiLibRelayInstance) Received_TRU_REL_TELL_PK(msg net.TRU_REL_TELL_PK) error {
 
-	p.relayState.trustees[msg.TrusteeID] = NodeRepresentation{msg.TrusteeID, true, msg.Pk, msg.Pk}
+	p.relayState.trustees[msg.TrusteeID] = NodeRepresentation{msg.TrusteeID, true, msg.Pk, msg.Pk, msg.SessionPk, msg.SessionPkSig}
 	p.relayState.nTrusteesPkCollected++
 
 	log.Lvl2("Relay : received TRU_REL_TELL_PK (" + strconv.Itoa(p.relayState.nTrusteesPkCollected) + "/" + strconv.Itoa(p.relayState.nTrustees) + ")")
@@ -738,6 +1174,7 @@ func (p *PriFiLibRelayInstance) Received_TRU_REL_TELL_PK(msg net.TRU_REL_TELL_PK
 
 		// prepare the message for the clients
 		trusteesPk := make([]kyber.Point, p.relayState.nTrustees)
+		trusteesSessionPks, trusteesSessionPkSigs := p.trusteesSessionKeys()
 		for i := 0; i < p.relayState.nTrustees; i++ {
 			trusteesPk[i] = p.relayState.trustees[i].PublicKey
 		}
@@ -749,11 +1186,25 @@ func (p *PriFiLibRelayInstance) Received_TRU_REL_TELL_PK(msg net.TRU_REL_TELL_PK
 		toSend.Add("UseUDP", p.relayState.UseUDP)
 		toSend.Add("StartNow", true)
 		toSend.Add("PayloadSize", p.relayState.PayloadSize)
+		toSend.Add("WindowSize", p.relayState.WindowSize)
 		toSend.Add("DCNetType", p.relayState.dcNetType)
 		toSend.Add("DisruptionProtectionEnabled", p.relayState.DisruptionProtectionEnabled)
 		toSend.Add("EquivocationProtectionEnabled", p.relayState.EquivocationProtectionEnabled)
 		toSend.Add("ForceDisruptionSinceRound3", p.relayState.ForceDisruptionSinceRound3)
+		toSend.Add("DCNetParallelism", p.relayState.DCNetParallelism)
+		toSend.Add("DCNetPRG", p.relayState.DCNetPRG)
+		toSend.Add("DCNetPrecomputedRounds", p.relayState.DCNetPrecomputedRounds)
+		toSend.Add("DCNetEpochLength", p.relayState.DCNetEpochLength)
+		toSend.Add("SessionNonce", p.relayState.SessionNonce)
+		toSend.Add("CryptoSuite", p.relayState.CryptoSuite.String())
+		toSend.Add("SlotScheduler", p.relayState.SlotScheduler)
+		toSend.Add("SignedReservations", p.relayState.signedReservations != nil)
+		toSend.Add("CoverReservationPolicy", p.relayState.CoverReservationPolicy)
+		toSend.Add("CoverReservationProbability", p.relayState.CoverReservationProbability)
+		toSend.Add("CoverReservationTail", p.relayState.CoverReservationTail)
 		toSend.TrusteesPks = trusteesPk
+		toSend.TrusteesSessionPks = trusteesSessionPks
+		toSend.TrusteesSessionPkSigs = trusteesSessionPkSigs
 
 		// Send those parameters to all clients
 		for j := 0; j < p.relayState.nClients; j++ {
@@ -775,7 +1226,7 @@ and send them to the first trustee for it to Neff-Shuffle them.
 */
 func (p *PriFiLibRelayInstance) Received_CLI_REL_TELL_PK_AND_EPH_PK(msg net.CLI_REL_TELL_PK_AND_EPH_PK) error {
 
-	p.relayState.clients[msg.ClientID] = NodeRepresentation{msg.ClientID, true, msg.Pk, msg.EphPk}
+	p.relayState.clients[msg.ClientID] = NodeRepresentation{msg.ClientID, true, msg.Pk, msg.EphPk, msg.SessionPk, msg.SessionPkSig}
 	p.relayState.nClientsPkCollected++
 
 	log.Lvl2("Relay : received CLI_REL_TELL_PK_AND_EPH_PK (" + strconv.Itoa(p.relayState.nClientsPkCollected) + "/" + strconv.Itoa(p.relayState.nClients) + ")")
@@ -801,10 +1252,7 @@ func (p *PriFiLibRelayInstance) Received_CLI_REL_TELL_PK_AND_EPH_PK(msg net.CLI_
 		toSend := msg.(*net.REL_TRU_TELL_CLIENTS_PKS_AND_EPH_PKS_AND_BASE)
 
 		//todo: fix this. The neff shuffle now stores twices the ephemeral public keys
-		toSend.Pks = make([]kyber.Point, p.relayState.nClients)
-		for i := 0; i < p.relayState.nClients; i++ {
-			toSend.Pks[i] = p.relayState.clients[i].PublicKey
-		}
+		p.addClientsKeys(toSend)
 
 		// send to the 1st trustee
 		p.messageSender.SendToTrusteeWithLog(trusteeID, toSend, "(0-th iteration)")
@@ -818,21 +1266,21 @@ func (p *PriFiLibRelayInstance) Received_CLI_REL_TELL_PK_AND_EPH_PK(msg net.CLI_
 /*
 Received_TRU_REL_TELL_NEW_BASE_AND_EPH_PKS handles TRU_REL_TELL_NEW_BASE_AND_EPH_PKS messages.
 Those are sent by the trustees once they finished a Neff-Shuffle.
-In that case, we forward the result to the next trustee.
+In that case, we verify the shuffle, and forward the result to the next trustee.
 We do nothing until the last trustee sends us this message.
 When this happens, we pack a transcript, and broadcast it to all the trustees who will sign it.
 */
 func (p *PriFiLibRelayInstance) Received_TRU_REL_TELL_NEW_BASE_AND_EPH_PKS(msg net.TRU_REL_TELL_NEW_BASE_AND_EPH_PKS) error {
 
-	p.relayState.VerifiableDCNetKeys[p.relayState.nVkeysCollected] = msg.VerifiableDCNetKey
-	p.relayState.nVkeysCollected++
-	p.relayState.EphemeralPublicKeys = msg.NewEphPks
 	done, err := p.relayState.neffShuffle.ReceivedShuffleFromTrustee(msg.NewBase, msg.NewEphPks, msg.Proof)
 	if err != nil {
 		e := "Relay : error in p.relayState.neffShuffle.ReceivedShuffleFromTrustee " + err.Error()
 		log.Error(e)
 		return errors.New(e)
 	}
+	p.relayState.VerifiableDCNetKeys[p.relayState.nVkeysCollected] = msg.VerifiableDCNetKey
+	p.relayState.nVkeysCollected++
+	p.relayState.EphemeralPublicKeys = msg.NewEphPks
 
 	// if we're still waiting on some trustees, send them the new shuffle
 	if !done {
@@ -846,10 +1294,7 @@ func (p *PriFiLibRelayInstance) Received_TRU_REL_TELL_NEW_BASE_AND_EPH_PKS(msg n
 		toSend := msg.(*net.REL_TRU_TELL_CLIENTS_PKS_AND_EPH_PKS_AND_BASE)
 
 		//todo: fix this. The neff shuffle now stores twices the ephemeral public keys
-		toSend.Pks = make([]kyber.Point, p.relayState.nClients)
-		for i := 0; i < p.relayState.nClients; i++ {
-			toSend.Pks[i] = p.relayState.clients[i].PublicKey
-		}
+		p.addClientsKeys(toSend)
 
 		// send to the i-th trustee
 		p.messageSender.SendToTrusteeWithLog(trusteeID, toSend, "("+strconv.Itoa(trusteeID)+"-th iteration)")
@@ -868,6 +1313,16 @@ func (p *PriFiLibRelayInstance) Received_TRU_REL_TELL_NEW_BASE_AND_EPH_PKS(msg n
 		}
 
 		toSend := msg.(*net.REL_TRU_TELL_TRANSCRIPT)
+		if p.relayState.dcNetType == "Verifiable" {
+			toSend.VerifiableDCNetKeys = p.verifiableDCNetKeys()
+		}
+		if p.relayState.TrusteeThreshold > 0 {
+			toSend.TrusteesPks = make([]kyber.Point, p.relayState.nTrustees)
+			for j := 0; j < p.relayState.nTrustees; j++ {
+				toSend.TrusteesPks[j] = p.relayState.trustees[j].PublicKey
+			}
+			toSend.TrusteesSessionPks, toSend.TrusteesSessionPkSigs = p.trusteesSessionKeys()
+		}
 
 		// broadcast to all trustees
 		for j := 0; j < p.relayState.nTrustees; j++ {
@@ -876,10 +1331,10 @@ func (p *PriFiLibRelayInstance) Received_TRU_REL_TELL_NEW_BASE_AND_EPH_PKS(msg n
 		}
 
 		p.relayState.DCNet = dcnet.NewDCNetEntity(0, dcnet.DCNET_RELAY, p.relayState.PayloadSize,
-			p.relayState.EquivocationProtectionEnabled, nil)
-
-		// prepare to collect the ciphers
-		p.relayState.DCNet.DecodeStart(0)
+			p.relayState.EquivocationProtectionEnabled, nil, p.relayState.CryptoSuite)
+		prg, _ := dcnet.NewPRG(p.relayState.DCNetPRG, p.relayState.CryptoSuite) // validated in Received_ALL_ALL_PARAMETERS
+		p.relayState.DCNet.SetPRG(prg)
+		p.relayState.DCNet.SetSessionContext(p.sessionContext())
 
 		p.stateMachine.ChangeState("COLLECTING_SHUFFLE_SIGNATURES")
 
@@ -919,10 +1374,28 @@ func (p *PriFiLibRelayInstance) Received_TRU_REL_SHUFFLE_SIG(msg net.TRU_REL_SHU
 			return errors.New(e)
 		}
 		msg := toSend5.(*net.REL_CLI_TELL_EPH_PKS_AND_TRUSTEES_SIG)
+
+		if p.relayState.dcNetType == "Verifiable" {
+			H, err := dcnet.CombineVerifiableDCNetKeys(p.relayState.CryptoSuite, p.relayState.VerifiableDCNetKeys)
+			if err != nil {
+				e := "Relay : could not set up the verifiable DC-net, error is " + err.Error()
+				log.Error(e)
+				return errors.New(e)
+			}
+			msg.VerifiableDCNetKeys = p.verifiableDCNetKeys()
+			p.relayState.DCNet.SetVerifiableDCNet(dcnet.NewVerifiableDCNet(p.relayState.CryptoSuite, H, msg.Base, msg.EphPks, nil, -1))
+		}
+		p.relayState.DCNet.SetSlotPseudonyms(msg.Base, msg.EphPks, nil, -1)
+		p.relayState.pseudonymBase = msg.Base
+		p.relayState.pseudonyms = msg.EphPks
+
 		// changing state
 		p.relayState.roundManager.OpenNextRound()
+		p.startDecodingRound(0, -1)
+		p.relayState.shuffleEpochStart = time.Now()
 		log.Lvl2("Relay : ready to communicate.")
 		p.stateMachine.ChangeState("COMMUNICATING")
+		p.startRoundPacing()
 
 		timing.StopMeasureAndLogWithInfo("resync-shuffle-trustee-2step", strconv.Itoa(p.relayState.nClients))
 		timing.StopMeasureAndLogWithInfo("resync-shuffle", strconv.Itoa(p.relayState.nClients))
@@ -941,6 +1414,38 @@ func (p *PriFiLibRelayInstance) Received_TRU_REL_SHUFFLE_SIG(msg net.TRU_REL_SHU
 	return nil
 }
 
+// addClientsKeys adds the long-term keys of the clients, and their signed session keys, to the shuffle of the setup
+func (p *PriFiLibRelayInstance) addClientsKeys(msg *net.REL_TRU_TELL_CLIENTS_PKS_AND_EPH_PKS_AND_BASE) {
+	msg.Pks = make([]kyber.Point, p.relayState.nClients)
+	msg.SessionPks = make([]kyber.Point, p.relayState.nClients)
+	msg.SessionPkSigs = make([]net.ByteArray, p.relayState.nClients)
+	for i := 0; i < p.relayState.nClients; i++ {
+		msg.Pks[i] = p.relayState.clients[i].PublicKey
+		msg.SessionPks[i] = p.relayState.clients[i].SessionPublicKey
+		msg.SessionPkSigs[i] = net.ByteArray{Bytes: p.relayState.clients[i].SessionPkSig}
+	}
+}
+
+// trusteesSessionKeys returns the session keys of the trustees, and their signatures by the trustees' long-term keys
+func (p *PriFiLibRelayInstance) trusteesSessionKeys() ([]kyber.Point, []net.ByteArray) {
+	keys := make([]kyber.Point, p.relayState.nTrustees)
+	sigs := make([]net.ByteArray, p.relayState.nTrustees)
+	for j := 0; j < p.relayState.nTrustees; j++ {
+		keys[j] = p.relayState.trustees[j].SessionPublicKey
+		sigs[j] = net.ByteArray{Bytes: p.relayState.trustees[j].SessionPkSig}
+	}
+	return keys, sigs
+}
+
+// verifiableDCNetKeys packs the trustees' shares of the verifiable DC-net commitment base
+func (p *PriFiLibRelayInstance) verifiableDCNetKeys() []net.ByteArray {
+	keys := make([]net.ByteArray, len(p.relayState.VerifiableDCNetKeys))
+	for j, k := range p.relayState.VerifiableDCNetKeys {
+		keys[j] = net.ByteArray{Bytes: k}
+	}
+	return keys
+}
+
 // ValidateHmac256 returns true iff the recomputed HMAC is equal to the given one
 func ValidateHmac256(message, inputHmac []byte, clientID int) bool {
 	key := []byte("client-secret" + strconv.Itoa(clientID)) // quick hack, this should be a random shared secret
@@ -9,9 +9,11 @@ import (
 	"github.com/dedis/prifi/prifi-lib/crypto"
 	"github.com/dedis/prifi/prifi-lib/dcnet"
 	"github.com/dedis/prifi/prifi-lib/net"
+	"github.com/dedis/prifi/prifi-lib/scheduler"
 	"go.dedis.ch/kyber/v3/sign/schnorr"
 	"go.dedis.ch/onet/v3/log"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -93,6 +95,15 @@ func getMessage(bufferPtr *[]interface{}, wantedMessage string) (interface{}, er
 	return msg, nil
 }
 
+// shuffles the keys sent to a trustee, as the trustee would
+func shuffleAsTrustee(t *testing.T, msg *net.REL_TRU_TELL_CLIENTS_PKS_AND_EPH_PKS_AND_BASE) net.TRU_REL_TELL_NEW_BASE_AND_EPH_PKS {
+	keys, base, _, proof, err := crypto.NeffShuffle(config.CryptoSuite, msg.EphPks, msg.Base, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return net.TRU_REL_TELL_NEW_BASE_AND_EPH_PKS{NewBase: base, NewEphPks: keys, Proof: proof}
+}
+
 func TestRelayRun1(t *testing.T) {
 
 	timeoutHandler := func(clients, trustees []int) { log.Error(clients, trustees) }
@@ -267,11 +278,16 @@ func TestRelayRun1(t *testing.T) {
 	}
 
 	//since startNow = true, trustee sends TRU_REL_TELL_PK
-	trusteePub, trusteePriv := crypto.NewKeyPair()
-	_ = trusteePriv
+	trusteePub, trusteePriv := crypto.NewKeyPair(config.CryptoSuite)
+	trusteeSessionPub, _, trusteeSessionSig, err := crypto.NewSessionKeyPair(config.CryptoSuite, trusteePriv, crypto.SessionKeyTrustee, 0, relay.relayState.SessionNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
 	msg6 := net.TRU_REL_TELL_PK{
-		TrusteeID: 0,
-		Pk:        trusteePub,
+		TrusteeID:    0,
+		Pk:           trusteePub,
+		SessionPk:    trusteeSessionPub,
+		SessionPkSig: trusteeSessionSig,
 	}
 	if err := relay.ReceivedMessage(msg6); err != nil {
 		t.Error("Relay should be able to receive this message, but", err)
@@ -305,19 +321,30 @@ func TestRelayRun1(t *testing.T) {
 	if msg5.ParamsStr["DCNetType"] != "Simple" {
 		t.Error("DCNetType not set correctly")
 	}
+	if msg5.ParamsStr["SlotScheduler"] != scheduler.SLOT_SCHEDULER_BITMASK {
+		t.Error("SlotScheduler not set correctly")
+	}
 	if !msg5.TrusteesPks[0].Equal(trusteePub) {
 		t.Error("Relay sent wrong public key")
 	}
+	if !msg5.TrusteesSessionPks[0].Equal(trusteeSessionPub) || !bytes.Equal(msg5.TrusteesSessionPkSigs[0].Bytes, trusteeSessionSig) {
+		t.Error("Relay sent wrong session key")
+	}
 
 	//should receive a CLI_REL_TELL_PK_AND_EPH_PK
-	cliPub, cliPriv := crypto.NewKeyPair()
-	cliEphPub, cliEphPriv := crypto.NewKeyPair()
-	_ = cliPriv
+	cliPub, cliPriv := crypto.NewKeyPair(config.CryptoSuite)
+	cliEphPub, cliEphPriv := crypto.NewKeyPair(config.CryptoSuite)
 	_ = cliEphPriv
+	cliSessionPub, _, cliSessionSig, err := crypto.NewSessionKeyPair(config.CryptoSuite, cliPriv, crypto.SessionKeyClient, 0, relay.relayState.SessionNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
 	msg9 := net.CLI_REL_TELL_PK_AND_EPH_PK{
-		ClientID: 0,
-		Pk:       cliPub,
-		EphPk:    cliEphPub,
+		ClientID:     0,
+		Pk:           cliPub,
+		EphPk:        cliEphPub,
+		SessionPk:    cliSessionPub,
+		SessionPkSig: cliSessionSig,
 	}
 	if err := relay.ReceivedMessage(msg9); err != nil {
 		t.Error("Relay should be able to receive this message, but", err)
@@ -336,13 +363,25 @@ func TestRelayRun1(t *testing.T) {
 	if !msg11.EphPks[0].Equal(cliEphPub) {
 		t.Error("Relay sent wrong ephemeral public key")
 	}
+	if !msg11.SessionPks[0].Equal(cliSessionPub) || !bytes.Equal(msg11.SessionPkSigs[0].Bytes, cliSessionSig) {
+		t.Error("Relay sent wrong session key")
+	}
 
-	//should receive a TRU_REL_TELL_NEW_BASE_AND_EPH_PKS
-	msg12 := net.TRU_REL_TELL_NEW_BASE_AND_EPH_PKS{
+	//should refuse a TRU_REL_TELL_NEW_BASE_AND_EPH_PKS without a valid proof, and name the trustee
+	forged := net.TRU_REL_TELL_NEW_BASE_AND_EPH_PKS{
 		NewBase:   msg11.Base,
 		NewEphPks: msg11.EphPks,
 		Proof:     make([]byte, 50),
 	}
+	if err := relay.ReceivedMessage(forged); err == nil || !strings.Contains(err.Error(), "Trustee 0") {
+		t.Error("Relay should refuse the shuffle of trustee 0, but", err)
+	}
+	if relay.stateMachine.State() != "COLLECTING_SHUFFLES" {
+		t.Error("In wrong state ! we should be in COLLECTING_SHUFFLES, but are in ", relay.stateMachine.State())
+	}
+
+	//should receive a TRU_REL_TELL_NEW_BASE_AND_EPH_PKS
+	msg12 := shuffleAsTrustee(t, msg11)
 
 	if err := relay.ReceivedMessage(msg12); err != nil {
 		t.Error("Relay should be able to receive this message, but", err)
@@ -503,7 +542,7 @@ func TestRelayRun2(t *testing.T) {
 	_ = msg4.(*net.ALL_ALL_PARAMETERS)
 
 	//since startNow = true, trustee sends TRU_REL_TELL_PK
-	trusteePub, trusteePriv := crypto.NewKeyPair()
+	trusteePub, trusteePriv := crypto.NewKeyPair(config.CryptoSuite)
 	_ = trusteePriv
 	msg6 := net.TRU_REL_TELL_PK{
 		TrusteeID: 0,
@@ -521,8 +560,8 @@ func TestRelayRun2(t *testing.T) {
 	_ = msg2.(*net.ALL_ALL_PARAMETERS)
 
 	//should receive a CLI_REL_TELL_PK_AND_EPH_PK
-	cliPub, cliPriv := crypto.NewKeyPair()
-	cliEphPub, cliEphPriv := crypto.NewKeyPair()
+	cliPub, cliPriv := crypto.NewKeyPair(config.CryptoSuite)
+	cliEphPub, cliEphPriv := crypto.NewKeyPair(config.CryptoSuite)
 	_ = cliPriv
 	_ = cliEphPriv
 	msg9 := net.CLI_REL_TELL_PK_AND_EPH_PK{
@@ -542,11 +581,7 @@ func TestRelayRun2(t *testing.T) {
 	msg11 := msg10.(*net.REL_TRU_TELL_CLIENTS_PKS_AND_EPH_PKS_AND_BASE)
 
 	//should receive a TRU_REL_TELL_NEW_BASE_AND_EPH_PKS
-	msg12 := net.TRU_REL_TELL_NEW_BASE_AND_EPH_PKS{
-		NewBase:   msg11.Base,
-		NewEphPks: msg11.EphPks,
-		Proof:     make([]byte, 50),
-	}
+	msg12 := shuffleAsTrustee(t, msg11)
 	if err := relay.ReceivedMessage(msg12); err != nil {
 		t.Error("Relay should be able to receive this message, but", err)
 	}
@@ -648,6 +683,11 @@ func TestRelayRun2(t *testing.T) {
 	if err := relay.ReceivedMessage(randomMsg); err == nil {
 		t.Error("Should not accept this REL_CLI_DOWNSTREAM_DATA message")
 	}
+
+	//all slots are closed, the relay waits before the next round; it must not open it during the next tests
+	if err := relay.ReceivedMessage(net.ALL_ALL_SHUTDOWN{}); err != nil {
+		t.Error("Should handle this ALL_ALL_SHUTDOWN message, but", err)
+	}
 }
 
 func TestRelayRun3(t *testing.T) {
@@ -708,7 +748,7 @@ func TestRelayRun3(t *testing.T) {
 	_ = msg4.(*net.ALL_ALL_PARAMETERS)
 
 	//since startNow = true, trustee sends TRU_REL_TELL_PK
-	trusteePub, trusteePriv := crypto.NewKeyPair()
+	trusteePub, trusteePriv := crypto.NewKeyPair(config.CryptoSuite)
 	_ = trusteePriv
 	msg6 := net.TRU_REL_TELL_PK{
 		TrusteeID: 0,
@@ -733,8 +773,8 @@ func TestRelayRun3(t *testing.T) {
 	_ = msg2.(*net.ALL_ALL_PARAMETERS)
 
 	//should receive a CLI_REL_TELL_PK_AND_EPH_PK
-	cliPub, cliPriv := crypto.NewKeyPair()
-	cliEphPub, cliEphPriv := crypto.NewKeyPair()
+	cliPub, cliPriv := crypto.NewKeyPair(config.CryptoSuite)
+	cliEphPub, cliEphPriv := crypto.NewKeyPair(config.CryptoSuite)
 	_ = cliPriv
 	_ = cliEphPriv
 	msg9 := net.CLI_REL_TELL_PK_AND_EPH_PK{
@@ -754,11 +794,7 @@ func TestRelayRun3(t *testing.T) {
 	msg11 := msg10.(*net.REL_TRU_TELL_CLIENTS_PKS_AND_EPH_PKS_AND_BASE)
 
 	//should receive a TRU_REL_TELL_NEW_BASE_AND_EPH_PKS
-	msg12 := net.TRU_REL_TELL_NEW_BASE_AND_EPH_PKS{
-		NewBase:   msg11.Base,
-		NewEphPks: msg11.EphPks,
-		Proof:     make([]byte, 50),
-	}
+	msg12 := shuffleAsTrustee(t, msg11)
 	if err := relay.ReceivedMessage(msg12); err != nil {
 		t.Error("Relay should be able to receive this message, but", err)
 	}
@@ -768,14 +804,13 @@ func TestRelayRun3(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	_ = msg10_2.(*net.REL_TRU_TELL_CLIENTS_PKS_AND_EPH_PKS_AND_BASE)
+	msg11_2 := msg10_2.(*net.REL_TRU_TELL_CLIENTS_PKS_AND_EPH_PKS_AND_BASE)
+	if !msg11_2.Base.Equal(msg12.NewBase) {
+		t.Error("Relay should send the output of trustee 0 to trustee 1")
+	}
 
 	//should receive a TRU_REL_TELL_NEW_BASE_AND_EPH_PKS
-	msg12_2 := net.TRU_REL_TELL_NEW_BASE_AND_EPH_PKS{
-		NewBase:   msg11.Base,
-		NewEphPks: msg11.EphPks,
-		Proof:     make([]byte, 50),
-	}
+	msg12_2 := shuffleAsTrustee(t, msg11_2)
 	if err := relay.ReceivedMessage(msg12_2); err != nil {
 		t.Error("Relay should be able to receive this message, but", err)
 	}
@@ -790,14 +825,14 @@ func TestRelayRun3(t *testing.T) {
 	//prepare the transcript signature. Since it is OK, we're gonna sign only the latest permutation
 	var blob []byte
 
-	lastSharesByte, err := transcript.Bases[0].MarshalBinary()
+	lastSharesByte, err := transcript.Bases[1].MarshalBinary()
 	if err != nil {
 		t.Error("Can't marshall the last shares...")
 	}
 	blob = append(blob, lastSharesByte...)
 
 	for j := 0; j < nClients; j++ {
-		pkBytes, err := transcript.EphPks[0].Keys[j].MarshalBinary()
+		pkBytes, err := transcript.EphPks[1].Keys[j].MarshalBinary()
 		if err != nil {
 			t.Error("Can't marshall shuffled public key" + strconv.Itoa(j))
 		}
@@ -857,7 +892,7 @@ func TestRelayRun3(t *testing.T) {
 	binary.BigEndian.PutUint64(latencyMessage[4:12], uint64(currentTime))
 
 	latencyMessage2 := dcnet.DCNetCipher{
-		Payload: latencyMessage,
+		Payload: scheduler.NewDataCell(latencyMessage),
 	}
 
 	msg18 := net.CLI_REL_UPSTREAM_DATA{
@@ -895,8 +930,6 @@ func TestRelayRun3(t *testing.T) {
 
 func TestRelayRun4(t *testing.T) {
 
-	t.Skip() //Verifiable DC-net disabled for now
-
 	timeoutHandler := func(clients, trustees []int) { log.Error(clients, trustees) }
 	resultChan := make(chan interface{}, 1)
 
@@ -936,6 +969,12 @@ func TestRelayRun4(t *testing.T) {
 	msg.Add("RelayTrusteeCacheLowBound", 10)
 	msg.Add("RelayTrusteeCacheHighBound", 15)
 
+	// the verifiable DC-net has its own protection and fixed-size cells, the other protections are refused
+	if err := relay.ReceivedMessage(*msg); err == nil {
+		t.Error("Relay should refuse the verifiable DC-net with the disruption protection and open/closed slots")
+	}
+	msg.Add("UseOpenClosedSlots", false)
+	msg.Add("DisruptionProtectionEnabled", false)
 	if err := relay.ReceivedMessage(*msg); err != nil {
 		t.Error("Relay should be able to receive this message, but", err)
 	}
@@ -956,7 +995,7 @@ func TestRelayRun4(t *testing.T) {
 	}
 
 	//since startNow = true, trustee sends TRU_REL_TELL_PK
-	trusteePub, trusteePriv := crypto.NewKeyPair()
+	trusteePub, trusteePriv := crypto.NewKeyPair(config.CryptoSuite)
 	_ = trusteePriv
 	msg6 := net.TRU_REL_TELL_PK{
 		TrusteeID: 0,
@@ -1005,3 +1044,317 @@ func TestRelayRun4(t *testing.T) {
 		t.Error("Relay should output an error when DCNetType != {Simple, Verifiable}")
 	}
 }
+
+func TestRelayCryptoSuite(t *testing.T) {
+
+	timeoutHandler := func(clients, trustees []int) { log.Error(clients, trustees) }
+	msw := newTestMessageSenderWrapper(new(TestMessageSender))
+	sentToClient = make([]interface{}, 0)
+	sentToTrustee = make([]interface{}, 0)
+	relay := NewRelay(false, make(chan []byte, 6), make(chan []byte, 3), make(chan interface{}, 1), timeoutHandler, msw)
+
+	msg := new(net.ALL_ALL_PARAMETERS)
+	msg.ForceParams = true
+	msg.Add("NClients", 2)
+	msg.Add("NTrustees", 1)
+	msg.Add("PayloadSize", 100)
+	msg.Add("CryptoSuite", "Curve41417")
+	if err := relay.ReceivedMessage(*msg); err == nil {
+		t.Error("Relay should refuse an unknown suite")
+	}
+
+	msg.Add("CryptoSuite", "P256")
+	msg.Add("StartNow", true)
+	if err := relay.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Relay should be able to receive this message, but", err)
+	}
+	rs := relay.relayState
+	if rs.CryptoSuite.String() != "P256" || rs.neffShuffle.Suite.String() != "P256" {
+		t.Error("The session should run with P256")
+	}
+	if rs.PublicKey.MarshalSize() != rs.CryptoSuite.PointLen() {
+		t.Error("The key of the relay should be in the suite of the session")
+	}
+
+	// the trustees are told the suite
+	msg2, err := getTrusteeMessage("ALL_ALL_PARAMETERS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg2.(*net.ALL_ALL_PARAMETERS).StringValueOrElse("CryptoSuite", "") != "P256" {
+		t.Error("Relay should announce the suite to the trustees")
+	}
+}
+
+func TestRelaySlotScheduler(t *testing.T) {
+
+	timeoutHandler := func(clients, trustees []int) { log.Error(clients, trustees) }
+	msw := newTestMessageSenderWrapper(new(TestMessageSender))
+	relay := NewRelay(false, make(chan []byte, 6), make(chan []byte, 3), make(chan interface{}, 1), timeoutHandler, msw)
+
+	msg := new(net.ALL_ALL_PARAMETERS)
+	msg.ForceParams = true
+	msg.Add("NClients", 2)
+	msg.Add("NTrustees", 1)
+	msg.Add("PayloadSize", 100)
+	msg.Add("SlotScheduler", "Lottery")
+	if err := relay.ReceivedMessage(*msg); err == nil {
+		t.Error("Relay should refuse an unknown slot scheduler")
+	}
+
+	// an empty name selects the default
+	msg.Add("SlotScheduler", "")
+	if err := relay.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Relay should be able to receive this message, but", err)
+	}
+	if relay.relayState.SlotScheduler != scheduler.SLOT_SCHEDULER_BITMASK {
+		t.Error("Relay should use the bitmask scheduler by default, got", relay.relayState.SlotScheduler)
+	}
+	if _, ok := relay.relayState.slotScheduler.(*scheduler.BitMaskSlotScheduler_Relay); !ok {
+		t.Error("Relay should use the relay side of the bitmask scheduler")
+	}
+
+	if relay.relayState.OpenClosedSlotsMaxCellsPerSlot != 1 {
+		t.Error("A slot should get one cell per schedule by default, got", relay.relayState.OpenClosedSlotsMaxCellsPerSlot)
+	}
+	msg.Add("SlotScheduler", scheduler.SLOT_SCHEDULER_COUNTER)
+	msg.Add("OpenClosedSlotsMaxCellsPerSlot", 4)
+	if err := relay.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Relay should be able to receive this message, but", err)
+	}
+	if relay.relayState.SlotScheduler != scheduler.SLOT_SCHEDULER_COUNTER || relay.relayState.OpenClosedSlotsMaxCellsPerSlot != 4 {
+		t.Error("Relay should use the counter scheduler, with 4 cells per slot at most")
+	}
+
+	// the footprint scheduler needs the open/closed slots, and does not prove the ownership of the slots; the relay
+	// refuses the settings it would otherwise have to override
+	msg.Add("SlotScheduler", scheduler.SLOT_SCHEDULER_FOOTPRINT)
+	msg.Add("UseOpenClosedSlots", false)
+	if err := relay.ReceivedMessage(*msg); err == nil {
+		t.Error("Relay should refuse the footprint scheduler without open/closed slots")
+	}
+	msg.Add("UseOpenClosedSlots", true)
+	msg.Add("EquivocationProtectionEnabled", true)
+	if err := relay.ReceivedMessage(*msg); err == nil {
+		t.Error("Relay should refuse the footprint scheduler with the equivocation protection")
+	}
+	msg.Add("EquivocationProtectionEnabled", false)
+	if err := relay.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Relay should be able to receive this message, but", err)
+	}
+	if relay.relayState.SlotScheduler != scheduler.SLOT_SCHEDULER_FOOTPRINT || !relay.relayState.UseOpenClosedSlots {
+		t.Error("Relay should use the footprint scheduler with open/closed slots")
+	}
+	msg.Add("DCNetType", "Verifiable")
+	if err := relay.ReceivedMessage(*msg); err == nil {
+		t.Error("Relay should refuse the footprint scheduler with the verifiable DC-net")
+	}
+
+	// the reservations must fit in a cell
+	msg.Add("DCNetType", "Simple")
+	msg.Add("PayloadSize", 10)
+	if err := relay.ReceivedMessage(*msg); err == nil {
+		t.Error("Relay should refuse a payload smaller than the reservation vector")
+	}
+}
+
+func TestRelayVariableCellSize(t *testing.T) {
+
+	timeoutHandler := func(clients, trustees []int) { log.Error(clients, trustees) }
+	msw := newTestMessageSenderWrapper(new(TestMessageSender))
+	relay := NewRelay(false, make(chan []byte, 6), make(chan []byte, 3), make(chan interface{}, 1), timeoutHandler, msw)
+
+	msg := new(net.ALL_ALL_PARAMETERS)
+	msg.ForceParams = true
+	msg.Add("NClients", 2)
+	msg.Add("NTrustees", 1)
+	msg.Add("PayloadSize", 1000)
+	if err := relay.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Relay should be able to receive this message, but", err)
+	}
+	if relay.upstreamPayloadSize(0, false) != 0 {
+		t.Error("Without variable cells, every round should have the session's PayloadSize")
+	}
+	msg.Add("UseVariableCellSize", true)
+	if err := relay.ReceivedMessage(*msg); err == nil {
+		t.Error("The cell lengths are requested in the open/closed rounds, relay should refuse variable cells without them")
+	}
+
+	msg.Add("UseOpenClosedSlots", true)
+	msg.Add("SlotScheduler", scheduler.SLOT_SCHEDULER_COUNTER)
+	if err := relay.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Relay should be able to receive this message, but", err)
+	}
+	if !relay.relayState.UseVariableCellSize {
+		t.Fatal("Relay should use variable cell sizes")
+	}
+
+	// slot 0 asked for 10 bytes, slot 1 for 500, slot 2 for full cells, slot 3 for more than PayloadSize
+	relay.relayState.slotPayloadSizes = map[int]int{0: 10, 1: 500, 2: 0, 3: 2000}
+	expected := map[int]int{0: MIN_CELL_PAYLOAD_SIZE, 1: 500, 2: 0, 3: 0, -1: MIN_CELL_PAYLOAD_SIZE}
+	for slot, payloadSize := range expected {
+		if relay.upstreamPayloadSize(slot, false) != payloadSize {
+			t.Error("Rounds of slot", slot, "should have cells of", payloadSize, "bytes, got", relay.upstreamPayloadSize(slot, false))
+		}
+	}
+	if relay.upstreamPayloadSize(-1, true) != MIN_CELL_PAYLOAD_SIZE {
+		t.Error("The open/closed rounds only need to fit the clients' contributions")
+	}
+
+	msg.Add("DisruptionProtectionEnabled", true)
+	if err := relay.ReceivedMessage(*msg); err == nil {
+		t.Error("The disruption protection works on full cells, relay should refuse variable cells")
+	}
+}
+
+func TestRelaySubCells(t *testing.T) {
+
+	timeoutHandler := func(clients, trustees []int) { log.Error(clients, trustees) }
+	msw := newTestMessageSenderWrapper(new(TestMessageSender))
+	relay := NewRelay(false, make(chan []byte, 6), make(chan []byte, 3), make(chan interface{}, 1), timeoutHandler, msw)
+
+	msg := new(net.ALL_ALL_PARAMETERS)
+	msg.ForceParams = true
+	msg.Add("NClients", 3)
+	msg.Add("NTrustees", 1)
+	msg.Add("PayloadSize", 1000)
+	msg.Add("SubCellsPerRound", 5)
+	msg.Add("UseOpenClosedSlots", true)
+	msg.Add("UseVariableCellSize", true)
+	if err := relay.ReceivedMessage(*msg); err == nil {
+		t.Error("Rounds split in sub-cells have the full PayloadSize, relay should refuse variable cells")
+	}
+	msg.Add("UseVariableCellSize", false)
+	if err := relay.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Relay should be able to receive this message, but", err)
+	}
+	if relay.relayState.SubCellsPerRound != 3 {
+		t.Error("There should be at most one sub-cell per client, got", relay.relayState.SubCellsPerRound)
+	}
+
+	// each sub-cell must fit a latency-test message
+	msg.Add("PayloadSize", 2*MIN_CELL_PAYLOAD_SIZE+1)
+	if err := relay.ReceivedMessage(*msg); err == nil {
+		t.Error("Only 2 sub-cells fit in the payload, relay should refuse 5")
+	}
+	msg.Add("SubCellsPerRound", 2)
+	if err := relay.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Relay should be able to receive this message, but", err)
+	}
+	if relay.relayState.SubCellsPerRound != 2 {
+		t.Error("2 sub-cells fit in the payload, got", relay.relayState.SubCellsPerRound)
+	}
+
+	msg.Add("EquivocationProtectionEnabled", true)
+	if err := relay.ReceivedMessage(*msg); err == nil {
+		t.Error("The equivocation protection needs one owner per cell, relay should refuse sub-cells")
+	}
+	msg.Add("EquivocationProtectionEnabled", false)
+	msg.Add("DisruptionProtectionEnabled", true)
+	if err := relay.ReceivedMessage(*msg); err == nil {
+		t.Error("The disruption protection needs one owner per cell, relay should refuse sub-cells")
+	}
+
+	// the sub-cells nobody owns are not output
+	payload := []byte{1, 1, 2, 2, 3, 3, 0}
+	outputs := splitSubCells(payload, []int{4, -1, 0})
+	if len(outputs) != 2 || !bytes.Equal(outputs[0], []byte{1, 1}) || !bytes.Equal(outputs[1], []byte{3, 3}) {
+		t.Error("Wrong sub-cells", outputs)
+	}
+}
+
+func TestRelayCoverReservations(t *testing.T) {
+
+	timeoutHandler := func(clients, trustees []int) { log.Error(clients, trustees) }
+	msw := newTestMessageSenderWrapper(new(TestMessageSender))
+	relay := NewRelay(false, make(chan []byte, 6), make(chan []byte, 3), make(chan interface{}, 1), timeoutHandler, msw)
+
+	msg := new(net.ALL_ALL_PARAMETERS)
+	msg.ForceParams = true
+	msg.Add("NClients", 3)
+	msg.Add("NTrustees", 1)
+	msg.Add("PayloadSize", 1000)
+	msg.Add("UseOpenClosedSlots", true)
+	if err := relay.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Relay should be able to receive this message, but", err)
+	}
+	if relay.relayState.CoverReservationPolicy != scheduler.COVER_POLICY_TAIL || relay.relayState.CoverReservationTail != 1000 {
+		t.Error("The clients should keep reserving for a second after their last activity by default")
+	}
+
+	msg.Add("CoverReservationPolicy", "Always")
+	if err := relay.ReceivedMessage(*msg); err == nil {
+		t.Error("Relay should refuse an unknown cover policy")
+	}
+	msg.Add("CoverReservationPolicy", scheduler.COVER_POLICY_RANDOM)
+	msg.Add("CoverReservationProbability", 150)
+	if err := relay.ReceivedMessage(*msg); err == nil {
+		t.Error("Relay should refuse a probability above 100%")
+	}
+	msg.Add("CoverReservationProbability", 20)
+	if err := relay.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Relay should be able to receive this message, but", err)
+	}
+	if relay.relayState.CoverReservationPolicy != scheduler.COVER_POLICY_RANDOM || relay.relayState.CoverReservationProbability != 20 {
+		t.Error("Relay should use the Random cover policy")
+	}
+
+	// a policy missing from prifi.toml is the historical tail
+	msg.Add("CoverReservationPolicy", "")
+	msg.Add("CoverReservationTail", 0)
+	if err := relay.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Relay should be able to receive this message, but", err)
+	}
+	if relay.relayState.CoverReservationPolicy != scheduler.COVER_POLICY_TAIL || relay.relayState.CoverReservationTail != 1000 {
+		t.Error("Without a cover policy, the clients should keep the historical tail")
+	}
+
+	// the cover cells are not output, the data cells are, whatever their content
+	cells := append(scheduler.NewCoverCell(4), scheduler.NewDataCell([]byte{1, 2, 3})...)
+	cells = append(cells, scheduler.NewDataCell(make([]byte, 3))...)
+	outputs := cellsData(splitSubCells(cells, []int{0, 1, 2}))
+	if len(outputs) != 2 || !bytes.Equal(outputs[0], []byte{1, 2, 3}) || !bytes.Equal(outputs[1], make([]byte, 3)) {
+		t.Error("Relay should only drop the cover cells, got", outputs)
+	}
+}
+
+func TestTrusteeCiphersInAdvance(t *testing.T) {
+
+	timeoutHandler := func(clients, trustees []int) { log.Error(clients, trustees) }
+	msw := newTestMessageSenderWrapper(new(TestMessageSender))
+	sentToClient = make([]interface{}, 0)
+	sentToTrustee = make([]interface{}, 0)
+	relay := NewRelay(false, make(chan []byte, 6), make(chan []byte, 3), make(chan interface{}, 1), timeoutHandler, msw)
+
+	msg := new(net.ALL_ALL_PARAMETERS)
+	msg.ForceParams = true
+	msg.Add("NClients", 1)
+	msg.Add("NTrustees", 2)
+	msg.Add("PayloadSize", 100)
+	msg.Add("WindowSize", 1)
+	if err := relay.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Relay should be able to receive this message, but", err)
+	}
+	relay.relayState.DCNet = dcnet.NewDCNetEntity(0, dcnet.DCNET_RELAY, 100, false, nil, config.CryptoSuite)
+
+	// the ciphers of a round that is not opened yet are folded in, not kept
+	for j := 0; j < 2; j++ {
+		cipher := &dcnet.DCNetCipher{Payload: []byte{byte(j + 1), 2, 3}}
+		relay.addTrusteeCipher(5, j, cipher.ToBytes())
+	}
+	if relay.relayState.DCNet.IsDecoding(5) {
+		t.Error("Round 5 is not opened yet")
+	}
+	if _, stored := relay.relayState.roundManager.TakeBufferedCiphers(5); len(stored) != 0 {
+		t.Error("Relay should not keep the trustee ciphers sent in advance, has", len(stored))
+	}
+	if relay.relayState.roundManager.NumberOfBufferedCiphers(0) != 1 {
+		t.Error("The rate of the trustees should still count the ciphers sent in advance")
+	}
+
+	// they are part of the round once it opens
+	relay.relayState.DCNet.DecodeStart(5, -1)
+	if output, _, _ := relay.relayState.DCNet.DecodeCell(5, true); !bytes.Equal(output[:3], []byte{3, 0, 0}) {
+		t.Error("The trustee ciphers sent in advance should be decoded, got", output[:3])
+	}
+}
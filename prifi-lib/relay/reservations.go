@@ -0,0 +1,288 @@
+package relay
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+
+	"github.com/dedis/prifi/prifi-lib/crypto"
+	"github.com/dedis/prifi/prifi-lib/dcnet"
+	"github.com/dedis/prifi/prifi-lib/net"
+	"github.com/dedis/prifi/prifi-lib/scheduler"
+	"go.dedis.ch/onet/v3/log"
+)
+
+/*
+Signed reservations. In the open/closed rounds, the cell is the plain XOR of the reservations: the equivocation
+protection does not apply, and the b_echo_last flag of the disruption protection is not sent. With either protection,
+the owner of each slot signs its reservation with the pseudonym of its slot (see scheduler.SignedReservations):
+
+- the relay checks every signature in the decoded reservation vector. A slot whose reservation was altered is opened
+  for one cell, whatever it asked for, so that a jammer cannot close it; the vector is sent to the clients
+  (REL_CLI_CORRUPTED_RESERVATIONS);
+- the owner of an altered slot looks for a bit it left at 0 that was decoded as 1, and blames it in the cell it gets,
+  signed with its pseudonym. This cell is not an output;
+- the clients that took part in the round reveal the bits of their pads at this position, and consent to the reveal
+  with their long-term key; with the consent of every client, the trustees reveal theirs (REL_ALL_RESERVATION_REVEAL,
+  CLI_REL_RESERVATION_REVEAL, TRU_REL_RESERVATION_REVEAL);
+- the entity whose cipher does not match its pads set the bit. If a client and a trustee reveal different bits of the
+  pad they share, one of them lied, and the seed of their pads tells which one (see disruption.go).
+
+A client found corrupting the reservations is reported, with the number of times it was found; the open/closed rounds
+keep working, as its jamming only opens slots. One reveal runs at a time.
+*/
+
+// reservationRound is an open/closed round in which some reservations were altered, kept for a blame
+type reservationRound struct {
+	vector         []byte         // the decoded reservation vector
+	corrupted      map[int]bool   // the slots whose reservation was altered
+	clientCiphers  map[int][]byte // the ciphers of the round, by client ID
+	trusteeCiphers map[int][]byte // the ciphers of the round, by trustee ID
+	blamed         bool           // a blame about this round was accepted
+}
+
+// reservationReveal is the reveal of the pads at a blamed bit of the reservation vector of round roundID
+type reservationReveal struct {
+	roundID     int32
+	bitPos      int
+	signature   []byte // the blame, signed by the owner of the bit's slot
+	clientBits  map[int]map[int]int
+	consents    map[int][]byte
+	trusteeBits map[int]map[int]int
+}
+
+// verifyReservations checks the signatures of the decoded reservation vector of round roundID. Returns the
+// scheduler's contributions, and the slots whose reservation was altered; unless notify is false (e.g., the round is
+// disrupted), the altered vector is kept for a blame and sent to the clients
+func (p *PriFiLibRelayInstance) verifyReservations(roundID int32, vector []byte, notify bool) ([]byte, []int) {
+	contributions, corrupted := p.relayState.signedReservations.Verify(roundID, vector, p.relayState.pseudonymBase, p.relayState.pseudonyms)
+	if len(corrupted) == 0 {
+		return contributions, corrupted
+	}
+	log.Error("Relay : the reservations of slots", corrupted, "were altered in round", roundID, ", opening them")
+	if !notify {
+		return contributions, corrupted
+	}
+
+	r := &reservationRound{
+		vector:         append([]byte(nil), vector...),
+		corrupted:      make(map[int]bool),
+		clientCiphers:  make(map[int][]byte),
+		trusteeCiphers: make(map[int][]byte),
+	}
+	for _, slot := range corrupted {
+		r.corrupted[slot] = true
+	}
+	for clientID, history := range p.relayState.CiphertextsHistoryClients {
+		if c, found := history[roundID]; found {
+			r.clientCiphers[int(clientID)] = c
+		}
+	}
+	for trusteeID, history := range p.relayState.CiphertextsHistoryTrustees {
+		if c, found := history[roundID]; found {
+			r.trusteeCiphers[int(trusteeID)] = c
+		}
+	}
+	p.storeReservationRound(roundID, r)
+
+	toSend := &net.REL_CLI_CORRUPTED_RESERVATIONS{RoundID: roundID, Reservations: r.vector}
+	for i := 0; i < p.relayState.nClients; i++ {
+		p.messageSender.SendToClientWithLog(i, toSend, "(client "+strconv.Itoa(i)+", round "+strconv.Itoa(int(roundID))+")")
+	}
+	return contributions, corrupted
+}
+
+// storeReservationRound keeps an altered open/closed round, and forgets the oldest ones
+func (p *PriFiLibRelayInstance) storeReservationRound(roundID int32, r *reservationRound) {
+	p.relayState.reservationRounds[roundID] = r
+	if len(p.relayState.reservationRounds) <= scheduler.RESERVATION_ROUNDS_KEPT {
+		return
+	}
+	rounds := make([]int, 0, len(p.relayState.reservationRounds))
+	for k := range p.relayState.reservationRounds {
+		rounds = append(rounds, int(k))
+	}
+	sort.Ints(rounds)
+	for _, k := range rounds[:len(rounds)-scheduler.RESERVATION_ROUNDS_KEPT] {
+		delete(p.relayState.reservationRounds, int32(k))
+	}
+}
+
+// handleReservationBlame checks whether the decoded payload of a round owned by ownerSlot is a blame about the
+// reservations, signed by the owner of the slot, and starts the reveal. Returns false if the payload is data
+func (p *PriFiLibRelayInstance) handleReservationBlame(ownerSlot int, payload []byte) bool {
+	sr := p.relayState.signedReservations
+	roundID, bitPos, sig, ok := scheduler.DecodeReservationBlame(payload, crypto.SchnorrSignatureSize(p.relayState.CryptoSuite))
+	if !ok || sr.VerifyBlame(roundID, bitPos, sig, p.relayState.pseudonymBase, p.relayState.pseudonyms) != nil {
+		return false
+	}
+
+	log.Lvl1("Relay : slot", ownerSlot, "blames bit", bitPos, "of the reservations of round", roundID)
+	if err := p.startReservationReveal(ownerSlot, roundID, bitPos, sig); err != nil {
+		log.Error("Relay : ignoring the blame of slot", ownerSlot, ":", err)
+	}
+	return true
+}
+
+// startReservationReveal checks that the blame is about a bit the jammer set in an altered reservation of ownerSlot,
+// and asks the clients to reveal their pads at this bit
+func (p *PriFiLibRelayInstance) startReservationReveal(ownerSlot int, roundID int32, bitPos int, sig []byte) error {
+	if p.relayState.signedReservations.SlotOfBit(bitPos) != ownerSlot {
+		return errors.New("bit " + strconv.Itoa(bitPos) + " does not belong to slot " + strconv.Itoa(ownerSlot))
+	}
+	r, found := p.relayState.reservationRounds[roundID]
+	if !found {
+		return errors.New("no altered reservation is known in round " + strconv.Itoa(int(roundID)))
+	}
+	if !r.corrupted[ownerSlot] {
+		return errors.New("the reservation of slot " + strconv.Itoa(ownerSlot) + " was not altered in round " + strconv.Itoa(int(roundID)))
+	}
+	if scheduler.Bit(r.vector, bitPos) != 1 {
+		return errors.New("bit " + strconv.Itoa(bitPos) + " was not set in round " + strconv.Itoa(int(roundID)))
+	}
+	if r.blamed {
+		return errors.New("round " + strconv.Itoa(int(roundID)) + " was already blamed")
+	}
+	// a reveal about a round we forgot will never complete
+	if rv := p.relayState.reservationReveal; rv != nil && p.relayState.reservationRounds[rv.roundID] != nil {
+		return errors.New("the reveal of round " + strconv.Itoa(int(rv.roundID)) + " is in progress")
+	}
+
+	r.blamed = true
+	p.relayState.reservationReveal = &reservationReveal{
+		roundID:     roundID,
+		bitPos:      bitPos,
+		signature:   sig,
+		clientBits:  make(map[int]map[int]int),
+		consents:    make(map[int][]byte),
+		trusteeBits: make(map[int]map[int]int),
+	}
+
+	toSend := &net.REL_ALL_RESERVATION_REVEAL{RoundID: roundID, BitPos: bitPos, Signature: sig}
+	for i := 0; i < p.relayState.nClients; i++ {
+		p.messageSender.SendToClientWithLog(i, toSend, "(client "+strconv.Itoa(i)+", round "+strconv.Itoa(int(roundID))+")")
+	}
+	return nil
+}
+
+/*
+Received_CLI_REL_RESERVATION_REVEAL handles CLI_REL_RESERVATION_REVEAL messages, the bits of a client's pads at the
+blamed bit. Once every client revealed its bits, their consents are sent to the trustees.
+*/
+func (p *PriFiLibRelayInstance) Received_CLI_REL_RESERVATION_REVEAL(msg net.CLI_REL_RESERVATION_REVEAL) error {
+	rv := p.relayState.reservationReveal
+	if rv == nil || msg.RoundID != rv.roundID || msg.BitPos != rv.bitPos {
+		return errors.New("Relay : unexpected reveal from client " + strconv.Itoa(msg.ClientID) + " for round " + strconv.Itoa(int(msg.RoundID)))
+	}
+	if msg.ClientID < 0 || msg.ClientID >= p.relayState.nClients {
+		return errors.New("Relay : reveal from unknown client " + strconv.Itoa(msg.ClientID))
+	}
+	if err := scheduler.VerifyRevealConsent(p.relayState.CryptoSuite, msg.RoundID, msg.BitPos, msg.Consent, p.relayState.clients[msg.ClientID].PublicKey); err != nil {
+		return errors.New("Relay : invalid consent from client " + strconv.Itoa(msg.ClientID) + ", " + err.Error())
+	}
+	log.Lvl2("Relay : received the bits of client", msg.ClientID, "for the reservations of round", msg.RoundID, ":", msg.Bits)
+
+	rv.clientBits[msg.ClientID] = msg.Bits
+	rv.consents[msg.ClientID] = msg.Consent
+	if len(rv.clientBits) < p.relayState.nClients {
+		return nil
+	}
+
+	consents := make([]net.ByteArray, p.relayState.nClients)
+	for i := range consents {
+		consents[i] = net.ByteArray{Bytes: rv.consents[i]}
+	}
+	toSend := &net.REL_ALL_RESERVATION_REVEAL{RoundID: rv.roundID, BitPos: rv.bitPos, Signature: rv.signature, Consents: consents}
+	for j := 0; j < p.relayState.nTrustees; j++ {
+		p.messageSender.SendToTrusteeWithLog(j, toSend, "(trustee "+strconv.Itoa(j)+", round "+strconv.Itoa(int(rv.roundID))+")")
+	}
+	return nil
+}
+
+/*
+Received_TRU_REL_RESERVATION_REVEAL handles TRU_REL_RESERVATION_REVEAL messages, the bits of a trustee's pads at the
+blamed bit. Once every trustee revealed its bits, the disruptor is looked for.
+*/
+func (p *PriFiLibRelayInstance) Received_TRU_REL_RESERVATION_REVEAL(msg net.TRU_REL_RESERVATION_REVEAL) error {
+	rv := p.relayState.reservationReveal
+	if rv == nil || msg.RoundID != rv.roundID || msg.BitPos != rv.bitPos || len(rv.clientBits) < p.relayState.nClients {
+		return errors.New("Relay : unexpected reveal from trustee " + strconv.Itoa(msg.TrusteeID) + " for round " + strconv.Itoa(int(msg.RoundID)))
+	}
+	log.Lvl2("Relay : received the bits of trustee", msg.TrusteeID, "for the reservations of round", msg.RoundID, ":", msg.Bits)
+
+	rv.trusteeBits[msg.TrusteeID] = msg.Bits
+	if len(rv.trusteeBits) == p.relayState.nTrustees {
+		p.reservationVerdict()
+	}
+	return nil
+}
+
+// reservationVerdict finds who set the blamed bit, once every client and trustee revealed its pads
+func (p *PriFiLibRelayInstance) reservationVerdict() {
+	rv := p.relayState.reservationReveal
+	p.relayState.reservationReveal = nil
+	r, found := p.relayState.reservationRounds[rv.roundID]
+	if !found {
+		log.Error("Relay : the ciphers of round", rv.roundID, "were forgotten, cannot end the reveal")
+		return
+	}
+
+	// a trustee whose cipher does not match its pads lied
+	for trusteeID := 0; trusteeID < p.relayState.nTrustees; trusteeID++ {
+		if dcnet.CipherPayloadBit(r.trusteeCiphers[trusteeID], rv.bitPos) != xorBits(rv.trusteeBits[trusteeID]) {
+			p.reservationDisruptorFound(false, trusteeID)
+			return
+		}
+	}
+
+	// a client and a trustee revealing different bits of the pad they share: one of them lied
+	for clientID := 0; clientID < p.relayState.nClients; clientID++ {
+		for trusteeID := 0; trusteeID < p.relayState.nTrustees; trusteeID++ {
+			clientBit := rv.clientBits[clientID][trusteeID]
+			trusteeBit := rv.trusteeBits[trusteeID][clientID]
+			if clientBit == trusteeBit {
+				continue
+			}
+			log.Error("Relay : client", clientID, "and trustee", trusteeID, "revealed different bits for the reservations of round", rv.roundID)
+			p.relayState.blamingData = BlamingData{
+				RoundID:            rv.roundID,
+				BitPos:             rv.bitPos,
+				ClientID:           clientID,
+				ClientBitRevealed:  clientBit,
+				TrusteeID:          trusteeID,
+				TrusteeBitRevealed: trusteeBit,
+				ScheduleRound:      true,
+			}
+			p.requestSharedSecrets()
+			return
+		}
+	}
+
+	// the pads are consistent, the client whose cipher does not match its pads set the bit
+	for clientID := 0; clientID < p.relayState.nClients; clientID++ {
+		if dcnet.CipherPayloadBit(r.clientCiphers[clientID], rv.bitPos) != xorBits(rv.clientBits[clientID]) {
+			p.reservationDisruptorFound(true, clientID)
+			return
+		}
+	}
+	log.Error("Relay : the reveal of bit", rv.bitPos, "in round", rv.roundID, "found nobody setting it")
+}
+
+// reservationDisruptorFound reports a client or a trustee found corrupting the reservations
+func (p *PriFiLibRelayInstance) reservationDisruptorFound(isClient bool, entityID int) {
+	if !isClient {
+		log.Error("Relay : trustee", entityID, "corrupted the reservations")
+		return
+	}
+	p.relayState.reservationDisruptors[entityID]++
+	log.Error("Relay : client", entityID, "corrupted the reservations, it was found", p.relayState.reservationDisruptors[entityID], "times")
+}
+
+// xorBits returns the XOR of the revealed bits
+func xorBits(bits map[int]int) int {
+	result := 0
+	for _, bit := range bits {
+		result ^= bit
+	}
+	return result & 1
+}
@@ -0,0 +1,184 @@
+package relay
+
+import (
+	"testing"
+
+	"github.com/dedis/prifi/prifi-lib/config"
+	"github.com/dedis/prifi/prifi-lib/crypto"
+	"github.com/dedis/prifi/prifi-lib/dcnet"
+	"github.com/dedis/prifi/prifi-lib/net"
+	"github.com/dedis/prifi/prifi-lib/scheduler"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestRelaySignedReservations(t *testing.T) {
+
+	timeoutHandler := func(clients, trustees []int) { log.Error(clients, trustees) }
+	msw := newTestMessageSenderWrapper(new(TestMessageSender))
+	sentToClient = make([]interface{}, 0)
+	sentToTrustee = make([]interface{}, 0)
+	relay := NewRelay(false, make(chan []byte, 6), make(chan []byte, 3), make(chan interface{}, 1), timeoutHandler, msw)
+
+	nClients, payloadSize := 2, 200
+	msg := new(net.ALL_ALL_PARAMETERS)
+	msg.ForceParams = true
+	msg.Add("NClients", nClients)
+	msg.Add("NTrustees", 1)
+	msg.Add("PayloadSize", payloadSize)
+	msg.Add("UseOpenClosedSlots", true)
+	if err := relay.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Relay should be able to receive this message, but", err)
+	}
+	if relay.relayState.signedReservations != nil {
+		t.Error("Without the equivocation or the disruption protection, the reservations should not be signed")
+	}
+	msg.Add("EquivocationProtectionEnabled", true)
+	msg.Add("PayloadSize", 100)
+	if err := relay.ReceivedMessage(*msg); err == nil {
+		t.Error("The signed reservations do not fit in 100 bytes, the relay should refuse them")
+	}
+	msg.Add("PayloadSize", payloadSize)
+	if err := relay.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Relay should be able to receive this message, but", err)
+	}
+	sr := relay.relayState.signedReservations
+	if sr == nil {
+		t.Fatal("With the equivocation protection, the reservations should be signed")
+	}
+
+	// the clients' long-term keys, the pseudonyms of their slots (client i owns slot i), and the pads they share with
+	// the trustee
+	suite := config.CryptoSuite
+	clientPrivs := make([]kyber.Scalar, nClients)
+	pseudonymPrivs := make([]kyber.Scalar, nClients)
+	pseudonyms := make([]kyber.Point, nClients)
+	sharedKeys := make([]kyber.Point, nClients)
+	clients := make([]*dcnet.DCNetEntity, nClients)
+	base, _ := crypto.NewKeyPair(suite)
+	for i := 0; i < nClients; i++ {
+		relay.relayState.clients[i].PublicKey, clientPrivs[i] = crypto.NewKeyPair(suite)
+		pseudonymPrivs[i] = suite.Scalar().Pick(suite.RandomStream())
+		pseudonyms[i] = suite.Point().Mul(pseudonymPrivs[i], base)
+		sharedKeys[i], _ = crypto.NewKeyPair(suite)
+		clients[i] = dcnet.NewDCNetEntity(i, dcnet.DCNET_CLIENT, payloadSize, false, []kyber.Point{sharedKeys[i]}, suite)
+	}
+	trustee := dcnet.NewDCNetEntity(0, dcnet.DCNET_TRUSTEE, payloadSize, false, sharedKeys, suite)
+	relay.relayState.pseudonymBase = base
+	relay.relayState.pseudonyms = pseudonyms
+	relay.stateMachine.ChangeState("COMMUNICATING")
+
+	// in round 3, slot 0 asks for a cell, slot 1 does not; client 0 also opens slot 1
+	roundID := int32(3)
+	contributions := make([][]byte, nClients)
+	vector := make([]byte, sr.Size())
+	for i := 0; i < nClients; i++ {
+		c := new(scheduler.BitMaskSlotScheduler).NewClient()
+		c.Client_ReceivedScheduleRequest(nClients, 10)
+		if i == 0 {
+			c.Client_ReserveRound(0, 1, 0)
+		}
+		signed, err := sr.Sign(roundID, c.Client_GetOpenScheduleContribution(), i, base, pseudonymPrivs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		contributions[i] = signed
+		payload := append([]byte(nil), signed...)
+		if i == 0 {
+			payload[0] |= 2
+		}
+		cipher, _ := clients[i].EncodeForSlot(roundID, -1, payload)
+		relay.relayState.CiphertextsHistoryClients[int32(i)][roundID] = cipher
+		for k := range payload {
+			vector[k] ^= payload[k]
+		}
+	}
+	relay.relayState.CiphertextsHistoryTrustees[0][roundID] = trustee.TrusteeEncodeForRound(roundID)
+
+	// slot 1 is opened anyway, and the clients learn the decoded vector
+	schedule, corrupted := relay.verifyReservations(roundID, vector, true)
+	if len(corrupted) != 1 || corrupted[0] != 1 {
+		t.Fatal("Only the reservation of slot 1 was altered, got", corrupted)
+	}
+	if len(schedule) != new(scheduler.BitMaskSlotScheduler).ContributionSize(nClients) {
+		t.Error("Relay should return the scheduler's contributions")
+	}
+	if len(sentToClient) != nClients || sentToClient[0].(*net.REL_CLI_CORRUPTED_RESERVATIONS).RoundID != roundID {
+		t.Fatal("Relay should send the altered reservations to every client")
+	}
+	sentToClient = make([]interface{}, 0)
+
+	// the owner of slot 1 blames the bit it did not set, in its cell
+	bitPos := sr.BlamableBit(contributions[1], vector, 1)
+	if bitPos != 1 {
+		t.Fatal("Slot 1 should blame bit 1, got", bitPos)
+	}
+	sig, err := sr.SignBlame(roundID, bitPos, base, pseudonymPrivs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	blame := append(scheduler.EncodeReservationBlame(roundID, bitPos, sig), make([]byte, 20)...)
+	if relay.handleReservationBlame(1, make([]byte, payloadSize)) {
+		t.Error("Data is not a blame")
+	}
+	if !relay.handleReservationBlame(0, blame) || relay.relayState.reservationReveal != nil {
+		t.Error("The blame of slot 1 in the cell of slot 0 should not be an output, nor start a reveal")
+	}
+	if !relay.handleReservationBlame(1, blame) || relay.relayState.reservationReveal == nil {
+		t.Fatal("Relay should start the reveal of bit 1 of round 3")
+	}
+	if len(sentToClient) != nClients || len(sentToTrustee) != 0 {
+		t.Fatal("Relay should first ask the clients to reveal their pads")
+	}
+	relay.handleReservationBlame(1, blame)
+	if len(sentToClient) != nClients {
+		t.Error("Relay should accept a single blame per round")
+	}
+
+	// the clients reveal their pads and consent; the trustee is asked once every client consented
+	for i := 0; i < nClients; i++ {
+		bits, err := clients[i].PadBitsOfRound(roundID, bitPos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		consent, err := scheduler.SignRevealConsent(suite, roundID, bitPos, clientPrivs[(i+1)%nClients])
+		if err != nil {
+			t.Fatal(err)
+		}
+		reveal := net.CLI_REL_RESERVATION_REVEAL{ClientID: i, RoundID: roundID, BitPos: bitPos, Bits: bits, Consent: consent}
+		if err := relay.ReceivedMessage(reveal); err == nil {
+			t.Error("Relay should refuse the consent signed by another client")
+		}
+		reveal.Consent, _ = scheduler.SignRevealConsent(suite, roundID, bitPos, clientPrivs[i])
+		if err := relay.ReceivedMessage(reveal); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(sentToTrustee) != 1 {
+		t.Fatal("Relay should ask the trustee to reveal its pads")
+	}
+	toTrustee := sentToTrustee[0].(*net.REL_ALL_RESERVATION_REVEAL)
+	if len(toTrustee.Consents) != nClients {
+		t.Fatal("Relay should forward the consent of every client")
+	}
+	for i, consent := range toTrustee.Consents {
+		if err := scheduler.VerifyRevealConsent(suite, roundID, bitPos, consent.Bytes, relay.relayState.clients[i].PublicKey); err != nil {
+			t.Error("The consents should be indexed by client:", err)
+		}
+	}
+
+	// client 0's cipher does not match its pads
+	bits, err := trustee.PadBitsOfRound(roundID, bitPos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := relay.ReceivedMessage(net.TRU_REL_RESERVATION_REVEAL{TrusteeID: 0, RoundID: roundID, BitPos: bitPos, Bits: bits}); err != nil {
+		t.Fatal(err)
+	}
+	if relay.relayState.reservationDisruptors[0] != 1 || relay.relayState.reservationDisruptors[1] != 0 {
+		t.Error("Client 0 should be found corrupting the reservations, got", relay.relayState.reservationDisruptors)
+	}
+	if relay.relayState.reservationReveal != nil {
+		t.Error("The reveal should be over")
+	}
+}
@@ -0,0 +1,216 @@
+package relay
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/dedis/prifi/prifi-lib/net"
+	"github.com/dedis/prifi/prifi-lib/scheduler"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+/*
+Slots reshuffling. The slot of a client is given by the Neff shuffle of the setup; if it never changes, the traffic of
+a slot links all the messages a client sends in the session. When ReshufflePeriodRounds or ReshufflePeriodSeconds is
+set, the relay periodically starts a new shuffle epoch while the current one keeps communicating:
+
+- it asks the clients for new ephemeral keys (REL_CLI_RESHUFFLE_REQUEST, CLI_REL_RESHUFFLE_EPH_PK);
+- the trustees shuffle them and sign the result, with the messages of the setup's shuffle tagged with the epoch;
+- the relay sends the new pseudonyms to the clients with a switch round, after the rounds in flight. From that round
+  on, the slots are the ones of the new shuffle, and the schedule of the old slots is discarded.
+
+A reshuffle that does not complete (e.g., a client or a trustee does not answer) leaves the current slots in use. It is
+dropped if its new slots are not announced within RESHUFFLE_TIMEOUT, and the next reshuffle starts when due, with a new
+shuffle epoch: the late messages of the dropped one are refused.
+*/
+
+// reshuffle is a shuffle of new ephemeral keys running in the background, for shuffle epoch epoch
+type reshuffle struct {
+	epoch       int
+	ephPks      []kyber.Point // the clients' new ephemeral keys, by client ID
+	nEphPks     int
+	neffShuffle *scheduler.NeffShuffleRelay
+	switchRound int32     // the first round using the new slots, -1 until the trustees signed the shuffle
+	started     time.Time // the reshuffle is dropped if the new slots are not announced within RESHUFFLE_TIMEOUT
+}
+
+// startReshuffleIfDue starts a reshuffle when the current shuffle epoch is old enough, and none is running. A running
+// reshuffle whose slots are not announced within RESHUFFLE_TIMEOUT is dropped. roundID is the round about to be opened
+func (p *PriFiLibRelayInstance) startReshuffleIfDue(roundID int32) {
+	if r := p.relayState.reshuffle; r != nil {
+		// once announced, the new slots are used at the switch round
+		if r.switchRound >= 0 || time.Since(r.started) < RESHUFFLE_TIMEOUT {
+			return
+		}
+		log.Lvl1("Relay : the reshuffle of shuffle epoch", r.epoch, "did not complete within", RESHUFFLE_TIMEOUT, ", dropping it")
+		p.relayState.reshuffle = nil
+	}
+	dueByRounds := p.relayState.ReshufflePeriodRounds > 0 &&
+		roundID-p.relayState.shuffleEpochFirstRound >= int32(p.relayState.ReshufflePeriodRounds)
+	dueByTime := p.relayState.ReshufflePeriodSeconds > 0 &&
+		time.Since(p.relayState.shuffleEpochStart) >= time.Duration(p.relayState.ReshufflePeriodSeconds)*time.Second
+	if !dueByRounds && !dueByTime {
+		return
+	}
+
+	// every trustee shuffles, a replaced one cannot
+	for trusteeID, recovery := range p.relayState.trusteeRecoveries {
+		if recovery.replaced {
+			log.Lvl2("Relay : trustee", trusteeID, "is replaced, cannot reshuffle the slots")
+			return
+		}
+	}
+
+	neffShuffle := new(scheduler.NeffShuffle)
+	neffShuffle.Init(p.relayState.CryptoSuite)
+	p.relayState.lastReshuffleEpoch++
+	p.relayState.reshuffle = &reshuffle{
+		epoch:       p.relayState.lastReshuffleEpoch,
+		ephPks:      make([]kyber.Point, p.relayState.nClients),
+		neffShuffle: neffShuffle.RelayView,
+		switchRound: -1,
+		started:     time.Now(),
+	}
+	log.Lvl2("Relay : starting the reshuffle of shuffle epoch", p.relayState.reshuffle.epoch, "in round", roundID)
+
+	toSend := &net.REL_CLI_RESHUFFLE_REQUEST{ShuffleEpoch: p.relayState.reshuffle.epoch}
+	for i := 0; i < p.relayState.nClients; i++ {
+		p.messageSender.SendToClientWithLog(i, toSend, "(client "+strconv.Itoa(i)+")")
+	}
+}
+
+/*
+Received_CLI_REL_RESHUFFLE_EPH_PK handles CLI_REL_RESHUFFLE_EPH_PK messages, the new ephemeral key of a client.
+We do nothing until we have collected one per client; then, they are sent to the first trustee to be shuffled.
+*/
+func (p *PriFiLibRelayInstance) Received_CLI_REL_RESHUFFLE_EPH_PK(msg net.CLI_REL_RESHUFFLE_EPH_PK) error {
+	r := p.relayState.reshuffle
+	if r == nil || msg.ShuffleEpoch != r.epoch {
+		return errors.New("Relay : received CLI_REL_RESHUFFLE_EPH_PK for shuffle epoch " + strconv.Itoa(msg.ShuffleEpoch) + ", but it is not being collected")
+	}
+	if msg.ClientID < 0 || msg.ClientID >= p.relayState.nClients {
+		return errors.New("Relay : CLI_REL_RESHUFFLE_EPH_PK from unknown client " + strconv.Itoa(msg.ClientID))
+	}
+	if msg.EphPk == nil || r.ephPks[msg.ClientID] != nil {
+		return errors.New("Relay : invalid or duplicate CLI_REL_RESHUFFLE_EPH_PK from client " + strconv.Itoa(msg.ClientID))
+	}
+	r.ephPks[msg.ClientID] = msg.EphPk
+	r.nEphPks++
+
+	log.Lvl2("Relay : received CLI_REL_RESHUFFLE_EPH_PK (" + strconv.Itoa(r.nEphPks) + "/" + strconv.Itoa(p.relayState.nClients) + ")")
+	if r.nEphPks < p.relayState.nClients {
+		return nil
+	}
+
+	if err := r.neffShuffle.Init(p.relayState.nTrustees); err != nil {
+		return errors.New("Relay : could not start the reshuffle, error is " + err.Error())
+	}
+	for _, ephPk := range r.ephPks {
+		if err := r.neffShuffle.AddClient(ephPk); err != nil {
+			return errors.New("Relay : could not start the reshuffle, error is " + err.Error())
+		}
+	}
+	return p.sendReshuffleToNextTrustee()
+}
+
+/*
+Received_TRU_REL_RESHUFFLE handles TRU_REL_TELL_NEW_BASE_AND_EPH_PKS messages of a reshuffle. We verify the shuffle, and
+forward it to the next trustee; once every trustee shuffled, we send them the transcript to sign.
+*/
+func (p *PriFiLibRelayInstance) Received_TRU_REL_RESHUFFLE(msg net.TRU_REL_TELL_NEW_BASE_AND_EPH_PKS) error {
+	r := p.relayState.reshuffle
+	if r == nil || msg.ShuffleEpoch != r.epoch || r.nEphPks < p.relayState.nClients {
+		return errors.New("Relay : received a shuffle for shuffle epoch " + strconv.Itoa(msg.ShuffleEpoch) + ", but it is not being shuffled")
+	}
+
+	done, err := r.neffShuffle.ReceivedShuffleFromTrustee(msg.NewBase, msg.NewEphPks, msg.Proof)
+	if err != nil {
+		return errors.New("Relay : invalid shuffle for shuffle epoch " + strconv.Itoa(r.epoch) + ", error is " + err.Error())
+	}
+	if !done {
+		return p.sendReshuffleToNextTrustee()
+	}
+
+	transcript, err := r.neffShuffle.SendTranscript()
+	if err != nil {
+		return errors.New("Relay : could not build the transcript of shuffle epoch " + strconv.Itoa(r.epoch) + ", error is " + err.Error())
+	}
+	toSend := transcript.(*net.REL_TRU_TELL_TRANSCRIPT)
+	toSend.ShuffleEpoch = r.epoch
+	for j := 0; j < p.relayState.nTrustees; j++ {
+		p.messageSender.SendToTrusteeWithLog(j, toSend, "(trustee "+strconv.Itoa(j+1)+", shuffle epoch "+strconv.Itoa(r.epoch)+")")
+	}
+	return nil
+}
+
+/*
+Received_TRU_REL_RESHUFFLE_SIG handles TRU_REL_SHUFFLE_SIG messages of a reshuffle. Once every trustee signed, we send
+the new pseudonyms to the clients, with the round from which they are used.
+*/
+func (p *PriFiLibRelayInstance) Received_TRU_REL_RESHUFFLE_SIG(msg net.TRU_REL_SHUFFLE_SIG) error {
+	r := p.relayState.reshuffle
+	if r == nil || msg.ShuffleEpoch != r.epoch || r.switchRound >= 0 {
+		return errors.New("Relay : received a shuffle signature for shuffle epoch " + strconv.Itoa(msg.ShuffleEpoch) + ", but it is not being signed")
+	}
+
+	done, err := r.neffShuffle.ReceivedSignatureFromTrustee(msg.TrusteeID, msg.Sig)
+	if err != nil {
+		return errors.New("Relay : invalid shuffle signature for shuffle epoch " + strconv.Itoa(r.epoch) + ", error is " + err.Error())
+	}
+	if !done {
+		return nil
+	}
+
+	trusteesPks := make([]kyber.Point, p.relayState.nTrustees)
+	for j := range trusteesPks {
+		trusteesPks[j] = p.relayState.trustees[j].PublicKey
+	}
+	result, err := r.neffShuffle.VerifySigsAndSendToClients(trusteesPks)
+	if err != nil {
+		return errors.New("Relay : could not verify the signatures of shuffle epoch " + strconv.Itoa(r.epoch) + ", error is " + err.Error())
+	}
+
+	// the clients must know the new slots before the switch, which is after every round already sent
+	r.switchRound = p.relayState.roundManager.NextRoundToOpen() + int32(p.relayState.WindowSize) + RESHUFFLE_SWITCH_DELAY
+	toSend := result.(*net.REL_CLI_TELL_EPH_PKS_AND_TRUSTEES_SIG)
+	toSend.ShuffleEpoch = r.epoch
+	toSend.SwitchRound = r.switchRound
+	for i := 0; i < p.relayState.nClients; i++ {
+		p.messageSender.SendToClientWithLog(i, toSend, "(client "+strconv.Itoa(i)+", shuffle epoch "+strconv.Itoa(r.epoch)+")")
+	}
+	log.Lvl2("Relay : the slots of shuffle epoch", r.epoch, "are used from round", r.switchRound)
+	return nil
+}
+
+// switchShuffleEpochIfDue starts using the slots of the reshuffle, if roundID is its switch round. The schedule of the
+// old slots is discarded
+func (p *PriFiLibRelayInstance) switchShuffleEpochIfDue(roundID int32) {
+	r := p.relayState.reshuffle
+	if r == nil || r.switchRound < 0 || roundID < r.switchRound {
+		return
+	}
+	p.relayState.shuffleEpoch = r.epoch
+	p.relayState.shuffleEpochFirstRound = roundID
+	p.relayState.shuffleEpochStart = time.Now()
+	p.relayState.EphemeralPublicKeys = r.neffShuffle.ShuffledPublicKeys[len(r.neffShuffle.ShuffledPublicKeys)-1].Keys
+	p.relayState.reshuffle = nil
+	p.relayState.roundManager.ResetSchedule()
+	p.relayState.slotPayloadSizes = make(map[int]int)
+
+	log.Lvl1("Relay : switched to the slots of shuffle epoch", p.relayState.shuffleEpoch, "in round", roundID)
+}
+
+// sendReshuffleToNextTrustee sends the keys of the reshuffle to the next trustee to shuffle them
+func (p *PriFiLibRelayInstance) sendReshuffleToNextTrustee() error {
+	r := p.relayState.reshuffle
+	msg, trusteeID, err := r.neffShuffle.SendToNextTrustee()
+	if err != nil {
+		return errors.New("Relay : could not send the reshuffle to the next trustee, error is " + err.Error())
+	}
+	toSend := msg.(*net.REL_TRU_TELL_CLIENTS_PKS_AND_EPH_PKS_AND_BASE)
+	toSend.ShuffleEpoch = r.epoch
+	p.messageSender.SendToTrusteeWithLog(trusteeID, toSend, "(trustee "+strconv.Itoa(trusteeID+1)+", shuffle epoch "+strconv.Itoa(r.epoch)+")")
+	return nil
+}
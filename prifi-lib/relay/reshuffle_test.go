@@ -0,0 +1,184 @@
+package relay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/prifi/prifi-lib/config"
+	"github.com/dedis/prifi/prifi-lib/crypto"
+	"github.com/dedis/prifi/prifi-lib/net"
+	"github.com/dedis/prifi/prifi-lib/scheduler"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestRelayReshuffle(t *testing.T) {
+
+	timeoutHandler := func(clients, trustees []int) { log.Error(clients, trustees) }
+	msw := newTestMessageSenderWrapper(new(TestMessageSender))
+	sentToClient = make([]interface{}, 0)
+	sentToTrustee = make([]interface{}, 0)
+	relay := NewRelay(false, make(chan []byte, 6), make(chan []byte, 3), make(chan interface{}, 1), timeoutHandler, msw)
+
+	msg := new(net.ALL_ALL_PARAMETERS)
+	msg.ForceParams = true
+	msg.Add("NClients", 2)
+	msg.Add("NTrustees", 1)
+	msg.Add("PayloadSize", 100)
+	msg.Add("WindowSize", 2)
+	msg.Add("UseOpenClosedSlots", true)
+	msg.Add("ReshufflePeriodRounds", 5)
+	msg.Add("EquivocationProtectionEnabled", true)
+	if err := relay.ReceivedMessage(*msg); err == nil {
+		t.Error("The equivocation protection binds the rounds to the pseudonyms, relay should refuse to reshuffle")
+	}
+	msg.Add("EquivocationProtectionEnabled", false)
+	msg.Add("DisruptionProtectionEnabled", true)
+	if err := relay.ReceivedMessage(*msg); err == nil {
+		t.Error("The disruption protection binds the rounds to the pseudonyms, relay should refuse to reshuffle")
+	}
+	msg.Add("DisruptionProtectionEnabled", false)
+	msg.Add("SlotScheduler", scheduler.SLOT_SCHEDULER_FOOTPRINT)
+	if err := relay.ReceivedMessage(*msg); err == nil {
+		t.Error("The footprint scheduler does not use the slots of the shuffle, relay should refuse to reshuffle")
+	}
+	msg.Add("SlotScheduler", scheduler.SLOT_SCHEDULER_BITMASK)
+	if err := relay.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Relay should be able to receive this message, but", err)
+	}
+	if relay.relayState.ReshufflePeriodRounds != 5 {
+		t.Fatal("Reshuffling should be enabled")
+	}
+
+	// the relay is communicating with the slots of the setup
+	neff := new(scheduler.NeffShuffle)
+	neff.Init(config.CryptoSuite)
+	trusteePk, trusteePriv := crypto.NewKeyPair(config.CryptoSuite)
+	neff.TrusteeView.Init(0, trusteePriv, trusteePk)
+	relay.relayState.trustees[0].PublicKey = trusteePk
+	relay.stateMachine.ChangeState("COMMUNICATING")
+
+	relay.startReshuffleIfDue(4)
+	if relay.relayState.reshuffle != nil || len(sentToClient) != 0 {
+		t.Fatal("Relay should not reshuffle before 5 rounds")
+	}
+	relay.startReshuffleIfDue(5)
+	if len(sentToClient) != 2 || sentToClient[0].(*net.REL_CLI_RESHUFFLE_REQUEST).ShuffleEpoch != 1 {
+		t.Fatal("Relay should ask both clients for a new key for shuffle epoch 1")
+	}
+	sentToClient = make([]interface{}, 0)
+	relay.startReshuffleIfDue(6)
+	if len(sentToClient) != 0 {
+		t.Error("Relay should not start another reshuffle while one is running")
+	}
+
+	// the clients send their new keys
+	ephPks := make([]kyber.Point, 2)
+	ephPrivs := make([]kyber.Scalar, 2)
+	for i := range ephPks {
+		ephPks[i], ephPrivs[i] = crypto.NewKeyPair(config.CryptoSuite)
+	}
+	if err := relay.ReceivedMessage(net.CLI_REL_RESHUFFLE_EPH_PK{ClientID: 0, ShuffleEpoch: 2, EphPk: ephPks[0]}); err == nil {
+		t.Error("Relay should refuse a key for another shuffle epoch")
+	}
+	if err := relay.ReceivedMessage(net.CLI_REL_RESHUFFLE_EPH_PK{ClientID: 0, ShuffleEpoch: 1, EphPk: ephPks[0]}); err != nil {
+		t.Error(err)
+	}
+	if err := relay.ReceivedMessage(net.CLI_REL_RESHUFFLE_EPH_PK{ClientID: 0, ShuffleEpoch: 1, EphPk: ephPks[0]}); err == nil {
+		t.Error("Relay should refuse a second key from client 0")
+	}
+	if len(sentToTrustee) != 0 {
+		t.Error("Relay should wait for the key of client 1")
+	}
+	if err := relay.ReceivedMessage(net.CLI_REL_RESHUFFLE_EPH_PK{ClientID: 1, ShuffleEpoch: 1, EphPk: ephPks[1]}); err != nil {
+		t.Error(err)
+	}
+
+	// the trustee shuffles and signs, as in the setup
+	toShuffle := sentToTrustee[0].(*net.REL_TRU_TELL_CLIENTS_PKS_AND_EPH_PKS_AND_BASE)
+	if toShuffle.ShuffleEpoch != 1 || len(toShuffle.EphPks) != 2 {
+		t.Fatal("Relay should send the new keys to the trustee for shuffle epoch 1")
+	}
+	shuffled, err := neff.TrusteeView.ReceivedShuffleFromRelay(toShuffle.Base, toShuffle.EphPks, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shuffledMsg := shuffled.(*net.TRU_REL_TELL_NEW_BASE_AND_EPH_PKS)
+	shuffledMsg.ShuffleEpoch = 1
+	if err := relay.ReceivedMessage(*shuffledMsg); err != nil {
+		t.Fatal(err)
+	}
+	transcript := sentToTrustee[1].(*net.REL_TRU_TELL_TRANSCRIPT)
+	if transcript.ShuffleEpoch != 1 {
+		t.Error("The transcript should be the one of shuffle epoch 1")
+	}
+	signed, err := neff.TrusteeView.ReceivedTranscriptFromRelay(transcript.InitialEphPks, transcript.Bases, transcript.GetKeys(), transcript.GetProofs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := signed.(*net.TRU_REL_SHUFFLE_SIG)
+	sig.ShuffleEpoch = 1
+	if err := relay.ReceivedMessage(*sig); err != nil {
+		t.Fatal(err)
+	}
+
+	// the clients get their new slots, after the rounds in flight
+	if len(sentToClient) != 2 {
+		t.Fatal("Relay should send the new slots to both clients")
+	}
+	result := sentToClient[0].(*net.REL_CLI_TELL_EPH_PKS_AND_TRUSTEES_SIG)
+	switchRound := relay.relayState.roundManager.NextRoundToOpen() + 2 + RESHUFFLE_SWITCH_DELAY
+	if result.ShuffleEpoch != 1 || result.SwitchRound != switchRound {
+		t.Error("The new slots should be used from round", switchRound, "got", result.SwitchRound)
+	}
+	slots := make(map[int]bool)
+	for i := range ephPrivs {
+		slot, err := neff.ClientVerifySigAndRecognizeSlot(ephPrivs[i], []kyber.Point{trusteePk}, result.Base, result.EphPks, result.GetSignatures())
+		if err != nil {
+			t.Fatal(err)
+		}
+		slots[slot] = true
+	}
+	if len(slots) != 2 {
+		t.Error("The clients should have different slots")
+	}
+
+	// the switch happens at the announced round, and the schedule of the old slots is discarded
+	relay.relayState.roundManager.SetStoredRoundSchedule(map[int]int{0: 1, 1: 0})
+	relay.switchShuffleEpochIfDue(switchRound - 1)
+	if relay.relayState.shuffleEpoch != 0 {
+		t.Error("Relay should keep the slots of the setup before the switch round")
+	}
+	relay.switchShuffleEpochIfDue(switchRound)
+	if relay.relayState.shuffleEpoch != 1 || relay.relayState.shuffleEpochFirstRound != switchRound || relay.relayState.reshuffle != nil {
+		t.Error("Relay should use the slots of shuffle epoch 1 from round", switchRound)
+	}
+	if !relay.relayState.roundManager.IsNextDownstreamRoundForOpenClosedRequest(2) {
+		t.Error("The first round with the new slots should ask for a new schedule")
+	}
+
+	// the next reshuffle is counted from the switch
+	relay.startReshuffleIfDue(switchRound + 4)
+	if relay.relayState.reshuffle != nil {
+		t.Error("Relay should not reshuffle before 5 rounds in the new shuffle epoch")
+	}
+	relay.startReshuffleIfDue(switchRound + 5)
+	if relay.relayState.reshuffle == nil || relay.relayState.reshuffle.epoch != 2 {
+		t.Fatal("Relay should start the reshuffle of shuffle epoch 2")
+	}
+
+	// a client never sends its key: the reshuffle is dropped after a while, and the next one has a new shuffle epoch
+	sentToClient = make([]interface{}, 0)
+	relay.startReshuffleIfDue(switchRound + 6)
+	if relay.relayState.reshuffle.epoch != 2 || len(sentToClient) != 0 {
+		t.Error("Relay should wait for the reshuffle of shuffle epoch 2")
+	}
+	relay.relayState.reshuffle.started = time.Now().Add(-RESHUFFLE_TIMEOUT)
+	relay.startReshuffleIfDue(switchRound + 7)
+	if relay.relayState.reshuffle == nil || relay.relayState.reshuffle.epoch != 3 || len(sentToClient) != 2 {
+		t.Fatal("Relay should drop the stuck reshuffle, and start the one of shuffle epoch 3")
+	}
+	if err := relay.ReceivedMessage(net.CLI_REL_RESHUFFLE_EPH_PK{ClientID: 0, ShuffleEpoch: 2, EphPk: ephPks[0]}); err == nil {
+		t.Error("Relay should refuse a late key of the dropped reshuffle")
+	}
+}
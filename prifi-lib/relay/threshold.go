@@ -0,0 +1,151 @@
+package relay
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/dedis/prifi/prifi-lib/crypto"
+	"github.com/dedis/prifi/prifi-lib/net"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+/*
+Threshold trustees. When TrusteeThreshold = k > 0, each trustee shares its private key among the other trustees
+(TRU_REL_KEY_SHARES) when it signs the shuffle. If a trustee stops sending ciphers, the relay asks the other trustees
+to replace it (REL_TRU_RECOVER_TRUSTEE), and names one of them the substitute. Each trustee first checks on its own
+link that the missing trustee does not answer, then sends the partial secrets computed with its share to the
+substitute, encrypted to it; with k of them, the substitute recovers the secrets the missing trustee shared with the
+clients, and sends the missing trustee's ciphers along with its own for the rest of the session
+(TRU_REL_TRUSTEE_REPLACED). The relay never sees a share, a partial secret or a pad, only the ciphers it would have
+received from the missing trustee; it cannot make the trustees recover a trustee that is still online.
+Anonymity then rests on the honest trustees that are still online; any k trustees together can recover the secrets of
+another one.
+*/
+
+// trusteeKeySharing is the sharing of a trustee's private key, share m being encrypted to trustee m
+type trusteeKeySharing struct {
+	encryptedShares [][]byte
+	commitments     []kyber.Point
+}
+
+// trusteeRecovery replaces a missing trustee
+type trusteeRecovery struct {
+	substituteID int  // the trustee computing the ciphers of the missing trustee
+	replaced     bool // true once the substitute sends them
+}
+
+/*
+Received_TRU_REL_KEY_SHARES handles TRU_REL_KEY_SHARES messages. Those are sent by threshold trustees along with their
+shuffle signature. We check that the sharing commits to the trustee's public key, and keep it in case the trustee
+goes missing.
+*/
+func (p *PriFiLibRelayInstance) Received_TRU_REL_KEY_SHARES(msg net.TRU_REL_KEY_SHARES) error {
+	if p.relayState.TrusteeThreshold == 0 {
+		return errors.New("Relay : received TRU_REL_KEY_SHARES, but the trustees are not threshold trustees")
+	}
+	if msg.TrusteeID < 0 || msg.TrusteeID >= p.relayState.nTrustees {
+		return errors.New("Relay : TRU_REL_KEY_SHARES from unknown trustee " + strconv.Itoa(msg.TrusteeID))
+	}
+	if len(msg.EncryptedShares) != p.relayState.nTrustees {
+		return errors.New("Relay : TRU_REL_KEY_SHARES from trustee " + strconv.Itoa(msg.TrusteeID) + " does not contain one share per trustee")
+	}
+	err := crypto.CheckKeySharing(p.relayState.trustees[msg.TrusteeID].SessionPublicKey, msg.Commitments, p.relayState.TrusteeThreshold)
+	if err != nil {
+		return errors.New("Relay : invalid key sharing from trustee " + strconv.Itoa(msg.TrusteeID) + ", " + err.Error())
+	}
+
+	sharing := &trusteeKeySharing{
+		encryptedShares: make([][]byte, len(msg.EncryptedShares)),
+		commitments:     msg.Commitments,
+	}
+	for m, s := range msg.EncryptedShares {
+		sharing.encryptedShares[m] = s.Bytes
+	}
+	p.relayState.trusteeKeySharings[msg.TrusteeID] = sharing
+
+	log.Lvl2("Relay : received the key sharing of trustee", msg.TrusteeID)
+	return nil
+}
+
+// recoverMissingTrustees starts replacing the given trustees, if enough of the others are online.
+// Returns true if a replacement just started, or if every missing trustee is already replaced. A replacement that
+// started at a previous timeout and is still not done does not count, so that the protocol is eventually killed
+// if the other trustees never answer
+func (p *PriFiLibRelayInstance) recoverMissingTrustees(missingTrustees []int) bool {
+	if p.relayState.TrusteeThreshold == 0 || len(missingTrustees) == 0 {
+		return false
+	}
+
+	missing := make(map[int]bool)
+	for _, j := range missingTrustees {
+		missing[j] = true
+	}
+	online := make([]int, 0)
+	for j := 0; j < p.relayState.nTrustees; j++ {
+		if _, recovered := p.relayState.trusteeRecoveries[j]; !missing[j] && !recovered {
+			online = append(online, j)
+		}
+	}
+
+	started := false
+	allReplaced := true
+	for _, j := range missingTrustees {
+		if r, found := p.relayState.trusteeRecoveries[j]; found {
+			allReplaced = allReplaced && r.replaced
+			continue
+		}
+		allReplaced = false
+
+		sharing, found := p.relayState.trusteeKeySharings[j]
+		if !found {
+			log.Error("Relay : trustee", j, "is missing, but never shared its key; cannot replace it")
+			continue
+		}
+		if len(online) < p.relayState.TrusteeThreshold {
+			log.Error("Relay : only", len(online), "trustees online, cannot replace trustee", j,
+				"(threshold is", p.relayState.TrusteeThreshold, ")")
+			continue
+		}
+
+		// the substitute sends the ciphers of the open rounds too, the missing trustee did not
+		firstRoundID := p.relayState.roundManager.NextRoundToOpen()
+		if open := p.relayState.roundManager.OpenRounds(); len(open) > 0 {
+			firstRoundID = open[0]
+		}
+		substituteID := online[0]
+		log.Lvl1("Relay : trustee", j, "is missing, asking trustees", online, "to replace it, trustee", substituteID, "computing its ciphers")
+		p.relayState.trusteeRecoveries[j] = &trusteeRecovery{substituteID: substituteID}
+		for _, m := range online {
+			toSend := &net.REL_TRU_RECOVER_TRUSTEE{
+				MissingTrusteeID:    j,
+				SubstituteTrusteeID: substituteID,
+				FirstRoundID:        firstRoundID,
+				EncryptedShare:      sharing.encryptedShares[m],
+				Commitments:         sharing.commitments,
+			}
+			p.messageSender.SendToTrusteeWithLog(m, toSend, "(trustee "+strconv.Itoa(m)+")")
+		}
+		started = true
+	}
+	return started || allReplaced
+}
+
+/*
+Received_TRU_REL_TRUSTEE_REPLACED handles TRU_REL_TRUSTEE_REPLACED messages. The substitute of a missing trustee
+recovered its secrets, and sends its ciphers from now on.
+*/
+func (p *PriFiLibRelayInstance) Received_TRU_REL_TRUSTEE_REPLACED(msg net.TRU_REL_TRUSTEE_REPLACED) error {
+	r, found := p.relayState.trusteeRecoveries[msg.MissingTrusteeID]
+	if !found {
+		return errors.New("Relay : trustee " + strconv.Itoa(msg.TrusteeID) + " replaced trustee " + strconv.Itoa(msg.MissingTrusteeID) + ", which is not being recovered")
+	}
+	if msg.TrusteeID != r.substituteID {
+		return errors.New("Relay : trustee " + strconv.Itoa(msg.TrusteeID) + " replaced trustee " + strconv.Itoa(msg.MissingTrusteeID) +
+			", but the substitute is trustee " + strconv.Itoa(r.substituteID))
+	}
+	r.replaced = true
+
+	log.Lvl1("Relay : trustee", msg.TrusteeID, "replaced trustee", msg.MissingTrusteeID, ", and sends its ciphers from now on")
+	return nil
+}
@@ -0,0 +1,132 @@
+package relay
+
+import (
+	"testing"
+
+	"github.com/dedis/prifi/prifi-lib/config"
+	"github.com/dedis/prifi/prifi-lib/crypto"
+	"github.com/dedis/prifi/prifi-lib/dcnet"
+	"github.com/dedis/prifi/prifi-lib/net"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestTrusteeRecovery(t *testing.T) {
+
+	timeoutHandler := func(clients, trustees []int) { log.Error(clients, trustees) }
+	msw := newTestMessageSenderWrapper(new(TestMessageSender))
+	sentToClient = make([]interface{}, 0)
+	sentToTrustee = make([]interface{}, 0)
+	relay := NewRelay(false, make(chan []byte, 6), make(chan []byte, 3), make(chan interface{}, 1), timeoutHandler, msw)
+
+	nClients := 3
+	nTrustees := 3
+	threshold := 2
+	payloadSize := 100
+
+	msg := new(net.ALL_ALL_PARAMETERS)
+	msg.ForceParams = true
+	msg.Add("NClients", nClients)
+	msg.Add("NTrustees", nTrustees)
+	msg.Add("PayloadSize", payloadSize)
+	msg.Add("WindowSize", 1)
+	msg.Add("DCNetType", "Simple")
+	msg.Add("EquivocationProtectionEnabled", true)
+	msg.Add("TrusteeThreshold", threshold)
+	if err := relay.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Relay should be able to receive this message, but", err)
+	}
+	relay.relayState.DCNet = dcnet.NewDCNetEntity(0, dcnet.DCNET_RELAY, payloadSize, true, nil, config.CryptoSuite)
+
+	clientPks := make([]kyber.Point, nClients)
+	for i := range clientPks {
+		clientPks[i], _ = crypto.NewKeyPair(config.CryptoSuite)
+		relay.relayState.clients[i] = NodeRepresentation{i, true, clientPks[i], clientPks[i], clientPks[i], nil}
+	}
+	trusteePks := make([]kyber.Point, nTrustees)
+	trusteePrivs := make([]kyber.Scalar, nTrustees)
+	sessionPrivs := make([]kyber.Scalar, nTrustees)
+	for j := range trusteePks {
+		var sessionPk kyber.Point
+		trusteePks[j], trusteePrivs[j] = crypto.NewKeyPair(config.CryptoSuite)
+		sessionPk, sessionPrivs[j] = crypto.NewKeyPair(config.CryptoSuite)
+		relay.relayState.trustees[j] = NodeRepresentation{j, true, trusteePks[j], trusteePks[j], sessionPk, nil}
+	}
+
+	// every trustee shares its session key, encrypted to the long-term keys
+	for j := range trusteePks {
+		encryptedShares, commitments, err := crypto.ShareKey(config.CryptoSuite, sessionPrivs[j], threshold, trusteePks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		toSend := net.TRU_REL_KEY_SHARES{TrusteeID: j, Commitments: commitments}
+		for _, s := range encryptedShares {
+			toSend.EncryptedShares = append(toSend.EncryptedShares, net.ByteArray{Bytes: s})
+		}
+		if err := relay.Received_TRU_REL_KEY_SHARES(toSend); err != nil {
+			t.Error(err)
+		}
+
+		// the DC-net secrets are not derived from the long-term key, a sharing of it is refused
+		_, longTermCommitments, err := crypto.ShareKey(config.CryptoSuite, trusteePrivs[j], threshold, trusteePks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := relay.Received_TRU_REL_KEY_SHARES(net.TRU_REL_KEY_SHARES{TrusteeID: j, EncryptedShares: toSend.EncryptedShares,
+			Commitments: longTermCommitments}); err == nil {
+			t.Error("Relay should refuse a sharing of the long-term key of a trustee")
+		}
+
+		// a sharing of another trustee's key is refused
+		toSend.TrusteeID = (j + 1) % nTrustees
+		if err := relay.Received_TRU_REL_KEY_SHARES(toSend); err == nil {
+			t.Error("Relay should refuse a sharing of another trustee's key")
+		}
+		toSend.TrusteeID = j
+		if err := relay.Received_TRU_REL_KEY_SHARES(toSend); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// trustee 0 goes missing, trustees 1 and 2 are asked to replace it; trustee 1 computes its ciphers
+	if !relay.recoverMissingTrustees([]int{0}) {
+		t.Error("Relay should start replacing trustee 0")
+	}
+	if len(sentToTrustee) != nTrustees-1 {
+		t.Fatal("Relay should have contacted", nTrustees-1, "trustees, but sent", len(sentToTrustee), "messages")
+	}
+	for k, m := range []int{1, 2} {
+		request := sentToTrustee[k].(*net.REL_TRU_RECOVER_TRUSTEE)
+		if request.MissingTrusteeID != 0 || request.SubstituteTrusteeID != 1 {
+			t.Error("Wrong trustee being recovered", request.MissingTrusteeID, "by", request.SubstituteTrusteeID)
+		}
+		if request.FirstRoundID != relay.relayState.roundManager.NextRoundToOpen() {
+			t.Error("No round is open, the substitute should send the ciphers from the next one on, got", request.FirstRoundID)
+		}
+		if _, err := crypto.DecryptKeyShare(config.CryptoSuite, trusteePrivs[m], m, request.EncryptedShare, request.Commitments); err != nil {
+			t.Error("Trustee", m, "should be able to decrypt its share,", err)
+		}
+	}
+	if relay.recoverMissingTrustees([]int{0}) {
+		t.Error("Trustee 0 is not replaced yet, the relay should give up at the next timeout")
+	}
+
+	// only the substitute replaces trustee 0
+	if err := relay.Received_TRU_REL_TRUSTEE_REPLACED(net.TRU_REL_TRUSTEE_REPLACED{TrusteeID: 2, MissingTrusteeID: 0}); err == nil {
+		t.Error("Relay should refuse a replacement by a trustee that is not the substitute")
+	}
+	if err := relay.Received_TRU_REL_TRUSTEE_REPLACED(net.TRU_REL_TRUSTEE_REPLACED{TrusteeID: 1, MissingTrusteeID: 2}); err == nil {
+		t.Error("Relay should refuse the replacement of a trustee that is not missing")
+	}
+	if err := relay.Received_TRU_REL_TRUSTEE_REPLACED(net.TRU_REL_TRUSTEE_REPLACED{TrusteeID: 1, MissingTrusteeID: 0}); err != nil {
+		t.Error(err)
+	}
+	if !relay.recoverMissingTrustees([]int{0}) {
+		t.Error("Trustee 0 is already replaced")
+	}
+
+	// trustee 2 is the only one left, it cannot replace trustee 1 alone
+	if relay.recoverMissingTrustees([]int{1}) {
+		t.Error("Relay should not be able to replace trustee 1 with a single trustee")
+	}
+}
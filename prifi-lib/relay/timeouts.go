@@ -37,7 +37,10 @@ func (p *PriFiLibRelayInstance) checkIfRoundHasEndedAfterTimeOut_Phase1(roundID
 	missingClientCiphers, missingTrusteeCiphers := p.relayState.roundManager.MissingCiphersForCurrentRound()
 	log.Lvl1("missing clients", missingClientCiphers, "and trustees", missingTrusteeCiphers)
 
-	if p.relayState.numberOfConsecutiveFailedRounds >= p.relayState.MaxNumberOfConsecutiveFailedRounds {
+	// with threshold trustees, the missing trustees are replaced; we do not give up while this starts
+	replacingTrustees := p.recoverMissingTrustees(missingTrusteeCiphers) && len(missingClientCiphers) == 0
+
+	if p.relayState.numberOfConsecutiveFailedRounds >= p.relayState.MaxNumberOfConsecutiveFailedRounds && !replacingTrustees {
 		log.Error("MAX_NUMBER_OF_CONSECUTIVE_FAILED_ROUNDS (", p.relayState.MaxNumberOfConsecutiveFailedRounds,
 			") reached, killing protocol.")
 
@@ -48,16 +51,14 @@ func (p *PriFiLibRelayInstance) checkIfRoundHasEndedAfterTimeOut_Phase1(roundID
 		// cleanup, start the transition to next round
 		log.Lvl1("Gonna Force close...")
 		p.relayState.roundManager.Dump()
+		closedRoundID := p.relayState.roundManager.CurrentRound()
 		p.relayState.roundManager.ForceCloseRound()
 		p.relayState.roundManager.Dump()
 
 		p.relayState.numberOfNonAckedDownstreamPackets-- // packet is not "in-flight" because it is lost
 
-		// if we still have open rounds (after closing this one), we need to tell the DC-net to move to this new round
-		if roundOpened, roundID := p.relayState.roundManager.currentRound(); roundOpened {
-			//prepare for the next round (this empties the dc-net buffer, making them ready for a new round)
-			p.relayState.DCNet.DecodeStart(roundID)
-		}
+		// forget what was decoded for the closed round; the other open rounds are still being decoded
+		p.relayState.DCNet.DecodeCancel(closedRoundID)
 
 		// if we can, open new rounds
 		p.downstreamPhase_sendMany()
@@ -4,24 +4,38 @@ import (
 	"math"
 )
 
-// SlotScheduler is a protocol between the relay and the clients that allows to decide which slots are gonna be
-// "open" (fixed-length byte array) or "closed" (inexistant, no message at all)
-type SlotScheduler interface {
+// BitMaskSlotScheduler gives one bit to each slot, set by the slot's owner if it wants to transmit
+type BitMaskSlotScheduler struct {
+}
 
-	//the client receives a new schedule request from the relay
-	Client_ReceivedScheduleRequest()
+// Name returns SLOT_SCHEDULER_BITMASK
+func (bm *BitMaskSlotScheduler) Name() string {
+	return SLOT_SCHEDULER_BITMASK
+}
 
-	//the client alters the schedule being computed, and ask to transmit
-	Client_ReserveRound(slotID int)
+// ContributionSize returns nClients bits, rounded up to the byte
+func (bm *BitMaskSlotScheduler) ContributionSize(nClients int) int {
+	return int(math.Ceil(float64(nClients) / 8))
+}
 
-	//return the schedule to send as payload
-	Client_GetOpenScheduleContribution() []byte
+// UsesShuffledSlots returns true, bit i belongs to the owner of slot i
+func (bm *BitMaskSlotScheduler) UsesShuffledSlots() bool {
+	return true
+}
 
-	//Called with each client's contribution
-	Relay_CombineContributions(contributions ...[]byte) []byte
+// SlotContributionBits returns the bit of slot
+func (bm *BitMaskSlotScheduler) SlotContributionBits(slot int, nClients int) (int, int) {
+	return slot, 1
+}
 
-	// returns all contributions in forms of a map of open slots
-	Relay_ComputeFinalSchedule() map[int]bool
+// NewClient returns a new BitMaskSlotScheduler_Client
+func (bm *BitMaskSlotScheduler) NewClient() SlotScheduler_Client {
+	return new(BitMaskSlotScheduler_Client)
+}
+
+// NewRelay returns a new BitMaskSlotScheduler_Relay
+func (bm *BitMaskSlotScheduler) NewRelay() SlotScheduler_Relay {
+	return new(BitMaskSlotScheduler_Relay)
 }
 
 // BitMaskScheduler_Client holds the info necessary for a client to compute his "contribution", or part of the bitmask
@@ -36,13 +50,14 @@ type BitMaskSlotScheduler_Relay struct {
 }
 
 // Client_ReceivedScheduleRequest instantiates the fields of BitMaskScheduler_Client
-func (bmc *BitMaskSlotScheduler_Client) Client_ReceivedScheduleRequest(nClients int) {
+func (bmc *BitMaskSlotScheduler_Client) Client_ReceivedScheduleRequest(nClients int, firstRound int32) {
 	bmc.NClients = nClients
 	bmc.ClientWantsToSend = false
 }
 
-// Client_ReserveRound indicates to reserve a slot in the next round
-func (bmc *BitMaskSlotScheduler_Client) Client_ReserveRound(slotID int) {
+// Client_ReserveRound indicates to reserve a slot in the next round. A bit cannot ask for more than one cell, nor
+// for a cell length
+func (bmc *BitMaskSlotScheduler_Client) Client_ReserveRound(slotID int, nCells int, payloadSize int) {
 	bmc.MySlotID = slotID
 	bmc.ClientWantsToSend = true
 }
@@ -50,8 +65,7 @@ func (bmc *BitMaskSlotScheduler_Client) Client_ReserveRound(slotID int) {
 // Client_GetOpenScheduleContribution computes their contribution as a bit array
 func (bmc *BitMaskSlotScheduler_Client) Client_GetOpenScheduleContribution() []byte {
 	//length of the contribution is nClients/8 bytes
-	nBytes := int(math.Ceil(float64(bmc.NClients) / 8))
-	payload := make([]byte, nBytes)
+	payload := make([]byte, new(BitMaskSlotScheduler).ContributionSize(bmc.NClients))
 
 	if !bmc.ClientWantsToSend {
 		return payload //all zeros
@@ -64,6 +78,16 @@ func (bmc *BitMaskSlotScheduler_Client) Client_GetOpenScheduleContribution() []b
 	return payload
 }
 
+// Client_IsSlotOwner returns true if ownerSlot is the client's slot in the shuffle
+func (bmc *BitMaskSlotScheduler_Client) Client_IsSlotOwner(roundID int32, ownerSlot int, slotID int) bool {
+	return ownerSlot == slotID
+}
+
+// Relay_ContributionSize returns the length of the combined contributions, see BitMaskSlotScheduler.ContributionSize
+func (bmr *BitMaskSlotScheduler_Relay) Relay_ContributionSize(nClients int) int {
+	return new(BitMaskSlotScheduler).ContributionSize(nClients)
+}
+
 // Relay_CombineContributions combines (XOR) the received contributions from each clients. In the real DC-net,
 // this is done automatically by the DC-net
 func (bmr *BitMaskSlotScheduler_Relay) Relay_CombineContributions(contributions ...[]byte) []byte {
@@ -76,20 +100,20 @@ func (bmr *BitMaskSlotScheduler_Relay) Relay_CombineContributions(contributions
 	return out
 }
 
-// Relay_ComputeFinalSchedule computes the map[int32]bool of open slots in the next round given the stored contributions
-func (bmr *BitMaskSlotScheduler_Relay) Relay_ComputeFinalSchedule(allContributions []byte, maxSlots int) map[int]bool {
+// Relay_ComputeFinalSchedule computes the open slots (one cell of the default length) in the next round given the stored contributions
+func (bmr *BitMaskSlotScheduler_Relay) Relay_ComputeFinalSchedule(allContributions []byte, maxSlots int) map[int]SlotRequest {
 
 	//this schedules goes from [0; maxSlots[
-	res := make(map[int]bool)
+	res := make(map[int]SlotRequest)
 
 	for byteIndex, b := range allContributions {
 		for bitPos := uint(0); bitPos < 8; bitPos++ {
 			ownerID := int(byteIndex*8 + int(bitPos))
 			val := b & (1 << bitPos)
 			if val > 0 { //the bit was set
-				res[ownerID] = true
+				res[ownerID] = SlotRequest{Cells: 1}
 			} else {
-				res[ownerID] = false
+				res[ownerID] = SlotRequest{}
 			}
 			if ownerID == maxSlots-1 {
 				return res
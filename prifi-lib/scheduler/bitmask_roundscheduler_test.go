@@ -17,11 +17,11 @@ func Test1Client(t *testing.T) {
 
 	//relay starts by sending a downstream message (for round currentRound) with OpenClosedSchedRequest=true
 	//client notice it, instead of sending the next upstream traffic, he will send the OCSchedule
-	bmc.Client_ReceivedScheduleRequest(nClients)
+	bmc.Client_ReceivedScheduleRequest(nClients, 0)
 
 	//12:SCHEDULE, 13:c2, 14:c3, 15:c4, 16:c0
 
-	bmc.Client_ReserveRound(mySlot)
+	bmc.Client_ReserveRound(mySlot, 1, 0)
 
 	contribution := bmc.Client_GetOpenScheduleContribution()
 
@@ -39,7 +39,7 @@ func Test1Client(t *testing.T) {
 		t.Error("finalSched should have length", nClients, ", has length", len(finalSched))
 	}
 
-	if !finalSched[mySlot] {
+	if finalSched[mySlot].Cells != 1 {
 		t.Error("finalSched should have slot", mySlot, "open")
 	}
 }
@@ -56,11 +56,11 @@ func Test2Client(t *testing.T) {
 
 	//relay starts by sending a downstream message (for round currentRound) with OpenClosedSchedRequest=true
 	//client notice it, instead of sending the next upstream traffic, he will send the OCSchedule
-	bmc1.Client_ReceivedScheduleRequest(nClients)
-	bmc2.Client_ReceivedScheduleRequest(nClients)
+	bmc1.Client_ReceivedScheduleRequest(nClients, 0)
+	bmc2.Client_ReceivedScheduleRequest(nClients, 0)
 
-	bmc1.Client_ReserveRound(mySlot1)
-	bmc2.Client_ReserveRound(mySlot2)
+	bmc1.Client_ReserveRound(mySlot1, 1, 0)
+	bmc2.Client_ReserveRound(mySlot2, 1, 0)
 
 	contribution1 := bmc1.Client_GetOpenScheduleContribution()
 	contribution2 := bmc2.Client_GetOpenScheduleContribution()
@@ -82,13 +82,52 @@ func Test2Client(t *testing.T) {
 		t.Error("finalSched should have length", nClients, ", has length", len(finalSched))
 	}
 
-	if !finalSched[mySlot1] {
+	if finalSched[mySlot1].Cells != 1 {
 		t.Error("finalSched should have slot", mySlot1, "open")
 	}
 
-	if !finalSched[mySlot2] {
+	if finalSched[mySlot2].Cells != 1 {
 		t.Error("finalSched should have slot", mySlot2, "open")
 	}
 
 	fmt.Println(finalSched)
 }
+
+func TestNewSlotScheduler(t *testing.T) {
+
+	if _, err := NewSlotScheduler("Lottery"); err == nil {
+		t.Error("An unknown scheduler should be refused")
+	}
+	for _, name := range []string{"", SLOT_SCHEDULER_BITMASK} {
+		s, err := NewSlotScheduler(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Name() != SLOT_SCHEDULER_BITMASK {
+			t.Error("Scheduler", name, "should be the bitmask scheduler, got", s.Name())
+		}
+	}
+
+	// the two sides, through the interfaces only
+	s, _ := NewSlotScheduler(SLOT_SCHEDULER_BITMASK)
+	nClients := 10
+	contributions := make([][]byte, 0)
+	for slot := 0; slot < nClients; slot++ {
+		c := s.NewClient()
+		c.Client_ReceivedScheduleRequest(nClients, 0)
+		if slot%3 == 0 {
+			c.Client_ReserveRound(slot, 1, 0)
+		}
+		contributions = append(contributions, c.Client_GetOpenScheduleContribution())
+	}
+	r := s.NewRelay()
+	schedule := r.Relay_ComputeFinalSchedule(r.Relay_CombineContributions(contributions...), nClients)
+	if len(schedule) != nClients {
+		t.Error("The schedule should have", nClients, "slots, has", len(schedule))
+	}
+	for slot := 0; slot < nClients; slot++ {
+		if (schedule[slot].Cells == 1) != (slot%3 == 0) {
+			t.Error("Slot", slot, "is wrongly open/closed")
+		}
+	}
+}
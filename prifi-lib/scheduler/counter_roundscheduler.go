@@ -0,0 +1,128 @@
+package scheduler
+
+import (
+	"encoding/binary"
+)
+
+// COUNTER_SIZE is the length of a slot's counter: one byte for the number of cells, two for their length
+const COUNTER_SIZE = 3
+
+// CounterSlotScheduler gives COUNTER_SIZE bytes to each slot, where the slot's owner writes the number of cells it
+// wants to transmit (at most 255) and their length
+type CounterSlotScheduler struct {
+}
+
+// Name returns SLOT_SCHEDULER_COUNTER
+func (cs *CounterSlotScheduler) Name() string {
+	return SLOT_SCHEDULER_COUNTER
+}
+
+// ContributionSize returns one counter per client
+func (cs *CounterSlotScheduler) ContributionSize(nClients int) int {
+	return COUNTER_SIZE * nClients
+}
+
+// UsesShuffledSlots returns true, counter i belongs to the owner of slot i
+func (cs *CounterSlotScheduler) UsesShuffledSlots() bool {
+	return true
+}
+
+// SlotContributionBits returns the bits of the counter of slot
+func (cs *CounterSlotScheduler) SlotContributionBits(slot int, nClients int) (int, int) {
+	return 8 * COUNTER_SIZE * slot, 8 * COUNTER_SIZE
+}
+
+// NewClient returns a new CounterSlotScheduler_Client
+func (cs *CounterSlotScheduler) NewClient() SlotScheduler_Client {
+	return new(CounterSlotScheduler_Client)
+}
+
+// NewRelay returns a new CounterSlotScheduler_Relay
+func (cs *CounterSlotScheduler) NewRelay() SlotScheduler_Relay {
+	return new(CounterSlotScheduler_Relay)
+}
+
+// CounterSlotScheduler_Client holds the number of cells requested by the client, and their length
+type CounterSlotScheduler_Client struct {
+	NClients    int
+	NCells      int
+	PayloadSize int
+	MySlotID    int
+}
+
+// CounterSlotScheduler_Relay reads the number of cells requested for each slot
+type CounterSlotScheduler_Relay struct {
+}
+
+// Client_ReceivedScheduleRequest instantiates the fields of CounterSlotScheduler_Client
+func (cc *CounterSlotScheduler_Client) Client_ReceivedScheduleRequest(nClients int, firstRound int32) {
+	cc.NClients = nClients
+	cc.NCells = 0
+	cc.PayloadSize = 0
+}
+
+// Client_ReserveRound asks for nCells cells of payloadSize bytes in our slot
+func (cc *CounterSlotScheduler_Client) Client_ReserveRound(slotID int, nCells int, payloadSize int) {
+	cc.MySlotID = slotID
+	cc.NCells = nCells
+	cc.PayloadSize = payloadSize
+}
+
+// Client_GetOpenScheduleContribution writes our counter in our slot, all the other bytes are zero
+func (cc *CounterSlotScheduler_Client) Client_GetOpenScheduleContribution() []byte {
+	payload := make([]byte, new(CounterSlotScheduler).ContributionSize(cc.NClients))
+	if cc.NCells > 0 && cc.MySlotID >= 0 && cc.MySlotID < cc.NClients {
+		counter := payload[cc.MySlotID*COUNTER_SIZE:]
+		counter[0] = cellsCounter(cc.NCells)
+		binary.BigEndian.PutUint16(counter[1:3], payloadSizeCounter(cc.PayloadSize))
+	}
+	return payload
+}
+
+// Client_IsSlotOwner returns true if ownerSlot is the client's slot in the shuffle
+func (cc *CounterSlotScheduler_Client) Client_IsSlotOwner(roundID int32, ownerSlot int, slotID int) bool {
+	return ownerSlot == slotID
+}
+
+// Relay_ContributionSize returns the length of the combined contributions, see CounterSlotScheduler.ContributionSize
+func (cr *CounterSlotScheduler_Relay) Relay_ContributionSize(nClients int) int {
+	return new(CounterSlotScheduler).ContributionSize(nClients)
+}
+
+// Relay_CombineContributions combines (XOR) the received contributions from each clients. In the real DC-net,
+// this is done automatically by the DC-net
+func (cr *CounterSlotScheduler_Relay) Relay_CombineContributions(contributions ...[]byte) []byte {
+	return new(BitMaskSlotScheduler_Relay).Relay_CombineContributions(contributions...)
+}
+
+// Relay_ComputeFinalSchedule returns the counter of each slot
+func (cr *CounterSlotScheduler_Relay) Relay_ComputeFinalSchedule(allContributions []byte, nClients int) map[int]SlotRequest {
+	res := make(map[int]SlotRequest)
+	for slot := 0; slot < nClients; slot++ {
+		res[slot] = SlotRequest{}
+		if (slot+1)*COUNTER_SIZE <= len(allContributions) {
+			counter := allContributions[slot*COUNTER_SIZE:]
+			res[slot] = SlotRequest{Cells: int(counter[0]), PayloadSize: int(binary.BigEndian.Uint16(counter[1:3]))}
+		}
+	}
+	return res
+}
+
+// the number of cells requested, as written in a one-byte counter
+func cellsCounter(nCells int) byte {
+	if nCells < 1 {
+		return 1
+	}
+	if nCells > 255 {
+		return 255
+	}
+	return byte(nCells)
+}
+
+// the length requested, as written in a two-byte counter (0 for the session's PayloadSize)
+func payloadSizeCounter(payloadSize int) uint16 {
+	if payloadSize < 0 || payloadSize > 0xFFFF {
+		return 0
+	}
+	return uint16(payloadSize)
+}
@@ -0,0 +1,126 @@
+package scheduler
+
+/*
+Cover reservations. A client reserves its slot when it has data to send, hence the open/closed schedule shows an
+observer when each pseudonym is active. With a cover policy, an idle client reserves a cell anyway; the cells it gets
+with nothing to send are cover cells, which the relay drops. The policies trade bandwidth for less activity leakage:
+
+- None: only reserve with data;
+- Random: when idle, reserve a cell with some probability in each open/closed request;
+- ConstantRate: reserve a cell in every open/closed request, the schedule says nothing about activity;
+- Tail: keep reserving for a while after the last activity (the historical behavior, with one second).
+
+The cover reservations ask for one cell; with the Counter and Footprint schedulers, the number of cells and their
+length still follow the data.
+
+Every (sub-)cell a client owns starts with a header, whose CELL_FLAG_DATA tells the relay whether it carries data: the
+relay never guesses from the content, so no data is mistaken for a cover cell.
+*/
+
+import (
+	"errors"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// Names of the available cover policies, as negotiated in ALL_ALL_PARAMETERS
+const (
+	COVER_POLICY_NONE          = "None"
+	COVER_POLICY_RANDOM        = "Random"
+	COVER_POLICY_CONSTANT_RATE = "ConstantRate"
+	COVER_POLICY_TAIL          = "Tail"
+)
+
+// COVER_DEFAULT_TAIL is how long a client keeps reserving after its last activity, in the historical behavior
+const COVER_DEFAULT_TAIL = time.Second
+
+// CELL_HEADER_SIZE is the length of the header the clients put in front of the content of the (sub-)cells they own
+const CELL_HEADER_SIZE = 1
+
+// CELL_FLAG_DATA is set in the header of a cell which carries data. A cell without it (a cover cell, or a cell that
+// nobody filled) is not an output, whatever its content
+const CELL_FLAG_DATA byte = 1
+
+// CoverPolicy decides whether an idle client reserves a cell anyway
+type CoverPolicy interface {
+	// Name returns the name of this policy, as negotiated in ALL_ALL_PARAMETERS
+	Name() string
+	// WantsCover returns true if a client with nothing to send, whose last activity was at lastActivity, reserves a
+	// cell in this open/closed request
+	WantsCover(now time.Time, lastActivity time.Time) bool
+}
+
+// NewCoverPolicy returns the policy called name. probability is the percentage of the open/closed requests in which
+// the Random policy reserves a cell, tail is how long the Tail policy keeps reserving after the last activity. An
+// empty name selects the historical default, a tail of COVER_DEFAULT_TAIL
+func NewCoverPolicy(name string, probability int, tail time.Duration) (CoverPolicy, error) {
+	switch name {
+	case "":
+		return &tailCover{tail: COVER_DEFAULT_TAIL}, nil
+	case COVER_POLICY_NONE:
+		return new(noCover), nil
+	case COVER_POLICY_RANDOM:
+		if probability < 0 || probability > 100 {
+			return nil, errors.New("the probability of a cover reservation must be in [0, 100], got " + strconv.Itoa(probability))
+		}
+		return &randomCover{probability: probability}, nil
+	case COVER_POLICY_CONSTANT_RATE:
+		return new(constantRateCover), nil
+	case COVER_POLICY_TAIL:
+		if tail < 0 {
+			return nil, errors.New("the tail of the cover reservations cannot be negative")
+		}
+		return &tailCover{tail: tail}, nil
+	}
+	return nil, errors.New("unknown cover policy " + name)
+}
+
+type noCover struct{}
+
+func (c *noCover) Name() string                        { return COVER_POLICY_NONE }
+func (c *noCover) WantsCover(now, last time.Time) bool { return false }
+
+type randomCover struct {
+	probability int // in percent
+}
+
+func (c *randomCover) Name() string { return COVER_POLICY_RANDOM }
+func (c *randomCover) WantsCover(now, last time.Time) bool {
+	return rand.Intn(100) < c.probability
+}
+
+type constantRateCover struct{}
+
+func (c *constantRateCover) Name() string                        { return COVER_POLICY_CONSTANT_RATE }
+func (c *constantRateCover) WantsCover(now, last time.Time) bool { return true }
+
+type tailCover struct {
+	tail time.Duration
+}
+
+func (c *tailCover) Name() string { return COVER_POLICY_TAIL }
+func (c *tailCover) WantsCover(now, last time.Time) bool {
+	return now.Before(last.Add(c.tail))
+}
+
+// NewCoverCell returns a cell of payloadSize bytes with nothing to send, its header does not have CELL_FLAG_DATA
+func NewCoverCell(payloadSize int) []byte {
+	return make([]byte, payloadSize)
+}
+
+// NewDataCell returns a cell carrying data, i.e., the header with CELL_FLAG_DATA, then data
+func NewDataCell(data []byte) []byte {
+	cell := make([]byte, CELL_HEADER_SIZE+len(data))
+	cell[0] = CELL_FLAG_DATA
+	copy(cell[CELL_HEADER_SIZE:], data)
+	return cell
+}
+
+// CellData returns the data of a cell, and false if the cell does not carry data (e.g., a cover cell)
+func CellData(cell []byte) ([]byte, bool) {
+	if len(cell) < CELL_HEADER_SIZE || cell[0]&CELL_FLAG_DATA == 0 {
+		return nil, false
+	}
+	return cell[CELL_HEADER_SIZE:], true
+}
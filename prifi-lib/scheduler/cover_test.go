@@ -0,0 +1,81 @@
+package scheduler
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestCoverPolicies(t *testing.T) {
+
+	now := time.Now()
+	idle := now.Add(-time.Hour)
+	active := now.Add(-100 * time.Millisecond)
+
+	if _, err := NewCoverPolicy("Always", 0, 0); err == nil {
+		t.Error("There is no policy Always")
+	}
+	if _, err := NewCoverPolicy(COVER_POLICY_RANDOM, 101, 0); err == nil {
+		t.Error("The probability is a percentage")
+	}
+	if _, err := NewCoverPolicy(COVER_POLICY_TAIL, 0, -time.Second); err == nil {
+		t.Error("The tail cannot be negative")
+	}
+
+	// the historical default keeps reserving for a second
+	c, err := NewCoverPolicy("", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name() != COVER_POLICY_TAIL || !c.WantsCover(now, active) || c.WantsCover(now, idle) {
+		t.Error("The default policy should reserve for a second after the last activity")
+	}
+
+	c, _ = NewCoverPolicy(COVER_POLICY_NONE, 0, 0)
+	if c.WantsCover(now, active) {
+		t.Error("The None policy never reserves without data")
+	}
+	c, _ = NewCoverPolicy(COVER_POLICY_CONSTANT_RATE, 0, 0)
+	if !c.WantsCover(now, idle) {
+		t.Error("The ConstantRate policy always reserves")
+	}
+	c, _ = NewCoverPolicy(COVER_POLICY_TAIL, 0, 50*time.Millisecond)
+	if c.WantsCover(now, active) {
+		t.Error("The tail is over")
+	}
+
+	never, _ := NewCoverPolicy(COVER_POLICY_RANDOM, 0, 0)
+	always, _ := NewCoverPolicy(COVER_POLICY_RANDOM, 100, 0)
+	sometimes, _ := NewCoverPolicy(COVER_POLICY_RANDOM, 50, 0)
+	reserved := 0
+	for i := 0; i < 1000; i++ {
+		if never.WantsCover(now, active) || !always.WantsCover(now, idle) {
+			t.Fatal("The Random policy should follow its probability")
+		}
+		if sometimes.WantsCover(now, idle) {
+			reserved++
+		}
+	}
+	if reserved < 350 || reserved > 650 {
+		t.Error("The Random policy with 50% reserved", reserved, "times out of 1000")
+	}
+}
+
+func TestCoverCells(t *testing.T) {
+
+	if _, isData := CellData(NewCoverCell(100)); isData {
+		t.Error("A cover cell should not carry data")
+	}
+	if _, isData := CellData(nil); isData {
+		t.Error("An empty cell should not carry data")
+	}
+
+	// data is never mistaken for a cover cell, even if it is all zeros
+	cell := NewDataCell(make([]byte, 99))
+	if data, isData := CellData(cell); len(cell) != 100 || !isData || len(data) != 99 {
+		t.Error("A data cell should carry its data, got", len(data), "bytes")
+	}
+	if data, isData := CellData(NewDataCell([]byte{1, 2, 3})); !isData || !bytes.Equal(data, []byte{1, 2, 3}) {
+		t.Error("A data cell should carry its data, got", data)
+	}
+}
@@ -0,0 +1,201 @@
+package scheduler
+
+/*
+The footprint scheduler does not give a fixed bit to each client. The reservation vector has
+FOOTPRINT_POSITIONS_PER_CLIENT * nClients positions of FOOTPRINT_SIZE bytes; a client that wants to transmit picks a
+random position, and writes a footprint there: FOOTPRINT_NONCE_SIZE random bytes, the number of cells requested (one
+byte) and their length (two bytes), followed by the first FOOTPRINT_CHECKSUM_SIZE bytes of their hash.
+
+Through the DC-net, the relay sees the XOR of the footprints of each position:
+- an all-zero position was not reserved, and is closed;
+- a valid footprint was written by exactly one client, the position is open for the cells requested;
+- an invalid footprint means that several clients picked the same position. It is closed, and these clients notice
+  that they did not get any round, so they pick another position at the next open/closed request.
+
+The schedule only reveals the number of reservations, not which pseudonyms are active. The slots are not the slots
+of the Neff shuffle, hence a client does not need to be part of a shuffle to reserve a slot.
+*/
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+
+	"go.dedis.ch/onet/v3/log"
+)
+
+// Parameters of the reservation vector
+const (
+	FOOTPRINT_POSITIONS_PER_CLIENT = 4
+	FOOTPRINT_NONCE_SIZE           = 3
+	FOOTPRINT_CHECKSUM_SIZE        = 4
+	FOOTPRINT_REQUEST_SIZE         = 3 // number of cells and their length
+	FOOTPRINT_SIZE                 = FOOTPRINT_NONCE_SIZE + FOOTPRINT_REQUEST_SIZE + FOOTPRINT_CHECKSUM_SIZE
+)
+
+// FootprintSlotScheduler lets the clients reserve random positions in a reservation vector
+type FootprintSlotScheduler struct {
+}
+
+// Name returns SLOT_SCHEDULER_FOOTPRINT
+func (fp *FootprintSlotScheduler) Name() string {
+	return SLOT_SCHEDULER_FOOTPRINT
+}
+
+// ContributionSize returns the size of the reservation vector
+func (fp *FootprintSlotScheduler) ContributionSize(nClients int) int {
+	return footprintPositions(nClients) * FOOTPRINT_SIZE
+}
+
+// UsesShuffledSlots returns false, the clients pick their positions
+func (fp *FootprintSlotScheduler) UsesShuffledSlots() bool {
+	return false
+}
+
+// SlotContributionBits returns 0, 0, the positions do not belong to a slot
+func (fp *FootprintSlotScheduler) SlotContributionBits(slot int, nClients int) (int, int) {
+	return 0, 0
+}
+
+// NewClient returns a new FootprintSlotScheduler_Client
+func (fp *FootprintSlotScheduler) NewClient() SlotScheduler_Client {
+	return &FootprintSlotScheduler_Client{
+		current: footprintReservation{Position: -1},
+		next:    footprintReservation{Position: -1}}
+}
+
+// NewRelay returns a new FootprintSlotScheduler_Relay
+func (fp *FootprintSlotScheduler) NewRelay() SlotScheduler_Relay {
+	return new(FootprintSlotScheduler_Relay)
+}
+
+// a position reserved by a client, for the schedule starting at FirstRound
+type footprintReservation struct {
+	Position   int // -1 if nothing was reserved
+	FirstRound int32
+	Owned      bool // true once the client was given a round in this position
+}
+
+// FootprintSlotScheduler_Client holds the reservation of the client being computed, and the one of the schedule in use
+type FootprintSlotScheduler_Client struct {
+	NClients   int
+	Collisions int // number of consecutive reservations that collided
+	footprint  []byte
+	current    footprintReservation
+	next       footprintReservation
+	hasNext    bool
+}
+
+// FootprintSlotScheduler_Relay counts the collisions seen in the schedules
+type FootprintSlotScheduler_Relay struct {
+	Collisions int
+}
+
+// Client_ReceivedScheduleRequest starts a new reservation. If the previous reservation never got a round, it
+// collided with another client's
+func (fc *FootprintSlotScheduler_Client) Client_ReceivedScheduleRequest(nClients int, firstRound int32) {
+	fc.NClients = nClients
+	if fc.current.Position >= 0 {
+		if fc.current.Owned {
+			fc.Collisions = 0
+		} else {
+			fc.Collisions++
+			log.Lvl3("Footprint scheduler: position", fc.current.Position, "collided", fc.Collisions, "time(s) in a row, picking another one")
+		}
+	}
+	fc.next = footprintReservation{Position: -1, FirstRound: firstRound}
+	fc.hasNext = true
+}
+
+// Client_ReserveRound picks a random position and a random footprint asking for nCells cells of payloadSize bytes.
+// slotID is not used
+func (fc *FootprintSlotScheduler_Client) Client_ReserveRound(slotID int, nCells int, payloadSize int) {
+	position, err := rand.Int(rand.Reader, big.NewInt(int64(footprintPositions(fc.NClients))))
+	if err != nil {
+		log.Fatal("Footprint scheduler: cannot pick a position,", err)
+	}
+	fc.next.Position = int(position.Int64())
+	fc.footprint = newFootprint(nCells, payloadSize)
+}
+
+// Client_GetOpenScheduleContribution returns the reservation vector, with our footprint at our position
+func (fc *FootprintSlotScheduler_Client) Client_GetOpenScheduleContribution() []byte {
+	payload := make([]byte, new(FootprintSlotScheduler).ContributionSize(fc.NClients))
+	if fc.hasNext && fc.next.Position >= 0 {
+		copy(payload[fc.next.Position*FOOTPRINT_SIZE:], fc.footprint)
+	}
+	return payload
+}
+
+// Client_IsSlotOwner returns true if ownerSlot is the position we reserved in the schedule used in round roundID
+func (fc *FootprintSlotScheduler_Client) Client_IsSlotOwner(roundID int32, ownerSlot int, slotID int) bool {
+	if fc.hasNext && roundID >= fc.next.FirstRound {
+		fc.current = fc.next
+		fc.hasNext = false
+	}
+	if fc.current.Position < 0 || ownerSlot != fc.current.Position {
+		return false
+	}
+	fc.current.Owned = true
+	return true
+}
+
+// Relay_ContributionSize returns the length of the combined contributions, see FootprintSlotScheduler.ContributionSize
+func (fr *FootprintSlotScheduler_Relay) Relay_ContributionSize(nClients int) int {
+	return new(FootprintSlotScheduler).ContributionSize(nClients)
+}
+
+// Relay_CombineContributions combines (XOR) the received contributions from each clients. In the real DC-net,
+// this is done automatically by the DC-net
+func (fr *FootprintSlotScheduler_Relay) Relay_CombineContributions(contributions ...[]byte) []byte {
+	return new(BitMaskSlotScheduler_Relay).Relay_CombineContributions(contributions...)
+}
+
+// Relay_ComputeFinalSchedule opens the positions holding a valid footprint
+func (fr *FootprintSlotScheduler_Relay) Relay_ComputeFinalSchedule(allContributions []byte, nClients int) map[int]SlotRequest {
+
+	res := make(map[int]SlotRequest)
+	empty := make([]byte, FOOTPRINT_SIZE)
+	for position := 0; position < footprintPositions(nClients); position++ {
+		res[position] = SlotRequest{}
+		if (position+1)*FOOTPRINT_SIZE > len(allContributions) {
+			continue
+		}
+		footprint := allContributions[position*FOOTPRINT_SIZE : (position+1)*FOOTPRINT_SIZE]
+		if bytes.Equal(footprint, empty) {
+			continue
+		}
+		if isValidFootprint(footprint) {
+			request := footprint[FOOTPRINT_NONCE_SIZE:]
+			res[position] = SlotRequest{Cells: int(request[0]), PayloadSize: int(binary.BigEndian.Uint16(request[1:3]))}
+		} else {
+			fr.Collisions++
+			log.Lvl3("Footprint scheduler: collision in position", position)
+		}
+	}
+	return res
+}
+
+func footprintPositions(nClients int) int {
+	return FOOTPRINT_POSITIONS_PER_CLIENT * nClients
+}
+
+// a random nonce, the number of cells (between 1 and 255) and their length, followed by their hash
+func newFootprint(nCells int, payloadSize int) []byte {
+	footprint := make([]byte, FOOTPRINT_NONCE_SIZE+FOOTPRINT_REQUEST_SIZE)
+	if _, err := rand.Read(footprint[:FOOTPRINT_NONCE_SIZE]); err != nil {
+		log.Fatal("Footprint scheduler: cannot pick a footprint,", err)
+	}
+	footprint[FOOTPRINT_NONCE_SIZE] = cellsCounter(nCells)
+	binary.BigEndian.PutUint16(footprint[FOOTPRINT_NONCE_SIZE+1:], payloadSizeCounter(payloadSize))
+	h := sha256.Sum256(footprint)
+	return append(footprint, h[:FOOTPRINT_CHECKSUM_SIZE]...)
+}
+
+// the checksum holds, and at least one cell is requested
+func isValidFootprint(footprint []byte) bool {
+	h := sha256.Sum256(footprint[:FOOTPRINT_NONCE_SIZE+FOOTPRINT_REQUEST_SIZE])
+	return footprint[FOOTPRINT_NONCE_SIZE] > 0 && bytes.Equal(footprint[FOOTPRINT_NONCE_SIZE+FOOTPRINT_REQUEST_SIZE:], h[:FOOTPRINT_CHECKSUM_SIZE])
+}
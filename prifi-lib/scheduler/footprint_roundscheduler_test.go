@@ -0,0 +1,164 @@
+package scheduler
+
+import (
+	"testing"
+)
+
+func TestFootprintSchedule(t *testing.T) {
+
+	s, err := NewSlotScheduler(SLOT_SCHEDULER_FOOTPRINT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.UsesShuffledSlots() {
+		t.Error("The footprint scheduler should not use the slots of the shuffle")
+	}
+	nClients := 3
+	if s.ContributionSize(nClients) != nClients*FOOTPRINT_POSITIONS_PER_CLIENT*FOOTPRINT_SIZE {
+		t.Error("Wrong contribution size", s.ContributionSize(nClients))
+	}
+
+	// the schedule computed in round 10 is used from round 12 on
+	clients := make([]*FootprintSlotScheduler_Client, nClients)
+	contributions := make([][]byte, nClients)
+	for i := range clients {
+		clients[i] = s.NewClient().(*FootprintSlotScheduler_Client)
+		clients[i].Client_ReceivedScheduleRequest(nClients, 12)
+		clients[i].Client_ReserveRound(-1, i+1, 100*i)
+	}
+	// clients 0 and 1 collide, client 2 is alone
+	clients[1].next.Position = clients[0].next.Position
+	clients[2].next.Position = (clients[0].next.Position + 1) % (FOOTPRINT_POSITIONS_PER_CLIENT * nClients)
+	for i := range clients {
+		contributions[i] = clients[i].Client_GetOpenScheduleContribution()
+		if len(contributions[i]) != s.ContributionSize(nClients) {
+			t.Error("Client", i, "sent a contribution of length", len(contributions[i]))
+		}
+	}
+
+	r := s.NewRelay().(*FootprintSlotScheduler_Relay)
+	schedule := r.Relay_ComputeFinalSchedule(r.Relay_CombineContributions(contributions...), nClients)
+	if len(schedule) != FOOTPRINT_POSITIONS_PER_CLIENT*nClients {
+		t.Error("The schedule should have a slot per position, has", len(schedule))
+	}
+	for position, request := range schedule {
+		if position == clients[2].next.Position && (request.Cells != 3 || request.PayloadSize != 200) {
+			t.Error("Client 2 asked for 3 cells of 200 bytes in position", position, ", got", request)
+		}
+		if position != clients[2].next.Position && request.Cells != 0 {
+			t.Error("Position", position, "should be closed")
+		}
+	}
+	if r.Collisions != 1 {
+		t.Error("The relay should see one collision, saw", r.Collisions)
+	}
+
+	// the rounds opened before the schedule still follow the previous one
+	reserved := clients[2].next.Position
+	if clients[2].Client_IsSlotOwner(11, reserved, 0) {
+		t.Error("Client 2 does not own a slot before round 12")
+	}
+	if !clients[2].Client_IsSlotOwner(12, reserved, 0) {
+		t.Error("Client 2 should own its position from round 12 on")
+	}
+	for i := 0; i < 2; i++ {
+		for position := range schedule {
+			if schedule[position].Cells > 0 && clients[i].Client_IsSlotOwner(13, position, 0) {
+				t.Error("Client", i, "collided, it should not own position", position)
+			}
+		}
+	}
+
+	// at the next request, the clients which did not get any round notice the collision
+	for i := range clients {
+		clients[i].Client_ReceivedScheduleRequest(nClients, 20)
+	}
+	if clients[0].Collisions != 1 || clients[1].Collisions != 1 || clients[2].Collisions != 0 {
+		t.Error("Clients 0 and 1 should have seen a collision, client 2 none")
+	}
+
+	// without reservation, the vector is empty and every slot is closed
+	empty := clients[0].Client_GetOpenScheduleContribution()
+	for position, request := range r.Relay_ComputeFinalSchedule(empty, nClients) {
+		if request.Cells != 0 {
+			t.Error("Position", position, "should be closed")
+		}
+	}
+}
+
+func TestFootprintCollisionRetry(t *testing.T) {
+
+	// two clients in a tiny vector collide often, but end up with different positions
+	nClients := 1
+	s := new(FootprintSlotScheduler)
+	a := s.NewClient().(*FootprintSlotScheduler_Client)
+	b := s.NewClient().(*FootprintSlotScheduler_Client)
+	r := s.NewRelay()
+
+	for round := int32(0); round < 100; round += 10 {
+		a.Client_ReceivedScheduleRequest(nClients, round+1)
+		b.Client_ReceivedScheduleRequest(nClients, round+1)
+		a.Client_ReserveRound(0, 1, 0)
+		b.Client_ReserveRound(0, 1, 0)
+		schedule := r.Relay_ComputeFinalSchedule(r.Relay_CombineContributions(a.Client_GetOpenScheduleContribution(), b.Client_GetOpenScheduleContribution()), nClients)
+
+		owners := 0
+		for position, request := range schedule {
+			if request.Cells == 0 {
+				continue
+			}
+			aOwns, bOwns := a.Client_IsSlotOwner(round+1, position, 0), b.Client_IsSlotOwner(round+1, position, 0)
+			if aOwns && bOwns {
+				t.Fatal("Both clients own position", position)
+			}
+			if aOwns || bOwns {
+				owners++
+			}
+		}
+		if a.next.Position == b.next.Position && owners != 0 {
+			t.Error("Colliding clients should not get any slot")
+		}
+		if a.next.Position != b.next.Position && owners != 2 {
+			t.Error("Both clients should get a slot, got", owners)
+		}
+	}
+}
+
+func TestCounterSchedule(t *testing.T) {
+
+	s, err := NewSlotScheduler(SLOT_SCHEDULER_COUNTER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nClients := 4
+	if s.ContributionSize(nClients) != COUNTER_SIZE*nClients {
+		t.Error("Wrong contribution size", s.ContributionSize(nClients))
+	}
+
+	// slot 1 is idle, the others ask for 1, 1000 (more than the counter holds) and 7 cells, slot 3 of 50 bytes
+	demands := map[int]int{0: 1, 2: 1000, 3: 7}
+	sizes := map[int]int{3: 50}
+	contributions := make([][]byte, 0)
+	for slot := 0; slot < nClients; slot++ {
+		c := s.NewClient()
+		c.Client_ReceivedScheduleRequest(nClients, 0)
+		if demands[slot] > 0 {
+			c.Client_ReserveRound(slot, demands[slot], sizes[slot])
+		}
+		if !c.Client_IsSlotOwner(1, slot, slot) || c.Client_IsSlotOwner(1, slot+1, slot) {
+			t.Error("A client owns its slot of the shuffle, and only this one")
+		}
+		contributions = append(contributions, c.Client_GetOpenScheduleContribution())
+	}
+	r := s.NewRelay()
+	schedule := r.Relay_ComputeFinalSchedule(r.Relay_CombineContributions(contributions...), nClients)
+	expected := map[int]SlotRequest{0: {Cells: 1}, 1: {}, 2: {Cells: 255}, 3: {Cells: 7, PayloadSize: 50}}
+	for slot := 0; slot < nClients; slot++ {
+		if schedule[slot] != expected[slot] {
+			t.Error("Slot", slot, "should have", expected[slot], ", has", schedule[slot])
+		}
+	}
+	if cells := CellsPerSlot(schedule); cells[2] != 255 || cells[1] != 0 {
+		t.Error("Wrong cells per slot", cells)
+	}
+}
@@ -2,7 +2,6 @@ package scheduler
 
 import (
 	"errors"
-	"github.com/dedis/prifi/prifi-lib/config"
 	"go.dedis.ch/kyber/v3"
 	"strconv"
 )
@@ -36,13 +35,13 @@ func (n *NeffShuffle) ClientVerifySigAndRecognizeSlot(privateKey kyber.Scalar, t
 	}
 
 	//batch-verify all signatures
-	success, err := multiSigVerify(trusteesPublicKeys, lastBase, shuffledPublicKeys, signatures)
+	success, err := multiSigVerify(n.Suite, trusteesPublicKeys, lastBase, shuffledPublicKeys, signatures)
 	if success != true {
 		return -1, err
 	}
 
 	//locate our public key in shuffle
-	publicKeyInNewBase := config.CryptoSuite.Point().Mul(privateKey, lastBase)
+	publicKeyInNewBase := n.Suite.Point().Mul(privateKey, lastBase)
 
 	mySlot := -1
 
@@ -2,10 +2,11 @@ package scheduler
 
 import (
 	"errors"
-	"github.com/dedis/prifi/prifi-lib/config"
+	"github.com/dedis/prifi/prifi-lib/crypto"
 	"github.com/dedis/prifi/prifi-lib/net"
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/kyber/v3/suites"
 	"strconv"
 )
 
@@ -13,8 +14,10 @@ import (
  * The view of the relay for the Neff Shuffle
  */
 type NeffShuffleRelay struct {
-	NTrustees   int
-	InitialBase kyber.Point
+	Suite             suites.Suite
+	NTrustees         int
+	InitialBase       kyber.Point
+	InitialPublicKeys []kyber.Point // the keys given to the first trustee
 
 	//this is the transcript, i.e. we keep everything
 	Bases              []kyber.Point
@@ -48,7 +51,7 @@ func (r *NeffShuffleRelay) Init(nTrustees int) error {
 	r.NTrustees = nTrustees
 
 	//the relay picks c0
-	r.InitialBase = config.CryptoSuite.Point().Base()
+	r.InitialBase = r.Suite.Point().Base()
 
 	//the share of products is c0 (will become c1*c0, c2*c1*c0, ...)
 	r.LastBase = r.InitialBase
@@ -88,6 +91,9 @@ func (r *NeffShuffleRelay) SendToNextTrustee() (interface{}, int, error) {
 		return nil, -1, errors.New("RelayView's public key array is empty")
 	}
 	r.CannotAddNewKeys = true
+	if r.currentTrusteeShuffling == 0 {
+		r.InitialPublicKeys = r.PublicKeyBeingShuffled
+	}
 
 	// send to the next trustee
 	msg := &net.REL_TRU_TELL_CLIENTS_PKS_AND_EPH_PKS_AND_BASE{
@@ -99,7 +105,8 @@ func (r *NeffShuffleRelay) SendToNextTrustee() (interface{}, int, error) {
 }
 
 /**
- * Simply holds the new shares and public keys, so we can use this in the next call to SendToNextTrustee()
+ * Verifies the shuffle of the current trustee against its input, and holds the new shares and public keys, so we can
+ * use this in the next call to SendToNextTrustee(). An invalid shuffle is refused, the error names the trustee
  */
 func (r *NeffShuffleRelay) ReceivedShuffleFromTrustee(newBase kyber.Point, newPublicKeys []kyber.Point, proof []byte) (bool, error) {
 
@@ -116,8 +123,15 @@ func (r *NeffShuffleRelay) ReceivedShuffleFromTrustee(newBase kyber.Point, newPu
 		return false, errors.New("Received a shuffle from the trustee, but len(newPublicKeys) is 0")
 	}
 
-	// store this shuffle's result in our transcript
 	j := r.currentTrusteeShuffling
+	if j >= r.NTrustees {
+		return false, errors.New("Received a shuffle from the trustee, but all trustees already shuffled")
+	}
+	if err := crypto.VerifyNeffShuffle(r.Suite, r.PublicKeyBeingShuffled, r.LastBase, newPublicKeys, newBase, proof); err != nil {
+		return false, errors.New("Trustee " + strconv.Itoa(j) + " sent an invalid shuffle, error is " + err.Error())
+	}
+
+	// store this shuffle's result in our transcript
 	r.ShuffledPublicKeys[j] = net.PublicKeyArray{Keys: newPublicKeys}
 	r.Proofs[j] = net.ByteArray{Bytes: proof}
 	r.Bases[j] = newBase
@@ -132,7 +146,7 @@ func (r *NeffShuffleRelay) ReceivedShuffleFromTrustee(newBase kyber.Point, newPu
 }
 
 /**
- * Packages the Shares, ShuffledPublicKeys and Proofs
+ * Packages the initial keys, the Shares, ShuffledPublicKeys and Proofs
  */
 func (r *NeffShuffleRelay) SendTranscript() (interface{}, error) {
 
@@ -144,9 +158,10 @@ func (r *NeffShuffleRelay) SendTranscript() (interface{}, error) {
 	}
 
 	msg := &net.REL_TRU_TELL_TRANSCRIPT{
-		Bases:  r.Bases,
-		EphPks: r.ShuffledPublicKeys,
-		Proofs: r.Proofs}
+		InitialEphPks: r.InitialPublicKeys,
+		Bases:         r.Bases,
+		EphPks:        r.ShuffledPublicKeys,
+		Proofs:        r.Proofs}
 	return msg, nil
 }
 
@@ -173,7 +188,7 @@ func (r *NeffShuffleRelay) ReceivedSignatureFromTrustee(trusteeID int, signature
  * Packages the shares, the shuffledPublicKeys in a byte array, and test the signatures from the trustees.
  * Fails if any one signature is invalid
  */
-func multiSigVerify(trusteesPublicKeys []kyber.Point, lastBase kyber.Point, shuffledPublicKeys []kyber.Point, signatures [][]byte) (bool, error) {
+func multiSigVerify(suite suites.Suite, trusteesPublicKeys []kyber.Point, lastBase kyber.Point, shuffledPublicKeys []kyber.Point, signatures [][]byte) (bool, error) {
 
 	nTrustees := len(trusteesPublicKeys)
 
@@ -212,7 +227,7 @@ func multiSigVerify(trusteesPublicKeys []kyber.Point, lastBase kyber.Point, shuf
 
 	//we test the signatures
 	for j := 0; j < nTrustees; j++ {
-		err := schnorr.Verify(config.CryptoSuite, trusteesPublicKeys[j], M, signatures[j])
+		err := schnorr.Verify(suite, trusteesPublicKeys[j], M, signatures[j])
 
 		if err != nil {
 			return false, errors.New("Can't verify sig n°" + strconv.Itoa(j) + "; " + err.Error())
@@ -246,7 +261,7 @@ func (r *NeffShuffleRelay) VerifySigsAndSendToClients(trusteesPublicKeys []kyber
 		sigArray = append(sigArray, r.Signatures[k].Bytes)
 	}
 
-	success, err := multiSigVerify(trusteesPublicKeys, lastBase, ephPubKeys.Keys, sigArray)
+	success, err := multiSigVerify(r.Suite, trusteesPublicKeys, lastBase, ephPubKeys.Keys, sigArray)
 	if success != true {
 		return nil, err
 	}
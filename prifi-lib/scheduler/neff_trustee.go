@@ -13,11 +13,11 @@ OUTPUT : list of slots
 import (
 	"bytes"
 	"errors"
-	"github.com/dedis/prifi/prifi-lib/config"
 	"github.com/dedis/prifi/prifi-lib/crypto"
 	"github.com/dedis/prifi/prifi-lib/net"
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/kyber/v3/suites"
 	"go.dedis.ch/onet/v3/log"
 	"strconv"
 )
@@ -26,6 +26,7 @@ import (
  * The view of one trustee for the Neff Shuffle
  */
 type NeffShuffleTrustee struct {
+	Suite      suites.Suite
 	TrusteeID  int
 	PrivateKey kyber.Scalar
 	PublicKey  kyber.Point
@@ -71,7 +72,7 @@ func (t *NeffShuffleTrustee) ReceivedShuffleFromRelay(lastBase kyber.Point, clie
 		return nil, errors.New("Cannot perform a shuffle is len(clientPublicKeys) is 0")
 	}
 
-	shuffledKeys, newBase, secretCoeff, proof, err := crypto.NeffShuffle(clientPublicKeys, lastBase, shuffleKeyPositions)
+	shuffledKeys, newBase, secretCoeff, proof, err := crypto.NeffShuffle(t.Suite, clientPublicKeys, lastBase, shuffleKeyPositions)
 	if err != nil {
 		return nil, err
 	}
@@ -94,9 +95,10 @@ func (t *NeffShuffleTrustee) ReceivedShuffleFromRelay(lastBase kyber.Point, clie
 }
 
 /**
- * We received a transcript of the whole shuffle from the relay. Check that we are included, and sign
+ * We received a transcript of the whole shuffle from the relay. Verify every shuffle, starting from the initial keys,
+ * check that we are included, and sign
  */
-func (t *NeffShuffleTrustee) ReceivedTranscriptFromRelay(bases []kyber.Point, shuffledPublicKeys [][]kyber.Point, proofs [][]byte) (interface{}, error) {
+func (t *NeffShuffleTrustee) ReceivedTranscriptFromRelay(initialKeys []kyber.Point, bases []kyber.Point, shuffledPublicKeys [][]kyber.Point, proofs [][]byte) (interface{}, error) {
 
 	if t.NewBase == nil {
 		return nil, errors.New("Cannot verify the shuffle, we didn't store the base")
@@ -110,36 +112,22 @@ func (t *NeffShuffleTrustee) ReceivedTranscriptFromRelay(bases []kyber.Point, sh
 	if len(bases) != len(shuffledPublicKeys) || len(bases) != len(proofs) {
 		return nil, errors.New("Size not matching, bases is " + strconv.Itoa(len(bases)) + ", shuffledPublicKeys_s is " + strconv.Itoa(len(shuffledPublicKeys)) + ", proof_s is " + strconv.Itoa(len(proofs)) + ".")
 	}
+	if len(bases) == 0 {
+		return nil, errors.New("Cannot verify an empty transcript")
+	}
 
 	nTrustees := len(bases)
 	nClients := len(shuffledPublicKeys[0])
 
-	//Todo : verify each individual permutations. No verification is done yet
-	var err error
+	//verify each individual permutation, the j-th trustee shuffled the output of the (j-1)-th
+	lastBase := t.Suite.Point().Base()
+	lastKeys := initialKeys
 	for j := 0; j < nTrustees; j++ {
-
-		verify := true
-		if j > 0 {
-			X := shuffledPublicKeys[j-1]
-			Y := shuffledPublicKeys[j-1]
-			Xbar := shuffledPublicKeys[j]
-			Ybar := shuffledPublicKeys[j]
-			if len(X) > 1 {
-				//verifier := shuffle.Verifier(config.CryptoSuite, nil, X[0], X, Y, Xbar, Ybar)
-				//err = crypto_proof.HashVerify(config.CryptoSuite, "PairShuffle", verifier, proofs[j])
-				_ = Y
-				_ = Xbar
-				_ = Ybar
-			}
-			if err != nil {
-				verify = false
-			}
-		}
-		verify = true // TODO: This shuffle needs to be fixed
-
-		if !verify {
-			return nil, errors.New("Could not verify the " + strconv.Itoa(j) + "th neff shuffle, error is " + err.Error())
+		if err := crypto.VerifyNeffShuffle(t.Suite, lastKeys, lastBase, shuffledPublicKeys[j], bases[j], proofs[j]); err != nil {
+			return nil, errors.New("Could not verify the shuffle of trustee " + strconv.Itoa(j) + ", error is " + err.Error())
 		}
+		lastBase = bases[j]
+		lastKeys = shuffledPublicKeys[j]
 	}
 
 	//we verify that our shuffle was included
@@ -182,7 +170,7 @@ func (t *NeffShuffleTrustee) ReceivedTranscriptFromRelay(bases []kyber.Point, sh
 	}
 
 	//sign this blob
-	signature, err := schnorr.Sign(config.CryptoSuite, t.PrivateKey, blob)
+	signature, err := schnorr.Sign(t.Suite, t.PrivateKey, blob)
 	if err != nil {
 		log.Panic("Could not schnorr-sign the transcript:", err)
 	}
@@ -1 +1,89 @@
 package scheduler
+
+import (
+	"errors"
+)
+
+// Names of the available slot schedulers, as negotiated in ALL_ALL_PARAMETERS
+const (
+	SLOT_SCHEDULER_BITMASK   = "BitMask"
+	SLOT_SCHEDULER_FOOTPRINT = "Footprint"
+	SLOT_SCHEDULER_COUNTER   = "Counter"
+)
+
+// SlotScheduler is a protocol between the relay and the clients that allows to decide which slots are gonna be
+// "open" (fixed-length byte array) or "closed" (inexistant, no message at all). In an open/closed request round, each
+// client sends its contribution through the DC-net, and the relay computes the schedule from the decoded cell. The
+// schedule gives the request of each slot: the number of cells, 0 for a closed slot, and the length of these cells
+type SlotScheduler interface {
+	// Name returns the name of this scheduler, as negotiated in ALL_ALL_PARAMETERS
+	Name() string
+	// ContributionSize returns the length of a client's contribution, which must fit in an upstream cell
+	ContributionSize(nClients int) int
+	// UsesShuffledSlots is true if the schedule is indexed by the slots of the Neff shuffle. Otherwise, the clients
+	// reserve their own slots in the schedule, and the owner of a slot is only known to itself
+	UsesShuffledSlots() bool
+	// SlotContributionBits returns the bits of the contributions written by the owner of slot: the first one, and their
+	// number. Bit i is bit i%8 of byte i/8. Returns 0, 0 if the scheduler does not use the slots of the shuffle
+	SlotContributionBits(slot int, nClients int) (int, int)
+	// NewClient returns the client side of this scheduler
+	NewClient() SlotScheduler_Client
+	// NewRelay returns the relay side of this scheduler
+	NewRelay() SlotScheduler_Relay
+}
+
+// SlotScheduler_Client computes the contribution of one client to the schedule
+type SlotScheduler_Client interface {
+	//the client receives a new schedule request from the relay. The schedule computed applies from firstRound on
+	Client_ReceivedScheduleRequest(nClients int, firstRound int32)
+
+	//the client alters the schedule being computed, and ask to transmit nCells cells of payloadSize bytes (0 for the
+	//session's PayloadSize)
+	Client_ReserveRound(slotID int, nCells int, payloadSize int)
+
+	//return the schedule to send as payload
+	Client_GetOpenScheduleContribution() []byte
+
+	//returns true if the client owns ownerSlot in round roundID; slotID is the client's slot in the shuffle
+	Client_IsSlotOwner(roundID int32, ownerSlot int, slotID int) bool
+}
+
+// SlotScheduler_Relay computes the schedule from the clients' contributions
+type SlotScheduler_Relay interface {
+	//returns the length of the combined contributions of nClients clients
+	Relay_ContributionSize(nClients int) int
+
+	//Called with each client's contribution. In the real DC-net, this is done by the DC-net
+	Relay_CombineContributions(contributions ...[]byte) []byte
+
+	// returns the request of each slot, in [0, nSlots[, given the combined contributions
+	Relay_ComputeFinalSchedule(allContributions []byte, nClients int) map[int]SlotRequest
+}
+
+// SlotRequest is what the owner of a slot asked for in a schedule
+type SlotRequest struct {
+	Cells       int // number of cells, 0 if the slot is closed
+	PayloadSize int // length of these cells, 0 for the session's PayloadSize
+}
+
+// CellsPerSlot returns the number of cells of each slot of schedule
+func CellsPerSlot(schedule map[int]SlotRequest) map[int]int {
+	cells := make(map[int]int)
+	for slot, request := range schedule {
+		cells[slot] = request.Cells
+	}
+	return cells
+}
+
+// NewSlotScheduler returns the scheduler called name. An empty name selects the bitmask scheduler, the historical default
+func NewSlotScheduler(name string) (SlotScheduler, error) {
+	switch name {
+	case "", SLOT_SCHEDULER_BITMASK:
+		return new(BitMaskSlotScheduler), nil
+	case SLOT_SCHEDULER_FOOTPRINT:
+		return new(FootprintSlotScheduler), nil
+	case SLOT_SCHEDULER_COUNTER:
+		return new(CounterSlotScheduler), nil
+	}
+	return nil, errors.New("unknown slot scheduler " + name)
+}
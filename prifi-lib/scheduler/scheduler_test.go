@@ -7,6 +7,7 @@ import (
 	"github.com/dedis/prifi/prifi-lib/net"
 	"go.dedis.ch/kyber/v3"
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -51,7 +52,7 @@ func TestWholeNeffShuffle(t *testing.T) {
 func NeffShuffleTestHelper(t *testing.T, nClients int, nTrustees int, shuffleKeyPos bool) []int {
 	clients := make([]*PrivatePublicPair, nClients)
 	for i := 0; i < nClients; i++ {
-		pub, priv := crypto.NewKeyPair()
+		pub, priv := crypto.NewKeyPair(config.CryptoSuite)
 		clients[i] = new(PrivatePublicPair)
 		clients[i].Public = pub
 		clients[i].Private = priv
@@ -59,14 +60,14 @@ func NeffShuffleTestHelper(t *testing.T, nClients int, nTrustees int, shuffleKey
 
 	//create the scheduler
 	n := new(NeffShuffle) //this will hold 1 relay, 1 trustee at most. Recreate n for >1 trustee
-	n.Init()
+	n.Init(config.CryptoSuite)
 
 	//init the trustees
 	trustees := make([]*NeffShuffle, nTrustees)
 	for i := 0; i < nTrustees; i++ {
 		trustees[i] = new(NeffShuffle)
-		trustees[i].Init()
-		pub, priv := crypto.NewKeyPair()
+		trustees[i].Init(config.CryptoSuite)
+		pub, priv := crypto.NewKeyPair(config.CryptoSuite)
 		trustees[i].TrusteeView.Init(i, priv, pub)
 	}
 
@@ -189,7 +190,7 @@ func NeffShuffleTestHelper(t *testing.T, nClients int, nTrustees int, shuffleKey
 	parsed3 := toSend3.(*net.REL_TRU_TELL_TRANSCRIPT)
 
 	for j := 0; j < nTrustees; j++ {
-		toSend4, err := trustees[j].TrusteeView.ReceivedTranscriptFromRelay(parsed3.Bases, parsed3.GetKeys(), parsed3.GetProofs())
+		toSend4, err := trustees[j].TrusteeView.ReceivedTranscriptFromRelay(parsed3.InitialEphPks, parsed3.Bases, parsed3.GetKeys(), parsed3.GetProofs())
 		if err != nil {
 			t.Error(err)
 		}
@@ -253,14 +254,14 @@ func NeffShuffleTestHelper(t *testing.T, nClients int, nTrustees int, shuffleKey
 
 func TestWholeNeffShuffleClientErrors(t *testing.T) {
 	n := new(NeffShuffle) //this will hold 1 relay, 1 trustee at most. Recreate n for >1 trustee
-	n.Init()
-	_, priv := crypto.NewKeyPair()
+	n.Init(config.CryptoSuite)
+	_, priv := crypto.NewKeyPair(config.CryptoSuite)
 
 	//init the trustees
 	nTrustees := 2
 	trusteesPks := make([]kyber.Point, nTrustees)
 	for i := 0; i < nTrustees; i++ {
-		pub, _ := crypto.NewKeyPair()
+		pub, _ := crypto.NewKeyPair(config.CryptoSuite)
 		trusteesPks[i] = pub
 	}
 
@@ -268,7 +269,7 @@ func TestWholeNeffShuffleClientErrors(t *testing.T) {
 	nClients := 4
 	ephPks := make([]kyber.Point, nClients)
 	for i := 0; i < nTrustees; i++ {
-		pub, _ := crypto.NewKeyPair()
+		pub, _ := crypto.NewKeyPair(config.CryptoSuite)
 		ephPks[i] = pub
 	}
 
@@ -312,10 +313,10 @@ func TestWholeNeffShuffleClientErrors(t *testing.T) {
 
 func TestWholeNeffShuffleRelayErrors(t *testing.T) {
 
-	pub, _ := crypto.NewKeyPair()
+	pub, _ := crypto.NewKeyPair(config.CryptoSuite)
 	//create the scheduler
 	n := new(NeffShuffle)
-	n.Init()
+	n.Init(config.CryptoSuite)
 
 	err := n.RelayView.Init(0)
 	if err == nil {
@@ -352,7 +353,7 @@ func TestWholeNeffShuffleRelayErrors(t *testing.T) {
 	nClients := 4
 	ephPks := make([]kyber.Point, nClients)
 	for i := 0; i < nClients; i++ {
-		pub, _ := crypto.NewKeyPair()
+		pub, _ := crypto.NewKeyPair(config.CryptoSuite)
 		ephPks[i] = pub
 	}
 	proof := make([]byte, 10)
@@ -415,10 +416,10 @@ func TestWholeNeffShuffleRelayErrors(t *testing.T) {
 
 func TestWholeNeffShuffleTrusteeErrors(t *testing.T) {
 
-	pub, priv := crypto.NewKeyPair()
+	pub, priv := crypto.NewKeyPair(config.CryptoSuite)
 	//create the scheduler
 	n := new(NeffShuffle)
-	n.Init()
+	n.Init(config.CryptoSuite)
 
 	err := n.TrusteeView.Init(-1, priv, pub)
 	if err == nil {
@@ -438,7 +439,7 @@ func TestWholeNeffShuffleTrusteeErrors(t *testing.T) {
 	nClients := 4
 	ephPks := make([]kyber.Point, nClients)
 	for i := 0; i < nClients; i++ {
-		pub, _ := crypto.NewKeyPair()
+		pub, _ := crypto.NewKeyPair(config.CryptoSuite)
 		ephPks[i] = pub
 	}
 	_, err = n.TrusteeView.ReceivedShuffleFromRelay(nil, ephPks, true, make([]byte, 1))
@@ -458,19 +459,19 @@ func TestWholeNeffShuffleTrusteeErrors(t *testing.T) {
 	bases := make([]kyber.Point, 2)
 	shuffledPublicKeys := make([][]kyber.Point, 3)
 	proofs := make([][]byte, 4)
-	_, err = n.TrusteeView.ReceivedTranscriptFromRelay(nil, shuffledPublicKeys, proofs)
+	_, err = n.TrusteeView.ReceivedTranscriptFromRelay(ephPks, nil, shuffledPublicKeys, proofs)
 	if err == nil {
 		t.Error("Shouldn't accept a transcript with nil instead of bases")
 	}
-	_, err = n.TrusteeView.ReceivedTranscriptFromRelay(bases, nil, proofs)
+	_, err = n.TrusteeView.ReceivedTranscriptFromRelay(ephPks, bases, nil, proofs)
 	if err == nil {
 		t.Error("Shouldn't accept a transcript with nil instead of bases")
 	}
-	_, err = n.TrusteeView.ReceivedTranscriptFromRelay(bases, shuffledPublicKeys, nil)
+	_, err = n.TrusteeView.ReceivedTranscriptFromRelay(ephPks, bases, shuffledPublicKeys, nil)
 	if err == nil {
 		t.Error("Shouldn't accept a transcript with nil instead of bases")
 	}
-	_, err = n.TrusteeView.ReceivedTranscriptFromRelay(bases, shuffledPublicKeys, proofs)
+	_, err = n.TrusteeView.ReceivedTranscriptFromRelay(ephPks, bases, shuffledPublicKeys, proofs)
 	if err == nil {
 		t.Error("Shouldn't accept a transcript when elements mismatch in sizes")
 	}
@@ -486,7 +487,7 @@ func TestWholeNeffShuffleTrusteeErrors(t *testing.T) {
 
 	n.TrusteeView.EphemeralKeys = ephPks
 
-	newPub, _ := crypto.NewKeyPair()
+	newPub, _ := crypto.NewKeyPair(config.CryptoSuite)
 	ephPks_s := make([][]kyber.Point, 1)
 	for i := 0; i < len(ephPks_s); i++ {
 		ephPks_s[i] = make([]kyber.Point, len(ephPks))
@@ -496,8 +497,92 @@ func TestWholeNeffShuffleTrusteeErrors(t *testing.T) {
 	}
 	ephPks_s[0][0] = newPub
 
-	_, err = n.TrusteeView.ReceivedTranscriptFromRelay(bases, ephPks_s, proofs)
+	_, err = n.TrusteeView.ReceivedTranscriptFromRelay(ephPks, bases, ephPks_s, proofs)
 	if err == nil {
 		t.Error("Shouldn't accept a transcript when one key has been changed !")
 	}
 }
+
+func TestNeffShuffleCheatingTrustee(t *testing.T) {
+
+	nClients := 3
+	nTrustees := 3
+	cheater := 1
+
+	n := new(NeffShuffle)
+	n.Init(config.CryptoSuite)
+	if err := n.RelayView.Init(nTrustees); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < nClients; i++ {
+		pub, _ := crypto.NewKeyPair(config.CryptoSuite)
+		n.RelayView.AddClient(pub)
+	}
+	trustees := make([]*NeffShuffle, nTrustees)
+	for i := 0; i < nTrustees; i++ {
+		trustees[i] = new(NeffShuffle)
+		trustees[i].Init(config.CryptoSuite)
+		pub, priv := crypto.NewKeyPair(config.CryptoSuite)
+		trustees[i].TrusteeView.Init(i, priv, pub)
+	}
+
+	// the cheater replaces a key by one of its own, but keeps the proof of its honest shuffle
+	var forged *net.TRU_REL_TELL_NEW_BASE_AND_EPH_PKS
+	for j := 0; j < nTrustees; j++ {
+		toSend, _, err := n.RelayView.SendToNextTrustee()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed := toSend.(*net.REL_TRU_TELL_CLIENTS_PKS_AND_EPH_PKS_AND_BASE)
+		toSend2, err := trustees[j].TrusteeView.ReceivedShuffleFromRelay(parsed.Base, parsed.EphPks, true, make([]byte, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		shuffle := toSend2.(*net.TRU_REL_TELL_NEW_BASE_AND_EPH_PKS)
+
+		if j == cheater {
+			ownKey, _ := crypto.NewKeyPair(config.CryptoSuite)
+			forged = &net.TRU_REL_TELL_NEW_BASE_AND_EPH_PKS{NewBase: shuffle.NewBase, NewEphPks: append([]kyber.Point{}, shuffle.NewEphPks...), Proof: shuffle.Proof}
+			forged.NewEphPks[0] = ownKey
+			trustees[j].TrusteeView.EphemeralKeys = forged.NewEphPks
+
+			// the relay refuses it, and names the cheater
+			_, err := n.RelayView.ReceivedShuffleFromTrustee(forged.NewBase, forged.NewEphPks, forged.Proof)
+			if err == nil || !strings.Contains(err.Error(), "Trustee "+strconv.Itoa(cheater)) {
+				t.Fatal("The relay should refuse the shuffle of trustee", cheater, "but", err)
+			}
+
+			// a relay that forwards it anyway
+			n.RelayView.Bases[j] = forged.NewBase
+			n.RelayView.ShuffledPublicKeys[j] = net.PublicKeyArray{Keys: forged.NewEphPks}
+			n.RelayView.Proofs[j] = net.ByteArray{Bytes: forged.Proof}
+			n.RelayView.PublicKeyBeingShuffled = forged.NewEphPks
+			n.RelayView.LastBase = forged.NewBase
+			n.RelayView.currentTrusteeShuffling++
+			continue
+		}
+		if _, err := n.RelayView.ReceivedShuffleFromTrustee(shuffle.NewBase, shuffle.NewEphPks, shuffle.Proof); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// every trustee checks the whole transcript, and names the cheater
+	toSend3, err := n.RelayView.SendTranscript()
+	if err != nil {
+		t.Fatal(err)
+	}
+	transcript := toSend3.(*net.REL_TRU_TELL_TRANSCRIPT)
+	for j := 0; j < nTrustees; j++ {
+		_, err := trustees[j].TrusteeView.ReceivedTranscriptFromRelay(transcript.InitialEphPks, transcript.Bases, transcript.GetKeys(), transcript.GetProofs())
+		if err == nil || !strings.Contains(err.Error(), "trustee "+strconv.Itoa(cheater)) {
+			t.Error("Trustee", j, "should refuse the shuffle of trustee", cheater, "but", err)
+		}
+	}
+
+	// another exponent for the keys than for the base is refused as well
+	c := config.CryptoSuite.Scalar().Pick(config.CryptoSuite.RandomStream())
+	otherBase := config.CryptoSuite.Point().Mul(c, transcript.Bases[0])
+	if _, err := trustees[0].TrusteeView.ReceivedTranscriptFromRelay(transcript.InitialEphPks, []kyber.Point{otherBase}, transcript.GetKeys()[0:1], transcript.GetProofs()[0:1]); err == nil {
+		t.Error("A shuffle with another exponent for the base should be refused")
+	}
+}
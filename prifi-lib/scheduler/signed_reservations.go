@@ -0,0 +1,234 @@
+package scheduler
+
+/*
+Signed reservations protect the open/closed requests against jamming. In a request round, the cell is the plain XOR
+of the clients' contributions, and nothing prevents a client from flipping the bits of the other slots: it could close
+a slot forever, or open slots nobody asked for. With signed reservations, the owner of each slot signs its part of the
+contributions with the pseudonym key of its slot (the output of the Neff shuffle), and writes the signature in the
+slot's place after the contributions. The relay checks every signature; a slot whose part or signature was altered is
+opened anyway, for one cell. A jammer can no longer close a slot, it can only open the slots it corrupts.
+
+The owner of a corrupted slot then learns the decoded reservation vector from the relay, and looks for a bit it left
+at 0 but that was decoded as 1: this bit was set by the jammer. It asks for a blame in the cell it gets, signing the
+round and the bit position with its pseudonym key, so it stays anonymous. Everybody reveals its pads at this single
+bit position, which tells whose cipher set the bit; since the owner left this bit at 0, the reveal says nothing about
+the honest clients. A jammer that only clears bits cannot be blamed, but it only opens the slots it corrupts.
+
+A reveal in a round carrying data would tell who sent it, hence the clients only reveal their pads in the open/closed
+rounds they took part in, and consent to the reveal with their long-term key. The trustees, who do not see the rounds,
+only reveal their pads with the consent of every client.
+*/
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+
+	"github.com/dedis/prifi/prifi-lib/crypto"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/suites"
+)
+
+// RESERVATION_BLAME_PATTERN starts the payload of a cell carrying a blame about a reservation (1100110011001100)
+const RESERVATION_BLAME_PATTERN uint16 = 52428
+
+// RESERVATION_ROUNDS_KEPT is the number of open/closed rounds whose reservations are kept for a blame
+const RESERVATION_ROUNDS_KEPT = 4
+
+// domains separating the signatures of the reservations, of the blames and of the consents to a reveal
+const (
+	reservationSignatureDomain = "PriFi-Reservation"
+	reservationBlameDomain     = "PriFi-ReservationBlame"
+	reservationConsentDomain   = "PriFi-ReservationRevealConsent"
+)
+
+// SignedReservations appends the signatures of the slots' owners to the contributions of a scheduler using the slots
+// of the shuffle. The reservation vector has the contributions, then one signature per slot
+type SignedReservations struct {
+	suite     suites.Suite
+	scheduler SlotScheduler
+	nClients  int
+}
+
+// NewSignedReservations returns the signed reservations of scheduler, which must use the slots of the shuffle
+func NewSignedReservations(suite suites.Suite, scheduler SlotScheduler, nClients int) (*SignedReservations, error) {
+	if !scheduler.UsesShuffledSlots() {
+		return nil, errors.New("the " + scheduler.Name() + " slot scheduler does not use the slots of the shuffle, its reservations cannot be signed")
+	}
+	return &SignedReservations{suite: suite, scheduler: scheduler, nClients: nClients}, nil
+}
+
+// Size returns the length of the reservation vector
+func (sr *SignedReservations) Size() int {
+	return sr.scheduler.ContributionSize(sr.nClients) + sr.nClients*crypto.SchnorrSignatureSize(sr.suite)
+}
+
+// signatureBits returns the first bit of the signature of slot, and the number of bits
+func (sr *SignedReservations) signatureBits(slot int) (int, int) {
+	signatureSize := crypto.SchnorrSignatureSize(sr.suite)
+	return 8 * (sr.scheduler.ContributionSize(sr.nClients) + slot*signatureSize), 8 * signatureSize
+}
+
+// Sign returns our contribution to the reservation vector of round roundID: the scheduler's contribution, and the
+// signature of our part of it in the place of our slot
+func (sr *SignedReservations) Sign(roundID int32, contribution []byte, slot int, base kyber.Point, privateKey kyber.Scalar) ([]byte, error) {
+	if slot < 0 || slot >= sr.nClients {
+		return nil, errors.New("no slot " + strconv.Itoa(slot))
+	}
+	vector := make([]byte, sr.Size())
+	copy(vector, contribution)
+
+	sig, err := crypto.SchnorrSign(sr.suite, base, privateKey, sr.reservationMessage(roundID, slot, vector))
+	if err != nil {
+		return nil, err
+	}
+	first, _ := sr.signatureBits(slot)
+	copy(vector[first/8:], sig)
+	return vector, nil
+}
+
+// Verify checks the signature of every slot in the decoded reservation vector of round roundID. Returns the
+// scheduler's contributions, and the slots whose reservation was altered
+func (sr *SignedReservations) Verify(roundID int32, vector []byte, base kyber.Point, pseudonyms []kyber.Point) ([]byte, []int) {
+	contributionSize := sr.scheduler.ContributionSize(sr.nClients)
+	corrupted := make([]int, 0)
+	if len(vector) < sr.Size() {
+		for slot := 0; slot < sr.nClients; slot++ {
+			corrupted = append(corrupted, slot)
+		}
+		return make([]byte, contributionSize), corrupted
+	}
+
+	signatureSize := crypto.SchnorrSignatureSize(sr.suite)
+	for slot := 0; slot < sr.nClients; slot++ {
+		first, _ := sr.signatureBits(slot)
+		sig := vector[first/8 : first/8+signatureSize]
+		if slot >= len(pseudonyms) || crypto.SchnorrVerify(sr.suite, base, pseudonyms[slot], sr.reservationMessage(roundID, slot, vector), sig) != nil {
+			corrupted = append(corrupted, slot)
+		}
+	}
+	return vector[:contributionSize], corrupted
+}
+
+// SlotOfBit returns the slot whose owner writes bit bitPos of the reservation vector, -1 if none
+func (sr *SignedReservations) SlotOfBit(bitPos int) int {
+	for slot := 0; slot < sr.nClients; slot++ {
+		first, n := sr.scheduler.SlotContributionBits(slot, sr.nClients)
+		if bitPos >= first && bitPos < first+n {
+			return slot
+		}
+		first, n = sr.signatureBits(slot)
+		if bitPos >= first && bitPos < first+n {
+			return slot
+		}
+	}
+	return -1
+}
+
+// BlamableBit returns the first bit written by the owner of slot that it left at 0 in its contribution mine, but that
+// is set in the decoded vector; -1 if there is none
+func (sr *SignedReservations) BlamableBit(mine, decoded []byte, slot int) int {
+	firstContribution, nContribution := sr.scheduler.SlotContributionBits(slot, sr.nClients)
+	firstSignature, nSignature := sr.signatureBits(slot)
+	for _, part := range [][2]int{{firstContribution, nContribution}, {firstSignature, nSignature}} {
+		for bitPos := part[0]; bitPos < part[0]+part[1]; bitPos++ {
+			if Bit(mine, bitPos) == 0 && Bit(decoded, bitPos) == 1 {
+				return bitPos
+			}
+		}
+	}
+	return -1
+}
+
+// SignBlame signs a blame about bit bitPos of the reservation vector of round roundID
+func (sr *SignedReservations) SignBlame(roundID int32, bitPos int, base kyber.Point, privateKey kyber.Scalar) ([]byte, error) {
+	return crypto.SchnorrSign(sr.suite, base, privateKey, blameMessage(roundID, bitPos))
+}
+
+// VerifyBlame checks that a blame about bit bitPos of the reservation vector of round roundID is signed by the owner
+// of the slot the bit belongs to; only the owner knows that it left this bit at 0
+func (sr *SignedReservations) VerifyBlame(roundID int32, bitPos int, sig []byte, base kyber.Point, pseudonyms []kyber.Point) error {
+	slot := sr.SlotOfBit(bitPos)
+	if slot < 0 || slot >= len(pseudonyms) {
+		return errors.New("bit " + strconv.Itoa(bitPos) + " does not belong to a slot")
+	}
+	return crypto.SchnorrVerify(sr.suite, base, pseudonyms[slot], blameMessage(roundID, bitPos), sig)
+}
+
+// reservationMessage returns what the owner of slot signs: the round, the slot and the bits of its part
+func (sr *SignedReservations) reservationMessage(roundID int32, slot int, vector []byte) []byte {
+	first, n := sr.scheduler.SlotContributionBits(slot, sr.nClients)
+	msg := make([]byte, 12, 12+(n+7)/8)
+	binary.BigEndian.PutUint64(msg[0:8], uint64(int64(roundID)))
+	binary.BigEndian.PutUint32(msg[8:12], uint32(slot))
+	part := make([]byte, (n+7)/8)
+	for i := 0; i < n; i++ {
+		if Bit(vector, first+i) == 1 {
+			part[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return append(append([]byte(reservationSignatureDomain), msg...), part...)
+}
+
+// SignRevealConsent signs, with a client's long-term key, its consent to reveal the pads at bit bitPos of the
+// reservation vector of round roundID
+func SignRevealConsent(suite suites.Suite, roundID int32, bitPos int, privateKey kyber.Scalar) ([]byte, error) {
+	return crypto.SchnorrSign(suite, suite.Point().Base(), privateKey, consentMessage(roundID, bitPos))
+}
+
+// VerifyRevealConsent checks the consent of the client whose long-term key is publicKey to reveal the pads at bit
+// bitPos of the reservation vector of round roundID
+func VerifyRevealConsent(suite suites.Suite, roundID int32, bitPos int, sig []byte, publicKey kyber.Point) error {
+	return crypto.SchnorrVerify(suite, suite.Point().Base(), publicKey, consentMessage(roundID, bitPos), sig)
+}
+
+// blameMessage returns what the owner of a slot signs to blame bit bitPos of the reservation vector of round roundID
+func blameMessage(roundID int32, bitPos int) []byte {
+	return append([]byte(reservationBlameDomain), roundAndBit(roundID, bitPos)...)
+}
+
+// consentMessage returns what a client signs to consent to a reveal at bit bitPos of the reservation vector of round
+// roundID
+func consentMessage(roundID int32, bitPos int) []byte {
+	return append([]byte(reservationConsentDomain), roundAndBit(roundID, bitPos)...)
+}
+
+func roundAndBit(roundID int32, bitPos int) []byte {
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint64(msg[0:8], uint64(int64(roundID)))
+	binary.BigEndian.PutUint32(msg[8:12], uint32(bitPos))
+	return msg
+}
+
+// ReservationBlameSize returns the length of the payload of a cell carrying a blame
+func ReservationBlameSize(suite suites.Suite) int {
+	return 10 + crypto.SchnorrSignatureSize(suite)
+}
+
+// EncodeReservationBlame returns the payload of a cell carrying a blame: the pattern, the round, the bit position and
+// the signature of the blame
+func EncodeReservationBlame(roundID int32, bitPos int, sig []byte) []byte {
+	payload := make([]byte, 10, 10+len(sig))
+	binary.BigEndian.PutUint16(payload[0:2], RESERVATION_BLAME_PATTERN)
+	binary.BigEndian.PutUint32(payload[2:6], uint32(roundID))
+	binary.BigEndian.PutUint32(payload[6:10], uint32(bitPos))
+	return append(payload, sig...)
+}
+
+// DecodeReservationBlame parses the payload of a cell carrying a blame; ok is false if the payload is not a blame
+func DecodeReservationBlame(payload []byte, signatureSize int) (roundID int32, bitPos int, sig []byte, ok bool) {
+	if len(payload) < 10+signatureSize || binary.BigEndian.Uint16(payload[0:2]) != RESERVATION_BLAME_PATTERN {
+		return 0, 0, nil, false
+	}
+	roundID = int32(binary.BigEndian.Uint32(payload[2:6]))
+	bitPos = int(int32(binary.BigEndian.Uint32(payload[6:10])))
+	return roundID, bitPos, payload[10 : 10+signatureSize], true
+}
+
+// Bit returns bit bitPos of data (bit bitPos%8 of byte bitPos/8), 0 if data is too short
+func Bit(data []byte, bitPos int) int {
+	if bitPos < 0 || bitPos/8 >= len(data) {
+		return 0
+	}
+	return int(data[bitPos/8]>>uint(bitPos%8)) & 1
+}
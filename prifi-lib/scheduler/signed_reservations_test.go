@@ -0,0 +1,116 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/dedis/prifi/prifi-lib/config"
+	"github.com/dedis/prifi/prifi-lib/crypto"
+	"go.dedis.ch/kyber/v3"
+)
+
+func TestSignedReservations(t *testing.T) {
+
+	nClients := 3
+	if _, err := NewSignedReservations(config.CryptoSuite, new(FootprintSlotScheduler), nClients); err == nil {
+		t.Error("The footprint scheduler does not use the slots of the shuffle, its reservations cannot be signed")
+	}
+	sr, err := NewSignedReservations(config.CryptoSuite, new(CounterSlotScheduler), nClients)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the pseudonyms are multiples of the shuffle's base
+	base, _ := crypto.NewKeyPair(config.CryptoSuite)
+	privateKeys := make([]kyber.Scalar, nClients)
+	pseudonyms := make([]kyber.Point, nClients)
+	for slot := range pseudonyms {
+		privateKeys[slot] = config.CryptoSuite.Scalar().Pick(config.CryptoSuite.RandomStream())
+		pseudonyms[slot] = config.CryptoSuite.Point().Mul(privateKeys[slot], base)
+	}
+
+	// slot 1 asks for 2 cells, the others are closed
+	contributions := make([][]byte, nClients)
+	for slot := range contributions {
+		c := new(CounterSlotScheduler).NewClient()
+		c.Client_ReceivedScheduleRequest(nClients, 10)
+		if slot == 1 {
+			c.Client_ReserveRound(slot, 2, 0)
+		}
+		contributions[slot], err = sr.Sign(7, c.Client_GetOpenScheduleContribution(), slot, base, privateKeys[slot])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(contributions[slot]) != sr.Size() {
+			t.Error("The contribution should have the size of the reservation vector")
+		}
+	}
+	vector := new(BitMaskSlotScheduler_Relay).Relay_CombineContributions(contributions...)
+
+	schedule, corrupted := sr.Verify(7, vector, base, pseudonyms)
+	if len(corrupted) != 0 {
+		t.Error("No reservation was altered, got", corrupted)
+	}
+	if new(CounterSlotScheduler_Relay).Relay_ComputeFinalSchedule(schedule, nClients)[1].Cells != 2 {
+		t.Error("Slot 1 should get its 2 cells")
+	}
+	if _, corrupted := sr.Verify(8, vector, base, pseudonyms); len(corrupted) != nClients {
+		t.Error("The signatures should not be valid in another round")
+	}
+
+	// a jammer opens slot 2; only its owner can tell which bit it did not set
+	jammed := append([]byte(nil), vector...)
+	jammed[2*COUNTER_SIZE] ^= 4
+	if _, corrupted := sr.Verify(7, jammed, base, pseudonyms); len(corrupted) != 1 || corrupted[0] != 2 {
+		t.Error("Only the reservation of slot 2 was altered, got", corrupted)
+	}
+	bitPos := sr.BlamableBit(contributions[2], jammed, 2)
+	if bitPos != 8*2*COUNTER_SIZE+2 || sr.SlotOfBit(bitPos) != 2 {
+		t.Error("Slot 2 should blame bit", 8*2*COUNTER_SIZE+2, ", got", bitPos)
+	}
+	if sr.BlamableBit(contributions[1], jammed, 1) != -1 {
+		t.Error("The part of slot 1 was not altered")
+	}
+
+	// a jammer that only clears bits cannot be blamed
+	cleared := append([]byte(nil), vector...)
+	cleared[1*COUNTER_SIZE] = 0
+	if sr.BlamableBit(contributions[1], cleared, 1) != -1 {
+		t.Error("No bit was set by the jammer")
+	}
+
+	// the blame is signed by the owner of the blamed bit, and travels in a cell
+	sig, err := sr.SignBlame(7, bitPos, base, privateKeys[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := EncodeReservationBlame(7, bitPos, sig)
+	roundID, decodedBitPos, decodedSig, ok := DecodeReservationBlame(payload, crypto.SchnorrSignatureSize(config.CryptoSuite))
+	if !ok || roundID != 7 || decodedBitPos != bitPos {
+		t.Fatal("Could not decode the blame")
+	}
+	if err := sr.VerifyBlame(roundID, decodedBitPos, decodedSig, base, pseudonyms); err != nil {
+		t.Error("The blame should be valid:", err)
+	}
+	if err := sr.VerifyBlame(roundID, 8, decodedSig, base, pseudonyms); err == nil {
+		t.Error("The owner of slot 2 cannot blame the bits of slot 0")
+	}
+	if _, _, _, ok := DecodeReservationBlame(make([]byte, 100), crypto.SchnorrSignatureSize(config.CryptoSuite)); ok {
+		t.Error("An empty payload is not a blame")
+	}
+	if len(payload) != ReservationBlameSize(config.CryptoSuite) {
+		t.Error("The blame should have", ReservationBlameSize(config.CryptoSuite), "bytes, got", len(payload))
+	}
+
+	// the clients consent to the reveal with their long-term key
+	pub, priv := crypto.NewKeyPair(config.CryptoSuite)
+	consent, err := SignRevealConsent(config.CryptoSuite, 7, bitPos, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyRevealConsent(config.CryptoSuite, 7, bitPos, consent, pub); err != nil {
+		t.Error("The consent should be valid:", err)
+	}
+	if VerifyRevealConsent(config.CryptoSuite, 8, bitPos, consent, pub) == nil {
+		t.Error("The consent is only valid for its round")
+	}
+}
@@ -1,8 +1,6 @@
 package trustee
 
 import (
-	"fmt"
-	"github.com/dedis/prifi/prifi-lib/config"
 	"github.com/dedis/prifi/prifi-lib/net"
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/proof"
@@ -22,7 +20,7 @@ func (p *PriFiLibTrusteeInstance) Received_REL_ALL_DISRUPTION_REVEAL(msg net.REL
 	var pred_array []proof.Predicate
 	sval := make(map[string]kyber.Scalar)
 	pval := make(map[string]kyber.Point)
-	suite := config.CryptoSuite
+	suite := p.trusteeState.CryptoSuite
 	B := suite.Point().Base()
 	pval["B"] = B
 	for i, prg := range PRGs {
@@ -55,56 +53,42 @@ func (p *PriFiLibTrusteeInstance) Received_REL_ALL_DISRUPTION_REVEAL(msg net.REL
 
 /*
 * Received_REL_ALL_REVEAL_SHARED_SECRETS handles REL_ALL_REVEAL_SHARED_SECRETS messages.
-* The method gets the shared secret and sends it to the relay.
+* The method sends to the relay the seed of the pads shared with the client in the key epoch of the blamed round. The
+* seed only gives the pads of that epoch, and the relay checks it against our commitment (see sendSeedCommitments). Our
+* shared secrets are erased once the session starts, they are never revealed.
  */
 func (p *PriFiLibTrusteeInstance) Received_REL_ALL_REVEAL_SHARED_SECRETS(msg net.REL_ALL_REVEAL_SHARED_SECRETS) error {
-	log.Lvl1("Disruption Phase 2: Received a reveal secret message for client", msg.EntityID)
-	// TODO: check that the relay asks for the correct entity, and not a honest entity. There should be a signature check on the TRU_REL_DISRUPTION_REVEAL the relay received (and forwarded to the client)
-	secret := p.trusteeState.sharedSecrets[msg.EntityID]
-	// as a pseudorandom base point multiplied by our private key.
-	suite := config.CryptoSuite
-	X := make([]kyber.Point, 1)
-	X[0] = p.trusteeState.PublicKey
-	B := suite.Point().Base() //BACK
-	// Generate the proof predicate: an OR branch for each public key.
-	sec := map[string]kyber.Scalar{"x": p.trusteeState.privateKey} //BACK
-	pub := map[string]kyber.Point{"B": B, "BT": p.trusteeState.ClientPublicKeys[msg.EntityID], "T": p.trusteeState.sharedSecrets[msg.EntityID]}
-	preds := make([]proof.Predicate, len(X))
-	for i := range X {
-		name := fmt.Sprintf("X[%d]", i) // "X[0]","X[1]",...
-		pub[name] = X[i]                // public point value
-
-		// Predicate indicates knowledge of the private key for X[i]
-		// and correspondence of the key with the linkage tag
-		preds[i] = proof.And(proof.Rep(name, "x", "B"), proof.Rep("T", "x", "BT"))
-	}
-	pred := proof.Or(preds...) // make a big Or predicate
-
-	// The prover needs to know which Or branch (mine) is actually true.
-	choice := make(map[proof.Predicate]int)
-	choice[pred] = 0
-
-	// Generate the signature
-	M := "SHAREDKEY"
-	prover := pred.Prover(suite, sec, pub, choice)
-	NIZK, _ := proof.HashProve(suite, M, prover)
-
-	// Verify the signature
-	verifier := pred.Verifier(suite, pub)
-	err := proof.HashVerify(suite, M, verifier, NIZK)
+	log.Lvl1("Disruption Phase 2: Received a reveal seed message for client", msg.EntityID, "round", msg.RoundID)
+	epoch, seed, err := p.trusteeState.DCNet.EpochSeed(msg.EntityID, msg.RoundID)
 	if err != nil {
-		log.Lvl1("signature failed to verify: ", err)
+		// we send an empty seed, the relay will blame us
+		log.Error("Disruption Phase 2: cannot reveal the seed of epoch", epoch, ":", err)
 	}
-	log.Lvl1("Linkable Ring Signature verified.")
 
-	toSend := &net.TRU_REL_SHARED_SECRET{
+	toSend := &net.TRU_REL_EPOCH_SEED{
 		TrusteeID: p.trusteeState.ID,
 		ClientID:  msg.EntityID,
-		Secret:    secret,
-		NIZK:      NIZK,
-		Pub:       pub,
+		Epoch:     epoch,
+		Seed:      seed,
 	}
-	p.messageSender.SendToRelayWithLog(toSend, "Sent secret to relay")
-	log.Lvl1("Reveling secret with client", msg.EntityID)
+	p.messageSender.SendToRelayWithLog(toSend, "Sent the seed of epoch "+strconv.Itoa(int(epoch))+" to relay")
 	return nil
 }
+
+/*
+* sendSeedCommitments sends to the relay the commitments to the seeds of the pads shared with each client in the key
+* epoch of the round, before our first cipher of that epoch. The seed we may reveal in a blame must match them.
+ */
+func (p *PriFiLibTrusteeInstance) sendSeedCommitments(roundID int32) {
+	epoch, commitments, err := p.trusteeState.DCNet.EpochSeedCommitments(roundID)
+	if err != nil {
+		log.Error("Trustee", p.trusteeState.ID, ": cannot commit to the seeds of epoch", epoch, ":", err)
+		return
+	}
+	toSend := &net.TRU_REL_SEED_COMMITMENTS{
+		TrusteeID:   p.trusteeState.ID,
+		Epoch:       epoch,
+		Commitments: commitments,
+	}
+	p.messageSender.SendToRelayWithLog(toSend, "(epoch "+strconv.Itoa(int(epoch))+")")
+}
@@ -2,15 +2,19 @@ package trustee
 
 import (
 	"errors"
+	"github.com/dedis/prifi/prifi-lib/config"
 	"github.com/dedis/prifi/prifi-lib/crypto"
 	"github.com/dedis/prifi/prifi-lib/dcnet"
 	"github.com/dedis/prifi/prifi-lib/net"
 	"github.com/dedis/prifi/prifi-lib/scheduler"
 	"github.com/dedis/prifi/prifi-lib/utils"
 	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/suites"
 	"go.dedis.ch/onet/v3/log"
 	"reflect"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Possible sending rates for the trustees.
@@ -34,9 +38,14 @@ func NewTrustee(neverSlowDown bool, alwaysSlowDown bool, baseSleepTime int, msgS
 
 	//init the static stuff
 	trusteeState.sendingRate = make(chan int16, 10)
-	trusteeState.PublicKey, trusteeState.privateKey = crypto.NewKeyPair()
+	trusteeState.skippedRounds = make(chan net.REL_TRU_TELL_SKIPPED_ROUNDS, 100)
+	trusteeState.substitutes = make(chan *substituteTrustee, 10)
+	trusteeState.absenceTimeout = TRUSTEE_ABSENCE_TIMEOUT
+	trusteeState.recoveries = make(map[int]*trusteeRecovery)
+	trusteeState.CryptoSuite = config.CryptoSuite
+	trusteeState.PublicKey, trusteeState.privateKey = crypto.NewKeyPair(trusteeState.CryptoSuite)
 	neffShuffle := new(scheduler.NeffShuffle)
-	neffShuffle.Init()
+	neffShuffle.Init(trusteeState.CryptoSuite)
 	trusteeState.neffShuffle = neffShuffle.TrusteeView
 	trusteeState.NeverSlowDown = neverSlowDown
 	trusteeState.AlwaysSlowDown = alwaysSlowDown
@@ -74,6 +83,7 @@ func NewTrustee(neverSlowDown bool, alwaysSlowDown bool, baseSleepTime int, msgS
 type TrusteeState struct {
 	DCNet                         *dcnet.DCNetEntity
 	ClientPublicKeys              []kyber.Point
+	ClientSessionPublicKeys       []kyber.Point // the DC-net secrets are shared with these keys
 	ID                            int
 	MessageHistory                kyber.XOF
 	Name                          string
@@ -83,13 +93,32 @@ type TrusteeState struct {
 	PayloadSize                   int
 	privateKey                    kyber.Scalar
 	PublicKey                     kyber.Point
+	sessionPrivateKey             kyber.Scalar // erased once the DC-net is set up, or once shared with threshold trustees
+	SessionPublicKey              kyber.Point
 	sendingRate                   chan int16
-	sharedSecrets                 []kyber.Point
+	skippedRounds                 chan net.REL_TRU_TELL_SKIPPED_ROUNDS // the rounds the relay will not open, for the sending goroutine
 	TrusteeID                     int
 	BaseSleepTime                 int
 	AlwaysSlowDown                bool //enforce the sleep in the sending function even if rate is FULL
 	NeverSlowDown                 bool //ignore the sleep in the sending function if rate is STOPPED
 	EquivocationProtectionEnabled bool
+	SignedReservations            bool // the clients sign their reservations, and may ask us to reveal our pads in open/closed rounds
+	DCNetType                     string
+	DCNetParallelism              int
+	DCNetPRG                      dcnet.PRG
+	DCNetPrecomputedRounds        int
+	SessionNonce                  []byte        // chosen by the relay for each session, the pads are derived from it
+	DCNetEpochLength              int           // number of rounds after which the DC-net keys are ratcheted, 0 = never
+	CryptoSuite                   suites.Suite  // the suite of the session, chosen by the relay
+	VerifiableDCNetKey            []byte        //our share of the verifiable DC-net commitment base, nil if unused
+	TrusteeThreshold              int           // number of trustees needed to replace a missing one, 0 = disabled
+	TrusteesPks                   []kyber.Point // the public keys of all trustees, only known with threshold trustees
+	TrusteesSessionPks            []kyber.Point // the session keys of all trustees, only known with threshold trustees
+	recoveryLock                  sync.Mutex
+	recoveries                    map[int]*trusteeRecovery // missing trusteeID -> its replacement, with threshold trustees
+	substitutes                   chan *substituteTrustee  // the trustees we replace, for the sending goroutine
+	absenceTimeout                time.Duration            // how long a missing trustee has to answer our ping
+	reshuffleEpoch                int                      // the shuffle epoch of the last reshuffle we shuffled, 0 if none
 }
 
 // NeffShuffleResult holds the result of the NeffShuffle,
@@ -114,17 +143,41 @@ func (p *PriFiLibTrusteeInstance) ReceivedMessage(msg interface{}) error {
 	case net.ALL_ALL_SHUTDOWN:
 		err = p.Received_ALL_ALL_SHUTDOWN(typedMsg)
 	case net.REL_TRU_TELL_CLIENTS_PKS_AND_EPH_PKS_AND_BASE:
-		if p.stateMachine.AssertState("INITIALIZING") {
+		if typedMsg.ShuffleEpoch > 0 {
+			if p.stateMachine.AssertState("READY") {
+				err = p.Received_REL_TRU_RESHUFFLE(typedMsg)
+			}
+		} else if p.stateMachine.AssertState("INITIALIZING") {
 			err = p.Received_REL_TRU_TELL_CLIENTS_PKS_AND_EPH_PKS_AND_BASE(typedMsg)
 		}
 	case net.REL_TRU_TELL_TRANSCRIPT:
-		if p.stateMachine.AssertState("SHUFFLE_DONE") {
+		if typedMsg.ShuffleEpoch > 0 {
+			if p.stateMachine.AssertState("READY") {
+				err = p.Received_REL_TRU_RESHUFFLE_TRANSCRIPT(typedMsg)
+			}
+		} else if p.stateMachine.AssertState("SHUFFLE_DONE") {
 			err = p.Received_REL_TRU_TELL_TRANSCRIPT(typedMsg)
 		}
 	case net.REL_TRU_TELL_RATE_CHANGE:
 		if p.stateMachine.AssertState("READY") {
 			err = p.Received_REL_TRU_TELL_RATE_CHANGE(typedMsg)
 		}
+	case net.REL_TRU_TELL_SKIPPED_ROUNDS:
+		if p.stateMachine.AssertState("READY") {
+			err = p.Received_REL_TRU_TELL_SKIPPED_ROUNDS(typedMsg)
+		}
+	case net.REL_TRU_RECOVER_TRUSTEE:
+		if p.stateMachine.AssertState("READY") {
+			err = p.Received_REL_TRU_RECOVER_TRUSTEE(typedMsg)
+		}
+	case net.TRU_TRU_PING:
+		err = p.Received_TRU_TRU_PING(typedMsg)
+	case net.TRU_TRU_PONG:
+		err = p.Received_TRU_TRU_PONG(typedMsg)
+	case net.TRU_TRU_RECOVERY_PARTIALS:
+		if p.stateMachine.AssertState("READY") {
+			err = p.Received_TRU_TRU_RECOVERY_PARTIALS(typedMsg)
+		}
 	case net.REL_ALL_DISRUPTION_REVEAL:
 		if p.stateMachine.AssertState("READY") {
 			err = p.Received_REL_ALL_DISRUPTION_REVEAL(typedMsg)
@@ -133,6 +186,10 @@ func (p *PriFiLibTrusteeInstance) ReceivedMessage(msg interface{}) error {
 		if p.stateMachine.AssertState("READY") {
 			err = p.Received_REL_ALL_REVEAL_SHARED_SECRETS(typedMsg)
 		}
+	case net.REL_ALL_RESERVATION_REVEAL:
+		if p.stateMachine.AssertState("READY") {
+			err = p.Received_REL_ALL_RESERVATION_REVEAL(typedMsg)
+		}
 	default:
 		err = errors.New("Unrecognized message, type" + reflect.TypeOf(msg).String())
 	}
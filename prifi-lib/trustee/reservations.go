@@ -0,0 +1,44 @@
+package trustee
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/dedis/prifi/prifi-lib/net"
+	"github.com/dedis/prifi/prifi-lib/scheduler"
+	"go.dedis.ch/onet/v3/log"
+)
+
+/*
+Received_REL_ALL_RESERVATION_REVEAL handles REL_ALL_RESERVATION_REVEAL messages. The owner of a slot blamed a bit of the
+reservations of an open/closed round; with the consent of every client, we reveal the bits of our pads at this position.
+We do not see the rounds: without the consents, the relay could ask us to reveal the pads of a round carrying data.
+*/
+func (p *PriFiLibTrusteeInstance) Received_REL_ALL_RESERVATION_REVEAL(msg net.REL_ALL_RESERVATION_REVEAL) error {
+	if !p.trusteeState.SignedReservations {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : the reservations are not signed in this session")
+	}
+	if len(msg.Consents) != p.trusteeState.nClients {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : refusing to reveal our pads in round " + strconv.Itoa(int(msg.RoundID)) + ", got " + strconv.Itoa(len(msg.Consents)) + " consents for " + strconv.Itoa(p.trusteeState.nClients) + " clients")
+	}
+	for i, consent := range msg.Consents {
+		if err := scheduler.VerifyRevealConsent(p.trusteeState.CryptoSuite, msg.RoundID, msg.BitPos, consent.Bytes, p.trusteeState.ClientPublicKeys[i]); err != nil {
+			return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : refusing to reveal our pads in round " + strconv.Itoa(int(msg.RoundID)) + ", invalid consent of client " + strconv.Itoa(i) + ", " + err.Error())
+		}
+	}
+
+	bits, err := p.trusteeState.DCNet.PadBitsOfRound(msg.RoundID, msg.BitPos)
+	if err != nil {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : cannot reveal our pads, " + err.Error())
+	}
+	log.Lvl1("Trustee", p.trusteeState.ID, ": revealing our pads at bit", msg.BitPos, "of the reservations of round", msg.RoundID)
+
+	toSend := &net.TRU_REL_RESERVATION_REVEAL{
+		TrusteeID: p.trusteeState.ID,
+		RoundID:   msg.RoundID,
+		BitPos:    msg.BitPos,
+		Bits:      bits,
+	}
+	p.messageSender.SendToRelayWithLog(toSend, "(round "+strconv.Itoa(int(msg.RoundID))+")")
+	return nil
+}
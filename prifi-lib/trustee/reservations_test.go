@@ -0,0 +1,77 @@
+package trustee
+
+import (
+	"testing"
+
+	"github.com/dedis/prifi/prifi-lib/config"
+	"github.com/dedis/prifi/prifi-lib/crypto"
+	"github.com/dedis/prifi/prifi-lib/dcnet"
+	"github.com/dedis/prifi/prifi-lib/net"
+	"github.com/dedis/prifi/prifi-lib/scheduler"
+	"go.dedis.ch/kyber/v3"
+)
+
+func TestTrusteeReservationReveal(t *testing.T) {
+
+	msgSender := new(TestMessageSender)
+	msgSender.sentToRelay = make(chan interface{}, 5)
+	trustee := NewTrustee(false, false, 1000, newTestMessageSenderWrapper(msgSender))
+
+	nClients := 2
+	msg := new(net.ALL_ALL_PARAMETERS)
+	msg.ForceParams = true
+	msg.Add("NClients", nClients)
+	msg.Add("NTrustees", 1)
+	msg.Add("PayloadSize", 100)
+	msg.Add("NextFreeTrusteeID", 0)
+	msg.Add("DCNetType", "Simple")
+	msg.Add("SignedReservations", true)
+	if err := trustee.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Trustee should be able to receive this message:", err)
+	}
+
+	clientPrivs := make([]kyber.Scalar, nClients)
+	sharedKeys := make([]kyber.Point, nClients)
+	for i := 0; i < nClients; i++ {
+		trustee.trusteeState.ClientPublicKeys[i], clientPrivs[i] = crypto.NewKeyPair(config.CryptoSuite)
+		sharedKeys[i], _ = crypto.NewKeyPair(config.CryptoSuite)
+	}
+	trustee.trusteeState.DCNet = dcnet.NewDCNetEntity(0, dcnet.DCNET_TRUSTEE, 100, false, sharedKeys, config.CryptoSuite)
+	trustee.stateMachine.ChangeState("READY")
+
+	// we only reveal our pads with the consent of every client
+	consents := make([]net.ByteArray, nClients)
+	for i := range consents {
+		consent, err := scheduler.SignRevealConsent(config.CryptoSuite, 3, 1, clientPrivs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		consents[i] = net.ByteArray{Bytes: consent}
+	}
+	reveal := net.REL_ALL_RESERVATION_REVEAL{RoundID: 3, BitPos: 1, Consents: consents[:1]}
+	if err := trustee.ReceivedMessage(reveal); err == nil {
+		t.Error("Trustee should refuse to reveal its pads without the consent of client 1")
+	}
+	reveal.Consents = []net.ByteArray{consents[1], consents[0]}
+	if err := trustee.ReceivedMessage(reveal); err == nil {
+		t.Error("Trustee should refuse the consents of the wrong clients")
+	}
+	reveal.RoundID = 4
+	reveal.Consents = consents
+	if err := trustee.ReceivedMessage(reveal); err == nil {
+		t.Error("Trustee should refuse the consents of another round")
+	}
+	if len(msgSender.sentToRelay) != 0 {
+		t.Fatal("Trustee should not reveal anything")
+	}
+
+	reveal.RoundID = 3
+	if err := trustee.ReceivedMessage(reveal); err != nil {
+		t.Fatal(err)
+	}
+	bits := (<-msgSender.sentToRelay).(*net.TRU_REL_RESERVATION_REVEAL).Bits
+	expected, _ := trustee.trusteeState.DCNet.PadBitsOfRound(3, 1)
+	if len(bits) != nClients || bits[0] != expected[0] || bits[1] != expected[1] {
+		t.Error("Trustee should reveal the bit of its pad with each client")
+	}
+}
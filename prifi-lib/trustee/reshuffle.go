@@ -0,0 +1,55 @@
+package trustee
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/dedis/prifi/prifi-lib/net"
+)
+
+/*
+Received_REL_TRU_RESHUFFLE handles REL_TRU_TELL_CLIENTS_PKS_AND_EPH_PKS_AND_BASE messages of a reshuffle. Those contain
+new ephemeral keys of the clients, shuffled to give them new slots while the DC-net keeps running; our DC-net keys are
+not affected. We shuffle them like in the setup.
+*/
+func (p *PriFiLibTrusteeInstance) Received_REL_TRU_RESHUFFLE(msg net.REL_TRU_TELL_CLIENTS_PKS_AND_EPH_PKS_AND_BASE) error {
+	if msg.ShuffleEpoch <= p.trusteeState.reshuffleEpoch {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : already shuffled shuffle epoch " + strconv.Itoa(msg.ShuffleEpoch))
+	}
+	if len(msg.EphPks) != p.trusteeState.nClients {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : the reshuffle has " + strconv.Itoa(len(msg.EphPks)) +
+			" keys for " + strconv.Itoa(p.trusteeState.nClients) + " clients")
+	}
+
+	toSend, err := p.trusteeState.neffShuffle.ReceivedShuffleFromRelay(msg.Base, msg.EphPks, true, nil)
+	if err != nil {
+		return errors.New("Could not do ReceivedShuffleFromRelay, error is " + err.Error())
+	}
+	p.trusteeState.reshuffleEpoch = msg.ShuffleEpoch
+
+	reply := toSend.(*net.TRU_REL_TELL_NEW_BASE_AND_EPH_PKS)
+	reply.ShuffleEpoch = msg.ShuffleEpoch
+	p.messageSender.SendToRelayWithLog(reply, "(shuffle epoch "+strconv.Itoa(msg.ShuffleEpoch)+")")
+	return nil
+}
+
+/*
+Received_REL_TRU_RESHUFFLE_TRANSCRIPT handles REL_TRU_TELL_TRANSCRIPT messages of a reshuffle. We verify every shuffle and
+that ours is included, and sign the last one, like in the setup.
+*/
+func (p *PriFiLibTrusteeInstance) Received_REL_TRU_RESHUFFLE_TRANSCRIPT(msg net.REL_TRU_TELL_TRANSCRIPT) error {
+	if msg.ShuffleEpoch != p.trusteeState.reshuffleEpoch {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : received the transcript of shuffle epoch " + strconv.Itoa(msg.ShuffleEpoch) +
+			", but we shuffled shuffle epoch " + strconv.Itoa(p.trusteeState.reshuffleEpoch))
+	}
+
+	toSend, err := p.trusteeState.neffShuffle.ReceivedTranscriptFromRelay(msg.InitialEphPks, msg.Bases, msg.GetKeys(), msg.GetProofs())
+	if err != nil {
+		return errors.New("Could not do ReceivedTranscriptFromRelay, error is " + err.Error())
+	}
+
+	sig := toSend.(*net.TRU_REL_SHUFFLE_SIG)
+	sig.ShuffleEpoch = msg.ShuffleEpoch
+	p.messageSender.SendToRelayWithLog(sig, "(shuffle epoch "+strconv.Itoa(msg.ShuffleEpoch)+")")
+	return nil
+}
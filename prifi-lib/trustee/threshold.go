@@ -0,0 +1,318 @@
+package trustee
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/dedis/prifi/prifi-lib/crypto"
+	"github.com/dedis/prifi/prifi-lib/dcnet"
+	"github.com/dedis/prifi/prifi-lib/net"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// TRUSTEE_ABSENCE_TIMEOUT is how long a missing trustee has to answer our TRU_TRU_PING before we help replacing it
+const TRUSTEE_ABSENCE_TIMEOUT = 5 * time.Second
+
+// trusteeRecovery is the replacement of a missing trustee, see relay/threshold.go
+type trusteeRecovery struct {
+	request  *net.REL_TRU_RECOVER_TRUSTEE           // nil until the relay asks us to replace the trustee
+	alive    bool                                   // the missing trustee answered our ping
+	absent   bool                                   // the missing trustee did not answer our ping in time
+	received map[int]*net.TRU_TRU_RECOVERY_PARTIALS // at the substitute: trusteeID -> the partial secrets not verified yet
+	partials map[int][]kyber.Point                  // at the substitute: trusteeID -> the verified partial secrets
+	replaced bool                                   // at the substitute: true once we send the missing trustee's ciphers
+}
+
+// substituteTrustee computes the ciphers of a missing trustee, from round firstRound on
+type substituteTrustee struct {
+	trusteeID  int
+	firstRound int32
+	dcNet      *dcnet.DCNetEntity
+}
+
+// sendKeyShares shares our session private key among the trustees, such that TrusteeThreshold of them can replace us
+// if we go missing, then erases it. The shares are encrypted to the long-term key of each trustee, since they are only
+// decrypted when a trustee goes missing, and sent through the relay
+func (p *PriFiLibTrusteeInstance) sendKeyShares(trusteesPks, trusteesSessionPks []kyber.Point, sigs []net.ByteArray) error {
+	defer p.eraseSessionKey()
+	if len(trusteesPks) != p.trusteeState.nTrustees || len(trusteesSessionPks) != p.trusteeState.nTrustees || len(sigs) != p.trusteeState.nTrustees {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : expected " + strconv.Itoa(p.trusteeState.nTrustees) +
+			" trustees public keys and signed session keys")
+	}
+	if !trusteesPks[p.trusteeState.ID].Equal(p.trusteeState.PublicKey) {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : our public key is not in the list of trustees")
+	}
+	if p.trusteeState.sessionPrivateKey == nil || !trusteesSessionPks[p.trusteeState.ID].Equal(p.trusteeState.SessionPublicKey) {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : our session key is not in the list of trustees")
+	}
+	// the relay cannot make us accept shares of another key than the session key of a trustee
+	for m := range trusteesSessionPks {
+		err := crypto.VerifySessionKey(p.trusteeState.CryptoSuite, trusteesPks[m], crypto.SessionKeyTrustee, m, p.trusteeState.SessionNonce,
+			trusteesSessionPks[m], sigs[m].Bytes)
+		if err != nil {
+			return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : invalid session key of trustee " + strconv.Itoa(m) + ", " + err.Error())
+		}
+	}
+	p.trusteeState.TrusteesPks = trusteesPks
+	p.trusteeState.TrusteesSessionPks = trusteesSessionPks
+
+	encryptedShares, commitments, err := crypto.ShareKey(p.trusteeState.CryptoSuite, p.trusteeState.sessionPrivateKey, p.trusteeState.TrusteeThreshold, trusteesPks)
+	if err != nil {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : could not share our key, " + err.Error())
+	}
+
+	toSend := &net.TRU_REL_KEY_SHARES{
+		TrusteeID:       p.trusteeState.ID,
+		EncryptedShares: make([]net.ByteArray, len(encryptedShares)),
+		Commitments:     commitments,
+	}
+	for m, s := range encryptedShares {
+		toSend.EncryptedShares[m] = net.ByteArray{Bytes: s}
+	}
+	p.messageSender.SendToRelayWithLog(toSend, "")
+	return nil
+}
+
+/*
+Received_REL_TRU_RECOVER_TRUSTEE handles REL_TRU_RECOVER_TRUSTEE messages. Those are sent by the relay when a trustee
+is missing. We do not take the relay's word for it: we ping the missing trustee ourselves, and only if it does not
+answer in time, we send the partial secrets computed with our share of its key to the substitute trustee.
+*/
+func (p *PriFiLibTrusteeInstance) Received_REL_TRU_RECOVER_TRUSTEE(msg net.REL_TRU_RECOVER_TRUSTEE) error {
+	if p.trusteeState.TrusteeThreshold == 0 {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : asked to recover a trustee, but we are not threshold trustees")
+	}
+	j := msg.MissingTrusteeID
+	if j < 0 || j >= len(p.trusteeState.TrusteesPks) || j == p.trusteeState.ID {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : asked to recover invalid trustee " + strconv.Itoa(j))
+	}
+	if s := msg.SubstituteTrusteeID; s < 0 || s >= len(p.trusteeState.TrusteesPks) || s == j {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : invalid substitute " + strconv.Itoa(s) + " for trustee " + strconv.Itoa(j))
+	}
+	if msg.FirstRoundID < 0 {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : invalid first round " + strconv.Itoa(int(msg.FirstRoundID)) + " for the substitute")
+	}
+
+	// the relay cannot make us compute partial secrets for a key that is not the missing trustee's
+	if err := crypto.CheckKeySharing(p.trusteeState.TrusteesSessionPks[j], msg.Commitments, p.trusteeState.TrusteeThreshold); err != nil {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : invalid key sharing of trustee " + strconv.Itoa(j) + ", " + err.Error())
+	}
+
+	p.trusteeState.recoveryLock.Lock()
+	defer p.trusteeState.recoveryLock.Unlock()
+	r := p.recovery(j)
+	if r.request != nil {
+		log.Lvl2("Trustee", p.trusteeState.ID, ": already asked to recover trustee", j)
+		return nil
+	}
+	r.request = &msg
+
+	log.Lvl1("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : asked to recover trustee " + strconv.Itoa(j) + ", checking that it is missing")
+	p.messageSender.SendToTrusteeWithLog(j, &net.TRU_TRU_PING{TrusteeID: p.trusteeState.ID}, "")
+	time.AfterFunc(p.trusteeState.absenceTimeout, func() { p.missingTrusteeTimeout(j, r) })
+	return nil
+}
+
+// recovery returns the replacement of trustee j, creating it if needed. Must be called with recoveryLock
+func (p *PriFiLibTrusteeInstance) recovery(j int) *trusteeRecovery {
+	r, found := p.trusteeState.recoveries[j]
+	if !found {
+		r = &trusteeRecovery{
+			received: make(map[int]*net.TRU_TRU_RECOVERY_PARTIALS),
+			partials: make(map[int][]kyber.Point),
+		}
+		p.trusteeState.recoveries[j] = r
+	}
+	return r
+}
+
+// missingTrusteeTimeout is called when trustee j had the time to answer our ping. If it did not, it is missing, and
+// we send our partial secrets
+func (p *PriFiLibTrusteeInstance) missingTrusteeTimeout(j int, r *trusteeRecovery) {
+	p.trusteeState.recoveryLock.Lock()
+	defer p.trusteeState.recoveryLock.Unlock()
+	if p.trusteeState.recoveries[j] != r {
+		return // the session changed
+	}
+	if r.alive {
+		log.Error("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : trustee " + strconv.Itoa(j) + " answers us, refusing to replace it")
+		delete(p.trusteeState.recoveries, j)
+		return
+	}
+	r.absent = true
+
+	log.Lvl1("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : trustee " + strconv.Itoa(j) + " did not answer, sending our partial secrets to trustee " +
+		strconv.Itoa(r.request.SubstituteTrusteeID))
+	if err := p.sendRecoveryPartials(j, r); err != nil {
+		log.Error(err)
+	}
+}
+
+// sendRecoveryPartials computes the partial secrets of trustee j with our share of its key, and sends them to the
+// substitute. Must be called with recoveryLock
+func (p *PriFiLibTrusteeInstance) sendRecoveryPartials(j int, r *trusteeRecovery) error {
+	suite := p.trusteeState.CryptoSuite
+	share, err := crypto.DecryptKeyShare(suite, p.trusteeState.privateKey, p.trusteeState.ID, r.request.EncryptedShare, r.request.Commitments)
+	if err != nil {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : invalid share of trustee " + strconv.Itoa(j) + ", " + err.Error())
+	}
+	partials, proofs, err := crypto.PartialDHSecrets(suite, share, p.trusteeState.ClientSessionPublicKeys)
+	share.V.Zero()
+	if err != nil {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : could not compute the partial secrets, " + err.Error())
+	}
+
+	substituteID := r.request.SubstituteTrusteeID
+	if substituteID == p.trusteeState.ID {
+		r.partials[p.trusteeState.ID] = partials
+		return p.replaceTrustee(j, r)
+	}
+	encrypted, err := crypto.EncryptPartialDHSecrets(suite, p.trusteeState.TrusteesPks[substituteID], partials, proofs)
+	if err != nil {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : could not encrypt the partial secrets, " + err.Error())
+	}
+	toSend := &net.TRU_TRU_RECOVERY_PARTIALS{
+		TrusteeID:         p.trusteeState.ID,
+		MissingTrusteeID:  j,
+		EncryptedPartials: encrypted,
+	}
+	p.messageSender.SendToTrusteeWithLog(substituteID, toSend, "")
+	return nil
+}
+
+/*
+Received_TRU_TRU_PING handles TRU_TRU_PING messages. Another trustee checks that we are online.
+*/
+func (p *PriFiLibTrusteeInstance) Received_TRU_TRU_PING(msg net.TRU_TRU_PING) error {
+	if msg.TrusteeID < 0 || msg.TrusteeID >= p.trusteeState.nTrustees || msg.TrusteeID == p.trusteeState.ID {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : ping from invalid trustee " + strconv.Itoa(msg.TrusteeID))
+	}
+	p.messageSender.SendToTrusteeWithLog(msg.TrusteeID, &net.TRU_TRU_PONG{TrusteeID: p.trusteeState.ID}, "")
+	return nil
+}
+
+/*
+Received_TRU_TRU_PONG handles TRU_TRU_PONG messages. A trustee we were asked to replace is online.
+*/
+func (p *PriFiLibTrusteeInstance) Received_TRU_TRU_PONG(msg net.TRU_TRU_PONG) error {
+	p.trusteeState.recoveryLock.Lock()
+	defer p.trusteeState.recoveryLock.Unlock()
+	if r, found := p.trusteeState.recoveries[msg.TrusteeID]; found && r.request != nil && !r.absent {
+		r.alive = true
+	}
+	return nil
+}
+
+/*
+Received_TRU_TRU_RECOVERY_PARTIALS handles TRU_TRU_RECOVERY_PARTIALS messages. We are the substitute of a missing
+trustee, and another trustee sends us the partial secrets computed with its share. Once we checked ourselves that the
+trustee is missing, and we have TrusteeThreshold valid partial secrets, we recover its secrets and send its ciphers.
+*/
+func (p *PriFiLibTrusteeInstance) Received_TRU_TRU_RECOVERY_PARTIALS(msg net.TRU_TRU_RECOVERY_PARTIALS) error {
+	if p.trusteeState.TrusteeThreshold == 0 {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : received partial secrets, but we are not threshold trustees")
+	}
+	j, m := msg.MissingTrusteeID, msg.TrusteeID
+	if j < 0 || j >= len(p.trusteeState.TrusteesPks) || j == p.trusteeState.ID {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : received partial secrets of invalid trustee " + strconv.Itoa(j))
+	}
+	if m < 0 || m >= len(p.trusteeState.TrusteesPks) || m == j || m == p.trusteeState.ID {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : partial secrets from invalid trustee " + strconv.Itoa(m))
+	}
+
+	p.trusteeState.recoveryLock.Lock()
+	defer p.trusteeState.recoveryLock.Unlock()
+	r := p.recovery(j)
+	if r.request != nil && r.request.SubstituteTrusteeID != p.trusteeState.ID {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : received partial secrets of trustee " + strconv.Itoa(j) + ", but we are not its substitute")
+	}
+	if r.replaced {
+		log.Lvl3("Trustee", p.trusteeState.ID, ": trustee", j, "already replaced, ignoring the partial secrets of trustee", m)
+		return nil
+	}
+	r.received[m] = &msg
+
+	log.Lvl2("Trustee", p.trusteeState.ID, ": received partial secrets of trustee", j, "from trustee", m)
+	return p.replaceTrustee(j, r)
+}
+
+// replaceTrustee recovers the secrets of trustee j, if we checked it is missing and have enough partial secrets, and
+// starts sending its ciphers. Must be called with recoveryLock
+func (p *PriFiLibTrusteeInstance) replaceTrustee(j int, r *trusteeRecovery) error {
+	if r.replaced || r.request == nil || !r.absent {
+		return nil
+	}
+
+	// the partial secrets that arrived before the relay's request can only be verified now
+	suite := p.trusteeState.CryptoSuite
+	for m, msg := range r.received {
+		delete(r.received, m)
+		partials, proofs, err := crypto.DecryptPartialDHSecrets(suite, p.trusteeState.privateKey, msg.EncryptedPartials, len(p.trusteeState.ClientSessionPublicKeys))
+		if err == nil {
+			err = crypto.VerifyPartialDHSecrets(suite, m, r.request.Commitments, p.trusteeState.ClientSessionPublicKeys, partials, proofs)
+		}
+		if err != nil {
+			log.Error("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : invalid partial secrets of trustee " + strconv.Itoa(j) + " from trustee " + strconv.Itoa(m) + ", " + err.Error())
+			continue
+		}
+		r.partials[m] = partials
+	}
+	if len(r.partials) < p.trusteeState.TrusteeThreshold {
+		return nil
+	}
+
+	sharedSecrets, err := crypto.RecoverDHSecrets(suite, r.partials, p.trusteeState.TrusteeThreshold, p.trusteeState.nTrustees)
+	for _, partials := range r.partials {
+		for _, partial := range partials {
+			partial.Null()
+		}
+	}
+	r.partials = make(map[int][]kyber.Point)
+	if err != nil {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : could not recover the secrets of trustee " + strconv.Itoa(j) + ", " + err.Error())
+	}
+	substitute := &substituteTrustee{
+		trusteeID:  j,
+		firstRound: r.request.FirstRoundID,
+		dcNet:      p.newSubstituteDCNet(j, sharedSecrets),
+	}
+	for _, secret := range sharedSecrets {
+		secret.Null()
+	}
+	r.replaced = true
+
+	select {
+	case p.trusteeState.substitutes <- substitute:
+	default:
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : too many substitutes pending, cannot replace trustee " + strconv.Itoa(j))
+	}
+	log.Lvl1("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : recovered the secrets of trustee " + strconv.Itoa(j) + ", sending its ciphers from now on")
+	p.messageSender.SendToRelayWithLog(&net.TRU_REL_TRUSTEE_REPLACED{TrusteeID: p.trusteeState.ID, MissingTrusteeID: j}, "")
+	return nil
+}
+
+// newSubstituteDCNet returns a DC-net trustee computing the ciphers of trustee j from its shared secrets
+func (p *PriFiLibTrusteeInstance) newSubstituteDCNet(j int, sharedSecrets []kyber.Point) *dcnet.DCNetEntity {
+	substitute := dcnet.NewDCNetEntity(j, dcnet.DCNET_TRUSTEE, p.trusteeState.PayloadSize,
+		p.trusteeState.EquivocationProtectionEnabled, sharedSecrets, p.trusteeState.CryptoSuite)
+	substitute.SetParallelism(p.trusteeState.DCNetParallelism)
+	substitute.SetPRG(p.trusteeState.DCNetPRG)
+	substitute.SetSessionContext(dcnet.SessionContext{Nonce: p.trusteeState.SessionNonce, EpochLength: int32(p.trusteeState.DCNetEpochLength)})
+	substitute.EraseSharedKeys()
+	if v := p.trusteeState.DCNet.GetVerifiableDCNet(); v != nil {
+		// the trustees' ciphers only depend on the public parameters of the verifiable DC-net
+		substitute.SetVerifiableDCNet(v)
+	}
+	return substitute
+}
+
+// sendSubstituteData computes the cipher of the trustee we replace for this round, and sends it as its own
+func sendSubstituteData(p *PriFiLibTrusteeInstance, s *substituteTrustee, roundID int32) {
+	toSend := &net.TRU_REL_DC_CIPHER{
+		RoundID:   roundID,
+		TrusteeID: s.trusteeID,
+		Data:      s.dcNet.TrusteeEncodeForRound(roundID)}
+	p.messageSender.SendToRelayWithLog(toSend, "(round "+strconv.Itoa(int(roundID))+", replacing trustee "+strconv.Itoa(s.trusteeID)+")")
+}
@@ -0,0 +1,189 @@
+package trustee
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/dedis/prifi/prifi-lib/config"
+	"github.com/dedis/prifi/prifi-lib/crypto"
+	"github.com/dedis/prifi/prifi-lib/dcnet"
+	"github.com/dedis/prifi/prifi-lib/net"
+	"go.dedis.ch/kyber/v3"
+)
+
+func TestTrusteeReplacement(t *testing.T) {
+
+	nClients := 2
+	nTrustees := 3
+	threshold := 2
+	payloadSize := 100
+	absenceTimeout := 50 * time.Millisecond
+	suite := config.CryptoSuite
+	prg, _ := dcnet.NewPRG("", suite)
+	ctx := dcnet.SessionContext{Nonce: dcnet.NewSessionNonce(), EpochLength: 4}
+
+	// the DC-net secrets are shared by the session keys
+	clientPks := make([]kyber.Point, nClients)
+	clientSessionPks := make([]kyber.Point, nClients)
+	for i := range clientPks {
+		clientPks[i], _ = crypto.NewKeyPair(suite)
+		clientSessionPks[i], _ = crypto.NewKeyPair(suite)
+	}
+	trustees := make([]*PriFiLibTrusteeInstance, nTrustees)
+	senders := make([]*TestMessageSender, nTrustees)
+	trusteePks := make([]kyber.Point, nTrustees)
+	trusteeSessionPks := make([]kyber.Point, nTrustees)
+	trusteeSessionSigs := make([]net.ByteArray, nTrustees)
+	for j := range trustees {
+		senders[j] = &TestMessageSender{sentToRelay: make(chan interface{}, 15), sentToTrustee: make(chan sentToTrustee, 15)}
+		trustees[j] = NewTrustee(false, false, 1000, newTestMessageSenderWrapper(senders[j]))
+		ts := trustees[j].trusteeState
+		trusteePks[j] = ts.PublicKey
+		var sig []byte
+		var err error
+		ts.SessionPublicKey, ts.sessionPrivateKey, sig, err = crypto.NewSessionKeyPair(suite, ts.privateKey, crypto.SessionKeyTrustee, j, ctx.Nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		trusteeSessionPks[j] = ts.SessionPublicKey
+		trusteeSessionSigs[j] = net.ByteArray{Bytes: sig}
+	}
+	for j, trustee := range trustees {
+		ts := trustee.trusteeState
+		ts.ID = j
+		ts.nClients = nClients
+		ts.nTrustees = nTrustees
+		ts.PayloadSize = payloadSize
+		ts.EquivocationProtectionEnabled = true
+		ts.DCNetPRG = prg
+		ts.SessionNonce = ctx.Nonce
+		ts.DCNetEpochLength = int(ctx.EpochLength)
+		ts.TrusteeThreshold = threshold
+		ts.ClientPublicKeys = clientPks
+		ts.ClientSessionPublicKeys = clientSessionPks
+		ts.absenceTimeout = absenceTimeout
+		sharedSecrets := make([]kyber.Point, nClients)
+		for i := range sharedSecrets {
+			sharedSecrets[i] = suite.Point().Mul(ts.sessionPrivateKey, clientSessionPks[i])
+		}
+		ts.DCNet = dcnet.NewDCNetEntity(j, dcnet.DCNET_TRUSTEE, payloadSize, true, sharedSecrets, suite)
+		ts.DCNet.SetSessionContext(ctx)
+	}
+
+	// the trustees only share session keys signed by the trustees
+	forgedSigs := append([]net.ByteArray{}, trusteeSessionSigs...)
+	forgedSigs[2] = trusteeSessionSigs[1]
+	if err := trustees[1].sendKeyShares(trusteePks, trusteeSessionPks, forgedSigs); err == nil {
+		t.Error("Trustee 1 should refuse a session key not signed by trustee 2")
+	}
+	if trustees[1].trusteeState.sessionPrivateKey != nil {
+		t.Error("Trustee 1 should have erased its session key anyway")
+	}
+
+	// trustee 0 shares its session key and erases it, trustee 1 is its substitute
+	for _, j := range []int{0, 2} {
+		if err := trustees[j].sendKeyShares(trusteePks, trusteeSessionPks, trusteeSessionSigs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if trustees[0].trusteeState.sessionPrivateKey != nil {
+		t.Error("Trustee 0 should have erased its session key once shared")
+	}
+	sharing := (<-senders[0].sentToRelay).(*net.TRU_REL_KEY_SHARES)
+	<-senders[2].sentToRelay
+	// trustee 1 does not share its key in this test, but knows the keys of the others
+	trustees[1].trusteeState.TrusteesPks = trusteePks
+	trustees[1].trusteeState.TrusteesSessionPks = trusteeSessionPks
+	request := func(m int) net.REL_TRU_RECOVER_TRUSTEE {
+		return net.REL_TRU_RECOVER_TRUSTEE{MissingTrusteeID: 0, SubstituteTrusteeID: 1, FirstRoundID: 3,
+			EncryptedShare: sharing.EncryptedShares[m].Bytes, Commitments: sharing.Commitments}
+	}
+	sent := func(j int) *sentToTrustee {
+		select {
+		case s := <-senders[j].sentToTrustee:
+			return &s
+		case <-time.After(10 * absenceTimeout):
+			return nil
+		}
+	}
+
+	// trustees answer the pings of the others directly
+	if err := trustees[0].ReceivedMessage(net.TRU_TRU_PING{TrusteeID: 2}); err != nil {
+		t.Error(err)
+	}
+	if s := sent(0); s == nil || s.trusteeID != 2 || s.msg.(*net.TRU_TRU_PONG).TrusteeID != 0 {
+		t.Error("Trustee 0 should answer the ping of trustee 2")
+	}
+
+	// trustee 2 refuses to help replacing trustee 0 while it answers
+	if err := trustees[2].Received_REL_TRU_RECOVER_TRUSTEE(request(2)); err != nil {
+		t.Fatal(err)
+	}
+	if s := sent(2); s == nil || s.trusteeID != 0 || s.msg.(*net.TRU_TRU_PING).TrusteeID != 2 {
+		t.Fatal("Trustee 2 should check itself that trustee 0 is missing")
+	}
+	if err := trustees[2].ReceivedMessage(net.TRU_TRU_PONG{TrusteeID: 0}); err != nil {
+		t.Error(err)
+	}
+	if s := sent(2); s != nil {
+		t.Fatal("Trustee 2 should not send its partial secrets, trustee 0 is online")
+	}
+
+	// the relay asks again, trustee 0 does not answer anymore
+	if err := trustees[2].Received_REL_TRU_RECOVER_TRUSTEE(request(2)); err != nil {
+		t.Fatal(err)
+	}
+	sent(2) // the ping
+	s := sent(2)
+	if s == nil || s.trusteeID != 1 {
+		t.Fatal("Trustee 2 should send its partial secrets to the substitute")
+	}
+	partials := *s.msg.(*net.TRU_TRU_RECOVERY_PARTIALS)
+
+	// only the substitute uses the partial secrets
+	if err := trustees[2].Received_TRU_TRU_RECOVERY_PARTIALS(partials); err == nil {
+		t.Error("Trustee 2 should refuse partial secrets, it is not the substitute")
+	}
+
+	// the substitute waits for its own check before using them
+	if err := trustees[1].Received_TRU_TRU_RECOVERY_PARTIALS(partials); err != nil {
+		t.Fatal(err)
+	}
+	forged := partials
+	forged.TrusteeID = 0
+	if err := trustees[1].Received_TRU_TRU_RECOVERY_PARTIALS(forged); err == nil {
+		t.Error("Trustee 1 should refuse partial secrets from the missing trustee")
+	}
+	if len(trustees[1].trusteeState.substitutes) != 0 {
+		t.Fatal("Trustee 1 did not check that trustee 0 is missing yet")
+	}
+	if err := trustees[1].Received_REL_TRU_RECOVER_TRUSTEE(request(1)); err != nil {
+		t.Fatal(err)
+	}
+	if s := sent(1); s == nil || s.trusteeID != 0 {
+		t.Fatal("Trustee 1 should check itself that trustee 0 is missing")
+	}
+	select {
+	case msg := <-senders[1].sentToRelay:
+		if replaced := msg.(*net.TRU_REL_TRUSTEE_REPLACED); replaced.TrusteeID != 1 || replaced.MissingTrusteeID != 0 {
+			t.Error("Trustee 1 should tell the relay it replaced trustee 0")
+		}
+	case <-time.After(10 * absenceTimeout):
+		t.Fatal("Trustee 1 should have replaced trustee 0")
+	}
+
+	// the substitute computes the same ciphers as trustee 0, from round 3 on
+	substitute := <-trustees[1].trusteeState.substitutes
+	if substitute.trusteeID != 0 || substitute.firstRound != 3 {
+		t.Error("Trustee 1 should send the ciphers of trustee 0 from round 3 on")
+	}
+	for _, roundID := range []int32{3, 4, 9} {
+		// the equivocation proofs are randomized, the rest of the ciphers must match
+		c1 := dcnet.DCNetCipherFromBytes(substitute.dcNet.TrusteeEncodeForRound(roundID))
+		c2 := dcnet.DCNetCipherFromBytes(trustees[0].trusteeState.DCNet.TrusteeEncodeForRound(roundID))
+		if !bytes.Equal(c1.Payload, c2.Payload) || !bytes.Equal(c1.EquivocationProtectionTag, c2.EquivocationProtectionTag) {
+			t.Error("The substitute of trustee 0 computed a wrong cipher for round", roundID)
+		}
+	}
+}
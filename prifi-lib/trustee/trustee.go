@@ -14,8 +14,10 @@ Then, this file simple handle the answer to the different message kind :
 */
 
 import (
+	"bytes"
 	"errors"
 	"github.com/dedis/prifi/prifi-lib/config"
+	"github.com/dedis/prifi/prifi-lib/crypto"
 	"github.com/dedis/prifi/prifi-lib/dcnet"
 	"github.com/dedis/prifi/prifi-lib/net"
 	"go.dedis.ch/kyber/v3"
@@ -33,6 +35,9 @@ func (p *PriFiLibTrusteeInstance) Received_ALL_ALL_SHUTDOWN(msg net.ALL_ALL_SHUT
 
 	//stop the sending process
 	p.trusteeState.sendingRate <- TRUSTEE_KILL_SEND_PROCESS
+	if p.trusteeState.DCNet != nil {
+		p.trusteeState.DCNet.StopPadPrecomputation()
+	}
 
 	p.stateMachine.ChangeState("SHUTDOWN")
 
@@ -55,6 +60,14 @@ func (p *PriFiLibTrusteeInstance) Received_ALL_ALL_PARAMETERS(msg net.ALL_ALL_PA
 	payloadSize := msg.IntValueOrElse("PayloadSize", p.trusteeState.PayloadSize)
 	dcNetType := msg.StringValueOrElse("DCNetType", "not initilaized")
 	equivProtection := msg.BoolValueOrElse("EquivocationProtectionEnabled", false)
+	signedReservations := msg.BoolValueOrElse("SignedReservations", false)
+	dcNetParallelism := msg.IntValueOrElse("DCNetParallelism", 0)
+	dcNetPRG := msg.StringValueOrElse("DCNetPRG", dcnet.PRG_XOF)
+	dcNetPrecomputedRounds := msg.IntValueOrElse("DCNetPrecomputedRounds", 0)
+	trusteeThreshold := msg.IntValueOrElse("TrusteeThreshold", 0)
+	sessionNonce := msg.BytesValueOrElse("SessionNonce", nil)
+	dcNetEpochLength := msg.IntValueOrElse("DCNetEpochLength", 0)
+	cryptoSuite := msg.StringValueOrElse("CryptoSuite", p.trusteeState.CryptoSuite.String())
 
 	//sanity checks
 	if trusteeID < -1 {
@@ -69,10 +82,23 @@ func (p *PriFiLibTrusteeInstance) Received_ALL_ALL_PARAMETERS(msg net.ALL_ALL_PA
 	if payloadSize < 1 {
 		return errors.New("payloadSize cannot be 0")
 	}
+	if trusteeThreshold < 0 || trusteeThreshold > nTrustees {
+		return errors.New("trusteeThreshold must be in [0, nTrustees]")
+	}
+
+	suite, err := config.FindCryptoSuite(cryptoSuite)
+	if err != nil {
+		return err
+	}
+	prg, err := dcnet.NewPRG(dcNetPRG, suite)
+	if err != nil {
+		return err
+	}
 
 	switch dcNetType {
-	case "Verifiable":
-		panic("not supported yet")
+	case "Simple", "Verifiable":
+	default:
+		return errors.New("unknown DCNetType " + dcNetType)
 	}
 
 	p.trusteeState.ID = trusteeID
@@ -82,15 +108,39 @@ func (p *PriFiLibTrusteeInstance) Received_ALL_ALL_PARAMETERS(msg net.ALL_ALL_PA
 	p.trusteeState.PayloadSize = payloadSize
 	p.trusteeState.TrusteeID = trusteeID
 	p.trusteeState.EquivocationProtectionEnabled = equivProtection
+	p.trusteeState.SignedReservations = signedReservations
+	p.trusteeState.DCNetType = dcNetType
+	p.trusteeState.DCNetParallelism = dcNetParallelism
+	p.trusteeState.DCNetPRG = prg
+	p.trusteeState.DCNetPrecomputedRounds = dcNetPrecomputedRounds
+	p.trusteeState.TrusteeThreshold = trusteeThreshold
+	p.trusteeState.SessionNonce = sessionNonce
+	p.trusteeState.DCNetEpochLength = dcNetEpochLength
+	p.trusteeState.TrusteesPks = nil
+	p.trusteeState.TrusteesSessionPks = nil
+	p.eraseSessionKey()
+	p.trusteeState.recoveryLock.Lock()
+	p.trusteeState.recoveries = make(map[int]*trusteeRecovery)
+	p.trusteeState.recoveryLock.Unlock()
+	p.trusteeState.reshuffleEpoch = 0
+	p.trusteeState.VerifiableDCNetKey = nil
+	if suite.String() != p.trusteeState.CryptoSuite.String() {
+		// our key is sent to the relay after the parameters, it must be in the suite of the session
+		p.trusteeState.PublicKey, p.trusteeState.privateKey = crypto.NewKeyPair(suite)
+	}
+	p.trusteeState.CryptoSuite = suite
+	p.trusteeState.neffShuffle.Suite = suite
 	p.trusteeState.neffShuffle.Init(trusteeID, p.trusteeState.privateKey, p.trusteeState.PublicKey)
 
-	//placeholders for pubkeys and secrets
+	//placeholders for pubkeys
 	p.trusteeState.ClientPublicKeys = make([]kyber.Point, nClients)
-	p.trusteeState.sharedSecrets = make([]kyber.Point, nClients)
+	p.trusteeState.ClientSessionPublicKeys = make([]kyber.Point, nClients)
 
 	if startNow {
 		// send our public key to the relay
-		p.Send_TRU_REL_PK()
+		if err := p.Send_TRU_REL_PK(); err != nil {
+			return err
+		}
 	}
 
 	p.stateMachine.ChangeState("INITIALIZING")
@@ -103,26 +153,74 @@ func (p *PriFiLibTrusteeInstance) Received_ALL_ALL_PARAMETERS(msg net.ALL_ALL_PA
 /*
 Send_TRU_REL_PK tells the relay's public key to the relay
 (this, of course, provides no security, but this is an early version of the protocol).
-This is the first action of the trustee.
+This is the first action of the trustee. We pick our session key at the same time: the DC-net secrets are derived from
+it, and our long-term key only signs it, so that the long-term key does not give back the pads once the session key
+is erased.
 */
 func (p *PriFiLibTrusteeInstance) Send_TRU_REL_PK() error {
-	toSend := &net.TRU_REL_TELL_PK{TrusteeID: p.trusteeState.ID, Pk: p.trusteeState.PublicKey}
+	sessionPk, sessionPriv, sig, err := crypto.NewSessionKeyPair(p.trusteeState.CryptoSuite, p.trusteeState.privateKey,
+		crypto.SessionKeyTrustee, p.trusteeState.ID, p.trusteeState.SessionNonce)
+	if err != nil {
+		e := "Trustee " + strconv.Itoa(p.trusteeState.ID) + " : could not create our session key, " + err.Error()
+		log.Error(e)
+		return errors.New(e)
+	}
+	p.eraseSessionKey()
+	p.trusteeState.SessionPublicKey, p.trusteeState.sessionPrivateKey = sessionPk, sessionPriv
+
+	toSend := &net.TRU_REL_TELL_PK{
+		TrusteeID:    p.trusteeState.ID,
+		Pk:           p.trusteeState.PublicKey,
+		SessionPk:    sessionPk,
+		SessionPkSig: sig,
+	}
 	p.messageSender.SendToRelayWithLog(toSend, "")
 	return nil
 }
 
+// eraseSessionKey forgets our session private key, the secrets of the session cannot be derived anymore
+func (p *PriFiLibTrusteeInstance) eraseSessionKey() {
+	if p.trusteeState.sessionPrivateKey != nil {
+		p.trusteeState.sessionPrivateKey.Zero()
+		p.trusteeState.sessionPrivateKey = nil
+	}
+}
+
 /*
 Send_TRU_REL_DC_CIPHER sends DC-net ciphers to the relay continuously once started.
-One can control the rate by sending flags to "rateChan".
+One can control the rate by sending flags to "rateChan". The rounds the relay skips are received on
+p.trusteeState.skippedRounds, and no cipher is sent for them. The trustees we replace are received on
+p.trusteeState.substitutes, and their ciphers are sent along with ours.
 */
 func (p *PriFiLibTrusteeInstance) Send_TRU_REL_DC_CIPHER(rateChan chan int16) {
 
 	stop := false
 	currentRate := TRUSTEE_RATE_ACTIVE
 	roundID := int32(0)
+	committedEpoch := int32(-1) // the last key epoch whose seeds we committed to
+
+	//the skipped rounds of a previous session do not apply to this one
+	skipped := make([]net.REL_TRU_TELL_SKIPPED_ROUNDS, 0)
+	for len(p.trusteeState.skippedRounds) > 0 {
+		<-p.trusteeState.skippedRounds
+	}
+	substitutes := make([]*substituteTrustee, 0)
+	for len(p.trusteeState.substitutes) > 0 {
+		<-p.trusteeState.substitutes
+	}
 
 	for !stop {
 		select {
+		case s := <-p.trusteeState.skippedRounds:
+			skipped = append(skipped, s)
+
+		case s := <-p.trusteeState.substitutes:
+			// the relay waits for the ciphers the missing trustee did not send
+			substitutes = append(substitutes, s)
+			for r := s.firstRound; r < roundID; r++ {
+				sendSubstituteData(p, s, r)
+			}
+
 		case newRate := <-rateChan:
 
 			if currentRate != newRate {
@@ -144,10 +242,18 @@ func (p *PriFiLibTrusteeInstance) Send_TRU_REL_DC_CIPHER(rateChan chan int16) {
 					log.Lvl4("Trustee " + strconv.Itoa(p.trusteeState.ID) + " rate FULL, sleeping for " + strconv.Itoa(p.trusteeState.BaseSleepTime))
 					time.Sleep(time.Duration(p.trusteeState.BaseSleepTime) * time.Millisecond)
 				}
+				roundID, skipped = skipRounds(roundID, skipped)
+				if epoch := p.trusteeState.DCNet.EpochOfRound(roundID); epoch > committedEpoch {
+					p.sendSeedCommitments(roundID)
+					committedEpoch = epoch
+				}
 				newRoundID, err := sendData(p, roundID)
 				if err != nil {
 					stop = true
 				}
+				for _, s := range substitutes {
+					sendSubstituteData(p, s, roundID)
+				}
 				roundID = newRoundID
 
 			} else if currentRate == TRUSTEE_RATE_HALVED {
@@ -188,12 +294,55 @@ func (p *PriFiLibTrusteeInstance) Received_REL_TRU_TELL_RATE_CHANGE(msg net.REL_
 	return nil
 }
 
+/*
+Received_REL_TRU_TELL_SKIPPED_ROUNDS handles REL_TRU_TELL_SKIPPED_ROUNDS messages. All slots are closed, and the relay
+will not open those rounds; we do not compute their ciphers. The ciphers we already sent for them are discarded.
+*/
+func (p *PriFiLibTrusteeInstance) Received_REL_TRU_TELL_SKIPPED_ROUNDS(msg net.REL_TRU_TELL_SKIPPED_ROUNDS) error {
+	if msg.LastRound < msg.FirstRound {
+		return errors.New("Trustee " + strconv.Itoa(p.trusteeState.ID) + " : invalid skipped rounds " +
+			strconv.Itoa(int(msg.FirstRound)) + " to " + strconv.Itoa(int(msg.LastRound)))
+	}
+	log.Lvl3("Trustee", p.trusteeState.ID, ": the relay skips rounds", msg.FirstRound, "to", msg.LastRound)
+
+	select {
+	case p.trusteeState.skippedRounds <- msg:
+	default:
+		// we only waste the computation of those ciphers
+		log.Lvl2("Trustee", p.trusteeState.ID, ": too many skipped rounds pending, sending the ciphers of rounds", msg.FirstRound, "to", msg.LastRound, "anyway")
+	}
+	return nil
+}
+
+// skipRounds returns the first round from roundID on that is not skipped, and the skipped rounds still ahead
+func skipRounds(roundID int32, skipped []net.REL_TRU_TELL_SKIPPED_ROUNDS) (int32, []net.REL_TRU_TELL_SKIPPED_ROUNDS) {
+	for moved := true; moved; {
+		moved = false
+		for _, s := range skipped {
+			if s.FirstRound <= roundID && roundID <= s.LastRound {
+				roundID = s.LastRound + 1
+				moved = true
+			}
+		}
+	}
+	ahead := skipped[:0]
+	for _, s := range skipped {
+		if s.LastRound >= roundID {
+			ahead = append(ahead, s)
+		}
+	}
+	return roundID, ahead
+}
+
 /*
 sendData is an auxiliary function used by Send_TRU_REL_DC_CIPHER. It computes the DC-net's cipher and sends it.
 It returns the new round number (previous + 1).
 */
 func sendData(p *PriFiLibTrusteeInstance, roundID int32) (int32, error) {
 	data := p.trusteeState.DCNet.TrusteeEncodeForRound(roundID)
+	if p.trusteeState.DCNetPrecomputedRounds > 0 && roundID%1000 == 0 {
+		log.Lvl2("Trustee", p.trusteeState.ID, ":", p.trusteeState.DCNet.PadPrecomputationStats())
+	}
 	//send the data
 	toSend := &net.TRU_REL_DC_CIPHER{
 		RoundID:   roundID,
@@ -209,8 +358,8 @@ func sendData(p *PriFiLibTrusteeInstance, roundID int32) (int32, error) {
 /*
 Received_REL_TRU_TELL_CLIENTS_PKS_AND_EPH_PKS_AND_BASE handles REL_TRU_TELL_CLIENTS_PKS_AND_EPH_PKS_AND_BASE messages.
 Those are sent when the connection to a relay is established.
-They contain the long-term and ephemeral public keys of the clients,
-and a base given by the relay. In addition to deriving the secrets,
+They contain the long-term, session and ephemeral public keys of the clients,
+and a base given by the relay. In addition to deriving the secrets from the session keys,
 the trustee uses the ephemeral keys to perform a Neff shuffle. It remembers
 this shuffle in order to check the correctness of the chain of shuffle afterwards.
 */
@@ -236,18 +385,61 @@ func (p *PriFiLibTrusteeInstance) Received_REL_TRU_TELL_CLIENTS_PKS_AND_EPH_PKS_
 		log.Error(e)
 		return errors.New(e)
 	}
+	if len(msg.SessionPks) != len(clientsPks) || len(msg.SessionPkSigs) != len(clientsPks) {
+		e := "Trustee " + strconv.Itoa(p.trusteeState.ID) + " : expected one signed session key per client"
+		log.Error(e)
+		return errors.New(e)
+	}
+	if p.trusteeState.sessionPrivateKey == nil {
+		e := "Trustee " + strconv.Itoa(p.trusteeState.ID) + " : our session key is already erased, the secrets of this session cannot be derived again"
+		log.Error(e)
+		return errors.New(e)
+	}
+
+	//the relay cannot substitute the session keys of the clients, they are signed by their long-term keys
+	for i := 0; i < len(clientsPks); i++ {
+		err := crypto.VerifySessionKey(p.trusteeState.CryptoSuite, clientsPks[i], crypto.SessionKeyClient, i, p.trusteeState.SessionNonce,
+			msg.SessionPks[i], msg.SessionPkSigs[i].Bytes)
+		if err != nil {
+			e := "Trustee " + strconv.Itoa(p.trusteeState.ID) + " : invalid session key of client " + strconv.Itoa(i) + ", " + err.Error()
+			log.Error(e)
+			return errors.New(e)
+		}
+	}
 
 	//fill in the clients keys
+	sharedSecrets := make([]kyber.Point, len(clientsPks))
 	for i := 0; i < len(clientsPks); i++ {
 		p.trusteeState.ClientPublicKeys[i] = clientsPks[i]
-		p.trusteeState.sharedSecrets[i] = config.CryptoSuite.Point().Mul(p.trusteeState.privateKey, clientsPks[i])
+		p.trusteeState.ClientSessionPublicKeys[i] = msg.SessionPks[i]
+		sharedSecrets[i] = p.trusteeState.CryptoSuite.Point().Mul(p.trusteeState.sessionPrivateKey, msg.SessionPks[i])
 	}
 
+	if p.trusteeState.DCNet != nil {
+		p.trusteeState.DCNet.StopPadPrecomputation()
+	}
 	p.trusteeState.DCNet = dcnet.NewDCNetEntity(p.trusteeState.ID, dcnet.DCNET_TRUSTEE,
-		p.trusteeState.PayloadSize, p.trusteeState.EquivocationProtectionEnabled, p.trusteeState.sharedSecrets)
+		p.trusteeState.PayloadSize, p.trusteeState.EquivocationProtectionEnabled, sharedSecrets, p.trusteeState.CryptoSuite)
+	p.trusteeState.DCNet.SetParallelism(p.trusteeState.DCNetParallelism)
+	p.trusteeState.DCNet.SetPRG(p.trusteeState.DCNetPRG)
+	p.trusteeState.DCNet.SetSessionContext(dcnet.SessionContext{Nonce: p.trusteeState.SessionNonce, EpochLength: int32(p.trusteeState.DCNetEpochLength)})
+
+	//the chain keys of the first epoch are derived, the shared secrets would give back every pad of the session
+	p.trusteeState.DCNet.EraseSharedKeys()
+	for _, secret := range sharedSecrets {
+		secret.Null()
+	}
+	//and so would our session key; threshold trustees first share it, see sendKeyShares
+	if p.trusteeState.TrusteeThreshold == 0 {
+		p.eraseSessionKey()
+	}
 
 	//In case we use the simple dcnet, vkey isn't needed
 	vkey := make([]byte, 1)
+	if p.trusteeState.DCNetType == "Verifiable" {
+		vkey = dcnet.NewVerifiableDCNetKey(p.trusteeState.CryptoSuite)
+		p.trusteeState.VerifiableDCNetKey = vkey
+	}
 
 	toSend, err := p.trusteeState.neffShuffle.ReceivedShuffleFromRelay(msg.Base, msg.EphPks, true, vkey)
 	if err != nil {
@@ -271,11 +463,24 @@ If everything succeed, starts the goroutine for sending DC-net ciphers to the re
 */
 func (p *PriFiLibTrusteeInstance) Received_REL_TRU_TELL_TRANSCRIPT(msg net.REL_TRU_TELL_TRANSCRIPT) error {
 
-	toSend, err := p.trusteeState.neffShuffle.ReceivedTranscriptFromRelay(msg.Bases, msg.GetKeys(), msg.GetProofs())
+	toSend, err := p.trusteeState.neffShuffle.ReceivedTranscriptFromRelay(msg.InitialEphPks, msg.Bases, msg.GetKeys(), msg.GetProofs())
 	if err != nil {
 		return errors.New("Could not do ReceivedTranscriptFromRelay, error is " + err.Error())
 	}
 
+	if p.trusteeState.DCNetType == "Verifiable" {
+		if err := p.setupVerifiableDCNet(msg); err != nil {
+			return err
+		}
+	}
+
+	// threshold trustees share their session key, before signing
+	if p.trusteeState.TrusteeThreshold > 0 {
+		if err := p.sendKeyShares(msg.TrusteesPks, msg.TrusteesSessionPks, msg.TrusteesSessionPkSigs); err != nil {
+			return err
+		}
+	}
+
 	//send the answer
 	p.messageSender.SendToRelayWithLog(toSend, "")
 
@@ -284,8 +489,40 @@ func (p *PriFiLibTrusteeInstance) Received_REL_TRU_TELL_TRANSCRIPT(msg net.REL_T
 
 	p.stateMachine.ChangeState("READY")
 
-	//everything is ready, we start sending
+	//everything is ready, we start sending; the pads are prepared ahead in the background
+	p.trusteeState.DCNet.StartPadPrecomputation(p.trusteeState.DCNetPrecomputedRounds)
 	go p.Send_TRU_REL_DC_CIPHER(p.trusteeState.sendingRate)
 
 	return nil
 }
+
+/*
+setupVerifiableDCNet checks that our share of the commitment base is part of the transcript,
+and switches our DC-net to the verifiable one using the combined commitment base.
+*/
+func (p *PriFiLibTrusteeInstance) setupVerifiableDCNet(msg net.REL_TRU_TELL_TRANSCRIPT) error {
+	keys := msg.GetVerifiableDCNetKeys()
+
+	ownKeyFound := false
+	for _, k := range keys {
+		if bytes.Equal(k, p.trusteeState.VerifiableDCNetKey) {
+			ownKeyFound = true
+		}
+	}
+	if !ownKeyFound {
+		e := "Trustee " + strconv.Itoa(p.trusteeState.ID) + " : could not locate our verifiable DC-net key in the transcript"
+		log.Error(e)
+		return errors.New(e)
+	}
+
+	H, err := dcnet.CombineVerifiableDCNetKeys(p.trusteeState.CryptoSuite, keys)
+	if err != nil {
+		e := "Trustee " + strconv.Itoa(p.trusteeState.ID) + " : " + err.Error()
+		log.Error(e)
+		return errors.New(e)
+	}
+
+	// trustees only need the commitment base
+	p.trusteeState.DCNet.SetVerifiableDCNet(dcnet.NewVerifiableDCNet(p.trusteeState.CryptoSuite, H, nil, nil, nil, -1))
+	return nil
+}
@@ -1,14 +1,17 @@
 package trustee
 
 import (
+	"bytes"
 	"errors"
 	"testing"
 
 	"github.com/dedis/prifi/prifi-lib/config"
 	"github.com/dedis/prifi/prifi-lib/crypto"
+	"github.com/dedis/prifi/prifi-lib/dcnet"
 	"github.com/dedis/prifi/prifi-lib/net"
 	"github.com/dedis/prifi/prifi-lib/scheduler"
 	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/suites"
 	"go.dedis.ch/onet/v3/log"
 	"time"
 )
@@ -17,14 +20,24 @@ import (
  * Message Sender
  */
 type TestMessageSender struct {
-	sentToRelay chan interface{}
+	sentToRelay   chan interface{}
+	sentToTrustee chan sentToTrustee // only threshold trustees send to other trustees
+}
+
+type sentToTrustee struct {
+	trusteeID int
+	msg       interface{}
 }
 
 func (t *TestMessageSender) SendToClient(i int, msg interface{}) error {
 	return errors.New("Trustees should never sent to clients")
 }
 func (t *TestMessageSender) SendToTrustee(i int, msg interface{}) error {
-	return errors.New("Trustees should never sent to other trustees")
+	if t.sentToTrustee == nil {
+		return errors.New("Trustees should never sent to other trustees")
+	}
+	t.sentToTrustee <- sentToTrustee{i, msg}
+	return nil
 }
 
 func (t *TestMessageSender) SendToRelay(msg interface{}) error {
@@ -55,6 +68,24 @@ func newTestMessageSenderWrapper(msgSender net.MessageSender) *net.MessageSender
 	return msw
 }
 
+// addClientsSessionKeys adds the session keys of the clients, signed by their long-term keys, to the keys sent to the
+// trustee, and returns the session private keys
+func addClientsSessionKeys(t *testing.T, suite suites.Suite, msg *net.REL_TRU_TELL_CLIENTS_PKS_AND_EPH_PKS_AND_BASE, clientPrivKeys []kyber.Scalar, nonce []byte) []kyber.Scalar {
+	sessionPrivKeys := make([]kyber.Scalar, len(clientPrivKeys))
+	msg.SessionPks = make([]kyber.Point, len(clientPrivKeys))
+	msg.SessionPkSigs = make([]net.ByteArray, len(clientPrivKeys))
+	for i, priv := range clientPrivKeys {
+		pk, sessionPriv, sig, err := crypto.NewSessionKeyPair(suite, priv, crypto.SessionKeyClient, i, nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessionPrivKeys[i] = sessionPriv
+		msg.SessionPks[i] = pk
+		msg.SessionPkSigs[i] = net.ByteArray{Bytes: sig}
+	}
+	return sessionPrivKeys
+}
+
 func TestTrustee(t *testing.T) {
 
 	msgSender := new(TestMessageSender)
@@ -135,14 +166,12 @@ func TestTrustee(t *testing.T) {
 	if len(ts.ClientPublicKeys) != nClients {
 		t.Error("Len(TrusteePKs) should be equal to NTrustees")
 	}
-	if len(ts.sharedSecrets) != nClients {
-		t.Error("Len(SharedSecrets) should be equal to NTrustees")
-	}
 	if trustee.stateMachine.State() != "INITIALIZING" {
 		t.Error("Trustee should be in state INITIALIZING")
 	}
 
 	//Should send a TRU_REL_TELL_PK
+	var mySessionPk kyber.Point
 	select {
 	case msg3 := <-msgSender.sentToRelay:
 		msg3_parsed := msg3.(*net.TRU_REL_TELL_PK)
@@ -152,19 +181,24 @@ func TestTrustee(t *testing.T) {
 		if !msg3_parsed.Pk.Equal(ts.PublicKey) {
 			t.Error("Trustee did not send his public key")
 		}
+		if err := crypto.VerifySessionKey(config.CryptoSuite, ts.PublicKey, crypto.SessionKeyTrustee, trusteeID, ts.SessionNonce,
+			msg3_parsed.SessionPk, msg3_parsed.SessionPkSig); err != nil {
+			t.Error("Trustee did not sign his session key,", err)
+		}
+		mySessionPk = msg3_parsed.SessionPk
 	default:
 		t.Error("Trustee should have sent a TRU_REL_TELL_PK to the relay")
 	}
 
 	//do the shuffle
 	n := new(scheduler.NeffShuffle)
-	n.Init()
+	n.Init(config.CryptoSuite)
 	n.RelayView.Init(1)
 
 	clientPubKeys := make([]kyber.Point, nClients)
 	clientPrivKeys := make([]kyber.Scalar, nClients)
 	for i := 0; i < nClients; i++ {
-		clientPubKeys[i], clientPrivKeys[i] = crypto.NewKeyPair()
+		clientPubKeys[i], clientPrivKeys[i] = crypto.NewKeyPair(config.CryptoSuite)
 		n.RelayView.AddClient(clientPubKeys[i])
 	}
 	toSend, _, err := n.RelayView.SendToNextTrustee()
@@ -179,17 +213,38 @@ func TestTrustee(t *testing.T) {
 		msg4.Pks[i] = clientPubKeys[i]
 	}
 
+	//the relay cannot substitute the session key of a client
+	if err := trustee.ReceivedMessage(*msg4); err == nil {
+		t.Error("Trustee should refuse clients without session keys")
+	}
+	clientSessionPrivKeys := addClientsSessionKeys(t, config.CryptoSuite, msg4, clientPrivKeys, ts.SessionNonce)
+	signedPk := msg4.SessionPks[0]
+	msg4.SessionPks[0], _ = crypto.NewKeyPair(config.CryptoSuite)
+	if err := trustee.ReceivedMessage(*msg4); err == nil {
+		t.Error("Trustee should refuse a session key not signed by the client")
+	}
+	msg4.SessionPks[0] = signedPk
+
 	//we receive the shuffle
 	if err := trustee.ReceivedMessage(*msg4); err != nil {
 		t.Error("Trustee should be able to receive this message:", err)
 	}
 
+	// the shared secrets are not kept, nor is the session key, but the seeds of the first epoch are derived from them
+	if ts.sessionPrivateKey != nil {
+		t.Error("Trustee should have erased its session key")
+	}
+	r := dcnet.NewDCNetEntity(0, dcnet.DCNET_RELAY, ts.PayloadSize, false, nil, config.CryptoSuite)
+	r.SetSessionContext(dcnet.SessionContext{Nonce: ts.SessionNonce, EpochLength: int32(ts.DCNetEpochLength)})
 	for i := 0; i < nClients; i++ {
 		if !ts.ClientPublicKeys[i].Equal(clientPubKeys[i]) {
 			t.Error("Pub key", i, "has not been stored correctly")
 		}
-		myPrivKey := ts.privateKey
-		if !ts.sharedSecrets[i].Equal(config.CryptoSuite.Point().Mul(myPrivKey, clientPubKeys[i])) {
+		_, seed, err := ts.DCNet.EpochSeed(i, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(r.EpochRoundPad(seed, 0), r.RoundPad(config.CryptoSuite.Point().Mul(clientSessionPrivKeys[i], mySessionPk), i, trusteeID, 0)) {
 			t.Error("Shared secret", i, "has not been computed correctly")
 		}
 	}
@@ -243,6 +298,17 @@ func TestTrustee(t *testing.T) {
 		t.Error("Should handle this stop message, but", err)
 	}
 
+	//should have committed to the seeds of the first epoch before its first cipher
+	select {
+	case msgX := <-msgSender.sentToRelay:
+		commitments := msgX.(*net.TRU_REL_SEED_COMMITMENTS)
+		if commitments.TrusteeID != trusteeID || commitments.Epoch != 0 || len(commitments.Commitments) != nClients {
+			t.Error("TRU_REL_SEED_COMMITMENTS should commit to a seed per client in epoch 0")
+		}
+	default:
+		t.Fatal("Trustee should have sent a TRU_REL_SEED_COMMITMENTS to the relay")
+	}
+
 	//should have sent a few ciphers before getting the stop message
 	select {
 	case msg8 := <-msgSender.sentToRelay:
@@ -254,7 +320,7 @@ func TestTrustee(t *testing.T) {
 		if msg8_parsed.RoundID != 0 {
 			t.Error("TRU_REL_DC_CIPHER has the wrong round ID")
 		}
-		if len(msg8_parsed.Data) != upCellSize+8 {
+		if len(msg8_parsed.Data) != upCellSize+12 {
 			t.Error("TRU_REL_DC_CIPHER sent a payload with wrong size")
 		}
 
@@ -302,7 +368,7 @@ func TestTrustee(t *testing.T) {
 		if msg8_parsed.TrusteeID != trusteeID {
 			t.Error("TRU_REL_DC_CIPHER has the wrong trustee ID")
 		}
-		if len(msg8_parsed.Data) != upCellSize+8 {
+		if len(msg8_parsed.Data) != upCellSize+12 {
 			t.Error("TRU_REL_DC_CIPHER sent a payload with wrong size")
 		}
 
@@ -325,3 +391,139 @@ func TestTrustee(t *testing.T) {
 
 	t.SkipNow() //we started a goroutine, let's kill everything, we're good
 }
+
+func TestTrusteeCryptoSuite(t *testing.T) {
+
+	p256, err := config.FindCryptoSuite("P256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := func(cryptoSuite string) *net.ALL_ALL_PARAMETERS {
+		msg := new(net.ALL_ALL_PARAMETERS)
+		msg.ForceParams = true
+		msg.Add("StartNow", true)
+		msg.Add("NClients", 2)
+		msg.Add("NTrustees", 1)
+		msg.Add("PayloadSize", 100)
+		msg.Add("NextFreeTrusteeID", 0)
+		msg.Add("DCNetType", "Simple")
+		if cryptoSuite != "" {
+			msg.Add("CryptoSuite", cryptoSuite)
+		}
+		return msg
+	}
+
+	// two sessions in the same process, with different suites
+	msgSender := new(TestMessageSender)
+	msgSender.sentToRelay = make(chan interface{}, 15)
+	trustee := NewTrustee(false, false, 1000, newTestMessageSenderWrapper(msgSender))
+	otherSender := new(TestMessageSender)
+	otherSender.sentToRelay = make(chan interface{}, 15)
+	other := NewTrustee(false, false, 1000, newTestMessageSenderWrapper(otherSender))
+
+	if err := trustee.ReceivedMessage(*params("Curve41417")); err == nil {
+		t.Error("Trustee should refuse an unknown suite")
+	}
+	if err := trustee.ReceivedMessage(*params("P256")); err != nil {
+		t.Fatal("Trustee should be able to receive this message:", err)
+	}
+	if err := other.ReceivedMessage(*params("")); err != nil {
+		t.Fatal("Trustee should be able to receive this message:", err)
+	}
+
+	// the long-term key is regenerated in the suite of the session
+	tellPk := (<-msgSender.sentToRelay).(*net.TRU_REL_TELL_PK)
+	pk := tellPk.Pk
+	if pk.MarshalSize() != p256.PointLen() || !pk.Equal(p256.Point().Mul(trustee.trusteeState.privateKey, nil)) {
+		t.Error("Trustee should have sent a P256 public key")
+	}
+	if err := crypto.VerifySessionKey(p256, pk, crypto.SessionKeyTrustee, 0, trustee.trusteeState.SessionNonce, tellPk.SessionPk, tellPk.SessionPkSig); err != nil {
+		t.Error("Trustee should have sent a P256 session key,", err)
+	}
+	otherPk := (<-otherSender.sentToRelay).(*net.TRU_REL_TELL_PK).Pk
+	if otherPk.MarshalSize() != config.CryptoSuite.PointLen() {
+		t.Error("Trustee should have kept a key in the default suite")
+	}
+
+	// the shuffle and its signature are in the suite of the session
+	n := new(scheduler.NeffShuffle)
+	n.Init(p256)
+	n.RelayView.Init(1)
+	clientPks := make([]kyber.Point, 2)
+	clientPrivs := make([]kyber.Scalar, 2)
+	for i := range clientPks {
+		clientPks[i], clientPrivs[i] = crypto.NewKeyPair(p256)
+		n.RelayView.AddClient(clientPks[i])
+	}
+	toSend, _, err := n.RelayView.SendToNextTrustee()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := toSend.(*net.REL_TRU_TELL_CLIENTS_PKS_AND_EPH_PKS_AND_BASE)
+	msg.Pks = clientPks
+	clientSessionPrivs := addClientsSessionKeys(t, p256, msg, clientPrivs, trustee.trusteeState.SessionNonce)
+	if err := trustee.ReceivedMessage(*msg); err != nil {
+		t.Fatal("Trustee should be able to receive this message:", err)
+	}
+	r := dcnet.NewDCNetEntity(0, dcnet.DCNET_RELAY, trustee.trusteeState.PayloadSize, false, nil, p256)
+	r.SetSessionContext(dcnet.SessionContext{Nonce: trustee.trusteeState.SessionNonce, EpochLength: int32(trustee.trusteeState.DCNetEpochLength)})
+	_, seed, err := trustee.trusteeState.DCNet.EpochSeed(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(r.EpochRoundPad(seed, 0), r.RoundPad(p256.Point().Mul(clientSessionPrivs[1], tellPk.SessionPk), 1, trustee.trusteeState.ID, 0)) {
+		t.Error("Shared secret has not been computed correctly")
+	}
+	shuffle := (<-msgSender.sentToRelay).(*net.TRU_REL_TELL_NEW_BASE_AND_EPH_PKS)
+	if _, err := n.RelayView.ReceivedShuffleFromTrustee(shuffle.NewBase, shuffle.NewEphPks, shuffle.Proof); err != nil {
+		t.Fatal(err)
+	}
+	transcript, err := n.RelayView.SendTranscript()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := trustee.ReceivedMessage(*transcript.(*net.REL_TRU_TELL_TRANSCRIPT)); err != nil {
+		t.Fatal("Trustee should be able to receive this message:", err)
+	}
+	sig := (<-msgSender.sentToRelay).(*net.TRU_REL_SHUFFLE_SIG)
+	if _, err := n.RelayView.ReceivedSignatureFromTrustee(sig.TrusteeID, sig.Sig); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.RelayView.VerifySigsAndSendToClients([]kyber.Point{pk}); err != nil {
+		t.Error("The P256 signature of the trustee should verify,", err)
+	}
+
+	trustee.ReceivedMessage(net.ALL_ALL_SHUTDOWN{})
+	other.ReceivedMessage(net.ALL_ALL_SHUTDOWN{})
+}
+
+func TestTrusteeSkippedRounds(t *testing.T) {
+
+	msgSender := new(TestMessageSender)
+	msgSender.sentToRelay = make(chan interface{}, 15)
+	trustee := NewTrustee(false, false, 1000, newTestMessageSenderWrapper(msgSender))
+
+	if err := trustee.Received_REL_TRU_TELL_SKIPPED_ROUNDS(net.REL_TRU_TELL_SKIPPED_ROUNDS{FirstRound: 5, LastRound: 4}); err == nil {
+		t.Error("Trustee should refuse an empty range of skipped rounds")
+	}
+	if err := trustee.Received_REL_TRU_TELL_SKIPPED_ROUNDS(net.REL_TRU_TELL_SKIPPED_ROUNDS{FirstRound: 3, LastRound: 4}); err != nil {
+		t.Error(err)
+	}
+	if len(trustee.trusteeState.skippedRounds) != 1 {
+		t.Error("The skipped rounds should be passed to the sending goroutine")
+	}
+
+	// no cipher is sent for the skipped rounds, and the ranges we passed are forgotten
+	skipped := []net.REL_TRU_TELL_SKIPPED_ROUNDS{{FirstRound: 5, LastRound: 6}, {FirstRound: 3, LastRound: 4}, {FirstRound: 9, LastRound: 9}}
+	roundID, skipped := skipRounds(2, skipped)
+	if roundID != 2 || len(skipped) != 3 {
+		t.Error("Round 2 is not skipped, got", roundID)
+	}
+	roundID, skipped = skipRounds(3, skipped)
+	if roundID != 7 || len(skipped) != 1 {
+		t.Error("Rounds 3 to 6 are skipped, the next cipher is for round 7, got", roundID, "with", len(skipped), "ranges left")
+	}
+	if roundID, _ = skipRounds(9, skipped); roundID != 10 {
+		t.Error("Round 9 is skipped, got", roundID)
+	}
+}
@@ -72,6 +72,11 @@ func (p *PriFiSDAProtocol) Received_REL_TRU_TELL_RATE_CHANGE(msg Struct_REL_TRU_
 	return p.prifiLibInstance.ReceivedMessage(msg.REL_TRU_TELL_RATE_CHANGE)
 }
 
+// Received_REL_TRU_TELL_SKIPPED_ROUNDS forward an REL_TRU_TELL_SKIPPED_ROUNDS message to PriFi's lib
+func (p *PriFiSDAProtocol) Received_REL_TRU_TELL_SKIPPED_ROUNDS(msg Struct_REL_TRU_TELL_SKIPPED_ROUNDS) error {
+	return p.prifiLibInstance.ReceivedMessage(msg.REL_TRU_TELL_SKIPPED_ROUNDS)
+}
+
 // Received_REL_CLI_DISRUPTED_ROUND forward an REL_CLI_DISRUPTED_ROUND message to PriFi's lib
 func (p *PriFiSDAProtocol) Received_REL_CLI_DISRUPTED_ROUND(msg Struct_REL_CLI_DISRUPTED_ROUND) error {
 	return p.prifiLibInstance.ReceivedMessage(msg.REL_CLI_DISRUPTED_ROUND)
@@ -102,12 +107,82 @@ func (p *PriFiSDAProtocol) Received_REL_ALL_DISRUPTION_SECRET(msg Struct_REL_ALL
 	return p.prifiLibInstance.ReceivedMessage(msg.REL_ALL_REVEAL_SHARED_SECRETS)
 }
 
-// Received_CLI_REL_DISRUPTION_SECRET forward an CLI_REL_SHARED_SECRET message to PriFi's lib
-func (p *PriFiSDAProtocol) Received_CLI_REL_DISRUPTION_SECRET(msg Struct_CLI_REL_DISRUPTION_SECRET) error {
-	return p.prifiLibInstance.ReceivedMessage(msg.CLI_REL_SHARED_SECRET)
+// Received_CLI_REL_EPOCH_SEED forward an CLI_REL_EPOCH_SEED message to PriFi's lib
+func (p *PriFiSDAProtocol) Received_CLI_REL_EPOCH_SEED(msg Struct_CLI_REL_EPOCH_SEED) error {
+	return p.prifiLibInstance.ReceivedMessage(msg.CLI_REL_EPOCH_SEED)
+}
+
+// Received_TRU_REL_EPOCH_SEED forward an TRU_REL_EPOCH_SEED message to PriFi's lib
+func (p *PriFiSDAProtocol) Received_TRU_REL_EPOCH_SEED(msg Struct_TRU_REL_EPOCH_SEED) error {
+	return p.prifiLibInstance.ReceivedMessage(msg.TRU_REL_EPOCH_SEED)
+}
+
+// Received_CLI_REL_SEED_COMMITMENTS forward an CLI_REL_SEED_COMMITMENTS message to PriFi's lib
+func (p *PriFiSDAProtocol) Received_CLI_REL_SEED_COMMITMENTS(msg Struct_CLI_REL_SEED_COMMITMENTS) error {
+	return p.prifiLibInstance.ReceivedMessage(msg.CLI_REL_SEED_COMMITMENTS)
+}
+
+// Received_TRU_REL_SEED_COMMITMENTS forward an TRU_REL_SEED_COMMITMENTS message to PriFi's lib
+func (p *PriFiSDAProtocol) Received_TRU_REL_SEED_COMMITMENTS(msg Struct_TRU_REL_SEED_COMMITMENTS) error {
+	return p.prifiLibInstance.ReceivedMessage(msg.TRU_REL_SEED_COMMITMENTS)
+}
+
+// Received_TRU_REL_KEY_SHARES forward an TRU_REL_KEY_SHARES message to PriFi's lib
+func (p *PriFiSDAProtocol) Received_TRU_REL_KEY_SHARES(msg Struct_TRU_REL_KEY_SHARES) error {
+	return p.prifiLibInstance.ReceivedMessage(msg.TRU_REL_KEY_SHARES)
+}
+
+// Received_REL_TRU_RECOVER_TRUSTEE forward an REL_TRU_RECOVER_TRUSTEE message to PriFi's lib
+func (p *PriFiSDAProtocol) Received_REL_TRU_RECOVER_TRUSTEE(msg Struct_REL_TRU_RECOVER_TRUSTEE) error {
+	return p.prifiLibInstance.ReceivedMessage(msg.REL_TRU_RECOVER_TRUSTEE)
+}
+
+// Received_TRU_TRU_PING forward an TRU_TRU_PING message to PriFi's lib
+func (p *PriFiSDAProtocol) Received_TRU_TRU_PING(msg Struct_TRU_TRU_PING) error {
+	return p.prifiLibInstance.ReceivedMessage(msg.TRU_TRU_PING)
+}
+
+// Received_TRU_TRU_PONG forward an TRU_TRU_PONG message to PriFi's lib
+func (p *PriFiSDAProtocol) Received_TRU_TRU_PONG(msg Struct_TRU_TRU_PONG) error {
+	return p.prifiLibInstance.ReceivedMessage(msg.TRU_TRU_PONG)
+}
+
+// Received_TRU_TRU_RECOVERY_PARTIALS forward an TRU_TRU_RECOVERY_PARTIALS message to PriFi's lib
+func (p *PriFiSDAProtocol) Received_TRU_TRU_RECOVERY_PARTIALS(msg Struct_TRU_TRU_RECOVERY_PARTIALS) error {
+	return p.prifiLibInstance.ReceivedMessage(msg.TRU_TRU_RECOVERY_PARTIALS)
+}
+
+// Received_TRU_REL_TRUSTEE_REPLACED forward an TRU_REL_TRUSTEE_REPLACED message to PriFi's lib
+func (p *PriFiSDAProtocol) Received_TRU_REL_TRUSTEE_REPLACED(msg Struct_TRU_REL_TRUSTEE_REPLACED) error {
+	return p.prifiLibInstance.ReceivedMessage(msg.TRU_REL_TRUSTEE_REPLACED)
+}
+
+// Received_REL_CLI_RESHUFFLE_REQUEST forward an REL_CLI_RESHUFFLE_REQUEST message to PriFi's lib
+func (p *PriFiSDAProtocol) Received_REL_CLI_RESHUFFLE_REQUEST(msg Struct_REL_CLI_RESHUFFLE_REQUEST) error {
+	return p.prifiLibInstance.ReceivedMessage(msg.REL_CLI_RESHUFFLE_REQUEST)
+}
+
+// Received_CLI_REL_RESHUFFLE_EPH_PK forward an CLI_REL_RESHUFFLE_EPH_PK message to PriFi's lib
+func (p *PriFiSDAProtocol) Received_CLI_REL_RESHUFFLE_EPH_PK(msg Struct_CLI_REL_RESHUFFLE_EPH_PK) error {
+	return p.prifiLibInstance.ReceivedMessage(msg.CLI_REL_RESHUFFLE_EPH_PK)
+}
+
+// Received_REL_CLI_CORRUPTED_RESERVATIONS forward an REL_CLI_CORRUPTED_RESERVATIONS message to PriFi's lib
+func (p *PriFiSDAProtocol) Received_REL_CLI_CORRUPTED_RESERVATIONS(msg Struct_REL_CLI_CORRUPTED_RESERVATIONS) error {
+	return p.prifiLibInstance.ReceivedMessage(msg.REL_CLI_CORRUPTED_RESERVATIONS)
+}
+
+// Received_REL_ALL_RESERVATION_REVEAL forward an REL_ALL_RESERVATION_REVEAL message to PriFi's lib
+func (p *PriFiSDAProtocol) Received_REL_ALL_RESERVATION_REVEAL(msg Struct_REL_ALL_RESERVATION_REVEAL) error {
+	return p.prifiLibInstance.ReceivedMessage(msg.REL_ALL_RESERVATION_REVEAL)
+}
+
+// Received_CLI_REL_RESERVATION_REVEAL forward an CLI_REL_RESERVATION_REVEAL message to PriFi's lib
+func (p *PriFiSDAProtocol) Received_CLI_REL_RESERVATION_REVEAL(msg Struct_CLI_REL_RESERVATION_REVEAL) error {
+	return p.prifiLibInstance.ReceivedMessage(msg.CLI_REL_RESERVATION_REVEAL)
 }
 
-// Received_TRU_REL_DISRUPTION_SECRET forward an TRU_REL_SHARED_SECRET message to PriFi's lib
-func (p *PriFiSDAProtocol) Received_TRU_REL_DISRUPTION_SECRET(msg Struct_TRU_REL_DISRUPTION_SECRET) error {
-	return p.prifiLibInstance.ReceivedMessage(msg.TRU_REL_SHARED_SECRET)
+// Received_TRU_REL_RESERVATION_REVEAL forward an TRU_REL_RESERVATION_REVEAL message to PriFi's lib
+func (p *PriFiSDAProtocol) Received_TRU_REL_RESERVATION_REVEAL(msg Struct_TRU_REL_RESERVATION_REVEAL) error {
+	return p.prifiLibInstance.ReceivedMessage(msg.TRU_REL_RESERVATION_REVEAL)
 }
@@ -83,6 +83,12 @@ type Struct_TRU_REL_TELL_PK struct {
 	net.TRU_REL_TELL_PK
 }
 
+//Struct_REL_TRU_TELL_SKIPPED_ROUNDS is a wrapper for REL_TRU_TELL_SKIPPED_ROUNDS (but also contains a *onet.TreeNode)
+type Struct_REL_TRU_TELL_SKIPPED_ROUNDS struct {
+	*onet.TreeNode
+	net.REL_TRU_TELL_SKIPPED_ROUNDS
+}
+
 //Struct_REL_TRU_TELL_RATE_CHANGE is a wrapper for REL_TRU_TELL_RATE_CHANGE (but also contains a *onet.TreeNode)
 type Struct_REL_TRU_TELL_RATE_CHANGE struct {
 	*onet.TreeNode
@@ -125,14 +131,98 @@ type Struct_REL_ALL_DISRUPTION_SECRET struct {
 	net.REL_ALL_REVEAL_SHARED_SECRETS
 }
 
-//Struct_CLI_REL_DISRUPTION_SECRET is a wrapper for CLI_REL_SHARED_SECRET (but also contains a *onet.TreeNode)
-type Struct_CLI_REL_DISRUPTION_SECRET struct {
+//Struct_CLI_REL_EPOCH_SEED is a wrapper for CLI_REL_EPOCH_SEED (but also contains a *onet.TreeNode)
+type Struct_CLI_REL_EPOCH_SEED struct {
+	*onet.TreeNode
+	net.CLI_REL_EPOCH_SEED
+}
+
+//Struct_TRU_REL_EPOCH_SEED is a wrapper for TRU_REL_EPOCH_SEED (but also contains a *onet.TreeNode)
+type Struct_TRU_REL_EPOCH_SEED struct {
+	*onet.TreeNode
+	net.TRU_REL_EPOCH_SEED
+}
+
+//Struct_CLI_REL_SEED_COMMITMENTS is a wrapper for CLI_REL_SEED_COMMITMENTS (but also contains a *onet.TreeNode)
+type Struct_CLI_REL_SEED_COMMITMENTS struct {
+	*onet.TreeNode
+	net.CLI_REL_SEED_COMMITMENTS
+}
+
+//Struct_TRU_REL_SEED_COMMITMENTS is a wrapper for TRU_REL_SEED_COMMITMENTS (but also contains a *onet.TreeNode)
+type Struct_TRU_REL_SEED_COMMITMENTS struct {
+	*onet.TreeNode
+	net.TRU_REL_SEED_COMMITMENTS
+}
+
+//Struct_TRU_REL_KEY_SHARES is a wrapper for TRU_REL_KEY_SHARES (but also contains a *onet.TreeNode)
+type Struct_TRU_REL_KEY_SHARES struct {
+	*onet.TreeNode
+	net.TRU_REL_KEY_SHARES
+}
+
+//Struct_REL_TRU_RECOVER_TRUSTEE is a wrapper for REL_TRU_RECOVER_TRUSTEE (but also contains a *onet.TreeNode)
+type Struct_REL_TRU_RECOVER_TRUSTEE struct {
+	*onet.TreeNode
+	net.REL_TRU_RECOVER_TRUSTEE
+}
+
+//Struct_TRU_TRU_PING is a wrapper for TRU_TRU_PING (but also contains a *onet.TreeNode)
+type Struct_TRU_TRU_PING struct {
+	*onet.TreeNode
+	net.TRU_TRU_PING
+}
+
+//Struct_TRU_TRU_PONG is a wrapper for TRU_TRU_PONG (but also contains a *onet.TreeNode)
+type Struct_TRU_TRU_PONG struct {
+	*onet.TreeNode
+	net.TRU_TRU_PONG
+}
+
+//Struct_TRU_TRU_RECOVERY_PARTIALS is a wrapper for TRU_TRU_RECOVERY_PARTIALS (but also contains a *onet.TreeNode)
+type Struct_TRU_TRU_RECOVERY_PARTIALS struct {
+	*onet.TreeNode
+	net.TRU_TRU_RECOVERY_PARTIALS
+}
+
+//Struct_TRU_REL_TRUSTEE_REPLACED is a wrapper for TRU_REL_TRUSTEE_REPLACED (but also contains a *onet.TreeNode)
+type Struct_TRU_REL_TRUSTEE_REPLACED struct {
+	*onet.TreeNode
+	net.TRU_REL_TRUSTEE_REPLACED
+}
+
+//Struct_REL_CLI_RESHUFFLE_REQUEST is a wrapper for REL_CLI_RESHUFFLE_REQUEST (but also contains a *onet.TreeNode)
+type Struct_REL_CLI_RESHUFFLE_REQUEST struct {
+	*onet.TreeNode
+	net.REL_CLI_RESHUFFLE_REQUEST
+}
+
+//Struct_CLI_REL_RESHUFFLE_EPH_PK is a wrapper for CLI_REL_RESHUFFLE_EPH_PK (but also contains a *onet.TreeNode)
+type Struct_CLI_REL_RESHUFFLE_EPH_PK struct {
+	*onet.TreeNode
+	net.CLI_REL_RESHUFFLE_EPH_PK
+}
+
+//Struct_REL_CLI_CORRUPTED_RESERVATIONS is a wrapper for REL_CLI_CORRUPTED_RESERVATIONS (but also contains a *onet.TreeNode)
+type Struct_REL_CLI_CORRUPTED_RESERVATIONS struct {
+	*onet.TreeNode
+	net.REL_CLI_CORRUPTED_RESERVATIONS
+}
+
+//Struct_REL_ALL_RESERVATION_REVEAL is a wrapper for REL_ALL_RESERVATION_REVEAL (but also contains a *onet.TreeNode)
+type Struct_REL_ALL_RESERVATION_REVEAL struct {
+	*onet.TreeNode
+	net.REL_ALL_RESERVATION_REVEAL
+}
+
+//Struct_CLI_REL_RESERVATION_REVEAL is a wrapper for CLI_REL_RESERVATION_REVEAL (but also contains a *onet.TreeNode)
+type Struct_CLI_REL_RESERVATION_REVEAL struct {
 	*onet.TreeNode
-	net.CLI_REL_SHARED_SECRET
+	net.CLI_REL_RESERVATION_REVEAL
 }
 
-//Struct_TRU_REL_DISRUPTION_SECRET is a wrapper for TRU_REL_SHARED_SECRET (but also contains a *onet.TreeNode)
-type Struct_TRU_REL_DISRUPTION_SECRET struct {
+//Struct_TRU_REL_RESERVATION_REVEAL is a wrapper for TRU_REL_RESERVATION_REVEAL (but also contains a *onet.TreeNode)
+type Struct_TRU_REL_RESERVATION_REVEAL struct {
 	*onet.TreeNode
-	net.TRU_REL_SHARED_SECRET
+	net.TRU_REL_RESERVATION_REVEAL
 }
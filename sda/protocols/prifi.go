@@ -43,6 +43,10 @@ type PrifiTomlConfig struct {
 	CellSizeDown                            int
 	RelayWindowSize                         int
 	RelayUseOpenClosedSlots                 bool
+	RelayUseVariableCellSize                bool
+	RelaySubCellsPerRound                   int
+	RelayReshufflePeriodRounds              int
+	RelayReshufflePeriodSeconds             int
 	RelayUseDummyDataDown                   bool
 	RelayReportingLimit                     int
 	UseUDP                                  bool
@@ -60,13 +64,26 @@ type PrifiTomlConfig struct {
 	DisruptionProtectionEnabled             bool
 	EquivocationProtectionEnabled           bool // not linked in the back
 	OpenClosedSlotsMinDelayBetweenRequests  int
+	OpenClosedSlotsMaxDelayBetweenRequests  int
+	OpenClosedSlotsMaxCellsPerSlot          int
 	RelayMaxNumberOfConsecutiveFailedRounds int
 	RelayProcessingLoopSleepTime            int
+	RelayRoundPacingPeriod                  int
 	RelayRoundTimeOut                       int
 	RelayTrusteeCacheLowBound               int
 	RelayTrusteeCacheHighBound              int
 	VerboseIngressEgressServers             bool
 	ForceDisruptionSinceRound3              bool
+	DCNetParallelism                        int
+	DCNetPRG                                string
+	DCNetPrecomputedRounds                  int
+	DCNetEpochLength                        int
+	TrusteeThreshold                        int
+	CryptoSuite                             string
+	SlotScheduler                           string
+	CoverReservationPolicy                  string
+	CoverReservationProbability             int
+	CoverReservationTail                    int
 }
 
 //PriFiSDAWrapperConfig is all the information the SDA-Protocols needs. It contains the network map of identities, our role, and the socks parameters if we are the corresponding role
@@ -112,12 +129,14 @@ func (p *PriFiSDAProtocol) SetConfigFromPriFiService(config *PriFiSDAWrapperConf
 	switch config.Role {
 	case Relay:
 		relayOutputEnabled := config.Toml.RelayDataOutputEnabled
-		p.prifiLibInstance = prifi_lib.NewPriFiRelay(relayOutputEnabled,
+		relay := prifi_lib.NewPriFiRelay(relayOutputEnabled,
 			config.RelaySideSocksConfig.DownstreamChannel,
 			config.RelaySideSocksConfig.UpstreamChannel,
 			experimentResultChan,
 			p.handleTimeout,
 			ms)
+		relay.SetDisruptorHandler(p.handleDisruptors)
+		p.prifiLibInstance = relay
 	case Trustee:
 		p.prifiLibInstance = prifi_lib.NewPriFiTrustee(config.Toml.TrusteeNeverSlowDown,
 			config.Toml.TrusteeAlwaysSlowDown,
@@ -146,3 +165,9 @@ func (p *PriFiSDAProtocol) SetConfigFromPriFiService(config *PriFiSDAWrapperConf
 func (p *PriFiSDAProtocol) SetTimeoutHandler(handler func([]string, []string)) {
 	p.toHandler = handler
 }
+
+// SetDisruptorHandler sets the function that will be called with the
+// clients found disrupting the protocol, if the protocol runs as the relay.
+func (p *PriFiSDAProtocol) SetDisruptorHandler(handler func([]*network.ServerIdentity)) {
+	p.dHandler = handler
+}
@@ -43,6 +43,7 @@ type PriFiSDAProtocol struct {
 	role          PriFiRole
 	ms            MessageSender
 	toHandler     func([]string, []string)
+	dHandler      func([]*network.ServerIdentity)
 	ResultChannel chan interface{}
 
 	//this is the actual "PriFi" (DC-net) protocol/library, defined in prifi-lib/prifi.go
@@ -70,19 +71,36 @@ func (p *PriFiSDAProtocol) Start() error {
 	msg.Add("DownstreamCellSize", p.config.Toml.CellSizeDown)
 	msg.Add("WindowSize", p.config.Toml.RelayWindowSize)
 	msg.Add("UseOpenClosedSlots", p.config.Toml.RelayUseOpenClosedSlots)
+	msg.Add("UseVariableCellSize", p.config.Toml.RelayUseVariableCellSize)
+	msg.Add("SubCellsPerRound", p.config.Toml.RelaySubCellsPerRound)
+	msg.Add("ReshufflePeriodRounds", p.config.Toml.RelayReshufflePeriodRounds)
+	msg.Add("ReshufflePeriodSeconds", p.config.Toml.RelayReshufflePeriodSeconds)
 	msg.Add("UseDummyDataDown", p.config.Toml.RelayUseDummyDataDown)
 	msg.Add("ExperimentRoundLimit", p.config.Toml.RelayReportingLimit)
 	msg.Add("UseUDP", p.config.Toml.UseUDP)
 	msg.Add("DCNetType", p.config.Toml.DCNetType)
 	msg.Add("DisruptionProtectionEnabled", p.config.Toml.DisruptionProtectionEnabled)
 	msg.Add("OpenClosedSlotsMinDelayBetweenRequests", p.config.Toml.OpenClosedSlotsMinDelayBetweenRequests)
+	msg.Add("OpenClosedSlotsMaxDelayBetweenRequests", p.config.Toml.OpenClosedSlotsMaxDelayBetweenRequests)
+	msg.Add("OpenClosedSlotsMaxCellsPerSlot", p.config.Toml.OpenClosedSlotsMaxCellsPerSlot)
 	msg.Add("RelayMaxNumberOfConsecutiveFailedRounds", p.config.Toml.RelayMaxNumberOfConsecutiveFailedRounds)
 	msg.Add("RelayProcessingLoopSleepTime", p.config.Toml.RelayProcessingLoopSleepTime)
+	msg.Add("RoundPacingPeriod", p.config.Toml.RelayRoundPacingPeriod)
 	msg.Add("RelayRoundTimeOut", p.config.Toml.RelayRoundTimeOut)
 	msg.Add("RelayTrusteeCacheLowBound", p.config.Toml.RelayTrusteeCacheLowBound)
 	msg.Add("RelayTrusteeCacheHighBound", p.config.Toml.RelayTrusteeCacheHighBound)
 	msg.Add("EquivocationProtectionEnabled", p.config.Toml.EquivocationProtectionEnabled)
 	msg.Add("ForceDisruptionSinceRound3", p.config.Toml.ForceDisruptionSinceRound3)
+	msg.Add("DCNetParallelism", p.config.Toml.DCNetParallelism)
+	msg.Add("DCNetPRG", p.config.Toml.DCNetPRG)
+	msg.Add("DCNetPrecomputedRounds", p.config.Toml.DCNetPrecomputedRounds)
+	msg.Add("DCNetEpochLength", p.config.Toml.DCNetEpochLength)
+	msg.Add("TrusteeThreshold", p.config.Toml.TrusteeThreshold)
+	msg.Add("CryptoSuite", p.cryptoSuite())
+	msg.Add("SlotScheduler", p.config.Toml.SlotScheduler)
+	msg.Add("CoverReservationPolicy", p.config.Toml.CoverReservationPolicy)
+	msg.Add("CoverReservationProbability", p.config.Toml.CoverReservationProbability)
+	msg.Add("CoverReservationTail", p.config.Toml.CoverReservationTail)
 	msg.ForceParams = true
 
 	p.SendTo(p.TreeNode(), msg)
@@ -90,6 +108,16 @@ func (p *PriFiSDAProtocol) Start() error {
 	return nil
 }
 
+// cryptoSuite returns the suite of the session. Onet decodes the points of the messages in the suite of the conode,
+// hence the session cannot use another one
+func (p *PriFiSDAProtocol) cryptoSuite() string {
+	conodeSuite := p.Suite().String()
+	if s := p.config.Toml.CryptoSuite; s != "" && s != conodeSuite {
+		log.Error("CryptoSuite is", s, "but the conodes use", conodeSuite+"; using", conodeSuite)
+	}
+	return conodeSuite
+}
+
 // Stop aborts the current execution of the protocol.
 func (p *PriFiSDAProtocol) Stop() {
 
@@ -136,8 +164,23 @@ func init() {
 	network.RegisterMessage(net.CLI_REL_DISRUPTION_REVEAL{})
 	network.RegisterMessage(net.TRU_REL_DISRUPTION_REVEAL{})
 	network.RegisterMessage(net.REL_ALL_REVEAL_SHARED_SECRETS{})
-	network.RegisterMessage(net.CLI_REL_SHARED_SECRET{})
-	network.RegisterMessage(net.TRU_REL_SHARED_SECRET{})
+	network.RegisterMessage(net.CLI_REL_EPOCH_SEED{})
+	network.RegisterMessage(net.TRU_REL_EPOCH_SEED{})
+	network.RegisterMessage(net.CLI_REL_SEED_COMMITMENTS{})
+	network.RegisterMessage(net.TRU_REL_SEED_COMMITMENTS{})
+	network.RegisterMessage(net.TRU_REL_KEY_SHARES{})
+	network.RegisterMessage(net.REL_TRU_RECOVER_TRUSTEE{})
+	network.RegisterMessage(net.TRU_TRU_PING{})
+	network.RegisterMessage(net.TRU_TRU_PONG{})
+	network.RegisterMessage(net.TRU_TRU_RECOVERY_PARTIALS{})
+	network.RegisterMessage(net.TRU_REL_TRUSTEE_REPLACED{})
+	network.RegisterMessage(net.REL_CLI_RESHUFFLE_REQUEST{})
+	network.RegisterMessage(net.CLI_REL_RESHUFFLE_EPH_PK{})
+	network.RegisterMessage(net.REL_TRU_TELL_SKIPPED_ROUNDS{})
+	network.RegisterMessage(net.REL_CLI_CORRUPTED_RESERVATIONS{})
+	network.RegisterMessage(net.REL_ALL_RESERVATION_REVEAL{})
+	network.RegisterMessage(net.CLI_REL_RESERVATION_REVEAL{})
+	network.RegisterMessage(net.TRU_REL_RESERVATION_REVEAL{})
 
 	onet.GlobalProtocolRegister(ProtocolName, NewPriFiSDAWrapperProtocol)
 }
@@ -159,6 +202,21 @@ func (p *PriFiSDAProtocol) handleTimeout(clientsIds []int, trusteesIds []int) {
 	p.toHandler(clients, trustees)
 }
 
+// handleDisruptors translates ids into ServerIdentities
+// and calls the disruptor handler.
+func (p *PriFiSDAProtocol) handleDisruptors(clientsIds []int) {
+	clients := make([]*network.ServerIdentity, len(clientsIds))
+	for i, v := range clientsIds {
+		clients[i] = p.ms.clients[v].ServerIdentity
+	}
+
+	if p.dHandler == nil {
+		log.Error("Clients", clients, "disrupted the protocol, but no handler can exclude them")
+		return
+	}
+	p.dHandler(clients)
+}
+
 // NewPriFiSDAWrapperProtocol creates a bare PrifiSDAWrapper struct.
 // SetConfig **MUST** be called on it before it can participate
 // to the protocol.
@@ -237,6 +295,10 @@ func (p *PriFiSDAProtocol) registerHandlers() error {
 	if err != nil {
 		return errors.New("couldn't register handler: " + err.Error())
 	}
+	err = p.RegisterHandler(p.Received_REL_TRU_TELL_SKIPPED_ROUNDS)
+	if err != nil {
+		return errors.New("couldn't register handler: " + err.Error())
+	}
 
 	//register blame procedure handlers
 	err = p.RegisterHandler(p.Received_REL_CLI_DISRUPTED_ROUND)
@@ -263,11 +325,73 @@ func (p *PriFiSDAProtocol) registerHandlers() error {
 	if err != nil {
 		return errors.New("couldn't register handler: " + err.Error())
 	}
-	err = p.RegisterHandler(p.Received_CLI_REL_DISRUPTION_SECRET)
+	err = p.RegisterHandler(p.Received_CLI_REL_EPOCH_SEED)
+	if err != nil {
+		return errors.New("couldn't register handler: " + err.Error())
+	}
+	err = p.RegisterHandler(p.Received_TRU_REL_EPOCH_SEED)
+	if err != nil {
+		return errors.New("couldn't register handler: " + err.Error())
+	}
+	err = p.RegisterHandler(p.Received_CLI_REL_SEED_COMMITMENTS)
+	if err != nil {
+		return errors.New("couldn't register handler: " + err.Error())
+	}
+	err = p.RegisterHandler(p.Received_TRU_REL_SEED_COMMITMENTS)
+	if err != nil {
+		return errors.New("couldn't register handler: " + err.Error())
+	}
+
+	//register the handlers of the blames about the reservations
+	err = p.RegisterHandler(p.Received_REL_CLI_CORRUPTED_RESERVATIONS)
+	if err != nil {
+		return errors.New("couldn't register handler: " + err.Error())
+	}
+	err = p.RegisterHandler(p.Received_REL_ALL_RESERVATION_REVEAL)
+	if err != nil {
+		return errors.New("couldn't register handler: " + err.Error())
+	}
+	err = p.RegisterHandler(p.Received_CLI_REL_RESERVATION_REVEAL)
+	if err != nil {
+		return errors.New("couldn't register handler: " + err.Error())
+	}
+	err = p.RegisterHandler(p.Received_TRU_REL_RESERVATION_REVEAL)
+	if err != nil {
+		return errors.New("couldn't register handler: " + err.Error())
+	}
+
+	//register threshold trustees handlers
+	err = p.RegisterHandler(p.Received_TRU_REL_KEY_SHARES)
+	if err != nil {
+		return errors.New("couldn't register handler: " + err.Error())
+	}
+	err = p.RegisterHandler(p.Received_REL_TRU_RECOVER_TRUSTEE)
+	if err != nil {
+		return errors.New("couldn't register handler: " + err.Error())
+	}
+	err = p.RegisterHandler(p.Received_TRU_TRU_PING)
+	if err != nil {
+		return errors.New("couldn't register handler: " + err.Error())
+	}
+	err = p.RegisterHandler(p.Received_TRU_TRU_PONG)
+	if err != nil {
+		return errors.New("couldn't register handler: " + err.Error())
+	}
+	err = p.RegisterHandler(p.Received_TRU_TRU_RECOVERY_PARTIALS)
+	if err != nil {
+		return errors.New("couldn't register handler: " + err.Error())
+	}
+	err = p.RegisterHandler(p.Received_TRU_REL_TRUSTEE_REPLACED)
+	if err != nil {
+		return errors.New("couldn't register handler: " + err.Error())
+	}
+
+	//register reshuffle handlers
+	err = p.RegisterHandler(p.Received_REL_CLI_RESHUFFLE_REQUEST)
 	if err != nil {
 		return errors.New("couldn't register handler: " + err.Error())
 	}
-	err = p.RegisterHandler(p.Received_TRU_REL_DISRUPTION_SECRET)
+	err = p.RegisterHandler(p.Received_CLI_REL_RESHUFFLE_EPH_PK)
 	if err != nil {
 		return errors.New("couldn't register handler: " + err.Error())
 	}
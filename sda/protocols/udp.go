@@ -206,7 +206,7 @@ func (c *RealUDPChannel) ListenAndBlock(emptyMessage MarshallableMessage, lastSe
 	sizeAdvertised := int(binary.BigEndian.Uint32(buf[0:4]))
 
 	if sizeAdvertised+4 != n {
-		log.Error("ListenAndBlock(", identityListening, "): could not receive read the ", string(sizeAdvertised+4), ", only", n, ", error is", err.Error())
+		log.Error("ListenAndBlock(", identityListening, "): could not receive read the ", strconv.Itoa(sizeAdvertised+4), ", only", n, ", error is", err.Error())
 	}
 	message := make([]byte, sizeAdvertised)
 	copy(message[:], buf[4:sizeAdvertised+4])
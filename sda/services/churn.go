@@ -55,6 +55,7 @@ func idFromServerIdentity(si *network.ServerIdentity) string {
 
 type churnHandler struct {
 	waitQueue         *waitQueue
+	excludedClients   map[string]bool // the clients found disrupting the protocol, which cannot join it again
 	nextFreeClientID  int
 	nextFreeTrusteeID int
 	relayIdentity     *network.ServerIdentity //necessary to call createRoster
@@ -79,6 +80,7 @@ func (c *churnHandler) init(relayID *network.ServerIdentity, trusteesIDs []*netw
 		clients:  make(map[string]*waitQueueEntry),
 		trustees: make(map[string]*waitQueueEntry),
 	}
+	c.excludedClients = make(map[string]bool)
 	c.nextFreeClientID = 0
 	c.nextFreeTrusteeID = 0
 	c.relayIdentity = relayID
@@ -220,6 +222,10 @@ func (c *churnHandler) handleConnection(msg *network.Envelope) {
 		log.Lvl4("Ignored new connection request from", node, ID, "already in the list")
 		return
 	}
+	if !isTrustee && c.excludedClients[ID] {
+		log.Lvl2("Ignored new connection request from", node, ID, ", excluded for disrupting the protocol")
+		return
+	}
 
 	log.Lvl2("Received new connection request from", node, ID)
 
@@ -258,6 +264,21 @@ func (c *churnHandler) handleUnknownDisconnection() {
 	c.tryStartProtocol()
 }
 
+/**
+ * Excludes the clients found disrupting the protocol, and restarts it without them
+ */
+func (c *churnHandler) excludeClients(clients []*network.ServerIdentity) {
+
+	c.waitQueue.writeMutex.Lock()
+	for _, si := range clients {
+		log.Error("Excluding client", si, "for disrupting the protocol")
+		c.excludedClients[idFromServerIdentity(si)] = true
+	}
+	c.waitQueue.writeMutex.Unlock()
+
+	c.handleUnknownDisconnection()
+}
+
 /**
  * Handles a "Disconnection" message
  */
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"github.com/dedis/prifi/prifi-lib/config"
 	"github.com/dedis/prifi/prifi-lib/crypto"
 	"github.com/dedis/prifi/sda/protocols"
 	"go.dedis.ch/onet/v3"
@@ -11,7 +12,7 @@ import (
 )
 
 func genSI(addrPort string) *network.ServerIdentity {
-	pub, _ := crypto.NewKeyPair()
+	pub, _ := crypto.NewKeyPair(config.CryptoSuite)
 	addr := network.NewAddress(network.Local, addrPort)
 	return network.NewServerIdentity(pub, addr)
 }
@@ -633,3 +634,48 @@ func TestChurn(t *testing.T) {
 		t.Error("Protocol should have restarted")
 	}
 }
+
+func TestChurnExcludesDisruptors(t *testing.T) {
+
+	relayID := genSI("127.0.0.0:1")
+	trustees := []*network.ServerIdentity{genSI("0.127.0.0:0")}
+	clients := []*network.ServerIdentity{genSI("0.0.127.0:0"), genSI("0.0.127.0:1")}
+
+	c := new(churnHandler)
+	c.init(relayID, trustees)
+	c.stopProtocol = stopProtocol
+	c.startProtocol = startProtocol
+	c.isProtocolRunning = func() bool { return true }
+
+	c.handleConnection(genPacketFromSource(trustees[0]))
+	c.handleConnection(genPacketFromSource(clients[0]))
+	c.handleConnection(genPacketFromSource(clients[1]))
+
+	//client 1 disrupted the protocol, it is stopped
+	stopProtocolCalled = false
+	startProtocolCalled = false
+	c.excludeClients([]*network.ServerIdentity{clients[1]})
+	if !stopProtocolCalled {
+		t.Error("Protocol should have been stopped, a client disrupted it")
+	}
+	nClients, nTrustees := c.waitQueue.count()
+	if nClients != 0 || nTrustees != 0 {
+		t.Error("The wait queue should be empty, is", nClients, nTrustees)
+	}
+
+	//everyone reconnects, but client 1 cannot join again
+	c.isProtocolRunning = func() bool { return false }
+	c.handleConnection(genPacketFromSource(trustees[0]))
+	c.handleConnection(genPacketFromSource(clients[0]))
+	c.handleConnection(genPacketFromSource(clients[1]))
+	nClients, nTrustees = c.waitQueue.count()
+	if nClients != 1 || nTrustees != 1 {
+		t.Error("Only client 0 and the trustee should be waiting, got", nClients, nTrustees)
+	}
+	if testIfInRoster(c.createRoster(), clients[1]) {
+		t.Error("Client 1 was excluded, it should not be in roster")
+	}
+	if !startProtocolCalled {
+		t.Error("Protocol should have restarted without client 1")
+	}
+}
@@ -107,6 +107,14 @@ func (s *ServiceState) handleTimeout(lateClients []string, lateTrustees []string
 	s.NetworkErrorHappened(nil)
 }
 
+// handleDisruptors excludes the clients found disrupting the protocol, and restarts it without them
+func (s *ServiceState) handleDisruptors(clients []*network.ServerIdentity) {
+	if s.churnHandler == nil {
+		log.Fatal("Can't exclude disruptors without a churnHandler")
+	}
+	s.churnHandler.excludeClients(clients)
+}
+
 // This is a handler passed to the SDA when starting a host. The SDA usually handle all the network by itself,
 // but in our case it is useful to know when a network RESET occurred, so we can kill protocols (otherwise they
 // remain in some weird state)
@@ -12,6 +12,7 @@ import (
 	"io/ioutil"
 	"strconv"
 
+	"github.com/dedis/prifi/prifi-lib/scheduler"
 	prifi_protocol "github.com/dedis/prifi/sda/protocols"
 	"github.com/dedis/prifi/stream-multiplexer"
 	"go.dedis.ch/onet/v3"
@@ -180,9 +181,22 @@ func (s *ServiceState) StartClient(group *app.Group, delay time.Duration) error
 	relayID, trusteeIDs := mapIdentities(group)
 	s.relayIdentity = relayID
 
+	//the data fits in a cell after its header (see scheduler.NewDataCell) and the fields of the protections. When the
+	//rounds are split in sub-cells (never with the protections), the data must fit in a sub-cell, the only cells we own
+	upstreamDataSize := s.prifiTomlConfig.PayloadSize - scheduler.CELL_HEADER_SIZE
+	if s.prifiTomlConfig.RelaySubCellsPerRound > 1 {
+		upstreamDataSize = s.prifiTomlConfig.PayloadSize/s.prifiTomlConfig.RelaySubCellsPerRound - scheduler.CELL_HEADER_SIZE
+	}
+	if s.prifiTomlConfig.DisruptionProtectionEnabled {
+		upstreamDataSize--
+	}
+	if s.prifiTomlConfig.EquivocationProtectionEnabled {
+		upstreamDataSize -= 16
+	}
+
 	socksClientConfig = &prifi_protocol.SOCKSConfig{
 		Port:              s.prifiTomlConfig.SocksServerPort,
-		PayloadSize:       s.prifiTomlConfig.PayloadSize,
+		PayloadSize:       upstreamDataSize,
 		UpstreamChannel:   make(chan []byte),
 		DownstreamChannel: make(chan []byte),
 	}